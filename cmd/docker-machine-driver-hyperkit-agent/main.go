@@ -0,0 +1,49 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command docker-machine-driver-hyperkit-agent runs inside machines and
+// reports their resource usage to the driver over vsock, optionally also
+// forwarding the docker socket and sshd. Build it with GOOS=linux; the driver
+// installs it with --hyperkit-guest-agent.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/mtibben/docker-machine-driver-hyperkit/pkg/agent"
+)
+
+func main() {
+	port := flag.Uint("port", agent.DefaultPort, "vsock port to listen on")
+	disk := flag.String("disk", "/mnt/sda1", "mount point of the disk to report the usage of")
+	dockerPort := flag.Uint("docker-port", 0, "vsock port to forward to the docker socket, 0 to not forward it")
+	sshPort := flag.Uint("ssh-port", 0, "vsock port to forward to sshd, 0 to not forward it")
+	sshdAddr := flag.String("sshd-addr", "127.0.0.1:22", "address sshd listens on")
+	flag.Parse()
+
+	if *dockerPort != 0 {
+		go func() {
+			log.Fatal(agent.Forward(uint32(*dockerPort), "unix", agent.DockerSocket))
+		}()
+	}
+	if *sshPort != 0 {
+		go func() {
+			log.Fatal(agent.Forward(uint32(*sshPort), "tcp", *sshdAddr))
+		}()
+	}
+	log.Fatal(agent.Serve(uint32(*port), agent.NewCollector(*disk)))
+}
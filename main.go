@@ -19,8 +19,20 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/docker/machine/libmachine/drivers/plugin"
 	"github.com/mtibben/docker-machine-driver-hyperkit/pkg/hyperkit"
@@ -28,11 +40,707 @@ import (
 
 var version = "dev"
 
+const storagePathUsage = "docker-machine storage paths, separated by the OS path list separator"
+
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "version" {
-		fmt.Println(version)
-		return
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version", "--version":
+			fmt.Println(version)
+			return
+		case "capabilities":
+			exitOnError(json.NewEncoder(os.Stdout).Encode(hyperkit.NewDriver("", "").Capabilities()))
+			return
+		case "prefetch":
+			exitOnError(prefetch(os.Args[2:]))
+			return
+		case "supervise":
+			exitOnError(supervise(os.Args[2:]))
+			return
+		case "file-server":
+			exitOnError(fileServer(os.Args[2:]))
+			return
+		case "ls":
+			exitOnError(list(os.Args[2:]))
+			return
+		case "update":
+			exitOnError(update(os.Args[2:]))
+			return
+		case "serve":
+			exitOnError(serve(os.Args[2:]))
+			return
+		case "create":
+			exitOnError(create(os.Args[2:]))
+			return
+		case "start", "restart", "stop", "kill", "status", "ip", "stats", "guest-stats", "compact", "upgrade", "plan", "autostart", "inspect", "docker-socket":
+			exitOnError(machineCommand(os.Args[1], os.Args[2:]))
+			return
+		case "ssh":
+			exitOnError(sshCommand(os.Args[2:]))
+			return
+		case "cp":
+			exitOnError(copyFiles(os.Args[2:]))
+			return
+		case "clone":
+			exitOnError(clone(os.Args[2:]))
+			return
+		case "rm":
+			exitOnError(remove(os.Args[2:]))
+			return
+		case "import-xhyve":
+			exitOnError(importXhyve(os.Args[2:]))
+			return
+		case "reconfigure":
+			exitOnError(reconfigure(os.Args[2:]))
+			return
+		case "mount", "unmount":
+			exitOnError(mountCommand(os.Args[1], os.Args[2:]))
+			return
+		case hyperkit.HelperCommand:
+			exitOnError(hyperkit.RunHelper(os.Args[2:], os.Stdout))
+			return
+		case "sudoers":
+			exitOnError(sudoers(os.Args[2:]))
+			return
+		case "known-hosts":
+			exitOnError(knownHosts(os.Args[2:]))
+			return
+		}
 	}
 
+	// Point out a broken installation up front, rather than on the first
+	// operation docker-machine runs as root. With the sudo helper the driver
+	// isn't meant to be root.
+	if err := hyperkit.CheckPermissions(); err != nil && os.Getenv("HYPERKIT_SUDO_HELPER") == "" {
+		fmt.Fprintln(os.Stderr, err)
+	}
 	plugin.RegisterDriver(hyperkit.NewDriver("", ""))
 }
+
+func prefetch(args []string) error {
+	fs := flag.NewFlagSet("prefetch", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	isoURL := fs.String("iso-url", "", "URL of the ISO to prefetch. Defaults to the latest boot2docker release")
+	checksum := fs.String("sha256", "", "SHA-256 checksum the ISO must have")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Nothing in the cache needs root, and extracting the ISO as root would
+	// follow whatever symlinks are in the store
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+
+	files, err := hyperkit.Prefetch(*storePath, *isoURL, *checksum)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("kernel: %s\ninitrd: %s\n", files.KernelPath, files.InitrdPath)
+	return nil
+}
+
+// knownHosts rewrites the known_hosts file of each store and prints its path,
+// to point ssh at with -o UserKnownHostsFile
+func knownHosts(args []string) error {
+	fs := flag.NewFlagSet("known-hosts", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Don't write into the store with the setuid root privileges of the
+	// driver
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+	for _, storePath := range filepath.SplitList(*storePaths) {
+		path, err := hyperkit.UpdateKnownHosts(storePath)
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func sudoers(args []string) error {
+	fs := flag.NewFlagSet("sudoers", flag.ExitOnError)
+	username := fs.String("user", os.Getenv("USER"), "user, or %group, allowed to run the helper")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := hyperkit.CheckHelperBinary(exe); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v. Install it with: sudo chown root:wheel %s && sudo chmod 755 %s\n", err, exe, exe)
+	}
+	fmt.Print(hyperkit.SudoersRules(exe, *username))
+	return nil
+}
+
+func supervise(args []string) error {
+	fs := flag.NewFlagSet("supervise", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s supervise [-storage-path paths] <machine>", filepath.Base(os.Args[0]))
+	}
+
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+	if err := d.Supervise(ctx); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// fileServer serves the shares of a machine using the sftp share backend
+func fileServer(args []string) error {
+	fs := flag.NewFlagSet("file-server", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s file-server [-storage-path paths] <machine>", filepath.Base(os.Args[0]))
+	}
+
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	// Serve the shares with the permissions of their owner, not the setuid
+	// root privileges of the driver
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+	if err := d.ServeFiles(ctx); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Listing needs no root
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+
+	refs, err := hyperkit.ListMachines(filepath.SplitList(*storePaths))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTORE")
+	for _, ref := range refs {
+		fmt.Fprintf(w, "%s\t%s\n", ref.QualifiedName(), ref.StorePath)
+	}
+	return w.Flush()
+}
+
+func update(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf("usage: %s update [-storage-path paths] <machine> <setting>=<value>...", filepath.Base(os.Args[0]))
+	}
+
+	settings, err := parseSettings(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	changes, err := d.UpdateConfig(settings)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		note := ""
+		if c.RestartRequired {
+			note = " (restart the machine to apply)"
+		}
+		fmt.Printf("%s: %v -> %v%s\n", c.Name, c.Old, c.New, note)
+	}
+	return nil
+}
+
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	socket := fs.String("socket", "", "unix socket to serve the API on. Defaults to hyperkit-api.sock in the first storage path")
+	metricsAddr := fs.String("metrics-addr", "", "TCP address to also serve Prometheus metrics on, e.g. :9339. The API stays on the unix socket only")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	stores := filepath.SplitList(*storePaths)
+	if *socket == "" {
+		if len(stores) == 0 {
+			return fmt.Errorf("no storage path to put the API socket in, use -socket")
+		}
+		*socket = filepath.Join(stores[0], "hyperkit-api.sock")
+	}
+
+	// The binary runs setuid root, replace and create the socket as the
+	// invoking user so the path can't make root remove someone else's file.
+	// Closing the listener removes the socket again.
+	euid := os.Geteuid()
+	if err := syscall.Seteuid(os.Getuid()); err != nil {
+		return err
+	}
+	os.Remove(*socket)
+	l, err := net.Listen("unix", *socket)
+	if err == nil {
+		err = os.Chmod(*socket, 0600)
+	}
+	if l != nil {
+		defer l.Close()
+	}
+	if err := syscall.Seteuid(euid); err != nil {
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	var metrics net.Listener
+	if *metricsAddr != "" {
+		if metrics, err = net.Listen("tcp", *metricsAddr); err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", hyperkit.MetricsHandler{StorePaths: stores})
+		go func() {
+			if err := http.Serve(metrics, mux); err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+				fmt.Fprintf(os.Stderr, "Serving metrics failed: %v\n", err)
+			}
+		}()
+		fmt.Fprintf(os.Stderr, "Serving metrics on http://%s/metrics\n", metrics.Addr())
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		l.Close()
+		if metrics != nil {
+			metrics.Close()
+		}
+	}()
+	fmt.Fprintf(os.Stderr, "Serving the hyperkit API on %s\n", *socket)
+	if err := (&hyperkit.APIServer{StorePaths: stores}).Serve(l); err != nil && !strings.Contains(err.Error(), "use of closed network connection") {
+		return err
+	}
+	return nil
+}
+
+func remove(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	force := fs.Bool("force", false, "remove the machine even if its state can't be determined or it can't be stopped")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s rm [-storage-path paths] [-force] <machine>", filepath.Base(os.Args[0]))
+	}
+	ref, err := hyperkit.ResolveMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	d, err := hyperkit.LoadDriver(ref.StorePath, ref.Name)
+	if err != nil {
+		return err
+	}
+	if *force {
+		err = d.ForceRemove()
+	} else {
+		err = d.Remove()
+	}
+	if err != nil {
+		return err
+	}
+	// Don't delete what's left with the setuid root privileges of the
+	// driver, the store may have changed under it since it was resolved
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(ref.StorePath, "machines", ref.Name))
+}
+
+func clone(args []string) error {
+	fs := flag.NewFlagSet("clone", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: %s clone [-storage-path paths] <machine> <new machine>", filepath.Base(os.Args[0]))
+	}
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := d.Clone(fs.Arg(1)); err != nil {
+		return err
+	}
+	fmt.Printf("Cloned %s to %s. Run \"docker-machine regenerate-certs %s\" once it is started.\n", fs.Arg(0), fs.Arg(1), fs.Arg(1))
+	return nil
+}
+
+func importXhyve(args []string) error {
+	fs := flag.NewFlagSet("import-xhyve", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s import-xhyve [-storage-path path] <machine>", filepath.Base(os.Args[0]))
+	}
+	_, err := hyperkit.ImportXhyveMachine(*storePath, fs.Arg(0))
+	return err
+}
+
+func reconfigure(args []string) error {
+	fs := flag.NewFlagSet("reconfigure", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	cpus := fs.Int("cpus", 0, "new number of CPUs, 0 keeps the current one")
+	memory := fs.Int("memory", 0, "new memory size in MB, 0 keeps the current one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s reconfigure [-storage-path paths] [-cpus n] [-memory mb] <machine>", filepath.Base(os.Args[0]))
+	}
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	changes, err := d.Reconfigure(*cpus, *memory)
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if err == nil && len(changes) == 0 {
+		fmt.Println("nothing to change")
+	}
+	return err
+}
+
+// parseSettings parses <setting>=<value> arguments. Values are JSON, with
+// plain strings as a convenience.
+func parseSettings(args []string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid setting %q, expected <setting>=<value>", arg)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(kv[1]), &v); err != nil {
+			v = kv[1]
+		}
+		settings[kv[0]] = v
+	}
+	return settings, nil
+}
+
+func create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	storePath := fs.String("storage-path", defaultStorePath(), "docker-machine storage path")
+	dryRun := fs.Bool("dry-run", false, "print what would be created, without creating it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: %s create [-storage-path path] [-dry-run] <machine> [<setting>=<value>...]", filepath.Base(os.Args[0]))
+	}
+	settings, err := parseSettings(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		p, err := hyperkit.PlanMachine(*storePath, fs.Arg(0), settings)
+		if err != nil {
+			return err
+		}
+		fmt.Print(p)
+		return nil
+	}
+	d, err := hyperkit.CreateMachine(*storePath, fs.Arg(0), settings)
+	if err != nil {
+		return err
+	}
+	fmt.Println(d.IPAddress)
+	return nil
+}
+
+// machineCommand runs a single driver operation on an existing machine
+func machineCommand(command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: %s %s [-storage-path paths] <machine>", filepath.Base(os.Args[0]), command)
+	}
+	if command == "inspect" {
+		// Inspecting only reads, which needs no root
+		if err := syscall.Setuid(os.Getuid()); err != nil {
+			return err
+		}
+	}
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "start":
+		if err := d.Start(); err != nil {
+			return err
+		}
+		return d.SaveConfig()
+	case "restart":
+		if err := d.Restart(); err != nil {
+			return err
+		}
+		return d.SaveConfig()
+	case "autostart":
+		// Run by launchd at login or boot
+		started, err := d.RunAutostart()
+		if err != nil || !started {
+			return err
+		}
+		return d.SaveConfig()
+	case "stop":
+		return d.Stop()
+	case "kill":
+		return d.Kill()
+	case "status":
+		st, err := d.GetState()
+		if err != nil {
+			return err
+		}
+		fmt.Println(st)
+		if stale, err := d.CertsStale(); err == nil && stale {
+			fmt.Fprintf(os.Stderr, "The certificates of %s don't match its IP address %s, run \"docker-machine regenerate-certs %s\"\n", d.MachineName, d.IPAddress, d.MachineName)
+		}
+	case "ip":
+		// GetState catches up with an address the machine changed
+		if _, err := d.GetState(); err != nil {
+			return err
+		}
+		ip, err := d.GetIP()
+		if err != nil {
+			return err
+		}
+		fmt.Println(ip)
+	case "stats":
+		stats, err := d.Stats()
+		if err != nil {
+			return err
+		}
+		fmt.Print(stats)
+	case "compact":
+		reclaimed, err := d.Compact()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reclaimed %d bytes\n", reclaimed)
+	case "inspect":
+		in, err := d.Inspect()
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(in, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "docker-socket":
+		u, err := d.DockerSocketURL()
+		if err != nil {
+			return err
+		}
+		fmt.Println(u)
+	case "plan":
+		p, err := d.Plan()
+		if err != nil {
+			return err
+		}
+		fmt.Print(p)
+	case "upgrade":
+		upgraded, err := d.Upgrade()
+		if err != nil {
+			return err
+		}
+		if !upgraded {
+			fmt.Println("already up to date")
+		}
+	case "guest-stats":
+		m, err := d.GuestMetrics()
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(m)
+	}
+	return nil
+}
+
+// mountCommand shares a host path with a running machine, or stops sharing
+// it, and saves the machine's new list of shares
+func mountCommand(command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: %s %s [-storage-path paths] <machine> <share>", filepath.Base(os.Args[0]), command)
+	}
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if command == "mount" {
+		err = d.Mount(fs.Arg(1))
+	} else {
+		err = d.Unmount(fs.Arg(1))
+	}
+	if err != nil {
+		return err
+	}
+	return d.SaveConfig()
+}
+
+// copyFiles copies files between the host and a machine. Host paths
+// containing a colon must start with ./ or /
+func copyFiles(args []string) error {
+	fs := flag.NewFlagSet("cp", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	srcMachine, src := hyperkit.ParseCopyPath(fs.Arg(0))
+	dstMachine, dst := hyperkit.ParseCopyPath(fs.Arg(1))
+	if fs.NArg() != 2 || (srcMachine == "") == (dstMachine == "") {
+		return fmt.Errorf("usage: %s cp [-storage-path paths] <machine>:<path> <path> | <path> <machine>:<path>", filepath.Base(os.Args[0]))
+	}
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), srcMachine+dstMachine)
+	if err != nil {
+		return err
+	}
+	// Don't copy with the setuid root privileges of the driver
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+	if srcMachine != "" {
+		return d.Pull(src, dst)
+	}
+	return d.Push(src, dst)
+}
+
+// sshCommand replaces the process with ssh to the machine, using its stored
+// key and discovered IP address
+func sshCommand(args []string) error {
+	fs := flag.NewFlagSet("ssh", flag.ExitOnError)
+	storePaths := fs.String("storage-path", defaultStorePath(), storagePathUsage)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: %s ssh [-storage-path paths] <machine> [command...]", filepath.Base(os.Args[0]))
+	}
+	d, err := hyperkit.LoadMachine(filepath.SplitList(*storePaths), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ip, err := d.GetIP()
+	if err != nil {
+		return err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return err
+	}
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil {
+		return err
+	}
+
+	sshArgs := []string{
+		"ssh",
+		"-i", d.GetSSHKeyPath(),
+		"-p", strconv.Itoa(port),
+		"-o", "IdentitiesOnly=yes",
+		"-o", "LogLevel=quiet",
+	}
+	sshArgs = append(sshArgs, d.SSHHostKeyOptions()...)
+	sshArgs = append(sshArgs, fmt.Sprintf("%s@%s", d.GetSSHUsername(), ip))
+	sshArgs = append(sshArgs, fs.Args()[1:]...)
+	// Don't run ssh with the setuid root privileges of the driver
+	if err := syscall.Setuid(os.Getuid()); err != nil {
+		return err
+	}
+	return syscall.Exec(sshPath, sshArgs, os.Environ())
+}
+
+// defaultStorePath mirrors docker-machine's default storage path
+func defaultStorePath() string {
+	if p := os.Getenv("MACHINE_STORAGE_PATH"); p != "" {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "machine")
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
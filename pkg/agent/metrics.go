@@ -0,0 +1,212 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package agent is the guest side of the driver's guest agent, which reports
+// the resource usage of a machine to the host over vsock.
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// DefaultPort is the vsock port the agent listens on
+	DefaultPort = 52001
+	// DockerPort is the vsock port the agent forwards to the docker socket
+	DockerPort = 52002
+	// SSHPort is the vsock port the agent forwards to the guest sshd
+	SSHPort = 52003
+	// DockerSocket is the docker socket in the guest
+	DockerSocket = "/var/run/docker.sock"
+)
+
+// Metrics is the guest resource usage the agent reports
+type Metrics struct {
+	Time time.Time `json:"time"`
+	CPUs int       `json:"cpus"`
+	// CPUPercent is how busy all CPUs were together since the previous
+	// report, or since boot for the first one
+	CPUPercent float64 `json:"cpu_percent"`
+	Load1      float64 `json:"load1"`
+	Load5      float64 `json:"load5"`
+	Load15     float64 `json:"load15"`
+
+	MemTotalBytes     int64 `json:"mem_total_bytes"`
+	MemAvailableBytes int64 `json:"mem_available_bytes"`
+
+	// DiskPath is the filesystem the disk fields describe
+	DiskPath       string `json:"disk_path"`
+	DiskTotalBytes int64  `json:"disk_total_bytes"`
+	DiskFreeBytes  int64  `json:"disk_free_bytes"`
+}
+
+// cpuTimes are the aggregate jiffies of the "cpu" line of /proc/stat
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// Collector reads Metrics from procfs
+type Collector struct {
+	// ProcPath is where procfs is mounted
+	ProcPath string
+	DiskPath string
+
+	prev cpuTimes
+}
+
+// NewCollector returns a Collector for the disk mounted at diskPath
+func NewCollector(diskPath string) *Collector {
+	return &Collector{ProcPath: "/proc", DiskPath: diskPath}
+}
+
+// Collect returns the current metrics
+func (c *Collector) Collect() (Metrics, error) {
+	m := Metrics{Time: time.Now(), DiskPath: c.DiskPath}
+
+	stat, err := ioutil.ReadFile(filepath.Join(c.ProcPath, "stat"))
+	if err != nil {
+		return m, err
+	}
+	times, cpus, err := parseProcStat(string(stat))
+	if err != nil {
+		return m, err
+	}
+	m.CPUs = cpus
+	m.CPUPercent = cpuPercent(c.prev, times)
+	c.prev = times
+
+	loadavg, err := ioutil.ReadFile(filepath.Join(c.ProcPath, "loadavg"))
+	if err != nil {
+		return m, err
+	}
+	if m.Load1, m.Load5, m.Load15, err = parseLoadavg(string(loadavg)); err != nil {
+		return m, err
+	}
+
+	meminfo, err := ioutil.ReadFile(filepath.Join(c.ProcPath, "meminfo"))
+	if err != nil {
+		return m, err
+	}
+	if m.MemTotalBytes, m.MemAvailableBytes, err = parseMeminfo(string(meminfo)); err != nil {
+		return m, err
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(c.DiskPath, &st); err != nil {
+		return m, fmt.Errorf("statfs %s: %w", c.DiskPath, err)
+	}
+	m.DiskTotalBytes = int64(st.Blocks) * int64(st.Bsize)
+	m.DiskFreeBytes = int64(st.Bavail) * int64(st.Bsize)
+	return m, nil
+}
+
+// parseProcStat returns the aggregate CPU times and the number of CPUs
+func parseProcStat(stat string) (cpuTimes, int, error) {
+	var times cpuTimes
+	var cpus int
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(stat))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal ...
+		for i, f := range fields[1:] {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return times, 0, fmt.Errorf("parsing /proc/stat: %w", err)
+			}
+			times.total += n
+			if i == 3 || i == 4 {
+				times.idle += n
+			}
+		}
+		found = true
+	}
+	if !found {
+		return times, 0, fmt.Errorf("no cpu line in /proc/stat")
+	}
+	return times, cpus, nil
+}
+
+func cpuPercent(prev, cur cpuTimes) float64 {
+	total := cur.total - prev.total
+	if cur.total <= prev.total {
+		return 0
+	}
+	return float64(total-(cur.idle-prev.idle)) * 100 / float64(total)
+}
+
+func parseLoadavg(loadavg string) (float64, float64, float64, error) {
+	fields := strings.Fields(loadavg)
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("unable to parse /proc/loadavg: %q", loadavg)
+	}
+	var loads [3]float64
+	for i := range loads {
+		l, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("parsing /proc/loadavg: %w", err)
+		}
+		loads[i] = l
+	}
+	return loads[0], loads[1], loads[2], nil
+}
+
+// parseMeminfo returns MemTotal and MemAvailable in bytes
+func parseMeminfo(meminfo string) (int64, int64, error) {
+	values := map[string]int64{}
+	scanner := bufio.NewScanner(strings.NewReader(meminfo))
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		fields := strings.Fields(kv[1])
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		// Values are in kB
+		values[kv[0]] = n * 1024
+	}
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, 0, fmt.Errorf("no MemTotal in /proc/meminfo")
+	}
+	avail, ok := values["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14
+		avail = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	return total, avail, nil
+}
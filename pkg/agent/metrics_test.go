@@ -0,0 +1,85 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import "testing"
+
+func TestParseProcStat(t *testing.T) {
+	stat := `cpu  100 0 50 800 50 0 0 0 0 0
+cpu0 50 0 25 400 25 0 0 0 0 0
+cpu1 50 0 25 400 25 0 0 0 0 0
+intr 12345
+ctxt 67890
+`
+	times, cpus, err := parseProcStat(stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpus != 2 {
+		t.Errorf("cpus = %d, want 2", cpus)
+	}
+	if times.total != 1000 || times.idle != 850 {
+		t.Errorf("times = %+v, want total 1000, idle 850", times)
+	}
+	if _, _, err := parseProcStat("intr 1\n"); err == nil {
+		t.Error("parseProcStat() without cpu line succeeded, want an error")
+	}
+}
+
+func TestCPUPercent(t *testing.T) {
+	tests := []struct {
+		prev, cur cpuTimes
+		want      float64
+	}{
+		{cpuTimes{}, cpuTimes{idle: 850, total: 1000}, 15},
+		{cpuTimes{idle: 850, total: 1000}, cpuTimes{idle: 900, total: 1100}, 50},
+		{cpuTimes{idle: 850, total: 1000}, cpuTimes{idle: 850, total: 1000}, 0},
+	}
+	for _, tt := range tests {
+		if got := cpuPercent(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("cpuPercent(%+v, %+v) = %v, want %v", tt.prev, tt.cur, got, tt.want)
+		}
+	}
+}
+
+func TestParseMeminfo(t *testing.T) {
+	total, avail, err := parseMeminfo("MemTotal:        2048000 kB\nMemFree:          100000 kB\nMemAvailable:    1024000 kB\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2048000*1024 || avail != 1024000*1024 {
+		t.Errorf("parseMeminfo() = %d, %d", total, avail)
+	}
+
+	_, avail, err = parseMeminfo("MemTotal: 2048 kB\nMemFree: 100 kB\nBuffers: 10 kB\nCached: 20 kB\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avail != 130*1024 {
+		t.Errorf("parseMeminfo() without MemAvailable = %d, want %d", avail, 130*1024)
+	}
+}
+
+func TestParseLoadavg(t *testing.T) {
+	l1, l5, l15, err := parseLoadavg("0.52 0.58 0.59 1/257 12345\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l1 != 0.52 || l5 != 0.58 || l15 != 0.59 {
+		t.Errorf("parseLoadavg() = %v, %v, %v", l1, l5, l15)
+	}
+}
@@ -0,0 +1,116 @@
+// +build linux
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	afVsock = 40
+	// cidAny is VMADDR_CID_ANY
+	cidAny = 0xffffffff
+)
+
+// sockaddrVM is struct sockaddr_vm, which package syscall doesn't know
+type sockaddrVM struct {
+	family    uint16
+	reserved1 uint16
+	port      uint32
+	cid       uint32
+	zero      [4]uint8
+}
+
+// Serve listens on vsock port and writes the metrics as JSON to every
+// connection, until listening fails.
+func Serve(port uint32, c *Collector) error {
+	return serveVSock(port, func(conn *os.File) {
+		defer conn.Close()
+		m, err := c.Collect()
+		if err != nil {
+			log.Printf("Collecting metrics: %v", err)
+		} else if err := json.NewEncoder(conn).Encode(m); err != nil {
+			log.Printf("Writing metrics: %v", err)
+		}
+	})
+}
+
+// Forward listens on vsock port and connects every connection through to
+// addr, e.g. the docker socket, until listening fails.
+func Forward(port uint32, network, addr string) error {
+	return serveVSock(port, func(conn *os.File) {
+		go func() {
+			defer conn.Close()
+			target, err := net.Dial(network, addr)
+			if err != nil {
+				log.Printf("Forwarding vsock port %d: %v", port, err)
+				return
+			}
+			defer target.Close()
+
+			done := make(chan struct{})
+			go func() {
+				io.Copy(target, conn)
+				if cw, ok := target.(interface{ CloseWrite() error }); ok {
+					cw.CloseWrite()
+				}
+				close(done)
+			}()
+			io.Copy(conn, target)
+			syscall.Shutdown(int(conn.Fd()), syscall.SHUT_WR)
+			<-done
+		}()
+	})
+}
+
+// serveVSock listens on vsock port and hands every connection to handle
+func serveVSock(port uint32, handle func(conn *os.File)) error {
+	fd, err := syscall.Socket(afVsock, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("vsock socket: %w", err)
+	}
+	defer syscall.Close(fd)
+
+	sa := sockaddrVM{family: afVsock, port: port, cid: cidAny}
+	if _, _, errno := syscall.Syscall(syscall.SYS_BIND, uintptr(fd), uintptr(unsafe.Pointer(&sa)), unsafe.Sizeof(sa)); errno != 0 {
+		return fmt.Errorf("binding vsock port %d: %w", port, errno)
+	}
+	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
+		return fmt.Errorf("listening on vsock port %d: %w", port, err)
+	}
+
+	for {
+		// syscall.Accept can't decode vsock addresses, so accept without one
+		nfd, _, errno := syscall.Syscall6(syscall.SYS_ACCEPT4, uintptr(fd), 0, 0, syscall.SOCK_CLOEXEC, 0, 0)
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return fmt.Errorf("accepting on vsock port %d: %w", port, errno)
+		}
+		handle(os.NewFile(nfd, "vsock"))
+	}
+}
@@ -0,0 +1,31 @@
+// +build !linux
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import "errors"
+
+// Serve is only supported on linux guests
+func Serve(port uint32, c *Collector) error {
+	return errors.New("the guest agent only runs on linux")
+}
+
+// Forward is only supported on linux guests
+func Forward(port uint32, network, addr string) error {
+	return errors.New("the guest agent only runs on linux")
+}
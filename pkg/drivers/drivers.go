@@ -91,21 +91,54 @@ func Restart(d drivers.Driver) error {
 	return d.Start()
 }
 
+// ISOCopyError is returned when the boot2docker ISO can't be downloaded or
+// copied to the machine dir
+type ISOCopyError struct {
+	Err error
+}
+
+func (e *ISOCopyError) Error() string {
+	return fmt.Sprintf("copy iso to machine dir: %v", e.Err)
+}
+
+func (e *ISOCopyError) Unwrap() error {
+	return e.Err
+}
+
 // MakeDiskImage makes a boot2docker VM disk image.
 func MakeDiskImage(d *drivers.BaseDriver, boot2dockerURL string, diskSize int) error {
-	glog.Infof("Making disk image using store path: %s", d.StorePath)
+	if err := CopyIsoToMachineDir(d, boot2dockerURL); err != nil {
+		return err
+	}
+	return MakeRawDisk(d, diskSize)
+}
+
+// CopyIsoToMachineDir puts the boot2docker ISO at boot2dockerURL, or the
+// latest release if it is empty, into the machine dir.
+func CopyIsoToMachineDir(d *drivers.BaseDriver, boot2dockerURL string) error {
+	glog.Infof("Copying boot2docker ISO using store path: %s", d.StorePath)
 	b2 := mcnutils.NewB2dUtils(d.StorePath)
 	if err := b2.CopyIsoToMachineDir(boot2dockerURL, d.MachineName); err != nil {
-		return fmt.Errorf("copy iso to machine dir: %w", err)
+		return &ISOCopyError{Err: err}
 	}
+	return nil
+}
+
+// MakeRawDisk generates the machine SSH key and a raw disk image carrying it,
+// for machines that don't boot from the boot2docker ISO.
+func MakeRawDisk(d *drivers.BaseDriver, diskSize int) error {
+	return MakeRawDiskAt(d, GetDiskPath(d), diskSize)
+}
 
+// MakeRawDiskAt is MakeRawDisk with the disk image at diskPath rather than
+// in the machine dir
+func MakeRawDiskAt(d *drivers.BaseDriver, diskPath string, diskSize int) error {
 	keyPath := d.GetSSHKeyPath()
 	glog.Infof("Creating ssh key: %s...", keyPath)
 	if err := ssh.GenerateSSHKey(keyPath); err != nil {
 		return fmt.Errorf("generate ssh key: %w", err)
 	}
 
-	diskPath := GetDiskPath(d)
 	glog.Infof("Creating raw disk image: %s...", diskPath)
 	if _, err := os.Stat(diskPath); os.IsNotExist(err) {
 		if err := createRawDiskImage(publicSSHKeyPath(d), diskPath, diskSize); err != nil {
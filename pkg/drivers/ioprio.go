@@ -0,0 +1,61 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drivers
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// IOPriorityLow runs disk heavy operations in the background I/O class
+	IOPriorityLow = "low"
+	// IOPriorityNormal runs disk heavy operations at the default priority
+	IOPriorityNormal = "normal"
+)
+
+// ValidateIOPriority returns an error for unknown I/O priorities
+func ValidateIOPriority(p string) error {
+	switch p {
+	case IOPriorityLow, IOPriorityNormal:
+		return nil
+	}
+	return fmt.Errorf("invalid I/O priority %q, must be %q or %q", p, IOPriorityLow, IOPriorityNormal)
+}
+
+// RunWithIOPriority runs f on a thread with the given I/O priority, so that
+// multi-GB disk operations don't starve the rest of the host.
+func RunWithIOPriority(p string, f func() error) error {
+	if p != IOPriorityLow {
+		return f()
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := setThreadBackground(true); err != nil {
+		glog.Warningf("Unable to lower I/O priority: %v", err)
+		return f()
+	}
+	defer func() {
+		if err := setThreadBackground(false); err != nil {
+			glog.Warningf("Unable to restore I/O priority: %v", err)
+		}
+	}()
+	return f()
+}
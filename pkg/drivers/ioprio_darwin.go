@@ -0,0 +1,39 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package drivers
+
+import (
+	"syscall"
+)
+
+// From <sys/resource.h>
+const (
+	prioDarwinThread = 3
+	prioDarwinBG     = 0x1000
+)
+
+// setThreadBackground moves the current thread in and out of the darwin
+// background band, which throttles both its CPU and disk I/O.
+func setThreadBackground(bg bool) error {
+	prio := 0
+	if bg {
+		prio = prioDarwinBG
+	}
+	return syscall.Setpriority(prioDarwinThread, 0, prio)
+}
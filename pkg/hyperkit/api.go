@@ -0,0 +1,280 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// APIServer serves a JSON API over HTTP for managing the hyperkit machines
+// of a set of docker-machine stores, for tools that don't go through
+// docker-machine. It is meant to listen on a unix socket only the owner can
+// access. Routes:
+//
+//	GET  /machines                       list machines
+//	POST /machines                       create {"name", "store_path", "settings"}
+//	GET  /machines/<name>/state          {"state"}
+//	GET  /machines/<name>/ip             {"ip"}
+//	GET  /machines/<name>/stats          cpu, memory, disk and uptime
+//	GET  /machines/<name>/guest-stats    usage reported by the guest agent
+//	GET  /machines/<name>/inspect        config, paths, runtime and NFS exports
+//	POST /machines/<name>/start
+//	POST /machines/<name>/restart
+//	POST /machines/<name>/stop
+//	POST /machines/<name>/kill
+//	POST /machines/<name>/mounts         {"share"}
+//	POST /machines/<name>/unmount        {"share"}
+//	POST /machines/<name>/reconfigure    {"cpus", "memory"}, returns {"changes"}
+//	POST /machines/<name>/compact        returns {"reclaimed_bytes"}
+//	POST /machines/<name>/upgrade        returns {"upgraded"}
+//	GET  /metrics                        Prometheus metrics of all machines
+type APIServer struct {
+	StorePaths []string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type createRequest struct {
+	Name      string                 `json:"name"`
+	StorePath string                 `json:"store_path"`
+	Settings  map[string]interface{} `json:"settings"`
+}
+
+type mountRequest struct {
+	Share string `json:"share"`
+}
+
+type reconfigureRequest struct {
+	CPUs   int `json:"cpus"`
+	Memory int `json:"memory"`
+}
+
+// Serve handles API requests on l until it is closed
+func (s *APIServer) Serve(l net.Listener) error {
+	return http.Serve(l, s)
+}
+
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/metrics" {
+		MetricsHandler{StorePaths: s.StorePaths}.ServeHTTP(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "machines" || len(parts) > 3 {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", r.URL.Path))
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		refs, err := ListMachines(s.StorePaths)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAPIResponse(w, refs)
+	case len(parts) == 1 && r.Method == http.MethodPost:
+		s.create(w, r)
+	case len(parts) == 3:
+		s.machineOperation(w, r, parts[1], parts[2])
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on %s", r.Method, r.URL.Path))
+	}
+}
+
+func (s *APIServer) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.StorePath == "" && len(s.StorePaths) > 0 {
+		req.StorePath = s.StorePaths[0]
+	}
+	if req.Name == "" || req.StorePath == "" {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("name and store_path are required"))
+		return
+	}
+
+	unlock := s.lock(MachineRef{Name: req.Name, StorePath: req.StorePath})
+	defer unlock()
+	d, err := CreateMachine(req.StorePath, req.Name, req.Settings)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIResponse(w, map[string]string{"name": req.Name, "ip": d.IPAddress})
+}
+
+func (s *APIServer) machineOperation(w http.ResponseWriter, r *http.Request, name, op string) {
+	ref, err := ResolveMachine(s.StorePaths, name)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	unlock := s.lock(ref)
+	defer unlock()
+	d, err := LoadDriver(ref.StorePath, ref.Name)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+
+	operation, ok := apiOperations[op]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("unknown operation %s", op))
+		return
+	}
+	if r.Method != operation.method {
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	result, err := operation.run(d, r)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if result == nil {
+		result = struct{}{}
+	}
+	writeAPIResponse(w, result)
+}
+
+type apiOperation struct {
+	method string
+	run    func(d *Driver, r *http.Request) (interface{}, error)
+}
+
+var apiOperations = map[string]apiOperation{
+	"state": {http.MethodGet, func(d *Driver, _ *http.Request) (interface{}, error) {
+		st, err := d.GetState()
+		return map[string]string{"state": st.String()}, err
+	}},
+	"ip": {http.MethodGet, func(d *Driver, _ *http.Request) (interface{}, error) {
+		ip, err := d.GetIP()
+		return map[string]string{"ip": ip}, err
+	}},
+	"stats": {http.MethodGet, func(d *Driver, _ *http.Request) (interface{}, error) {
+		return d.Stats()
+	}},
+	"guest-stats": {http.MethodGet, func(d *Driver, _ *http.Request) (interface{}, error) {
+		return d.GuestMetrics()
+	}},
+	"inspect": {http.MethodGet, func(d *Driver, _ *http.Request) (interface{}, error) {
+		return d.Inspect()
+	}},
+	"start": {http.MethodPost, func(d *Driver, _ *http.Request) (interface{}, error) {
+		if err := d.Start(); err != nil {
+			return nil, err
+		}
+		return nil, d.SaveConfig()
+	}},
+	"restart": {http.MethodPost, func(d *Driver, _ *http.Request) (interface{}, error) {
+		if err := d.Restart(); err != nil {
+			return nil, err
+		}
+		return nil, d.SaveConfig()
+	}},
+	"stop": {http.MethodPost, func(d *Driver, _ *http.Request) (interface{}, error) {
+		return nil, d.Stop()
+	}},
+	"kill": {http.MethodPost, func(d *Driver, _ *http.Request) (interface{}, error) {
+		return nil, d.Kill()
+	}},
+	"mounts": {http.MethodPost, func(d *Driver, r *http.Request) (interface{}, error) {
+		var req mountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		if err := d.Mount(req.Share); err != nil {
+			return nil, err
+		}
+		return nil, d.SaveConfig()
+	}},
+	"unmount": {http.MethodPost, func(d *Driver, r *http.Request) (interface{}, error) {
+		var req mountRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		if err := d.Unmount(req.Share); err != nil {
+			return nil, err
+		}
+		return nil, d.SaveConfig()
+	}},
+	"reconfigure": {http.MethodPost, func(d *Driver, r *http.Request) (interface{}, error) {
+		var req reconfigureRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+		changes, err := d.Reconfigure(req.CPUs, req.Memory)
+		return map[string][]string{"changes": changes}, err
+	}},
+	"compact": {http.MethodPost, func(d *Driver, _ *http.Request) (interface{}, error) {
+		reclaimed, err := d.Compact()
+		return map[string]int64{"reclaimed_bytes": reclaimed}, err
+	}},
+	"upgrade": {http.MethodPost, func(d *Driver, _ *http.Request) (interface{}, error) {
+		upgraded, err := d.Upgrade()
+		return map[string]bool{"upgraded": upgraded}, err
+	}},
+}
+
+// lock serializes operations on the same machine, and returns the unlock
+func (s *APIServer) lock(ref MachineRef) func() {
+	key := ref.Name + "@" + ref.StorePath
+	s.mu.Lock()
+	if s.locks == nil {
+		s.locks = map[string]*sync.Mutex{}
+	}
+	l, ok := s.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[key] = l
+	}
+	s.mu.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+func writeAPIResponse(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("Unable to write API response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(apiError{Error: err.Error()}); err != nil {
+		log.Debugf("Unable to write API error: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIServer(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	machineDir := filepath.Join(store, "machines", "dev")
+	if err := os.MkdirAll(machineDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"DriverName":"hyperkit","Driver":{"MachineName":"dev","IPAddress":"192.168.64.5"}}`
+	if err := ioutil.WriteFile(filepath.Join(machineDir, hostConfigFileName), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(&APIServer{StorePaths: []string{store}})
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{"list", http.MethodGet, "/machines", http.StatusOK, `[{"Name":"dev","StorePath":"` + store + `","Ambiguous":false}]`},
+		{"ip", http.MethodGet, "/machines/dev/ip", http.StatusOK, `{"ip":"192.168.64.5"}`},
+		{"unknown_machine", http.MethodGet, "/machines/prod/ip", http.StatusNotFound, ""},
+		{"unknown_operation", http.MethodPost, "/machines/dev/explode", http.StatusNotFound, ""},
+		{"wrong_method", http.MethodGet, "/machines/dev/start", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("%s %s = %d, want %d: %s", tt.method, tt.path, resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.want == "" {
+				var apiErr apiError
+				if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Error == "" {
+					t.Errorf("%s %s returned no error message: %s", tt.method, tt.path, body)
+				}
+				return
+			}
+			if got := string(body); got != tt.want+"\n" {
+				t.Errorf("%s %s = %s, want %s", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
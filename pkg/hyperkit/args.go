@@ -0,0 +1,266 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// wrapperFileName is the script earlier versions launched hyperkit
+	// through, only left to remove with the machine
+	wrapperFileName = "hyperkit-wrapper.sh"
+	// commandFileName is a script with the exact command line of the last
+	// launch, to reproduce crashes by hand
+	commandFileName = "command.sh"
+)
+
+// wiredMemoryFlag makes hyperkit wire guest memory, like bhyve's -S. Not
+// every hyperkit build has it, so it is looked up in the usage output.
+const wiredMemoryFlag = "-S"
+
+// argRewrite describes how to change the hyperkit command line the hyperkit
+// Go API generates, which doesn't expose every hyperkit flag.
+type argRewrite struct {
+	// drop lists generated arguments to remove
+	drop []string
+	// prepend lists arguments to add before the generated ones
+	prepend []string
+	// append lists arguments to add after the generated ones
+	append []string
+}
+
+// hyperkitArgRewrite returns the changes the driver config requires
+func (d *Driver) hyperkitArgRewrite() argRewrite {
+	var r argRewrite
+	if d.DisableACPI {
+		r.drop = append(r.drop, "-A")
+	}
+	if d.HaltExit || d.PowerSave {
+		r.prepend = append(r.prepend, "-H")
+	}
+	if d.PauseExit || d.PowerSave {
+		r.prepend = append(r.prepend, "-P")
+	}
+	if d.WiredMemory {
+		r.prepend = append(r.prepend, wiredMemoryFlag)
+	}
+	if d.Balloon {
+		r.append = append(r.append, d.balloonArgs()...)
+	}
+	// Unlike the Go API, hyperkitArgs doesn't always attach the rng, it is
+	// only added here when virtioRNG decided on it
+	if d.rngAttached {
+		r.append = append(r.append, rngArgs()...)
+	}
+	// Each extra arg may hold several whitespace separated arguments, like
+	// "-s 5,virtio-rnd"
+	for _, arg := range d.ExtraArgs {
+		r.append = append(r.append, strings.Fields(arg)...)
+	}
+	return r
+}
+
+// extraArgDevices are the hyperkit device emulations --hyperkit-extra-args may
+// add. Devices that open host sockets or network interfaces aren't allowed,
+// as hyperkit runs as root, and neither is virtio-9p, which shares a host
+// directory writable.
+var extraArgDevices = []string{"virtio-rnd", "virtio-net", "virtio-blk", "ahci-hd", "ahci-cd"}
+
+// validateExtraArgs checks that the --hyperkit-extra-args only add "-s" PCI
+// devices of extraArgDevices, with host files the user can read. The user may
+// not be allowed to write them, so disks must be read-only.
+func validateExtraArgs(extraArgs []string) error {
+	var args []string
+	for _, arg := range extraArgs {
+		args = append(args, strings.Fields(arg)...)
+	}
+	for i := 0; i < len(args); i += 2 {
+		if args[i] != "-s" || i+1 == len(args) {
+			return fmt.Errorf("invalid --hyperkit-extra-args %q, only \"-s <slot>,<device>[,<config>]\" devices can be added", strings.Join(args[i:], " "))
+		}
+		// <slot>,<device>[,<config>]
+		parts := strings.SplitN(args[i+1], ",", 3)
+		if len(parts) < 2 || !containsString(extraArgDevices, parts[1]) {
+			return fmt.Errorf("invalid --hyperkit-extra-args device %q, must be one of %s", args[i+1], strings.Join(extraArgDevices, ", "))
+		}
+		if len(parts) < 3 {
+			continue
+		}
+		if (parts[1] == "virtio-blk" || parts[1] == "ahci-hd") && !containsString(strings.Split(parts[2], ",")[1:], "ro") {
+			return fmt.Errorf("invalid --hyperkit-extra-args device %q: disks must be read-only, add \",ro\"", args[i+1])
+		}
+		for _, path := range extraArgPaths(parts[1], parts[2]) {
+			if err := checkCallerCanRead(path); err != nil {
+				return fmt.Errorf("invalid --hyperkit-extra-args device %q: %w", args[i+1], err)
+			}
+		}
+	}
+	return nil
+}
+
+// extraArgPaths returns the host paths in the config of a hyperkit device
+func extraArgPaths(device, config string) []string {
+	var paths []string
+	switch device {
+	case "virtio-blk", "ahci-hd", "ahci-cd":
+		// <path>[,<options>], the path optionally a file:// URL with a query
+		path := strings.SplitN(config, ",", 2)[0]
+		path = strings.TrimPrefix(path, "file://")
+		paths = append(paths, strings.SplitN(path, "?", 2)[0])
+	}
+	return paths
+}
+
+// apply returns args with the changes of r
+func (r argRewrite) apply(args []string) []string {
+	var out []string
+	out = append(out, r.prepend...)
+	for _, arg := range args {
+		if !containsString(r.drop, arg) {
+			out = append(out, arg)
+		}
+	}
+	return append(out, r.append...)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// recordCommandLine debug logs the command the machine is launched with and
+// writes it to a script in the machine dir
+func (d *Driver) recordCommandLine(binary string, args []string) {
+	command := strings.Join(shellQuoteAll(append([]string{binary}, args...)), " ")
+	log.Debugf("Launching: %s", command)
+	script := "#!/bin/sh\n# Last command line of " + d.MachineName + ", generated by docker-machine-driver-hyperkit.\n" +
+		"# Run it as root with the machine stopped to reproduce a launch.\n" +
+		"exec " + command + "\n"
+	path := d.ResolveStorePath(commandFileName)
+	if err := writeFileAtomic(path, []byte(script), 0755); err != nil {
+		log.Warnf("Unable to write %s: %v", path, err)
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func shellQuoteAll(args []string) []string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return quoted
+}
+
+// hyperkitSupportsFlag reports whether the hyperkit binary lists flag in its
+// usage output
+func hyperkitSupportsFlag(hyperkitPath, flag string) bool {
+	// hyperkit exits non-zero after printing the usage
+	out, _ := exec.Command(hyperkitPath, "-h").CombinedOutput()
+	return usageHasFlag(string(out), flag)
+}
+
+// hyperkitHasDevice reports whether the hyperkit binary has the device
+// emulation name compiled in. Emulations aren't listed in the usage output.
+func hyperkitHasDevice(hyperkitPath, name string) (bool, error) {
+	b, err := ioutil.ReadFile(hyperkitPath)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(b, append([]byte(name), 0)), nil
+}
+
+// validateHyperkitBinary checks that path, set with --hyperkit-binary, is an
+// executable file
+func validateHyperkitBinary(path string) error {
+	_, err := resolveHyperkitBinary(path)
+	return err
+}
+
+// resolveHyperkitBinary returns the file path, set with --hyperkit-binary,
+// links to. The driver runs it as root, so like the driver itself it must be
+// an executable owned and only writable by root.
+func resolveHyperkitBinary(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", newError(ErrHyperkitMissing, "check --hyperkit-binary", fmt.Errorf("hyperkit binary: %w", err))
+	}
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return "", newError(ErrHyperkitMissing, "check --hyperkit-binary", fmt.Errorf("hyperkit binary: %w", err))
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		return "", newError(ErrHyperkitMissing, "check --hyperkit-binary", fmt.Errorf("hyperkit binary %s is not an executable file", path))
+	}
+	if err := checkOwnedBy(resolved, nil); err != nil {
+		return "", newError(ErrHyperkitMissing, "check --hyperkit-binary", fmt.Errorf("hyperkit binary: %w", err))
+	}
+	return resolved, nil
+}
+
+// hyperkitVersion returns the version hyperkit -v reports
+func hyperkitVersion(hyperkitPath string) (string, error) {
+	out, err := exec.Command(hyperkitPath, "-v").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s -v: %w", hyperkitPath, err)
+	}
+	return parseHyperkitVersion(string(out)), nil
+}
+
+// parseHyperkitVersion extracts the version from the first line of
+// hyperkit -v, e.g. "hyperkit: v0.20200224-44-gb54460c". Docker Desktop's
+// build names itself com.docker.hyperkit instead.
+func parseHyperkitVersion(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if i := strings.Index(line, ": "); i >= 0 {
+			line = line[i+2:]
+		}
+		return line
+	}
+	return ""
+}
+
+// usageHasFlag looks for a "-X: description" line in hyperkit's usage
+func usageHasFlag(usage, flag string) bool {
+	for _, line := range strings.Split(usage, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), flag+":") {
+			return true
+		}
+	}
+	return false
+}
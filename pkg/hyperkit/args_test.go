@@ -0,0 +1,135 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"strings"
+	"testing"
+
+	hyperkit "github.com/moby/hyperkit/go"
+)
+
+func Test_hyperkitArgs(t *testing.T) {
+	h := &hyperkit.HyperKit{
+		HyperKit:      "/usr/local/bin/hyperkit",
+		StateDir:      "/machines/dev",
+		VMNet:         true,
+		UUID:          "c4b6d5a0-0d6e-5d2a-9d3c-3f4c1b2a0e11",
+		Disks:         []hyperkit.Disk{&hyperkit.RawDisk{Path: "/machines/dev/dev.rawdisk", Size: 20000, Trim: true}},
+		ISOImages:     []string{"/machines/dev/boot2docker.iso"},
+		VSock:         true,
+		VSockDir:      "/machines/dev",
+		VSockPorts:    []int{2376, 22},
+		VSockGuestCID: 3,
+		Kernel:        "/machines/dev/bzimage",
+		Initrd:        "/machines/dev/initrd",
+		CPUs:          2,
+		Memory:        2048,
+		Console:       hyperkit.ConsoleFile,
+	}
+	got := hyperkitArgs(h, "loglevel=3")
+	want := []string{
+		"-A", "-u", "-F", "/machines/dev/hyperkit.pid", "-c", "2", "-m", "2048M",
+		"-s", "0:0,hostbridge", "-s", "31,lpc",
+		"-s", "1:0,virtio-net",
+		"-U", "c4b6d5a0-0d6e-5d2a-9d3c-3f4c1b2a0e11",
+		"-s", "2:0,ahci-hd,/machines/dev/dev.rawdisk",
+		"-s", "3,virtio-sock,guest_cid=3,path=/machines/dev,guest_forwards=2376;22",
+		"-s", "4,ahci-cd,/machines/dev/boot2docker.iso",
+		"-l", "com1,autopty=/machines/dev/tty,log=/machines/dev/console-ring",
+		"-f", "kexec,/machines/dev/bzimage,/machines/dev/initrd,earlyprintk=serial loglevel=3",
+	}
+	if strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+		t.Errorf("hyperkitArgs() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func Test_argRewriteApply(t *testing.T) {
+	r := argRewrite{drop: []string{"-A"}, prepend: []string{"-H"}, append: []string{"-s", "5,virtio-rnd"}}
+	got := r.apply([]string{"-A", "-u", "-F", "hyperkit.pid"})
+	want := []string{"-H", "-u", "-F", "hyperkit.pid", "-s", "5,virtio-rnd"}
+	if strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+		t.Errorf("apply() = %q, want %q", got, want)
+	}
+}
+
+func Test_parseHyperkitVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"hyperkit: v0.20200224-44-gb54460c\n\nHomepage: https://github.com/docker/hyperkit\nLicense: BSD\n\n", "v0.20200224-44-gb54460c"},
+		{"\ncom.docker.hyperkit: v0.20210107-12-g9a8c5e2\n", "v0.20210107-12-g9a8c5e2"},
+		{"v0.1\n", "v0.1"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := parseHyperkitVersion(tt.out); got != tt.want {
+			t.Errorf("parseHyperkitVersion(%q) = %q, want %q", tt.out, got, tt.want)
+		}
+	}
+}
+
+func Test_usageHasFlag(t *testing.T) {
+	usage := `Usage: hyperkit [-behuwxACHPWY] [-c vcpus] [-m mem]
+       -A: create ACPI tables
+       -c: # cpus (default 1)
+       -S: guest memory cannot be swapped
+       -u: RTC keeps UTC time
+`
+	tests := []struct {
+		flag string
+		want bool
+	}{
+		{"-S", true},
+		{"-A", true},
+		{"-m", false},
+		{"-W", false},
+	}
+	for _, tt := range tests {
+		if got := usageHasFlag(usage, tt.flag); got != tt.want {
+			t.Errorf("usageHasFlag(%q) = %v, want %v", tt.flag, got, tt.want)
+		}
+	}
+}
+
+func Test_validateExtraArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"-s 5,virtio-rnd"}, false},
+		{[]string{"-s", "6,virtio-blk,file:///dev/null?sync=os,ro"}, false},
+		{[]string{"-s", "6,virtio-blk,file:///dev/null?sync=os"}, true},
+		{[]string{"-s 6,ahci-hd,/dev/null,ro"}, false},
+		{[]string{"-s 6,ahci-hd,/dev/null,nocache"}, true},
+		{[]string{"-s 6,ahci-cd,/dev/null"}, false},
+		{[]string{"-s 7,virtio-9p,path=/tmp,tag=tmp"}, true},
+		{[]string{"-s 5,virtio-tap,tap0"}, true},
+		{[]string{"-s 5,virtio-vpnkit,path=/var/run/vpnkit.sock"}, true},
+		{[]string{"-f kexec,/tmp/evil"}, true},
+		{[]string{"-s"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateExtraArgs(tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("validateExtraArgs(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// auditLogFileName is the log of the privileged operations of the driver,
+// kept in the store so it covers all of its machines
+const auditLogFileName = "hyperkit-audit.log"
+
+// Privileged operations recorded in the audit log
+const (
+	auditStart       = "start"
+	auditSignal      = "signal"
+	auditNFSExport   = "nfs-export"
+	auditNFSUnexport = "nfs-unexport"
+	auditNFSReload   = "nfsd-reload"
+	auditLeaseRead   = "lease-read"
+	auditLeaseRemove = "lease-remove"
+	auditHostsUpdate = "hosts-update"
+	// auditHelperRefused records a sudo helper call that failed its checks
+	auditHelperRefused = "helper-refused"
+)
+
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Machine   string    `json:"machine"`
+	Operation string    `json:"operation"`
+	Detail    string    `json:"detail,omitempty"`
+	// UID is the user the operation was done for, not the root it ran as
+	UID   int    `json:"uid"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// audit appends the outcome of a privileged operation to the audit log. The
+// log is only ever appended to, and macOS is told to enforce that.
+func (d *Driver) audit(operation, detail string, err error) {
+	uid, _ := callerIDs()
+	r := auditRecord{
+		Time:      time.Now().UTC(),
+		Machine:   d.MachineName,
+		Operation: operation,
+		Detail:    detail,
+		UID:       uid,
+		OK:        err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if err := appendAuditRecord(filepath.Join(d.StorePath, auditLogFileName), r); err != nil {
+		log.Warnf("Unable to write the audit log: %v", err)
+	}
+}
+
+// appendAuditRecord appends r to the log at path. A new log is made system
+// append-only when root writes it, which not even its owner can lift, and an
+// existing one must be a regular file of the writing user, not a symlink.
+func appendAuditRecord(path string, r auditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	flag := os.O_WRONLY | os.O_APPEND | syscall.O_NOFOLLOW | syscall.O_NONBLOCK
+	f, err := os.OpenFile(path, flag|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		appendOnly := "uappnd"
+		if syscall.Geteuid() == 0 {
+			appendOnly = "sappnd"
+		}
+		if out, err := exec.Command("/usr/bin/chflags", appendOnly, path).CombinedOutput(); err != nil {
+			log.Debugf("Unable to make %s append-only: %v %s", path, err, strings.TrimSpace(string(out)))
+		}
+	} else if os.IsExist(err) {
+		if f, err = os.OpenFile(path, flag, 0); err != nil {
+			return err
+		}
+		if err := checkAuditLog(f); err != nil {
+			f.Close()
+			return err
+		}
+	} else {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// checkAuditLog fails unless f is a regular file owned by the effective user
+func checkAuditLog(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !fi.Mode().IsRegular() || !ok || int(st.Uid) != syscall.Geteuid() {
+		return fmt.Errorf("%s isn't a regular file owned by uid %d", f.Name(), syscall.Geteuid())
+	}
+	return nil
+}
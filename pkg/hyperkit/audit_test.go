@@ -0,0 +1,80 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir}}
+
+	d.audit(auditNFSReload, "", nil)
+	d.audit(auditSignal, "terminated to pid 42", errors.New("operation not permitted"))
+	b, err := ioutil.ReadFile(filepath.Join(dir, auditLogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2:\n%s", len(lines), b)
+	}
+	var r auditRecord
+	if err := json.Unmarshal([]byte(lines[1]), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Machine != "test" || r.Operation != auditSignal || r.OK || r.Error != "operation not permitted" || r.UID != os.Getuid() {
+		t.Errorf("unexpected record %+v", r)
+	}
+}
+
+func TestAppendAuditRecordSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "target")
+	if err := ioutil.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, auditLogFileName)
+	if err := os.Symlink(target, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := appendAuditRecord(path, auditRecord{Operation: auditStart}); err == nil {
+		t.Error("audit record appended through a symlink")
+	}
+	if b, _ := ioutil.ReadFile(target); len(b) != 0 {
+		t.Errorf("symlink target = %q", b)
+	}
+}
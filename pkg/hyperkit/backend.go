@@ -0,0 +1,372 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	hyperkit "github.com/moby/hyperkit/go"
+)
+
+// Backends that can run the machine, set with --hyperkit-backend
+const (
+	backendAuto     = "auto"
+	backendHyperkit = "hyperkit"
+	backendQEMU     = "qemu"
+)
+
+// backend launches the VM process of a machine. Everything around it, the
+// store layout, disks, IP discovery and stopping through the recorded pid, is
+// shared by all backends.
+type backend interface {
+	// name identifies the backend in logs and errors
+	name() string
+	// macAddress returns the MAC address the guest gets for uuid
+	macAddress(uuid string) (string, error)
+	// start boots the machine and records its pid in the machine state file
+	start(d *Driver, uuid, cmdline string) (int, error)
+}
+
+func validateBackend(b string) error {
+	switch b {
+	case backendAuto, backendHyperkit, backendQEMU:
+		return nil
+	}
+	return fmt.Errorf("invalid backend %q, must be one of %s, %s or %s", b, backendAuto, backendHyperkit, backendQEMU)
+}
+
+// backend resolves the configured backend. auto prefers hyperkit and falls
+// back to QEMU when no hyperkit binary can be found.
+func (d *Driver) backend() (backend, error) {
+	switch d.Backend {
+	case backendHyperkit:
+		return hyperkitBackend{}, nil
+	case backendQEMU:
+		return qemuBackend{}, nil
+	}
+	if d.HyperkitBinary != "" {
+		// Don't silently fall back from an explicitly chosen binary
+		if _, err := resolveHyperkitBinary(d.HyperkitBinary); err != nil {
+			return nil, err
+		}
+		return hyperkitBackend{}, nil
+	}
+	if _, err := d.hyperkitBinary(); err == nil {
+		return hyperkitBackend{}, nil
+	}
+	if qemuInstalled() {
+		log.Infof("hyperkit not found, falling back to %s", qemuBinary)
+		return qemuBackend{}, nil
+	}
+	return nil, newError(ErrHyperkitMissing, "install hyperkit, e.g. with Docker Desktop or brew install hyperkit",
+		fmt.Errorf("neither hyperkit nor %s could be found", qemuBinary))
+}
+
+// hyperkitBinary returns the hyperkit binary a machine runs, the one set
+// with --hyperkit-binary or else the one the Go API finds
+func (d *Driver) hyperkitBinary() (string, error) {
+	if d.HyperkitBinary != "" {
+		return resolveHyperkitBinary(d.HyperkitBinary)
+	}
+	h, err := hyperkit.New("", "", "")
+	if err != nil {
+		return "", err
+	}
+	return h.HyperKit, nil
+}
+
+// hyperkitBackend runs the machine with hyperkit through its Go API
+type hyperkitBackend struct{}
+
+func (hyperkitBackend) name() string {
+	return backendHyperkit
+}
+
+func (hyperkitBackend) macAddress(uuid string) (string, error) {
+	return GetMACAddressFromUUID(uuid)
+}
+
+func (hyperkitBackend) start(d *Driver, uuid, cmdline string) (int, error) {
+	binary := ""
+	if d.HyperkitBinary != "" {
+		resolved, err := resolveHyperkitBinary(d.HyperkitBinary)
+		if err != nil {
+			return 0, err
+		}
+		binary = resolved
+	}
+	h, err := hyperkit.New(binary, d.VpnKitSock, d.ResolveStorePath("."))
+	if err != nil {
+		return 0, newError(ErrHyperkitMissing, "install hyperkit, e.g. with Docker Desktop or brew install hyperkit", fmt.Errorf("new-ing Hyperkit: %w", err))
+	}
+	if version, err := hyperkitVersion(h.HyperKit); err != nil {
+		log.Debugf("Unable to get the hyperkit version: %v", err)
+	} else {
+		log.Debugf("Using %s %s", h.HyperKit, version)
+		d.HyperkitVersion = version
+	}
+
+	// The config may have been edited since it was validated
+	if err := validateExtraArgs(d.ExtraArgs); err != nil {
+		return 0, err
+	}
+	if err := validateAttachedISOs(d.AttachISOs); err != nil {
+		return 0, err
+	}
+	if d.WiredMemory && !hyperkitSupportsFlag(h.HyperKit, wiredMemoryFlag) {
+		return 0, fmt.Errorf("%s does not support wiring guest memory (%s), use a hyperkit build that does or drop --hyperkit-wired-memory", h.HyperKit, wiredMemoryFlag)
+	}
+	if d.Balloon {
+		if ok, err := hyperkitHasDevice(h.HyperKit, balloonDevice); err != nil {
+			return 0, err
+		} else if !ok {
+			return 0, fmt.Errorf("%s has no %s device, use a hyperkit build with memory ballooning or drop --hyperkit-balloon", h.HyperKit, balloonDevice)
+		}
+	}
+	d.rngAttached = d.virtioRNG(h.HyperKit)
+
+	// TODO: handle the rest of our settings.
+	h.Kernel = d.BootKernel
+	h.Initrd = d.BootInitrd
+	h.VMNet = true
+	h.ISOImages = d.isoImages()
+	h.Console = hyperkit.ConsoleFile
+	if d.CPU > defaultCPUs {
+		h.CPUs = d.CPU
+	}
+	if d.Memory > defaultMemory {
+		h.Memory = d.Memory
+	}
+	h.UUID = uuid
+
+	if vsockPorts, err := d.extractVSockPorts(); err != nil {
+		return 0, err
+	} else if len(vsockPorts) >= 1 {
+		h.VSock = true
+		h.VSockPorts = vsockPorts
+	}
+	if d.GuestAgent {
+		h.VSock = true
+		h.VSockPorts = append(h.VSockPorts, guestAgentPort)
+	}
+	if d.DockerVSock {
+		h.VSockPorts = append(h.VSockPorts, guestDockerPort)
+	}
+	if d.SSHOverVSock {
+		h.VSockPorts = append(h.VSockPorts, guestSSHPort)
+	}
+	if ports := d.bridgedGuestPorts(); len(ports) > 0 {
+		h.VSock = true
+		h.VSockPorts = append(h.VSockPorts, ports...)
+	}
+
+	disk, err := hyperkit.NewDisk(d.rootDisk(), d.DiskSize)
+	if err != nil {
+		return 0, fmt.Errorf("error creating disk: %w", err)
+	}
+	h.Disks = []hyperkit.Disk{disk}
+	for _, extra := range d.extraDisks() {
+		disk, err := hyperkit.NewDisk(d.diskPath(extra), extra.size)
+		if err != nil {
+			return 0, fmt.Errorf("error creating disk %s: %w", extra.name, err)
+		}
+		h.Disks = append(h.Disks, disk)
+	}
+	// The raw disks keep NewDisk's Trim, an ahci-hd that passes TRIM on.
+	// Turning it off would switch them to virtio-blk under the guest.
+
+	if err := d.applyConfigHooks(h); err != nil {
+		return 0, err
+	}
+	err = launchHyperkit(h, cmdline, d.hyperkitArgRewrite())
+	if len(h.Arguments) > 0 {
+		d.recordCommandLine(h.HyperKit, h.Arguments)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("starting with cmd line: %s: %w", cmdline, err)
+	}
+	return h.Pid, nil
+}
+
+// launchHyperkit starts hyperkit with the arguments the hyperkit Go API
+// generates for h, changed by r, and writes the machine state file like the Go
+// API does. The Go API has no way to change the arguments it launches
+// hyperkit with, so the driver launches hyperkit itself.
+func launchHyperkit(h *hyperkit.HyperKit, cmdline string, r argRewrite) error {
+	if err := prepareHyperkit(h); err != nil {
+		return err
+	}
+	h.Arguments = r.apply(hyperkitArgs(h, cmdline))
+	h.CmdLine = h.HyperKit + " " + strings.Join(h.Arguments, " ")
+
+	cmd := exec.Command(h.HyperKit, h.Arguments...)
+	if h.Argv0 != "" {
+		cmd.Args[0] = h.Argv0
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	h.Pid = cmd.Process.Pid
+	b, err := json.Marshal(h)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(h.StateDir, machineFileName), b, 0644)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		return fmt.Errorf("writing machine state: %w", err)
+	}
+	// Reap hyperkit once it exits, for as long as the driver runs
+	go cmd.Wait()
+	return nil
+}
+
+// prepareHyperkit checks the files h refers to and creates the directories
+// and disk images it needs, as the hyperkit Go API does before a launch
+func prepareHyperkit(h *hyperkit.HyperKit) error {
+	if h.StateDir == "" {
+		return fmt.Errorf("hyperkit needs a state dir")
+	}
+	if h.VSock && h.VSockDir == "" {
+		h.VSockDir = h.StateDir
+	}
+	files := append([]string{h.Kernel}, h.ISOImages...)
+	if h.Initrd != "" {
+		files = append(files, h.Initrd)
+	}
+	for _, path := range files {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{h.VSockDir, h.StateDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	for _, disk := range h.Disks {
+		if err := disk.Ensure(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hyperkitArgs returns the arguments the hyperkit Go API generates to boot
+// the kernel in h with cmdline, with the console in the state dir
+func hyperkitArgs(h *hyperkit.HyperKit, cmdline string) []string {
+	a := []string{"-A", "-u", "-F", filepath.Join(h.StateDir, pidFileName)}
+	a = append(a, "-c", strconv.Itoa(h.CPUs), "-m", fmt.Sprintf("%dM", h.Memory))
+	a = append(a, "-s", "0:0,hostbridge", "-s", "31,lpc")
+
+	slot := 1
+	device := func(format string, args ...interface{}) {
+		a = append(a, "-s", fmt.Sprintf("%d"+format, append([]interface{}{slot}, args...)...))
+		slot++
+	}
+	if h.VPNKitSock != "" {
+		opts := ""
+		if h.VPNKitUUID != "" {
+			opts += ",uuid=" + h.VPNKitUUID
+		}
+		if h.VPNKitPreferredIPv4 != "" {
+			opts += ",preferred_ipv4=" + h.VPNKitPreferredIPv4
+		}
+		device(":0,virtio-vpnkit,path=%s%s", h.VPNKitSock, opts)
+	}
+	if h.VMNet {
+		device(":0,virtio-net")
+	}
+	if h.UUID != "" {
+		a = append(a, "-U", h.UUID)
+	}
+	for _, disk := range h.Disks {
+		device(":0,%s", disk.AsArgument())
+	}
+	if h.VSock {
+		vsock := fmt.Sprintf(",virtio-sock,guest_cid=%d,path=%s", h.VSockGuestCID, h.VSockDir)
+		if len(h.VSockPorts) > 0 {
+			ports := make([]string, len(h.VSockPorts))
+			for i, port := range h.VSockPorts {
+				ports[i] = strconv.Itoa(port)
+			}
+			vsock += ",guest_forwards=" + strings.Join(ports, ";")
+		}
+		device("%s", vsock)
+	}
+	for _, image := range h.ISOImages {
+		device(",ahci-cd,%s", image)
+	}
+	for _, p := range h.Sockets9P {
+		device(",virtio-9p,path=%s,tag=%s", p.Path, p.Tag)
+	}
+
+	console := "com1,autopty=" + h.StateDir + "/tty"
+	if h.Console == hyperkit.ConsoleLog {
+		console += ",asl"
+	} else {
+		console += ",log=" + h.StateDir + "/console-ring"
+	}
+	a = append(a, "-l", console)
+
+	if h.Bootrom != "" {
+		return append(a, "-f", fmt.Sprintf("bootrom,%s,,", h.Bootrom))
+	}
+	return append(a, "-f", fmt.Sprintf("kexec,%s,%s,earlyprintk=serial %s", h.Kernel, h.Initrd, cmdline))
+}
+
+// isoImages returns the ISOs attached to the machine: the boot ISO, the
+// ignition config drive and the ones attached with --hyperkit-attach-iso
+func (d *Driver) isoImages() []string {
+	var isos []string
+	if !d.netboot() {
+		isos = append(isos, d.ResolveStorePath(isoFilename))
+	}
+	if iso := d.ignitionISO(); iso != "" {
+		isos = append(isos, iso)
+	}
+	return append(isos, d.AttachISOs...)
+}
+
+// validateAttachedISOs checks the ISOs attached with --hyperkit-attach-iso
+// are files the user who invoked the driver may read, as hyperkit opens
+// them as root
+func validateAttachedISOs(isos []string) error {
+	for _, iso := range isos {
+		if fi, err := os.Stat(iso); err != nil {
+			return fmt.Errorf("attached ISO: %w", err)
+		} else if !fi.Mode().IsRegular() {
+			return fmt.Errorf("attached ISO %s is not a file", iso)
+		}
+		if err := checkCallerCanRead(iso); err != nil {
+			return fmt.Errorf("attached ISO: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// spotlightMarkerFileName keeps Spotlight from indexing the directory it is
+// in
+const spotlightMarkerFileName = ".metadata_never_index"
+
+// excludeFromBackups keeps Time Machine and Spotlight out of the machine dir
+// dir, whose disks change all the time while the machine runs. Failures only
+// cost backup space and indexing time, so they are warnings.
+func excludeFromBackups(dir string) {
+	if err := writeFileAtomic(filepath.Join(dir, spotlightMarkerFileName), nil, 0644); err != nil {
+		log.Warnf("Unable to exclude %s from Spotlight: %v", dir, err)
+	}
+	// Without -p the exclusion is an extended attribute of the directory,
+	// which needs no root and goes away with it
+	if out, err := asCaller(exec.Command("/usr/bin/tmutil", "addexclusion", dir)).CombinedOutput(); err != nil {
+		log.Warnf("Unable to exclude %s from Time Machine backups: %v %s", dir, err, strings.TrimSpace(string(out)))
+	}
+}
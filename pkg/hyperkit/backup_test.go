@@ -0,0 +1,40 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExcludeFromBackups(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// tmutil failing, or missing outside macOS, is only a warning
+	excludeFromBackups(tmpDir)
+	if _, err := os.Stat(filepath.Join(tmpDir, spotlightMarkerFileName)); err != nil {
+		t.Errorf("Spotlight marker not written: %v", err)
+	}
+}
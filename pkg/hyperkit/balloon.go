@@ -0,0 +1,94 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// balloonDevice is the device emulation of hyperkit builds with memory
+	// ballooning. Stock hyperkit doesn't have it.
+	balloonDevice = "virtio-balloon"
+	// balloonSlot is the PCI slot of the balloon, clear of the slots the
+	// hyperkit Go API hands out
+	balloonSlot = 29
+	// balloonTargetFileName holds the balloon size in pages, which the
+	// device polls
+	balloonTargetFileName = "balloon-target"
+	balloonPageSize       = 4096
+	// balloonInterval is how often the supervisor resizes the balloon
+	balloonInterval = 30 * time.Second
+	// balloonMinHeadroom is the least free memory, in bytes, left to the
+	// guest on top of what it uses
+	balloonMinHeadroom = 256 * 1024 * 1024
+)
+
+// balloonArgs returns the hyperkit arguments adding the balloon device
+func (d *Driver) balloonArgs() []string {
+	return []string{"-s", fmt.Sprintf("%d,%s,target=%s", balloonSlot, balloonDevice, d.ResolveStorePath(balloonTargetFileName))}
+}
+
+// balloonTarget returns the balloon size in bytes that leaves the guest
+// enough headroom on top of the memory it uses. A Linux guest's MemTotal
+// excludes the current balloon, so configured minus MemTotal is its size.
+func balloonTarget(configured, guestTotal, guestAvailable int64) int64 {
+	headroom := configured / 4
+	if headroom < balloonMinHeadroom {
+		headroom = balloonMinHeadroom
+	}
+	current := configured - guestTotal
+	if current < 0 {
+		current = 0
+	}
+	target := current + guestAvailable - headroom
+	if max := configured - minMemory*1024*1024; target > max {
+		target = max
+	}
+	if target < 0 {
+		target = 0
+	}
+	return target
+}
+
+// resizeBalloon sets the balloon target from the free memory the guest agent
+// reports, so idle machines give memory back to the host
+func (d *Driver) resizeBalloon() {
+	m, err := d.GuestMetrics()
+	if err != nil {
+		warnings.Warnf("Unable to size the memory balloon: %v", err)
+		return
+	}
+	configured := int64(d.Memory) * 1024 * 1024
+	target := balloonTarget(configured, m.MemTotalBytes, m.MemAvailableBytes)
+	pages := strconv.FormatInt(target/balloonPageSize, 10)
+	path := d.ResolveStorePath(balloonTargetFileName)
+	if b, err := readCallerFile(path, syscall.O_NOFOLLOW); err == nil && string(b) == pages {
+		return
+	}
+	log.Debugf("Resizing memory balloon of %s to %s", d.MachineName, formatBytes(target))
+	if err := writeFileAtomic(path, []byte(pages), 0644); err != nil {
+		warnings.Warnf("Unable to size the memory balloon: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import "testing"
+
+func TestBalloonTarget(t *testing.T) {
+	const mb = 1024 * 1024
+	tests := []struct {
+		name                            string
+		configured, guestTotal, guestAv int64
+		want                            int64
+	}{
+		{"busy guest", 2048 * mb, 2000 * mb, 300 * mb, 0},
+		{"idle guest", 4096 * mb, 4000 * mb, 3500 * mb, 96*mb + 3500*mb - 1024*mb},
+		{"never below minimum", 1024 * mb, 1000 * mb, 1000 * mb, 1024*mb - minMemory*mb},
+		{"deflate", 2048 * mb, 1024 * mb, 100 * mb, 1024*mb + 100*mb - 512*mb},
+		{"no balloon yet", 2048 * mb, 2048 * mb, 1536 * mb, 1024 * mb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := balloonTarget(tt.configured, tt.guestTotal, tt.guestAv); got != tt.want {
+				t.Errorf("balloonTarget() = %d MB, want %d MB", got/mb, tt.want/mb)
+			}
+		})
+	}
+}
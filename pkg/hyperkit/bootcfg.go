@@ -0,0 +1,211 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bootEntry is the default boot entry of a bootloader config
+type bootEntry struct {
+	cmdline string
+	// initrds are the ISO paths of the initrd parts, in load order
+	initrds []string
+}
+
+// isoBootEntry returns the default boot entry of the extracted isolinux or
+// grub config, a zero one if there is none
+func isoBootEntry(files ISOBootFiles) bootEntry {
+	for _, cfg := range []struct {
+		path  string
+		parse func(io.Reader) bootEntry
+	}{
+		{files.IsoLinuxCfgPath, parseIsolinuxEntry},
+		{files.GrubCfgPath, parseGrubEntry},
+	} {
+		if cfg.path == "" {
+			continue
+		}
+		f, err := os.Open(cfg.path)
+		if err != nil {
+			continue
+		}
+		entry := cfg.parse(f)
+		f.Close()
+		if entry.cmdline != "" || len(entry.initrds) > 0 {
+			return entry
+		}
+	}
+	return bootEntry{}
+}
+
+// parseIsolinuxEntry returns the APPEND line and initrds of the DEFAULT
+// label of an isolinux config, falling back to the label marked MENU
+// DEFAULT, then the first label, and to a global APPEND for a label without
+// its own. The initrds come from INITRD or the initrd= option of APPEND.
+func parseIsolinuxEntry(r io.Reader) bootEntry {
+	var (
+		defaultLabel, menuDefault, first, global string
+		labels                                   []string
+	)
+	appends := map[string]string{}
+	initrds := map[string]string{}
+	label := ""
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rest := strings.Join(fields[1:], " ")
+		switch strings.ToLower(fields[0]) {
+		case "default":
+			defaultLabel = rest
+		case "label":
+			label = rest
+			labels = append(labels, label)
+			if first == "" {
+				first = label
+			}
+		case "append":
+			if label == "" {
+				global = rest
+			} else {
+				appends[label] = rest
+			}
+		case "initrd":
+			initrds[label] = rest
+		case "menu":
+			if label != "" && strings.EqualFold(rest, "default") {
+				menuDefault = label
+			}
+		}
+	}
+
+	chosen := first
+	if menuDefault != "" {
+		chosen = menuDefault
+	}
+	for _, l := range labels {
+		if l == defaultLabel {
+			chosen = l
+		}
+	}
+	cmdline, ok := appends[chosen]
+	if !ok {
+		cmdline = global
+	}
+	initrd := initrds[chosen]
+	for _, arg := range strings.Fields(cmdline) {
+		if strings.HasPrefix(arg, "initrd=") {
+			initrd = strings.TrimPrefix(arg, "initrd=")
+		}
+	}
+	var parts []string
+	for _, part := range strings.Split(initrd, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return bootEntry{cmdline: cleanBootCmdline(cmdline), initrds: parts}
+}
+
+// parseGrubEntry returns the options of the linux line and the initrds of
+// the default menuentry of a grub config: the one "set default" names by
+// index or title, the first one otherwise
+func parseGrubEntry(r io.Reader) bootEntry {
+	var (
+		defaultEntry string
+		titles       []string
+		entries      []bootEntry
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "set":
+			if v := strings.TrimPrefix(line, "set default="); v != line {
+				defaultEntry = strings.Trim(v, `"'`)
+			}
+		case "menuentry":
+			titles = append(titles, grubEntryTitle(line))
+			entries = append(entries, bootEntry{})
+		case "linux", "linux16", "linuxefi":
+			// The kernel path comes first
+			if len(entries) > 0 && len(fields) > 1 {
+				entries[len(entries)-1].cmdline = cleanBootCmdline(strings.Join(fields[2:], " "))
+			}
+		case "initrd", "initrd16", "initrdefi":
+			if len(entries) > 0 {
+				entries[len(entries)-1].initrds = fields[1:]
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return bootEntry{}
+	}
+
+	chosen := 0
+	if i, err := strconv.Atoi(defaultEntry); err == nil && i >= 0 && i < len(entries) {
+		chosen = i
+	}
+	for i, title := range titles {
+		if defaultEntry != "" && title == defaultEntry {
+			chosen = i
+		}
+	}
+	return entries[chosen]
+}
+
+// grubEntryTitle returns the quoted title of a menuentry line
+func grubEntryTitle(line string) string {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "menuentry"))
+	if line == "" {
+		return ""
+	}
+	quote := line[0]
+	if quote != '"' && quote != '\'' {
+		return strings.Fields(line)[0]
+	}
+	if end := strings.IndexByte(line[1:], quote); end >= 0 {
+		return line[1 : end+1]
+	}
+	return ""
+}
+
+// cleanBootCmdline drops what only makes sense to the bootloader: the
+// initrd, which hyperkit is given separately, and unexpanded variables
+func cleanBootCmdline(cmdline string) string {
+	var args []string
+	for _, arg := range strings.Fields(cmdline) {
+		if strings.HasPrefix(arg, "initrd=") || strings.Contains(arg, "$") {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " ")
+}
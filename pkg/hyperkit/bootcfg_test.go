@@ -0,0 +1,134 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseIsolinuxEntry(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  string
+		want bootEntry
+	}{
+		{
+			"boot2docker",
+			`serial 0 9600
+display boot.msg
+default boot2docker
+label boot2docker
+	kernel /boot/vmlinuz64
+	initrd /boot/initrd.img
+	append loglevel=3 user=docker console=ttyS0 console=tty0 noembed nomodeset norestore waitusb=10:LABEL=boot2docker-data base
+
+# see http://www.syslinux.org/wiki/index.php/SYSLINUX
+prompt 1
+timeout 1
+`,
+			bootEntry{
+				cmdline: "loglevel=3 user=docker console=ttyS0 console=tty0 noembed nomodeset norestore waitusb=10:LABEL=boot2docker-data base",
+				initrds: []string{"/boot/initrd.img"},
+			},
+		},
+		{
+			"default label",
+			"DEFAULT second\nLABEL first\n  APPEND quiet\nLABEL second\n  KERNEL /vmlinuz\n  APPEND initrd=/initrd.img console=ttyS0\n",
+			bootEntry{cmdline: "console=ttyS0", initrds: []string{"/initrd.img"}},
+		},
+		{
+			"multi-part initrd",
+			"DEFAULT linux\nLABEL linux\n  KERNEL /vmlinuz\n  APPEND initrd=/ucode.img,/initrd.img quiet\n",
+			bootEntry{cmdline: "quiet", initrds: []string{"/ucode.img", "/initrd.img"}},
+		},
+		{
+			"menu default",
+			"DEFAULT vesamenu.c32\nLABEL first\n  APPEND quiet\nLABEL second\n  MENU DEFAULT\n  APPEND debug\n",
+			bootEntry{cmdline: "debug"},
+		},
+		{
+			"first label",
+			"LABEL first\n  APPEND quiet\nLABEL second\n  APPEND debug\n",
+			bootEntry{cmdline: "quiet"},
+		},
+		{
+			"global append",
+			"APPEND console=ttyS0\nDEFAULT linux\nLABEL linux\n  KERNEL /vmlinuz\n",
+			bootEntry{cmdline: "console=ttyS0"},
+		},
+		{"empty", "", bootEntry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseIsolinuxEntry(strings.NewReader(tt.cfg)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIsolinuxEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGrubEntry(t *testing.T) {
+	entries := `menuentry 'Flatcar default' {
+	linux /flatcar/vmlinuz-a console=ttyS0 flatcar.autologin
+	initrd /flatcar/ucode.img /flatcar/initrd
+}
+menuentry "Debug" --class os {
+	linux /flatcar/vmlinuz-a console=ttyS0 debug $extra
+}
+`
+	flatcar := bootEntry{cmdline: "console=ttyS0 flatcar.autologin", initrds: []string{"/flatcar/ucode.img", "/flatcar/initrd"}}
+	debug := bootEntry{cmdline: "console=ttyS0 debug"}
+	tests := []struct {
+		name string
+		cfg  string
+		want bootEntry
+	}{
+		{"no default", entries, flatcar},
+		{"default index", `set default="1"` + "\n" + entries, debug},
+		{"default title", "set default='Debug'\n" + entries, debug},
+		{"default out of range", "set default=5\n" + entries, flatcar},
+		{"no entries", "set timeout=5\n", bootEntry{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseGrubEntry(strings.NewReader(tt.cfg)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseGrubEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeCmdline(t *testing.T) {
+	tests := []struct {
+		base, overrides string
+		want            string
+	}{
+		{"loglevel=3 console=ttyS0 console=tty0 base", "", "loglevel=3 console=ttyS0 console=tty0 base"},
+		{"", "quiet", "quiet"},
+		{"loglevel=3 console=ttyS0 console=tty0 base", "console=ttyS0 loglevel=7", "base console=ttyS0 loglevel=7"},
+		{"loglevel=3 base", "noembed", "loglevel=3 base noembed"},
+	}
+	for _, tt := range tests {
+		if got := mergeCmdline(tt.base, tt.overrides); got != tt.want {
+			t.Errorf("mergeCmdline(%q, %q) = %q, want %q", tt.base, tt.overrides, got, tt.want)
+		}
+	}
+}
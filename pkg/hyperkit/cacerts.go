@@ -0,0 +1,134 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// guestPersistentCerts are added to the trust store at every boot2docker
+	// boot
+	guestPersistentCerts = "/var/lib/boot2docker/certs"
+	// guestCABundle is the trust store of boot2docker
+	guestCABundle = "/etc/ssl/certs/ca-certificates.crt"
+	// guestRegistryCerts is where docker looks for the CA of a registry
+	guestRegistryCerts = "/etc/docker/certs.d"
+)
+
+// caCert is a CA certificate to install in the guest, for all of the guest
+// or, with a registry, only for docker pulling from it
+type caCert struct {
+	registry string
+	path     string
+	pem      string
+}
+
+// parseCACert parses a [registry=]path spec
+func parseCACert(spec string) caCert {
+	if i := strings.Index(spec, "="); i >= 0 {
+		return caCert{registry: spec[:i], path: spec[i+1:]}
+	}
+	return caCert{path: spec}
+}
+
+// loadCACerts reads the configured certificates, checking they are PEM
+// certificates
+func (d *Driver) loadCACerts() ([]caCert, error) {
+	var certs []caCert
+	for _, spec := range d.CACerts {
+		c := parseCACert(spec)
+		b, err := readCallerFile(c.path, 0)
+		if err != nil {
+			return nil, fmt.Errorf("CA certificate: %w", err)
+		}
+		if _, err := parseCertificate(b); err != nil {
+			return nil, fmt.Errorf("CA certificate %s: %w", c.path, err)
+		}
+		if c.registry != "" && strings.ContainsAny(c.registry, "/' ") {
+			return nil, fmt.Errorf("CA certificate %s: invalid registry %q", c.path, c.registry)
+		}
+		c.pem = strings.TrimSpace(string(b)) + "\n"
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// caCertName names the certificate in the guest trust store
+func caCertName(i int, c caCert) string {
+	base := strings.TrimSuffix(filepath.Base(c.path), filepath.Ext(c.path))
+	return fmt.Sprintf("docker-machine-%d-%s", i, strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, base))
+}
+
+// caCertScript returns the shell script that installs the certificates in a
+// guest with the given os-release ID, restarting dockerd if the trust store
+// changed
+func caCertScript(osID string, certs []caCert) string {
+	var s strings.Builder
+	s.WriteString("set -e\nchanged=\n")
+	if osID != "boot2docker" {
+		// Debian and Alpine, or Fedora and its relatives
+		s.WriteString("if command -v update-ca-certificates >/dev/null; then dir=/usr/local/share/ca-certificates; else dir=/etc/pki/ca-trust/source/anchors; fi\nmkdir -p $dir\n")
+	}
+	for i, c := range certs {
+		if c.registry != "" {
+			dir := guestRegistryCerts + "/" + c.registry
+			fmt.Fprintf(&s, "mkdir -p '%s'\ncat > '%s/ca.crt' <<'EOF'\n%sEOF\n", dir, dir, c.pem)
+			continue
+		}
+		name := caCertName(i, c)
+		if osID == "boot2docker" {
+			// boot2docker adds these on later boots by itself
+			path := guestPersistentCerts + "/" + name + ".pem"
+			fmt.Fprintf(&s, "mkdir -p %s\ncat > %s <<'EOF'\n%sEOF\n", guestPersistentCerts, path, c.pem)
+			fmt.Fprintf(&s, "grep -qF \"$(sed -n 2p %[1]s)\" %[2]s || { cat %[1]s >> %[2]s; changed=1; }\n", path, guestCABundle)
+			continue
+		}
+		fmt.Fprintf(&s, "cat > /tmp/%[1]s.crt <<'EOF'\n%[2]sEOF\n", name, c.pem)
+		fmt.Fprintf(&s, "cmp -s /tmp/%[1]s.crt $dir/%[1]s.crt || { mv /tmp/%[1]s.crt $dir/%[1]s.crt; changed=1; }\n", name)
+	}
+	if osID != "boot2docker" {
+		s.WriteString("[ -z \"$changed\" ] || { update-ca-certificates 2>/dev/null || update-ca-trust; }\n")
+	}
+	s.WriteString("[ -z \"$changed\" ] || systemctl restart docker 2>/dev/null || /etc/init.d/docker restart\n")
+	return s.String()
+}
+
+// installCACerts adds the configured CA certificates to the guest
+func (d *Driver) installCACerts() error {
+	certs, err := d.loadCACerts()
+	if err != nil || len(certs) == 0 {
+		return err
+	}
+	id, err := d.guestOSID()
+	if err != nil {
+		return fmt.Errorf("detecting the guest OS: %w", err)
+	}
+	log.Infof("Installing %d CA certificates in %s", len(certs), d.MachineName)
+	return d.runSSHWithStdin("sudo sh", strings.NewReader(caCertScript(id, certs)))
+}
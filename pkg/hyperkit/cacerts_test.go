@@ -0,0 +1,68 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCACert(t *testing.T) {
+	tests := []struct {
+		spec string
+		want caCert
+	}{
+		{"/certs/corp.pem", caCert{path: "/certs/corp.pem"}},
+		{"registry.corp:5000=/certs/registry.pem", caCert{registry: "registry.corp:5000", path: "/certs/registry.pem"}},
+	}
+	for _, tt := range tests {
+		if got := parseCACert(tt.spec); got != tt.want {
+			t.Errorf("parseCACert(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCACertScript(t *testing.T) {
+	const pem = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	certs := []caCert{
+		{path: "/certs/Corp Root.pem", pem: pem},
+		{registry: "registry.corp:5000", path: "/certs/registry.pem", pem: pem},
+	}
+
+	b2d := caCertScript("boot2docker", certs)
+	for _, want := range []string{
+		guestPersistentCerts + "/docker-machine-0-Corp_Root.pem",
+		guestCABundle,
+		"'/etc/docker/certs.d/registry.corp:5000/ca.crt'",
+	} {
+		if !strings.Contains(b2d, want) {
+			t.Errorf("boot2docker script doesn't contain %q:\n%s", want, b2d)
+		}
+	}
+
+	other := caCertScript("debian", certs)
+	for _, want := range []string{
+		"$dir/docker-machine-0-Corp_Root.crt",
+		"update-ca-certificates",
+	} {
+		if !strings.Contains(other, want) {
+			t.Errorf("script doesn't contain %q:\n%s", want, other)
+		}
+	}
+}
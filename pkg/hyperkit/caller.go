@@ -0,0 +1,173 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// callerIDs returns the uid and gid of the user who invoked the driver,
+// through its setuid bit or sudo. SUDO_UID is only trusted when sudo made the
+// real user root, a setuid driver gets its environment from the caller.
+func callerIDs() (int, int) {
+	if syscall.Getuid() == 0 && syscall.Geteuid() == 0 {
+		if uid, err := strconv.Atoi(os.Getenv("SUDO_UID")); err == nil {
+			gid, _ := strconv.Atoi(os.Getenv("SUDO_GID"))
+			return uid, gid
+		}
+	}
+	return syscall.Getuid(), syscall.Getgid()
+}
+
+// privileged reports whether the driver runs as root on behalf of another
+// user, who mustn't get to use root's permissions for anything they choose
+func privileged() bool {
+	uid, _ := callerIDs()
+	return syscall.Geteuid() == 0 && uid != 0
+}
+
+// asCaller makes cmd run as the user who invoked the driver, with their home
+// directory, rather than as root
+func asCaller(cmd *exec.Cmd) *exec.Cmd {
+	if !privileged() {
+		return cmd
+	}
+	uid, gid := callerIDs()
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+	return cmd
+}
+
+// withCallerIDs runs f with the effective uid and gid of the user who invoked
+// the driver, so the files f touches are subject to their permissions rather
+// than root's
+func withCallerIDs(f func() error) error {
+	if !privileged() {
+		return f()
+	}
+	uid, gid := callerIDs()
+	euid, egid := syscall.Geteuid(), syscall.Getegid()
+	if err := syscall.Setegid(gid); err != nil {
+		return err
+	}
+	if err := syscall.Seteuid(uid); err != nil {
+		syscall.Setegid(egid)
+		return err
+	}
+	ferr := f()
+	if err := syscall.Seteuid(euid); err != nil {
+		return err
+	}
+	if err := syscall.Setegid(egid); err != nil {
+		return err
+	}
+	return ferr
+}
+
+// chownToCaller gives path, which the driver made as root, to the user who
+// invoked it
+func chownToCaller(path string) error {
+	if !privileged() {
+		return nil
+	}
+	uid, gid := callerIDs()
+	return os.Lchown(path, uid, gid)
+}
+
+// checkCallerCanRead fails unless the user who invoked the driver is allowed
+// to read path, so root doesn't read files on their behalf they couldn't
+func checkCallerCanRead(path string) error {
+	if !privileged() {
+		return nil
+	}
+	return withCallerIDs(func() error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// readCallerFile reads path with the permissions of the user who invoked the
+// driver, so root doesn't read files on their behalf they couldn't. Extra
+// open flags like O_NOFOLLOW go in flag.
+func readCallerFile(path string, flag int) ([]byte, error) {
+	var b []byte
+	err := withCallerIDs(func() error {
+		f, err := os.OpenFile(path, os.O_RDONLY|flag, 0)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		b, err = ioutil.ReadAll(f)
+		return err
+	})
+	return b, err
+}
+
+// openCallerFile opens path for appending on behalf of the user who invoked
+// the driver. It is created for them, or must already be theirs, so root
+// doesn't write to a file they couldn't, or through a symlink they planted.
+func openCallerFile(path string) (*os.File, error) {
+	// Non-blocking, so a fifo without a reader fails rather than hangs
+	flag := os.O_WRONLY | os.O_APPEND | syscall.O_NOFOLLOW | syscall.O_NONBLOCK
+	f, err := os.OpenFile(path, flag|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		if err := chownToCaller(path); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	if !os.IsExist(err) {
+		return nil, err
+	}
+	if f, err = os.OpenFile(path, flag, 0); err != nil {
+		return nil, err
+	}
+	if privileged() {
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		uid, _ := callerIDs()
+		if st, ok := fi.Sys().(*syscall.Stat_t); !ok || st.Uid != uint32(uid) {
+			f.Close()
+			return nil, fmt.Errorf("%s isn't owned by uid %d", path, uid)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,104 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestAsCaller(t *testing.T) {
+	for _, key := range []string{"SUDO_UID", "SUDO_GID"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+	os.Setenv("SUDO_UID", "12345")
+	os.Setenv("SUDO_GID", "54321")
+
+	if os.Getuid() != 0 {
+		// SUDO_UID is only trusted when sudo runs the driver
+		if uid, _ := callerIDs(); uid != os.Getuid() {
+			t.Errorf("callerIDs() = %d, want the real uid %d", uid, os.Getuid())
+		}
+		return
+	}
+	cmd := asCaller(exec.Command("true"))
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Credential == nil {
+		t.Fatal("asCaller() runs the command as root")
+	}
+	if c := cmd.SysProcAttr.Credential; c.Uid != 12345 || c.Gid != 54321 {
+		t.Errorf("asCaller() credentials = %d:%d, want 12345:54321", c.Uid, c.Gid)
+	}
+}
+
+func TestOpenCallerFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "progress")
+	for i := 0; i < 2; i++ {
+		f, err := openCallerFile(path)
+		if err != nil {
+			t.Fatalf("openCallerFile() = %v", err)
+		}
+		f.WriteString("line\n")
+		f.Close()
+	}
+	if b, _ := ioutil.ReadFile(path); string(b) != "line\nline\n" {
+		t.Errorf("file content = %q, want two appended lines", b)
+	}
+
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := openCallerFile(link); err == nil {
+		f.Close()
+		t.Error("openCallerFile() followed a symlink")
+	}
+}
+
+func TestReadCallerFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(path, []byte("cert"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := readCallerFile(path, syscall.O_NOFOLLOW); err != nil || string(b) != "cert" {
+		t.Errorf("readCallerFile() = %q, %v", b, err)
+	}
+	link := filepath.Join(dir, "link.pem")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readCallerFile(link, syscall.O_NOFOLLOW); err == nil {
+		t.Error("readCallerFile() followed a symlink with O_NOFOLLOW")
+	}
+}
@@ -0,0 +1,106 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"os/exec"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// vsockDevice and virtio9pDevice are the hyperkit device emulations
+	// behind vsock ports and virtio-9p shares
+	vsockDevice    = "virtio-sock"
+	virtio9pDevice = "virtio-9p"
+	// qcowMarker is the OCaml callback hyperkit builds with qcow support
+	// open qcow2 disks through
+	qcowMarker = "mirage_block_open"
+	// qemuBridgedNetdev is the QEMU netdev bridging vmnet to a host
+	// interface
+	qemuBridgedNetdev = "vmnet-bridged"
+)
+
+// Capabilities describes which optional features this build of the driver
+// supports on the current host, so frontends can adapt before hitting
+// unsupported flags at runtime.
+type Capabilities struct {
+	// VSock is support for exposing guest vsock ports
+	VSock bool `json:"vsock"`
+	// Qcow2 is support for qcow2 disk images
+	Qcow2 bool `json:"qcow2"`
+	// VMNet is support for shared vmnet networking, which needs a cgo build
+	VMNet bool `json:"vmnet"`
+	// VMNetBridged is support for bridging vmnet to a host interface
+	VMNetBridged bool `json:"vmnet_bridged"`
+	// Virtio9P is support for virtio-9p file sharing
+	Virtio9P bool `json:"virtio_9p"`
+	// VZ is support for the Virtualization.framework backend. The driver
+	// has no such backend yet, so it is never set.
+	VZ bool `json:"vz"`
+	// QEMU is whether the QEMU fallback backend is installed
+	QEMU bool `json:"qemu"`
+}
+
+// Capabilities returns the optional features supported by the backend, and
+// hyperkit binary, that the driver settings resolve to
+func (d *Driver) Capabilities() Capabilities {
+	c := Capabilities{
+		VMNet: vmnetSupported,
+		QEMU:  qemuInstalled(),
+	}
+	b, err := d.backend()
+	if err != nil {
+		log.Debugf("Unable to resolve the backend: %v", err)
+		return c
+	}
+	switch b.name() {
+	case backendHyperkit:
+		path, err := d.hyperkitBinary()
+		if err != nil {
+			log.Debugf("Unable to find the hyperkit binary: %v", err)
+			return c
+		}
+		c.addHyperkit(path)
+	case backendQEMU:
+		c.VMNetBridged = qemuHasNetdev(qemuBinary, qemuBridgedNetdev)
+	}
+	return c
+}
+
+// addHyperkit sets the features the hyperkit binary at path has compiled in
+func (c *Capabilities) addHyperkit(path string) {
+	has := func(name string) bool {
+		ok, err := hyperkitHasDevice(path, name)
+		return err == nil && ok
+	}
+	c.VSock = has(vsockDevice)
+	c.Qcow2 = has(qcowMarker)
+	c.Virtio9P = has(virtio9pDevice)
+}
+
+// qemuHasNetdev reports whether the QEMU binary lists the netdev name
+func qemuHasNetdev(binary, name string) bool {
+	out, err := exec.Command(binary, "-netdev", "help").Output()
+	if err != nil {
+		return false
+	}
+	return containsString(strings.Fields(string(out)), name)
+}
@@ -0,0 +1,95 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCapabilitiesAddHyperkit(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tests := []struct {
+		name    string
+		content string
+		want    Capabilities
+	}{
+		{"stock", "virtio-net\x00virtio-sock\x00", Capabilities{VSock: true}},
+		{"qcow and 9p", "virtio-sock\x00virtio-9p\x00mirage_block_open\x00", Capabilities{VSock: true, Qcow2: true, Virtio9P: true}},
+		{"name prefix only", "virtio-sockets\x00", Capabilities{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmp, "hyperkit")
+			if err := ioutil.WriteFile(path, []byte(tt.content), 0755); err != nil {
+				t.Fatal(err)
+			}
+			var got Capabilities
+			got.addHyperkit(path)
+			if got != tt.want {
+				t.Errorf("addHyperkit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var got Capabilities
+	got.addHyperkit(filepath.Join(tmp, "missing"))
+	if got != (Capabilities{}) {
+		t.Errorf("addHyperkit() of a missing binary = %+v", got)
+	}
+}
+
+func TestCapabilitiesQEMU(t *testing.T) {
+	d := NewDriver("", "")
+	d.Backend = backendQEMU
+	c := d.Capabilities()
+	if c.VSock || c.Qcow2 || c.Virtio9P {
+		t.Errorf("Capabilities() with QEMU = %+v, want no hyperkit features", c)
+	}
+}
+
+func TestQEMUHasNetdev(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	qemu := filepath.Join(tmp, "qemu")
+	script := "#!/bin/sh\necho 'Available netdev backend types:'\necho socket user vmnet-host vmnet-shared\n"
+	if err := ioutil.WriteFile(qemu, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if !qemuHasNetdev(qemu, "vmnet-shared") {
+		t.Error("qemuHasNetdev() missed vmnet-shared")
+	}
+	if qemuHasNetdev(qemu, qemuBridgedNetdev) {
+		t.Error("qemuHasNetdev() found a netdev QEMU doesn't list")
+	}
+	if qemuHasNetdev(filepath.Join(tmp, "missing"), "vmnet-shared") {
+		t.Error("qemuHasNetdev() of a missing binary succeeded")
+	}
+}
@@ -0,0 +1,181 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/google/uuid"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// cloneSkipFiles are the runtime and identity files of a machine that a
+// clone must not inherit
+var cloneSkipFiles = map[string]bool{
+	machineFileName:         true,
+	pidFileName:             true,
+	qemuPidFileName:         true,
+	consoleFileName:         true,
+	consoleTTYFileName:      true,
+	lastBootConsoleFileName: true,
+	diagnosticsFileName:     true,
+	lockFileName:            true,
+	stopMarkerFileName:      true,
+	supervisorPidFileName:   true,
+	supervisorLogFileName:   true,
+	ephemeralDiskFileName:   true,
+	eventsFileName:          true,
+	metricsFileName:         true,
+	"id_rsa":                true,
+	"id_rsa.pub":            true,
+	"id_ed25519":            true,
+	"id_ed25519.pub":        true,
+	"file-server.pid":       true,
+	"file-server.log":       true,
+	"file-server.json":      true,
+}
+
+// Clone copies the stopped machine d to a new machine called name in the
+// same store. The clone gets its own UUID, and so MAC and IP address, and
+// its own SSH key, which is authorized in the guest on its first start.
+// Its Docker server certificate still names the original machine, so it
+// needs a docker-machine regenerate-certs.
+func (d *Driver) Clone(name string) (*Driver, error) {
+	if err := validateMachineName(name); err != nil {
+		return nil, err
+	}
+	s, err := d.pidState(d.getPid())
+	if err != nil {
+		return nil, err
+	}
+	if s != state.Stopped {
+		return nil, fmt.Errorf("machine %s must be stopped to be cloned", d.MachineName)
+	}
+	if d.EncryptDisk {
+		return nil, fmt.Errorf("machine %s has an encrypted disk, which can't be cloned", d.MachineName)
+	}
+
+	srcDir := d.ResolveStorePath(".")
+	dstDir := filepath.Join(d.StorePath, "machines", name)
+	if _, err := os.Stat(dstDir); err == nil {
+		return nil, fmt.Errorf("machine %s already exists", name)
+	}
+	if err := os.MkdirAll(dstDir, 0700); err != nil {
+		return nil, err
+	}
+	if !d.KeepInBackups {
+		excludeFromBackups(dstDir)
+	}
+
+	srcDisk := pkgdrivers.GetDiskPath(d.BaseDriver)
+	dstDisk := filepath.Join(dstDir, name+".rawdisk")
+	log.Infof("Copying %s to %s", srcDisk, dstDisk)
+	if err := cloneFile(srcDisk, dstDisk, d.DiskIOPriority); err != nil {
+		return nil, fmt.Errorf("copying disk: %w", err)
+	}
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if !f.Mode().IsRegular() || cloneSkipFiles[f.Name()] || strings.HasPrefix(f.Name(), consoleFileName+".") || f.Name() == filepath.Base(srcDisk) {
+			continue
+		}
+		if err := mcnutils.CopyFile(filepath.Join(srcDir, f.Name()), filepath.Join(dstDir, f.Name())); err != nil {
+			return nil, err
+		}
+	}
+
+	// Paths in the config, like the boot files and certificates, move to the
+	// clone's dir
+	b, err := ioutil.ReadFile(filepath.Join(srcDir, hostConfigFileName))
+	if err != nil {
+		return nil, fmt.Errorf("reading machine config: %w", err)
+	}
+	b = bytes.Replace(b, []byte(srcDir+"/"), []byte(dstDir+"/"), -1)
+	host := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &host); err != nil {
+		return nil, fmt.Errorf("decoding machine config: %w", err)
+	}
+	clone := NewDriver(name, d.StorePath)
+	clone.BaseDriver = &drivers.BaseDriver{MachineName: name, StorePath: d.StorePath}
+	if err := json.Unmarshal(host["Driver"], clone); err != nil {
+		return nil, fmt.Errorf("decoding driver config: %w", err)
+	}
+	clone.MachineName = name
+	clone.IPAddress = ""
+	clone.FileServerPort = 0
+	clone.UUID = uuid.New().String()
+	if clone.SSHKeyPath != "" {
+		clone.SSHKeyPath = filepath.Join(dstDir, filepath.Base(clone.SSHKeyPath))
+	}
+	if err := clone.installSSHKey(); err != nil {
+		return nil, fmt.Errorf("generating SSH key: %w", err)
+	}
+	clone.SSHKeyPending = true
+
+	if host["Name"], err = json.Marshal(name); err != nil {
+		return nil, err
+	}
+	if host["Driver"], err = json.Marshal(clone); err != nil {
+		return nil, err
+	}
+	if b, err = json.MarshalIndent(host, "", "    "); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dstDir, hostConfigFileName), b, 0600); err != nil {
+		return nil, err
+	}
+	// Everything was made as root, but belongs to the user like the source
+	if err := chownToCaller(dstDir); err != nil {
+		return nil, err
+	}
+	if files, err = ioutil.ReadDir(dstDir); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if err := chownToCaller(filepath.Join(dstDir, f.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return clone, nil
+}
+
+// cloneFile copies src to dst as an APFS clone where possible, which is
+// instant and doesn't use disk space until either file changes. Otherwise the
+// data is copied at ioPriority.
+func cloneFile(src, dst, ioPriority string) error {
+	if err := exec.Command("/bin/cp", "-c", src, dst).Run(); err == nil {
+		return nil
+	}
+	return pkgdrivers.RunWithIOPriority(ioPriority, func() error {
+		return mcnutils.CopyFile(src, dst)
+	})
+}
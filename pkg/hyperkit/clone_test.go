@@ -0,0 +1,88 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDriver_Clone(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	srcDir := filepath.Join(store, "machines", "dev")
+	if err := os.MkdirAll(srcDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"Name":"dev","DriverName":"hyperkit","Driver":{"MachineName":"dev","IPAddress":"192.168.64.5",` +
+		`"UUID":"c4b6d5a0-0d6e-5d2a-9d3c-3f4c1b2a0e11","BootKernel":"` + srcDir + `/bzimage"},` +
+		`"HostOptions":{"AuthOptions":{"ServerCertPath":"` + srcDir + `/server.pem"}}}`
+	files := map[string]string{
+		hostConfigFileName: config,
+		"dev.rawdisk":      "disk",
+		"bzimage":          "kernel",
+		"server.pem":       "cert",
+		"id_rsa":           "key",
+		consoleFileName:    "console",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(srcDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := LoadDriver(store, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Clone("dev2"); err != nil {
+		t.Fatalf("Clone() error = %v", err)
+	}
+
+	clone, err := LoadDriver(store, "dev2")
+	if err != nil {
+		t.Fatalf("LoadDriver() of clone error = %v", err)
+	}
+	dstDir := filepath.Join(store, "machines", "dev2")
+	if clone.UUID == d.UUID || clone.IPAddress != "" || !clone.SSHKeyPending {
+		t.Errorf("clone identity not reset: %+v", clone)
+	}
+	if clone.BootKernel != filepath.Join(dstDir, "bzimage") {
+		t.Errorf("clone kernel = %q, want it in %s", clone.BootKernel, dstDir)
+	}
+	for _, name := range []string{"dev2.rawdisk", "bzimage", "server.pem"} {
+		if _, err := os.Stat(filepath.Join(dstDir, name)); err != nil {
+			t.Errorf("%s not copied: %v", name, err)
+		}
+	}
+	for _, name := range []string{"dev.rawdisk", consoleFileName} {
+		if _, err := os.Stat(filepath.Join(dstDir, name)); err == nil {
+			t.Errorf("%s copied to the clone", name)
+		}
+	}
+
+	if _, err := d.Clone("dev2"); err == nil {
+		t.Error("Clone() over an existing machine succeeded")
+	}
+}
@@ -0,0 +1,70 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"strings"
+)
+
+// kernelCmdline returns the guest kernel command line: the one of the ISO's
+// bootloader config with the configured Cmdline layered on top, plus the
+// options required by enabled driver features. Options whose key is already
+// set are left alone.
+func (d *Driver) kernelCmdline() string {
+	var extra []string
+	if d.PowerSave {
+		extra = append(extra, powerSaveCmdline)
+	}
+	extra = append(extra, d.ignitionCmdline()...)
+	return appendCmdline(mergeCmdline(d.ISOCmdline, d.Cmdline), extra...)
+}
+
+// mergeCmdline returns base with the options of overrides replacing the
+// ones with the same key, all console= options of base for a console= in
+// overrides for instance
+func mergeCmdline(base, overrides string) string {
+	over := strings.Fields(overrides)
+	var args []string
+	for _, arg := range strings.Fields(base) {
+		if !hasCmdlineKey(over, strings.SplitN(arg, "=", 2)[0]) {
+			args = append(args, arg)
+		}
+	}
+	return strings.Join(append(args, over...), " ")
+}
+
+func appendCmdline(cmdline string, options ...string) string {
+	args := strings.Fields(cmdline)
+	for _, opt := range options {
+		key := strings.SplitN(opt, "=", 2)[0]
+		if !hasCmdlineKey(args, key) {
+			args = append(args, opt)
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+func hasCmdlineKey(args []string, key string) bool {
+	for _, arg := range args {
+		if arg == key || strings.HasPrefix(arg, key+"=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+const (
+	// fPunchHole is F_PUNCHHOLE from <sys/fcntl.h>
+	fPunchHole = 99
+	// compactChunk is the unit zeroes are looked for in, a multiple of the
+	// filesystem block size hole punching needs
+	compactChunk = 1 << 20
+	// guestTrimCommand trims every filesystem on an ahci or virtio disk
+	guestTrimCommand = `for m in $(awk '$1 ~ /^\/dev\/[sv]d/ {print $2}' /proc/mounts); do sudo fstrim -v $m; done`
+)
+
+// fpunchhole is struct fpunchhole from <sys/fcntl.h>
+type fpunchhole struct {
+	flags    uint32
+	reserved uint32
+	offset   int64
+	length   int64
+}
+
+// diskImages returns the root disk and extra disk images of the machine
+func (d *Driver) diskImages() []string {
+	images := []string{pkgdrivers.GetDiskPath(d.BaseDriver)}
+	for _, disk := range d.extraDisks() {
+		images = append(images, d.diskPath(disk))
+	}
+	return images
+}
+
+// allocatedBytes returns the host space a possibly sparse file takes
+func allocatedBytes(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return fi.Size()
+}
+
+// Compact reclaims the host space of disk blocks the guest no longer uses
+// and returns how much it freed. A running machine trims its filesystems,
+// which hyperkit turns into holes in the images, as does qemu with
+// --hyperkit-disk-trim. For a stopped machine the zeroed blocks of the
+// images are punched out on the host instead, which after a trim in the
+// guest is all unused space.
+func (d *Driver) Compact() (int64, error) {
+	unlock, err := d.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	images := d.diskImages()
+	var before int64
+	for _, image := range images {
+		before += allocatedBytes(image)
+	}
+
+	s, err := d.GetState()
+	if err != nil {
+		return 0, err
+	}
+	if s == state.Running {
+		b, err := d.backend()
+		if err != nil {
+			return 0, err
+		}
+		if b.name() == backendQEMU && !d.DiskTrim {
+			return 0, fmt.Errorf("machine %s doesn't pass discards on to its disk images, stop it to compact them, or set DiskTrim=true with the update command and restart it", d.MachineName)
+		}
+		log.Infof("Trimming the filesystems of %s", d.MachineName)
+		out, err := drivers.RunSSHCommandFromDriver(d, guestTrimCommand)
+		if err != nil {
+			return 0, fmt.Errorf("fstrim: %w", err)
+		}
+		log.Debugf("fstrim: %s", out)
+	} else {
+		err := pkgdrivers.RunWithIOPriority(d.DiskIOPriority, func() error {
+			for _, image := range images {
+				log.Infof("Punching out the zeroed blocks of %s", image)
+				if err := punchZeroes(image); err != nil {
+					return fmt.Errorf("compacting %s: %w", image, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var after int64
+	for _, image := range images {
+		after += allocatedBytes(image)
+	}
+	if after > before {
+		return 0, nil
+	}
+	return before - after, nil
+}
+
+// punchZeroes deallocates the chunks of path that only hold zeroes
+func punchZeroes(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offsets, err := zeroChunks(f)
+	if err != nil {
+		return err
+	}
+	for _, off := range offsets {
+		if err := punchHole(f, off, compactChunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zeroChunks returns the offsets of the whole chunks of r that only hold
+// zeroes. A partial last chunk is left out, it isn't block aligned.
+func zeroChunks(r io.Reader) ([]int64, error) {
+	var offsets []int64
+	buf := make([]byte, compactChunk)
+	zero := make([]byte, compactChunk)
+	for off := int64(0); ; off += compactChunk {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return offsets, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == compactChunk && bytes.Equal(buf, zero) {
+			offsets = append(offsets, off)
+		}
+	}
+}
+
+func punchHole(f *os.File, offset, length int64) error {
+	arg := fpunchhole{offset: offset, length: length}
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fPunchHole, uintptr(unsafe.Pointer(&arg)))
+	if errno != 0 {
+		return fmt.Errorf("punching hole at %d: %w", offset, errno)
+	}
+	return nil
+}
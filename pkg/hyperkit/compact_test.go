@@ -0,0 +1,69 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestZeroChunks(t *testing.T) {
+	data := func(chunks ...byte) []byte {
+		var b []byte
+		for _, c := range chunks {
+			b = append(b, bytes.Repeat([]byte{c}, compactChunk)...)
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want []int64
+	}{
+		{"empty", nil, nil},
+		{"all zeroes", data(0, 0), []int64{0, compactChunk}},
+		{"no zeroes", data(1, 2), nil},
+		{"mixed", data(1, 0, 1, 0), []int64{compactChunk, 3 * compactChunk}},
+		{"partial last chunk", append(data(0), 0, 0, 0), []int64{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := zeroChunks(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("zeroChunks() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZeroChunksSingleNonZeroByte(t *testing.T) {
+	b := make([]byte, 2*compactChunk)
+	b[compactChunk+compactChunk/2] = 1
+	got, err := zeroChunks(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zeroChunks() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,207 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// combinedInitrdFileName is the initrd the parts of a multi-part initrd are
+// concatenated into
+const combinedInitrdFileName = "initrd.combined"
+
+// compressionMagics are the headers of the compression formats boot files
+// come in
+var compressionMagics = []struct {
+	name  string
+	magic []byte
+}{
+	{"gzip", []byte{0x1f, 0x8b}},
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// compressionOf returns the compression format of the file starting with
+// header, empty if it isn't compressed
+func compressionOf(header []byte) string {
+	for _, c := range compressionMagics {
+		if bytes.HasPrefix(header, c.magic) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// decompressionToolDirs are where the xz and zstd tools are looked for, the
+// system's and Homebrew's, rather than the PATH root was started with
+var decompressionToolDirs = []string{"/usr/bin", "/opt/homebrew/bin", "/usr/local/bin"}
+
+// fileCompression returns the compression format of the whole file at path,
+// empty if it isn't compressed
+func fileCompression(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	header := make([]byte, 8)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return compressionOf(header[:n]), nil
+}
+
+// checkKernelUncompressed fails for a kernel that is compressed as a whole,
+// which hyperkit's loader can't boot. A bzImage carries its own
+// decompressor and passes.
+func checkKernelUncompressed(path string) error {
+	format, err := fileCompression(path)
+	if err != nil {
+		return err
+	}
+	if format != "" {
+		return fmt.Errorf("kernel %s is %s compressed, which hyperkit can't boot, use --hyperkit-iso-kernel-path to locate a bzImage", path, format)
+	}
+	return nil
+}
+
+// decompressInitrd decompresses the initrd at path in place, for kernels
+// built without support for its compression
+func decompressInitrd(path string) error {
+	format, err := fileCompression(path)
+	if err != nil || format == "" {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	log.Infof("Decompressing %s initrd %s", format, path)
+	tmp := path + ".decompressed"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer out.Close()
+	if err := decompress(format, f, out); err != nil {
+		return fmt.Errorf("decompressing %s: %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// decompressionTool returns the absolute path of the command line tool for
+// format
+func decompressionTool(format string) (string, error) {
+	for _, dir := range decompressionToolDirs {
+		path := filepath.Join(dir, format)
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s is needed to decompress %s files, install it with \"brew install %s\"", format, format, format)
+}
+
+// decompress writes r decompressed from format to w. gzip is handled here,
+// xz and zstd by their command line tools, run as the user who invoked the
+// driver.
+func decompress(format string, r io.Reader, w io.Writer) error {
+	if format == "gzip" {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		_, err = io.Copy(w, zr)
+		return err
+	}
+	tool, err := decompressionTool(format)
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := asCaller(exec.Command(tool, "-dc"))
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s -dc: %w: %s", format, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return nil
+}
+
+// combineInitrds extracts the initrd parts at paths in the ISO and
+// concatenates them, in order, into one initrd in destDir, the way a
+// bootloader loads them
+func combineInitrds(isoPath, destDir string, paths []string) (string, error) {
+	tmpDir, err := ioutil.TempDir(destDir, ".initrd-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	parts, err := isoExtractFiles(isoPath, tmpDir, paths)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(destDir, combinedInitrdFileName)
+	log.Debugf("Combining initrds %v into %s", paths, dest)
+	return dest, concatInitrds(dest, parts)
+}
+
+// concatInitrds writes the files at parts one after the other to dest,
+// padding each to the 4 byte alignment the kernel expects of cpio archives
+func concatInitrds(dest string, parts []string) error {
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	for _, part := range parts {
+		f, err := os.Open(part)
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(out, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if pad := (4 - n%4) % 4; pad > 0 {
+			if _, err := out.Write(make([]byte, pad)); err != nil {
+				return err
+			}
+		}
+	}
+	return out.Close()
+}
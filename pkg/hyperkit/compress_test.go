@@ -0,0 +1,157 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressionOf(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   string
+	}{
+		{[]byte{0x1f, 0x8b, 0x08, 0x00}, "gzip"},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, "xz"},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, "zstd"},
+		// bzImage
+		{[]byte{'M', 'Z', 0xea, 0x07}, ""},
+		{[]byte{0x1f}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := compressionOf(tt.header); got != tt.want {
+			t.Errorf("compressionOf(% x) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestDecompressInitrd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initrd := []byte("070701 not really a cpio archive")
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(initrd)
+	zw.Close()
+	files := map[string][]byte{
+		"initrd.gz":  gz.Bytes(),
+		"initrd.img": initrd,
+	}
+	if tool, err := decompressionTool("xz"); err == nil {
+		cmd := exec.Command(tool, "-c")
+		cmd.Stdin = bytes.NewReader(initrd)
+		xz, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["initrd.xz"] = xz
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := decompressInitrd(path); err != nil {
+			t.Errorf("decompressInitrd(%s) error = %v", name, err)
+			continue
+		}
+		got, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, initrd) {
+			t.Errorf("decompressInitrd(%s) left %q, want %q", name, got, initrd)
+		}
+	}
+}
+
+func TestCheckKernelUncompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kernel := []byte("MZ not really a kernel")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(kernel)
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		content []byte
+		wantErr bool
+	}{
+		{"bzImage", kernel, false},
+		{"vmlinuz.gz", gz.Bytes(), true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkKernelUncompressed(path); (err != nil) != tt.wantErr {
+			t.Errorf("checkKernelUncompressed(%s) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got, _ := ioutil.ReadFile(path); !bytes.Equal(got, tt.content) {
+			t.Errorf("checkKernelUncompressed(%s) changed the kernel", tt.name)
+		}
+	}
+}
+
+func TestConcatInitrds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var parts []string
+	// ucode first, like a bootloader loads them
+	for _, part := range []struct{ name, content string }{{"ucode.img", "ucode"}, {"initrd.img", "initrd!!"}} {
+		path := filepath.Join(dir, part.name)
+		if err := ioutil.WriteFile(path, []byte(part.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, path)
+	}
+
+	dest := filepath.Join(dir, combinedInitrdFileName)
+	if err := concatInitrds(dest, parts); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ucode\x00\x00\x00initrd!!"; string(got) != want {
+		t.Errorf("combined initrd = %q, want %q", got, want)
+	}
+}
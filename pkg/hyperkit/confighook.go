@@ -0,0 +1,85 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/docker/machine/libmachine/log"
+	hyperkit "github.com/moby/hyperkit/go"
+)
+
+// applyConfigHooks passes the assembled hyperkit configuration, as the JSON
+// hyperkit saves in hyperkit.json, through the configured hook program and
+// JSON patch file. Disks are hyperkit.Disk implementations that can't be
+// decoded back, so they are left out of the document and kept as they are.
+// The hook runs as the user, and neither may change the binary the driver
+// runs as root or the files it creates with it.
+func (d *Driver) applyConfigHooks(h *hyperkit.HyperKit) error {
+	if d.ConfigHook == "" && d.ConfigPatch == "" {
+		return nil
+	}
+
+	disks := h.Disks
+	h.Disks = nil
+	doc, err := json.Marshal(h)
+	h.Disks = disks
+	if err != nil {
+		return fmt.Errorf("encoding hyperkit config: %w", err)
+	}
+
+	if d.ConfigHook != "" {
+		log.Debugf("Running hyperkit config hook %s", d.ConfigHook)
+		var stderr bytes.Buffer
+		cmd := asCaller(exec.Command(d.ConfigHook))
+		cmd.Stdin = bytes.NewReader(doc)
+		cmd.Stderr = &stderr
+		if doc, err = cmd.Output(); err != nil {
+			return fmt.Errorf("hyperkit config hook %s: %w: %s", d.ConfigHook, err, bytes.TrimSpace(stderr.Bytes()))
+		}
+	}
+	if d.ConfigPatch != "" {
+		if err := checkCallerCanRead(d.ConfigPatch); err != nil {
+			return fmt.Errorf("reading hyperkit config patch: %w", err)
+		}
+		patch, err := ioutil.ReadFile(d.ConfigPatch)
+		if err != nil {
+			return fmt.Errorf("reading hyperkit config patch: %w", err)
+		}
+		if doc, err = applyJSONPatch(doc, patch); err != nil {
+			return fmt.Errorf("applying hyperkit config patch %s: %w", d.ConfigPatch, err)
+		}
+	}
+
+	patched := hyperkit.HyperKit{}
+	if err := json.Unmarshal(doc, &patched); err != nil {
+		return fmt.Errorf("decoding patched hyperkit config: %w", err)
+	}
+	if patched.HyperKit != h.HyperKit || patched.Argv0 != h.Argv0 || patched.Console != h.Console || patched.StateDir != h.StateDir {
+		return fmt.Errorf("the hyperkit config hook and patch can't change hyperkit, argv0, console or state_dir")
+	}
+	patched.Disks = disks
+	*h = patched
+	log.Debugf("Patched hyperkit config: %s", doc)
+	return nil
+}
@@ -0,0 +1,64 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hyperkit "github.com/moby/hyperkit/go"
+)
+
+func TestApplyConfigHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		patch   string
+		wantErr bool
+	}{
+		{"cpus", `[{"op":"replace","path":"/cpus","value":4}]`, false},
+		{"binary", `[{"op":"replace","path":"/hyperkit","value":"/tmp/evil"}]`, true},
+		{"argv0", `[{"op":"replace","path":"/argv0","value":"sh"}]`, true},
+		{"state_dir", `[{"op":"replace","path":"/state_dir","value":"/etc"}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := filepath.Join(dir, tt.name+".json")
+			if err := ioutil.WriteFile(patch, []byte(tt.patch), 0644); err != nil {
+				t.Fatal(err)
+			}
+			d := &Driver{ConfigPatch: patch}
+			h := &hyperkit.HyperKit{HyperKit: "/usr/local/bin/hyperkit", StateDir: "/store/machines/dev", CPUs: 1}
+			err := d.applyConfigHooks(h)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyConfigHooks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && h.CPUs != 4 {
+				t.Errorf("CPUs = %d, want 4", h.CPUs)
+			}
+		})
+	}
+}
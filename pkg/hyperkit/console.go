@@ -0,0 +1,142 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// consoleFileName is where hyperkit logs the guest console with hyperkit.ConsoleFile
+	consoleFileName         = "console-ring"
+	lastBootConsoleFileName = "last-boot-console.log"
+	consoleTailSize         = 64 * 1024
+)
+
+// bootFailed saves the tail of the guest console and a diagnostics bundle
+// next to the machine and points to them from the returned error, so failures
+// come with kernel output.
+func (d *Driver) bootFailed(err error, mac string) error {
+	var saved []string
+	if path, cerr := d.saveConsoleTail(); cerr != nil {
+		log.Debugf("Unable to save console output: %v", cerr)
+	} else {
+		saved = append(saved, "last console output saved to "+path)
+	}
+	if path, derr := d.writeDiagnostics(mac); derr != nil {
+		log.Debugf("Unable to write diagnostics bundle: %v", derr)
+	} else {
+		saved = append(saved, "diagnostics saved to "+path)
+	}
+	if len(saved) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (%s)", err, strings.Join(saved, ", "))
+}
+
+func (d *Driver) saveConsoleTail() (string, error) {
+	tail, err := readTail(d.ResolveStorePath(consoleFileName), consoleTailSize)
+	if err != nil {
+		return "", err
+	}
+	path := d.ResolveStorePath(lastBootConsoleFileName)
+	if err := writeFileAtomic(path, tail, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readTail returns up to the last n bytes of the file at path, without the
+// NUL padding of hyperkit's ring buffer.
+func readTail(path string, n int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if off := fi.Size() - n; off > 0 {
+		if _, err := f.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Trim(b, "\x00"), nil
+}
+
+// rotateConsoleLog rotates the console log once it outgrew
+// --hyperkit-console-log-max-size. It must only be called while the machine
+// is stopped, hyperkit writes to the open file while it runs.
+func (d *Driver) rotateConsoleLog() {
+	if d.ConsoleMaxSize <= 0 {
+		return
+	}
+	path := d.ResolveStorePath(consoleFileName)
+	rotated, err := rotateLog(path, int64(d.ConsoleMaxSize)*1024*1024, d.ConsoleMaxFiles)
+	if err != nil {
+		log.Warnf("Unable to rotate %s: %v", path, err)
+	} else if rotated {
+		log.Debugf("Rotated %s", path)
+	}
+}
+
+// rotateLog moves path to path.1, path.1 to path.2 and so on, keeping up to
+// keep old logs, if path is at least maxSize
+func rotateLog(path string, maxSize int64, keep int) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if fi.Size() < maxSize {
+		return false, nil
+	}
+
+	old := func(n int) string { return path + "." + strconv.Itoa(n) }
+	if err := os.Remove(old(keep)); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(old(n), old(n+1)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+	}
+
+	if keep > 0 {
+		return true, os.Rename(path, old(1))
+	}
+	return true, os.Remove(path)
+}
@@ -0,0 +1,71 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, consoleFileName)
+	read := func(p string) string {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return "<missing>"
+		}
+		return string(b)
+	}
+
+	for _, content := range []string{"first", "second", "third", "fourth"} {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rotated, err := rotateLog(path, 5, 2)
+		if err != nil || !rotated {
+			t.Fatalf("rotateLog() = %v, %v, want true, nil", rotated, err)
+		}
+	}
+	if got := read(path + ".1"); got != "fourth" {
+		t.Errorf(".1 = %q, want fourth", got)
+	}
+	if got := read(path + ".2"); got != "third" {
+		t.Errorf(".2 = %q, want third", got)
+	}
+	if got := read(path + ".3"); got != "<missing>" {
+		t.Errorf(".3 = %q, want it removed", got)
+	}
+	if got := read(path); got != "<missing>" {
+		t.Errorf("log = %q, want it moved", got)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("tiny"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, err := rotateLog(path, 5, 2); err != nil || rotated {
+		t.Errorf("rotateLog() of a small log = %v, %v, want false, nil", rotated, err)
+	}
+}
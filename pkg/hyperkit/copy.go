@@ -0,0 +1,112 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Push copies the host file or directory src to dst in the guest over SFTP,
+// authenticating with the machine's SSH key
+func (d *Driver) Push(src, dst string) error {
+	return d.sftp("put", src, dst)
+}
+
+// Pull copies the guest file or directory src to dst on the host over SFTP,
+// authenticating with the machine's SSH key
+func (d *Driver) Pull(src, dst string) error {
+	return d.sftp("get", src, dst)
+}
+
+// sftp runs a single put or get with the sftp client in batch mode
+func (d *Driver) sftp(op, src, dst string) error {
+	batch, err := sftpBatch(op, src, dst)
+	if err != nil {
+		return err
+	}
+	host, err := d.GetSSHHostname()
+	if err != nil {
+		return err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("sftp",
+		"-b", "-",
+		"-i", d.GetSSHKeyPath(),
+		"-P", strconv.Itoa(port),
+		"-o", "IdentitiesOnly=yes",
+		"-o", "LogLevel=quiet")
+	cmd.Args = append(cmd.Args, d.SSHHostKeyOptions()...)
+	cmd.Args = append(cmd.Args, fmt.Sprintf("%s@[%s]", d.GetSSHUsername(), host))
+	cmd.Stdin = strings.NewReader(batch)
+	log.Debugf("Running sftp %s %s %s", op, src, dst)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sftp %s %s %s: %w: %s", op, src, dst, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// sftpBatch returns the sftp batch file copying src to dst, recursively so
+// directories are copied too
+func sftpBatch(op, src, dst string) (string, error) {
+	for _, path := range []string{src, dst} {
+		if path == "" || strings.ContainsAny(path, "\n\r") {
+			return "", fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return fmt.Sprintf("%s -r %s %s\n", op, sftpQuote(src), sftpQuote(dst)), nil
+}
+
+// sftpQuote quotes path for sftp, escaping the characters it would
+// otherwise expand as a glob
+func sftpQuote(path string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range path {
+		if strings.ContainsRune(`\"*?[]`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// ParseCopyPath splits a cp argument of the form machine:path, where the
+// machine may be qualified as name@store-path, into the machine and the
+// guest path. Host paths have no machine.
+func ParseCopyPath(arg string) (machine, path string) {
+	i := strings.Index(arg, ":")
+	if i < 0 {
+		return "", arg
+	}
+	name := strings.SplitN(arg[:i], "@", 2)[0]
+	if name == "" || strings.Contains(name, "/") {
+		return "", arg
+	}
+	return arg[:i], arg[i+1:]
+}
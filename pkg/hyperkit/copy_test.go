@@ -0,0 +1,63 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import "testing"
+
+func TestSFTPBatch(t *testing.T) {
+	tests := []struct {
+		op, src, dst string
+		want         string
+		wantErr      bool
+	}{
+		{"put", "/Users/me/app", "/home/docker/app", "put -r \"/Users/me/app\" \"/home/docker/app\"\n", false},
+		{"get", `logs/*.log`, `my "logs"`, "get -r \"logs/\\*.log\" \"my \\\"logs\\\"\"\n", false},
+		{"get", "a\nput /etc/passwd", "b", "", true},
+		{"put", "", "b", "", true},
+	}
+	for _, tt := range tests {
+		got, err := sftpBatch(tt.op, tt.src, tt.dst)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("sftpBatch(%s, %q, %q) error = %v, wantErr %v", tt.op, tt.src, tt.dst, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("sftpBatch(%s, %q, %q) = %q, want %q", tt.op, tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestParseCopyPath(t *testing.T) {
+	tests := []struct {
+		arg, machine, path string
+	}{
+		{"dev:/etc/hosts", "dev", "/etc/hosts"},
+		{"dev@/store:logs", "dev@/store", "logs"},
+		{"dev:", "dev", ""},
+		{"/Users/me/a:b", "", "/Users/me/a:b"},
+		{"./a:b", "", "./a:b"},
+		{":foo", "", ":foo"},
+		{"notes.txt", "", "notes.txt"},
+	}
+	for _, tt := range tests {
+		if machine, path := ParseCopyPath(tt.arg); machine != tt.machine || path != tt.path {
+			t.Errorf("ParseCopyPath(%q) = %q, %q, want %q, %q", tt.arg, machine, path, tt.machine, tt.path)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultsFileNames are the files in the store that can hold team defaults
+// for the create flags, in order of preference. Keys are flag names, with
+// or without the hyperkit- prefix:
+//
+//	memory-size: 4096
+//	cpu-count: 4
+//	nfs-flags: noacl,async,nolock
+//	profiles:
+//	  ci:
+//	    cpu-count: 8
+//	    memory-size: 16384
+//
+// Named profiles bundle flags selected with --hyperkit-profile, and take
+// precedence over the top level defaults.
+var defaultsFileNames = []string{"hyperkit.defaults.yaml", "hyperkit.defaults.yml", "hyperkit.defaults.json"}
+
+const profileFlag = "hyperkit-profile"
+
+// defaultsProfilesKey holds the named profiles in the defaults file
+const defaultsProfilesKey = "profiles"
+
+// loadDefaults reads the defaults file of the store with profile, or the
+// profile it defaults to, expanded, and checks its keys and values against
+// flags. It returns no defaults if there is no file.
+func loadDefaults(storePath string, flags []mcnflag.Flag, profile string) (map[string]interface{}, error) {
+	for _, name := range defaultsFileNames {
+		path := filepath.Join(storePath, name)
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw := map[string]interface{}{}
+		if filepath.Ext(path) == ".json" {
+			err = json.Unmarshal(b, &raw)
+		} else {
+			err = yaml.Unmarshal(b, &raw)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		profiles, ok := raw[defaultsProfilesKey].(map[string]interface{})
+		if _, present := raw[defaultsProfilesKey]; present && !ok {
+			return nil, fmt.Errorf("%s: %s must map profile names to flags", path, defaultsProfilesKey)
+		}
+		delete(raw, defaultsProfilesKey)
+		defaults, err := parseDefaults(raw, flags)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		log.Debugf("Using the flag defaults of %s", path)
+
+		if profile == "" {
+			profile, _ = defaults[profileFlag].(string)
+		}
+		if profile == "" {
+			return defaults, nil
+		}
+		settings, ok := profiles[profile].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no profile %s in %s, it has %s", profile, path, strings.Join(profileNames(profiles), ", "))
+		}
+		overrides, err := parseDefaults(settings, flags)
+		if err != nil {
+			return nil, fmt.Errorf("%s: profile %s: %w", path, profile, err)
+		}
+		if _, ok := overrides[profileFlag]; ok {
+			return nil, fmt.Errorf("%s: profile %s can't select another profile", path, profile)
+		}
+		for name, v := range overrides {
+			defaults[name] = v
+		}
+		defaults[profileFlag] = profile
+		return defaults, nil
+	}
+	if profile != "" {
+		return nil, fmt.Errorf("no profile %s, there is no %s in %s", profile, defaultsFileNames[0], storePath)
+	}
+	return nil, nil
+}
+
+func profileNames(profiles map[string]interface{}) []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseDefaults maps the keys of a decoded defaults file to flag names, and
+// converts the values to the types of the flags
+func parseDefaults(raw map[string]interface{}, flags []mcnflag.Flag) (map[string]interface{}, error) {
+	byName := map[string]mcnflag.Flag{}
+	for _, f := range flags {
+		byName[f.String()] = f
+	}
+	defaults := map[string]interface{}{}
+	for key, value := range raw {
+		name := key
+		if !strings.HasPrefix(name, "hyperkit-") {
+			name = "hyperkit-" + name
+		}
+		f, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown flag %s", key)
+		}
+		v, err := convertDefault(f, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		defaults[name] = v
+	}
+	return defaults, nil
+}
+
+func convertDefault(f mcnflag.Flag, value interface{}) (interface{}, error) {
+	switch f.(type) {
+	case mcnflag.StringFlag:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case int, float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	case mcnflag.IntFlag:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case float64:
+			if v == float64(int(v)) {
+				return int(v), nil
+			}
+		}
+	case mcnflag.BoolFlag:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case mcnflag.StringSliceFlag:
+		switch v := value.(type) {
+		case string:
+			return []string{v}, nil
+		case []interface{}:
+			s := make([]string, 0, len(v))
+			for _, item := range v {
+				str, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("list items must be strings, not %v", item)
+				}
+				s = append(s, str)
+			}
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %v for a %T", value, f)
+}
+
+// defaultsOptions layers the defaults file beneath the flags given to
+// create. docker-machine doesn't tell which flags were given, so a flag
+// still at its default takes the defaults file value. This also means a
+// boolean defaulted to true can't be turned off on the command line.
+type defaultsOptions struct {
+	// flags are the create flags, or nil to use the defaults only
+	flags        drivers.DriverOptions
+	defaults     map[string]interface{}
+	flagDefaults map[string]interface{}
+}
+
+// withDefaults returns flags with the defaults file of the store beneath them
+func (d *Driver) withDefaults(flags drivers.DriverOptions) (drivers.DriverOptions, error) {
+	// Without flags, the profile is the one of the machine settings
+	profile := d.Profile
+	if flags != nil {
+		profile = flags.String(profileFlag)
+	}
+	var defaults map[string]interface{}
+	if d.BaseDriver != nil && d.StorePath != "" {
+		var err error
+		if defaults, err = loadDefaults(d.StorePath, d.GetCreateFlags(), profile); err != nil {
+			return nil, err
+		}
+	}
+	if flags != nil && len(defaults) == 0 {
+		return flags, nil
+	}
+	o := defaultsOptions{flags: flags, defaults: defaults, flagDefaults: map[string]interface{}{}}
+	for _, f := range d.GetCreateFlags() {
+		o.flagDefaults[f.String()] = f.Default()
+	}
+	return o, nil
+}
+
+// value returns the value of a flag: given if it was set on the command
+// line, otherwise the defaults file value or the flag default
+func (o defaultsOptions) value(key string, given interface{}, isDefault bool) interface{} {
+	if o.flags != nil && !isDefault {
+		return given
+	}
+	if v, ok := o.defaults[key]; ok {
+		return v
+	}
+	if o.flags != nil {
+		return given
+	}
+	return o.flagDefaults[key]
+}
+
+func (o defaultsOptions) String(key string) string {
+	var given string
+	if o.flags != nil {
+		given = o.flags.String(key)
+	}
+	def, _ := o.flagDefaults[key].(string)
+	v, _ := o.value(key, given, given == def).(string)
+	return v
+}
+
+func (o defaultsOptions) StringSlice(key string) []string {
+	var given []string
+	if o.flags != nil {
+		given = o.flags.StringSlice(key)
+	}
+	def, _ := o.flagDefaults[key].([]string)
+	v, _ := o.value(key, given, len(given) == 0 || reflect.DeepEqual(given, def)).([]string)
+	return v
+}
+
+func (o defaultsOptions) Int(key string) int {
+	var given int
+	if o.flags != nil {
+		given = o.flags.Int(key)
+	}
+	def, _ := o.flagDefaults[key].(int)
+	v, _ := o.value(key, given, given == def).(int)
+	return v
+}
+
+// Bool flags always default to false
+func (o defaultsOptions) Bool(key string) bool {
+	var given bool
+	if o.flags != nil {
+		given = o.flags.Bool(key)
+	}
+	v, _ := o.value(key, given, !given).(bool)
+	return v
+}
@@ -0,0 +1,171 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+// testOptions are create flags as docker-machine passes them: the given
+// ones, and the flag defaults for the rest
+type testOptions map[string]interface{}
+
+func (o testOptions) get(key string) interface{} {
+	if v, ok := o[key]; ok {
+		return v
+	}
+	for _, f := range NewDriver("", "").GetCreateFlags() {
+		if f.String() == key {
+			return f.Default()
+		}
+	}
+	return nil
+}
+
+func (o testOptions) String(key string) string        { v, _ := o.get(key).(string); return v }
+func (o testOptions) StringSlice(key string) []string { v, _ := o.get(key).([]string); return v }
+func (o testOptions) Int(key string) int              { v, _ := o.get(key).(int); return v }
+func (o testOptions) Bool(key string) bool            { v, _ := o.get(key).(bool); return v }
+
+func TestParseDefaults(t *testing.T) {
+	flags := NewDriver("", "").GetCreateFlags()
+	got, err := parseDefaults(map[string]interface{}{
+		"memory-size":          4096.0,
+		"hyperkit-nfs-flags":   "noacl",
+		"nfs-shares":           []interface{}{"/Users"},
+		"stable-hostname":      true,
+		"hyperkit-cpu-count":   4,
+		"hyperkit-vpnkit-sock": "auto",
+	}, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"hyperkit-memory-size":     4096,
+		"hyperkit-nfs-flags":       "noacl",
+		"hyperkit-nfs-shares":      []string{"/Users"},
+		"hyperkit-stable-hostname": true,
+		"hyperkit-cpu-count":       4,
+		"hyperkit-vpnkit-sock":     "auto",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDefaults() = %v, want %v", got, want)
+	}
+
+	for _, raw := range []map[string]interface{}{
+		{"memory": 4096},
+		{"memory-size": 1.5},
+		{"memory-size": "lots"},
+		{"stable-hostname": "yes"},
+		{"nfs-shares": []interface{}{1}},
+	} {
+		if _, err := parseDefaults(raw, flags); err == nil {
+			t.Errorf("parseDefaults(%v) accepted", raw)
+		}
+	}
+}
+
+func TestSetConfigFromFlagsDefaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defaults := "# team defaults\nmemory-size: 4096\ncpu-count: 2\nnfs-flags: noacl,nolock\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "hyperkit.defaults.yaml"), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDriver("test", dir)
+	d.BaseDriver = &drivers.BaseDriver{MachineName: "test", StorePath: dir}
+	if err := d.SetConfigFromFlags(testOptions{"hyperkit-cpu-count": 8}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Memory != 4096 || d.CPU != 8 || d.NFSFlags != "noacl,nolock" {
+		t.Errorf("got memory %d, cpus %d, NFS flags %s, want 4096, 8 and noacl,nolock", d.Memory, d.CPU, d.NFSFlags)
+	}
+
+	// A fixed backend keeps the plan from looking for a hyperkit binary
+	p, err := PlanMachine(dir, "planned", map[string]interface{}{"CPU": 3, "Backend": backendHyperkit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Memory != 4096 || p.CPUs != 3 {
+		t.Errorf("got plan memory %d and cpus %d, want 4096 and 3", p.Memory, p.CPUs)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defaults := `{
+		"memory-size": 2048,
+		"cpu-count": 2,
+		"profiles": {
+			"small": {"memory-size": 1024, "cpu-count": 1},
+			"ci": {"memory-size": 8192, "cpu-count": 4, "disk-size": 60000}
+		}
+	}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "hyperkit.defaults.json"), []byte(defaults), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newTestDriver := func() *Driver {
+		d := NewDriver("test", dir)
+		d.BaseDriver = &drivers.BaseDriver{MachineName: "test", StorePath: dir}
+		return d
+	}
+
+	d := newTestDriver()
+	if err := d.SetConfigFromFlags(testOptions{profileFlag: "ci", "hyperkit-cpu-count": 6}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Profile != "ci" || d.Memory != 8192 || d.CPU != 6 || d.DiskSize != 60000 {
+		t.Errorf("got profile %s, memory %d, cpus %d, disk %d, want ci, 8192, 6 and 60000", d.Profile, d.Memory, d.CPU, d.DiskSize)
+	}
+
+	d = newTestDriver()
+	if err := d.SetConfigFromFlags(testOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if d.Profile != "" || d.Memory != 2048 {
+		t.Errorf("got profile %q and memory %d without a profile, want none and 2048", d.Profile, d.Memory)
+	}
+
+	if err := newTestDriver().SetConfigFromFlags(testOptions{profileFlag: "bigmem"}); err == nil || !strings.Contains(err.Error(), "ci, small") {
+		t.Errorf("unknown profile error = %v, want it to list ci, small", err)
+	}
+
+	p, err := PlanMachine(dir, "planned", map[string]interface{}{"Profile": "small", "Backend": backendHyperkit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Memory != 1024 || p.CPUs != 1 {
+		t.Errorf("got plan memory %d and cpus %d, want 1024 and 1", p.Memory, p.CPUs)
+	}
+}
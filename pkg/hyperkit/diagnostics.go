@@ -0,0 +1,143 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	diagnosticsFileName = "diagnostics.tar.gz"
+	// diagnosticsLeases is how many dhcp leases are included when none
+	// matches the machine
+	diagnosticsLeases = 5
+)
+
+// writeDiagnostics bundles the console tail, the hyperkit command line, the
+// relevant dhcp leases and the machine config into a tar.gz in the machine
+// dir, for attaching to bug reports about failed starts.
+func (d *Driver) writeDiagnostics(mac string) (string, error) {
+	files := map[string][]byte{}
+	if tail, err := readTail(d.ResolveStorePath(consoleFileName), consoleTailSize); err == nil {
+		files["console.log"] = tail
+	}
+	if b, err := ioutil.ReadFile(d.ResolveStorePath(machineFileName)); err == nil {
+		files[machineFileName] = b
+		if cmd, err := renderCommandLine(b); err == nil {
+			files["hyperkit-command.txt"] = []byte(cmd)
+		}
+	}
+	if b, err := ioutil.ReadFile(d.ResolveStorePath(commandFileName)); err == nil {
+		files[commandFileName] = b
+	}
+	if b, err := ioutil.ReadFile(d.ResolveStorePath(hostConfigFileName)); err == nil {
+		files[hostConfigFileName] = b
+	}
+	files["dhcpd_leases.txt"] = []byte(leasesExcerpt(d.leasesPath(), mac))
+	var attempts strings.Builder
+	for _, a := range d.ipAttempts {
+		fmt.Fprintln(&attempts, a)
+	}
+	files["ip-discovery.txt"] = []byte(attempts.String())
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, b := range files {
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(b)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return "", err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gw.Close(); err != nil {
+		return "", err
+	}
+	path := d.ResolveStorePath(diagnosticsFileName)
+	return path, writeFileAtomic(path, buf.Bytes(), 0644)
+}
+
+// renderCommandLine returns the hyperkit invocation recorded in hyperkit.json
+func renderCommandLine(machineJSON []byte) (string, error) {
+	ms := struct {
+		HyperKit  string   `json:"hyperkit"`
+		Arguments []string `json:"arguments"`
+		CmdLine   string   `json:"cmdline"`
+	}{}
+	if err := json.Unmarshal(machineJSON, &ms); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s\nkernel cmdline: %s\n", ms.HyperKit, strings.Join(ms.Arguments, " "), ms.CmdLine), nil
+}
+
+// leasesExcerpt returns the dhcp leases for mac, or the last few leases if
+// there are none.
+func leasesExcerpt(path, mac string) string {
+	if err := checkLeasesPath(path); err != nil {
+		return fmt.Sprintf("unable to read %s: %v\n", path, err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("unable to read %s: %v\n", path, err)
+	}
+	defer f.Close()
+
+	entries, err := parseDHCPdLeasesFile(f)
+	if err != nil {
+		return fmt.Sprintf("unable to parse %s: %v\n", path, err)
+	}
+	var matching []DHCPEntry
+	for _, e := range entries {
+		if e.HWAddress == mac {
+			matching = append(matching, e)
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d leases in %s, %d for %s\n", len(entries), path, len(matching), mac)
+	if len(matching) == 0 && len(entries) > 0 {
+		start := len(entries) - diagnosticsLeases
+		if start < 0 {
+			start = 0
+		}
+		matching = entries[start:]
+	}
+	for _, e := range matching {
+		fmt.Fprintf(&buf, "%+v\n", e)
+	}
+	return buf.String()
+}
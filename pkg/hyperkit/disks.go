@@ -0,0 +1,239 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// guestBootSync runs at every boot2docker boot before docker starts
+	guestBootSync = "/var/lib/boot2docker/bootsync.sh"
+	// guestDockerRoot is where dockerd keeps images and volumes
+	guestDockerRoot = "/var/lib/docker"
+	// dataDiskName is the extra disk mounted at guestDockerRoot
+	dataDiskName = "data"
+	diskMarker   = "# docker-machine-driver-hyperkit disk"
+)
+
+var (
+	// diskNameRegexp keeps disk names usable as file names and filesystem
+	// labels
+	diskNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,15}$`)
+	fsTypeRegexp   = regexp.MustCompile(`^[a-z0-9]+$`)
+)
+
+// extraDisk is a disk attached after the root disk. Disks with a filesystem
+// are formatted and mounted by the driver, the others are left raw.
+type extraDisk struct {
+	name  string
+	size  int
+	fs    string
+	mount string
+}
+
+// parseExtraDisk parses a name:size[:fs:mountpoint] disk with the size in MB
+func parseExtraDisk(spec string) (extraDisk, error) {
+	var disk extraDisk
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 && len(parts) != 4 {
+		return disk, fmt.Errorf("extra disk %q is not of the form name:size[:fs:mountpoint]", spec)
+	}
+	disk.name = parts[0]
+	if !diskNameRegexp.MatchString(disk.name) {
+		return disk, fmt.Errorf("extra disk %q: name must be up to 16 lower case letters, digits and dashes", spec)
+	}
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size <= 0 {
+		return disk, fmt.Errorf("extra disk %q: invalid size %q in MB", spec, parts[1])
+	}
+	disk.size = size
+	if len(parts) == 4 {
+		disk.fs, disk.mount = parts[2], parts[3]
+		if !fsTypeRegexp.MatchString(disk.fs) {
+			return disk, fmt.Errorf("extra disk %q: invalid filesystem %q", spec, disk.fs)
+		}
+		if !path.IsAbs(disk.mount) || strings.ContainsAny(disk.mount, " '\"\\$") {
+			return disk, fmt.Errorf("extra disk %q: mount point must be an absolute path without spaces or quotes", spec)
+		}
+	}
+	return disk, nil
+}
+
+// extraDisks returns the disks to attach after the root disk, in order: the
+// data disk, then the user's extra disks
+func (d *Driver) extraDisks() []extraDisk {
+	var disks []extraDisk
+	if d.DataDisk > 0 {
+		disks = append(disks, extraDisk{name: dataDiskName, size: d.DataDisk, fs: "ext4", mount: guestDockerRoot})
+	}
+	for _, spec := range d.ExtraDisks {
+		// validateExtraDisks rejected invalid ones
+		if disk, err := parseExtraDisk(spec); err == nil {
+			disks = append(disks, disk)
+		}
+	}
+	return disks
+}
+
+// validateExtraDisks checks the extra disks and that their names are unique
+func (d *Driver) validateExtraDisks() error {
+	names := map[string]bool{}
+	if d.DataDisk > 0 {
+		names[dataDiskName] = true
+	}
+	for _, spec := range d.ExtraDisks {
+		disk, err := parseExtraDisk(spec)
+		if err != nil {
+			return err
+		}
+		if names[disk.name] {
+			return fmt.Errorf("extra disk %q: there already is a disk called %s", spec, disk.name)
+		}
+		names[disk.name] = true
+	}
+	return nil
+}
+
+// formatsDisks reports whether any extra disk is formatted by the driver
+func (d *Driver) formatsDisks() bool {
+	for _, disk := range d.extraDisks() {
+		if disk.fs != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// diskPath returns the image of an extra disk in the machine dir
+func (d *Driver) diskPath(disk extraDisk) string {
+	return d.ResolveStorePath("disk-" + disk.name + ".rawdisk")
+}
+
+// Guest block device prefixes: hyperkit attaches the disks as ahci-hd, qemu
+// as virtio
+const (
+	ahciDevicePrefix   = "/dev/sd"
+	virtioDevicePrefix = "/dev/vd"
+)
+
+// guestDevicePrefix returns the prefix of the guest block devices the disks
+// show up as
+func (d *Driver) guestDevicePrefix() (string, error) {
+	b, err := d.backend()
+	if err != nil {
+		return "", err
+	}
+	if b.name() == backendQEMU {
+		return virtioDevicePrefix, nil
+	}
+	return ahciDevicePrefix, nil
+}
+
+// guestDevice is the block device of the i-th extra disk, the root disk
+// being the first one with prefix
+func guestDevice(prefix string, i int) string {
+	return fmt.Sprintf("%s%c", prefix, 'b'+i)
+}
+
+// createExtraDisks creates sparse images for the extra disks that don't
+// have one yet
+func (d *Driver) createExtraDisks() error {
+	for _, disk := range d.extraDisks() {
+		path := d.diskPath(disk)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		log.Infof("Creating %d MB disk %s", disk.size, path)
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		err = f.Truncate(int64(disk.size) * 1000000)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("creating disk %s: %w", disk.name, err)
+		}
+	}
+	return nil
+}
+
+// removeExtraDisks deletes the images of the extra disks
+func (d *Driver) removeExtraDisks() {
+	for _, disk := range d.extraDisks() {
+		if err := os.Remove(d.diskPath(disk)); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to remove %s: %v", d.diskPath(disk), err)
+		}
+	}
+}
+
+// diskScript returns the shell script that formats the extra disks that
+// have no filesystem yet, mounts them and makes them mount on every boot:
+// from bootsync.sh on boot2docker, which runs before docker starts, and
+// from fstab elsewhere. Docker is restarted around mounting its own dir.
+func diskScript(osID, devPrefix string, disks []extraDisk) string {
+	var s strings.Builder
+	s.WriteString("set -e\nsvc() { systemctl $1 docker 2>/dev/null || /etc/init.d/docker $1; }\n")
+	for i, disk := range disks {
+		if disk.fs == "" {
+			continue
+		}
+		dev := guestDevice(devPrefix, i)
+		mount := fmt.Sprintf("grep -qs '^%[1]s ' /proc/mounts || { mkdir -p %[2]s && mount %[1]s %[2]s; }", dev, disk.mount)
+		marker := diskMarker + " " + disk.name
+		fmt.Fprintf(&s, "blkid %[1]s >/dev/null 2>&1 || mkfs.%[2]s -q -L %[3]s %[1]s\n", dev, disk.fs, disk.name)
+		if osID == "boot2docker" {
+			fmt.Fprintf(&s, "grep -qsF '%[1]s' %[2]s || echo \"%[3]s %[1]s\" >> %[2]s\nchmod +x %[2]s\n", marker, guestBootSync, mount)
+		} else {
+			fmt.Fprintf(&s, "grep -qsF '%[1]s' /etc/fstab || printf '%%s\\n' '%[1]s' '%[2]s %[3]s %[4]s defaults,nofail 0 2' >> /etc/fstab\n", marker, dev, disk.mount, disk.fs)
+		}
+		if disk.mount == guestDockerRoot {
+			fmt.Fprintf(&s, "grep -qs '^%[1]s ' /proc/mounts || { svc stop; %[2]s; svc start; }\n", dev, mount)
+		} else {
+			s.WriteString(mount + "\n")
+		}
+	}
+	return s.String()
+}
+
+// setupExtraDisks formats and mounts the extra disks in the guest
+func (d *Driver) setupExtraDisks() error {
+	disks := d.extraDisks()
+	if !d.formatsDisks() {
+		return nil
+	}
+	prefix, err := d.guestDevicePrefix()
+	if err != nil {
+		return err
+	}
+	id, err := d.guestOSID()
+	if err != nil {
+		return fmt.Errorf("detecting the guest OS: %w", err)
+	}
+	return d.runSSHWithStdin("sudo sh", strings.NewReader(diskScript(id, prefix, disks)))
+}
@@ -0,0 +1,99 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiskScript(t *testing.T) {
+	disks := []extraDisk{{name: dataDiskName, size: 20000, fs: "ext4", mount: guestDockerRoot}}
+
+	b2d := diskScript("boot2docker", virtioDevicePrefix, disks)
+	for _, want := range []string{
+		"blkid /dev/vdb >/dev/null 2>&1 || mkfs.ext4 -q -L data /dev/vdb\n",
+		guestBootSync,
+		"svc stop; grep -qs '^/dev/vdb ' /proc/mounts || { mkdir -p /var/lib/docker && mount /dev/vdb /var/lib/docker; }; svc start",
+	} {
+		if !strings.Contains(b2d, want) {
+			t.Errorf("boot2docker script doesn't contain %q:\n%s", want, b2d)
+		}
+	}
+	if strings.Contains(b2d, "/etc/fstab") {
+		t.Errorf("boot2docker script uses fstab:\n%s", b2d)
+	}
+
+	other := diskScript("fedora", virtioDevicePrefix, disks)
+	if want := "'" + diskMarker + " data' '/dev/vdb /var/lib/docker ext4 defaults,nofail 0 2' >> /etc/fstab"; !strings.Contains(other, want) {
+		t.Errorf("script doesn't contain %q:\n%s", want, other)
+	}
+}
+
+func TestParseExtraDisk(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    extraDisk
+		wantErr bool
+	}{
+		{"scratch:10000", extraDisk{name: "scratch", size: 10000}, false},
+		{"cache:5000:ext4:/mnt/cache", extraDisk{name: "cache", size: 5000, fs: "ext4", mount: "/mnt/cache"}, false},
+		{"cache:5000:ext4", extraDisk{}, true},
+		{"Cache:5000", extraDisk{}, true},
+		{"a-very-long-disk-name:5000", extraDisk{}, true},
+		{"cache:0", extraDisk{}, true},
+		{"cache:5000:ext4:mnt", extraDisk{}, true},
+		{"cache:5000:ext4:/mnt/my cache", extraDisk{}, true},
+		{"cache:5000:ext4;rm:/mnt", extraDisk{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseExtraDisk(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseExtraDisk(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseExtraDisk(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestValidateExtraDisks(t *testing.T) {
+	d := &Driver{DataDisk: 1000, ExtraDisks: []string{"data:1000"}}
+	if err := d.validateExtraDisks(); err == nil {
+		t.Error("extra disk named like the data disk accepted")
+	}
+	d = &Driver{ExtraDisks: []string{"raw:1000", "cache:1000:ext4:/mnt/cache"}}
+	if err := d.validateExtraDisks(); err != nil {
+		t.Fatal(err)
+	}
+	script := diskScript("boot2docker", ahciDevicePrefix, d.extraDisks())
+	if strings.Contains(script, "/dev/sdb") || !strings.Contains(script, "mount /dev/sdc /mnt/cache") {
+		t.Errorf("raw disk not skipped or cache disk not mounted:\n%s", script)
+	}
+}
+
+func TestGuestDevice(t *testing.T) {
+	if got := guestDevice(virtioDevicePrefix, 0); got != "/dev/vdb" {
+		t.Errorf("guestDevice(virtio, 0) = %s, want /dev/vdb", got)
+	}
+	if got := guestDevice(ahciDevicePrefix, 2); got != "/dev/sdd" {
+		t.Errorf("guestDevice(ahci, 2) = %s, want /dev/sdd", got)
+	}
+}
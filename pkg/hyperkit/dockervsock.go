@@ -0,0 +1,64 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/state"
+)
+
+// dockerSocketFileName is the docker socket in the machine dir with
+// --hyperkit-docker-vsock
+const dockerSocketFileName = "docker.sock"
+
+// dockerSocket returns the unix socket that reaches the guest docker daemon
+// over vsock, through the guest agent
+func (d *Driver) dockerSocket() string {
+	return d.ResolveStorePath(dockerSocketFileName)
+}
+
+// DockerSocketURL returns the unix:// URL of the docker socket served over
+// vsock. GetURL keeps returning the TLS endpoint docker-machine provisioned,
+// so this is for DOCKER_HOST set by hand
+func (d *Driver) DockerSocketURL() (string, error) {
+	if !d.DockerVSock {
+		return "", errors.New("the machine was created without --hyperkit-docker-vsock")
+	}
+	s, err := d.GetState()
+	if err != nil {
+		return "", err
+	}
+	if s != state.Running {
+		return "", errors.New("the machine is not running")
+	}
+	return "unix://" + d.dockerSocket(), nil
+}
+
+// linkDockerSocket points docker.sock at the socket hyperkit forwards to the
+// agent's docker port, so the URL doesn't depend on hyperkit's naming
+func (d *Driver) linkDockerSocket() error {
+	link := d.dockerSocket()
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(filepath.Base(d.guestVSockSocket(guestDockerPort)), link)
+}
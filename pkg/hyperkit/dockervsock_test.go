@@ -0,0 +1,63 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestLinkDockerSocket(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	d := &Driver{BaseDriver: &drivers.BaseDriver{StorePath: store, MachineName: "test"}}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := d.linkDockerSocket(); err != nil {
+			t.Fatalf("linkDockerSocket() = %v", err)
+		}
+	}
+	target, err := os.Readlink(d.dockerSocket())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "00000003.0000cb22"; target != want {
+		t.Errorf("docker.sock points at %s, want %s", target, want)
+	}
+}
+
+func TestGuestAgentInstallCommand(t *testing.T) {
+	d := &Driver{}
+	if cmd := d.guestAgentInstallCommand(); strings.Contains(cmd, "-docker-port") {
+		t.Errorf("docker port forwarded without --hyperkit-docker-vsock: %s", cmd)
+	}
+	d.DockerVSock = true
+	if cmd := d.guestAgentInstallCommand(); !strings.Contains(cmd, "-docker-port 52002") {
+		t.Errorf("docker port not forwarded: %s", cmd)
+	}
+}
@@ -19,9 +19,13 @@ limitations under the License.
 package hyperkit
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/user"
 	"path"
@@ -38,7 +42,6 @@ import (
 	"github.com/google/uuid"
 	"github.com/johanneswuerbach/nfsexports"
 	ps "github.com/mitchellh/go-ps"
-	hyperkit "github.com/moby/hyperkit/go"
 	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
 )
 
@@ -54,8 +57,20 @@ const (
 	defaultDiskSize = 20000
 	defaultMemory   = 1024
 	defaultSSHUser  = "docker"
+	defaultSSHPort  = 22
 	defaultNFSFlags = "noacl,async"
 	defaultNFSRoot  = "/mnt"
+
+	defaultShutdownTimeout = 30
+	defaultStopTimeout     = 5
+	defaultKillTimeout     = 5
+	defaultIPTimeout       = 60
+	defaultIPPollInterval  = 2
+	maxIPPollInterval      = 10 * time.Second
+	defaultWaitTimeout     = 120
+
+	defaultConsoleLogMaxSize = 10
+	defaultConsoleLogFiles   = 3
 )
 
 // Driver is the machine driver for Hyperkit
@@ -72,17 +87,124 @@ type Driver struct {
 	NFSShares      []string
 	NFSSharesRoot  string
 	NFSFlags       string
+	NFSHostIP      string
+	NFSInterface   string
 	UUID           string
 	VpnKitSock     string
 	VSockPorts     []string
+	VSockBridges   []string
+	DockerVSock    bool
+	SSHOverVSock   bool
+	VSockSSHPort   int
+	StableHostname bool
+	MDNS           bool
+	HTTPProxy      string
+	HTTPSProxy     string
+	NoProxy        string
+	CACerts        []string
+	AttachISOs     []string
+	Autostart      bool
+	SudoHelper     bool
+	Profile        string
+	SoftRestart    bool
+	SSHKey         string
+	SSHKeyType     string
+	Events         string
+	KeepInBackups  bool
+	EncryptDisk    bool
+	ShareBackend   string
+	FileServerPort int
+
+	ShutdownTimeout int
+	StopTimeout     int
+	KillTimeout     int
+	IPTimeout       int
+	IPPollInterval  int
+	IPDiscovery     []string
+	Wait            string
+	WaitTimeout     int
+	Supervised      bool
+	DiskIOPriority  string
+	DisableACPI     bool
+	HaltExit        bool
+	PauseExit       bool
+	PowerSave       bool
+	WiredMemory     bool
+	Backend         string
+	ConfigHook      string
+	ConfigPatch     string
+	SSHKeyPending   bool
+	LeasesPath      string
+	PreferIPv6      bool
+	IPv6Address     string
+	MTU             int
+	TimeSync        bool
+	ProgressFile    string
+	HyperkitBinary  string
+	HyperkitVersion string
+	ExtraArgs       []string
+	ConsoleMaxSize  int
+	ConsoleMaxFiles int
+	GuestAgent      bool
+	GuestAgentPath  string
+	AgentInstalled  bool
+	Balloon         bool
+	NoVirtioRNG     bool
+	// RNGUnsupported is set once the guest turned out to have no
+	// virtio-rng driver
+	RNGUnsupported  bool
+	IgnitionConfig  string
+	IgnitionApplied bool
+	ISOKernelPath   string
+	ISOInitrdPath   string
+	ISOChecksum     string
+	ISOCmdline      string
+	KernelURL       string
+	KernelChecksum  string
+	InitrdURL       string
+	InitrdChecksum  string
+	ProvisionScript string
+	ProvisionAlways bool
+	Provisioned     bool
+	Hooks           []string
+	DataDisk        int
+	ExtraDisks      []string
+	DiskTrim        bool
+	Ephemeral       bool
+	BaseDiskSealed  bool
+
+	ipAttempts []ipAttempt
+	lockFile   *os.File
+	lockDepth  int
+
+	helperChecked bool
+
+	// rngAttached is whether this boot of the machine got the rng
+	rngAttached bool
+
+	progressFunc ProgressFunc
 }
 
 // NewDriver creates a new driver for a host
 func NewDriver(machineName, storePath string) *Driver {
 	return &Driver{
 		// Don't init BaseDriver values here. They are overwritten by API .SetConfigRaw() call.
-		CommonDriver: &pkgdrivers.CommonDriver{},
-		DiskSize:     defaultDiskSize,
+		CommonDriver:    &pkgdrivers.CommonDriver{},
+		DiskSize:        defaultDiskSize,
+		ShutdownTimeout: defaultShutdownTimeout,
+		StopTimeout:     defaultStopTimeout,
+		KillTimeout:     defaultKillTimeout,
+		IPTimeout:       defaultIPTimeout,
+		IPPollInterval:  defaultIPPollInterval,
+		Wait:            waitIP,
+		SSHKeyType:      sshKeyTypeRSA,
+		Backend:         backendAuto,
+		LeasesPath:      LeasesPath,
+		WaitTimeout:     defaultWaitTimeout,
+		DiskIOPriority:  pkgdrivers.IOPriorityLow,
+
+		ConsoleMaxSize:  defaultConsoleLogMaxSize,
+		ConsoleMaxFiles: defaultConsoleLogFiles,
 	}
 }
 
@@ -96,6 +218,48 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "The URL of the boot2docker image. Defaults to the latest available version",
 			Value:  "",
 		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_ISO_KERNEL_PATH",
+			Name:   "hyperkit-iso-kernel-path",
+			Usage:  "Path of the kernel inside the ISO. Detected automatically by default",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_ISO_INITRD_PATH",
+			Name:   "hyperkit-iso-initrd-path",
+			Usage:  "Path of the initrd inside the ISO. Detected automatically by default",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_BOOT_CMD",
+			Name:   "hyperkit-boot-cmd",
+			Usage:  "Kernel command line options, layered over the ones the ISO's bootloader config boots with",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_KERNEL_URL",
+			Name:   "hyperkit-kernel-url",
+			Usage:  "URL of a kernel to boot directly instead of an ISO. Requires --hyperkit-initrd-url",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_KERNEL_CHECKSUM",
+			Name:   "hyperkit-kernel-checksum",
+			Usage:  "Expected sha256 of the kernel downloaded from --hyperkit-kernel-url",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_INITRD_URL",
+			Name:   "hyperkit-initrd-url",
+			Usage:  "URL of an initrd to boot directly instead of an ISO",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_INITRD_CHECKSUM",
+			Name:   "hyperkit-initrd-checksum",
+			Usage:  "Expected sha256 of the initrd downloaded from --hyperkit-initrd-url",
+			Value:  "",
+		},
 		mcnflag.IntFlag{
 			EnvVar: "HYPERKIT_CPU_COUNT",
 			Name:   "hyperkit-cpu-count",
@@ -117,7 +281,7 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 		mcnflag.StringSliceFlag{
 			EnvVar: "HYPERKIT_NFS_SHARES",
 			Name:   "hyperkit-nfs-shares",
-			Usage:  "NFS directories to share in format src:dst where 'src' is relative to the machine/machines/<name> folder and 'dst' is relative to the directory set in hyperkit-nfs-root.",
+			Usage:  "NFS directories to share in format src:dst where 'dst' is relative to the directory set in hyperkit-nfs-root. 'src' is a host directory like ~/src, ./src or /Users/me/src, or a name relative to the machine/machines/<name> folder. 'dst' defaults to 'src'. Append :flags=<options> to mount a share with other options than hyperkit-nfs-flags, e.g. ~/db:db:flags=vers=3,nolock",
 			Value:  nil,
 		},
 		mcnflag.StringFlag{
@@ -132,29 +296,642 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "additional flags for NFS",
 			Value:  defaultNFSFlags,
 		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_NFS_HOST_IP",
+			Name:   "hyperkit-nfs-host-ip",
+			Usage:  "Host address the machine mounts the NFS shares from. Defaults to the vmnet address",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_NFS_INTERFACE",
+			Name:   "hyperkit-nfs-interface",
+			Usage:  "Host interface, like bridge100, whose IPv4 address the machine mounts the NFS shares from",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_SHUTDOWN_TIMEOUT",
+			Name:   "hyperkit-shutdown-timeout",
+			Usage:  "Seconds to wait for the guest to power off over SSH before signaling hyperkit. 0 disables the SSH shutdown.",
+			Value:  defaultShutdownTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_STOP_TIMEOUT",
+			Name:   "hyperkit-stop-timeout",
+			Usage:  "Seconds to wait for hyperkit to exit after SIGTERM before it is killed.",
+			Value:  defaultStopTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_KILL_TIMEOUT",
+			Name:   "hyperkit-kill-timeout",
+			Usage:  "Seconds to wait for hyperkit to exit after SIGKILL.",
+			Value:  defaultKillTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_IP_TIMEOUT",
+			Name:   "hyperkit-ip-timeout",
+			Usage:  "Seconds to wait for the machine to get an IP address.",
+			Value:  defaultIPTimeout,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_IP_POLL_INTERVAL",
+			Name:   "hyperkit-ip-poll-interval",
+			Usage:  "Initial seconds between IP address lookups. The interval doubles after each attempt, up to 10 seconds.",
+			Value:  defaultIPPollInterval,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_IP_DISCOVERY",
+			Name:   "hyperkit-ip-discovery",
+			Usage:  "Ordered IP discovery strategies: leases, arp, static:<ip> or exec:<command>, where the command gets the MAC address and prints the IP address",
+			Value:  defaultIPStrategies,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_WAIT",
+			Name:   "hyperkit-wait",
+			Usage:  "What Start waits for before returning: none, ip, ssh or docker",
+			Value:  waitIP,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_WAIT_TIMEOUT",
+			Name:   "hyperkit-wait-timeout",
+			Usage:  "Seconds to wait for SSH and Docker to become ready after the machine got an IP address.",
+			Value:  defaultWaitTimeout,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_SUPERVISE",
+			Name:   "hyperkit-supervise",
+			Usage:  "Restart the machine automatically if hyperkit exits without being stopped",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_DISK_IO_PRIORITY",
+			Name:   "hyperkit-disk-io-priority",
+			Usage:  "I/O priority of disk heavy operations such as disk image creation: low or normal",
+			Value:  pkgdrivers.IOPriorityLow,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_DISABLE_ACPI",
+			Name:   "hyperkit-disable-acpi",
+			Usage:  "Don't create ACPI tables for the guest (hyperkit -A)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_HALT_EXIT",
+			Name:   "hyperkit-halt-exit",
+			Usage:  "Exit from the guest on HLT, which lowers host CPU usage of idle guests (hyperkit -H)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_PAUSE_EXIT",
+			Name:   "hyperkit-pause-exit",
+			Usage:  "Exit from the guest on PAUSE (hyperkit -P)",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_POWER_SAVE",
+			Name:   "hyperkit-power-save",
+			Usage:  "Minimize host CPU usage of idle machines: enables HLT and PAUSE exits, a tickless guest kernel and less frequent host polling",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_WIRED_MEMORY",
+			Name:   "hyperkit-wired-memory",
+			Usage:  "Wire all guest memory up front instead of backing it lazily, so host paging can't stall latency-sensitive workloads like databases under host memory pressure",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_BACKEND",
+			Name:   "hyperkit-backend",
+			Usage:  "VM backend: hyperkit, qemu (HVF accelerated qemu-system-x86_64) or auto to fall back to qemu when hyperkit isn't installed",
+			Value:  backendAuto,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_CONFIG_HOOK",
+			Name:   "hyperkit-config-hook",
+			Usage:  "Program that receives the final hyperkit config as JSON on stdin and prints the config to launch with",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_CONFIG_PATCH",
+			Name:   "hyperkit-config-patch",
+			Usage:  "RFC 6902 JSON patch file applied to the final hyperkit config before launch",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_LEASES_PATH",
+			Name:   "hyperkit-leases-path",
+			Usage:  "Path of the dhcp leases file bootpd writes the machine's lease to. Any other file than bootpd's must be readable by the user",
+			Value:  LeasesPath,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_PREFER_IPV6",
+			Name:   "hyperkit-prefer-ipv6",
+			Usage:  "Discover the machine's global IPv6 address and use it for SSH. The Docker URL stays on IPv4, which its TLS certificate is issued for",
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_MTU",
+			Name:   "hyperkit-mtu",
+			Usage:  "MTU of the guest network interface, set after boot. Pass the same value to dockerd with --engine-opt mtu=<mtu>. 0 keeps the vmnet default",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_TIME_SYNC",
+			Name:   "hyperkit-time-sync",
+			Usage:  "Set the guest clock from the host at start, and again whenever it drifts, like after the host slept",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_PROGRESS_FILE",
+			Name:   "hyperkit-progress-file",
+			Usage:  "File or fifo that create appends download and disk progress to, as one JSON object per line",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_BINARY",
+			Name:   "hyperkit-binary",
+			Usage:  "Path of the hyperkit executable, e.g. from brew, Docker Desktop's com.docker.hyperkit or a custom build, owned and only writable by root. Found automatically if empty",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_EXTRA_ARGS",
+			Name:   "hyperkit-extra-args",
+			Usage:  "Arguments appended to the generated hyperkit command line, split on whitespace, e.g. \"-s 5,virtio-rnd\". Only \"-s\" devices of the types virtio-rnd, virtio-net, virtio-blk, ahci-hd and ahci-cd, with files you can read, disks read-only with \",ro\". Unsupported, for experimenting with devices the driver doesn't model",
+			Value:  nil,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_CONSOLE_LOG_MAX_SIZE",
+			Name:   "hyperkit-console-log-max-size",
+			Usage:  "Size in MB at which the guest console log is rotated. 0 disables rotation",
+			Value:  defaultConsoleLogMaxSize,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_CONSOLE_LOG_FILES",
+			Name:   "hyperkit-console-log-files",
+			Usage:  "Number of rotated guest console logs to keep",
+			Value:  defaultConsoleLogFiles,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_GUEST_AGENT",
+			Name:   "hyperkit-guest-agent",
+			Usage:  "Install an agent in the guest that reports its memory, CPU and disk usage over vsock",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_GUEST_AGENT_PATH",
+			Name:   "hyperkit-guest-agent-path",
+			Usage:  "Linux build of " + guestAgentBinaryName + " to install. Defaults to the one next to the driver",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_BALLOON",
+			Name:   "hyperkit-balloon",
+			Usage:  "Return memory the guest doesn't use to the host with a virtio-balloon, sized from the guest agent's reports. Needs a hyperkit build with " + balloonDevice,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_DISABLE_VIRTIO_RNG",
+			Name:   "hyperkit-disable-virtio-rng",
+			Usage:  "Don't attach the virtio-rng device that feeds the guest entropy pool from the host, which otherwise avoids long crng init delays at boot",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_VSOCK_BRIDGE",
+			Name:   "hyperkit-vsock-bridge",
+			Usage:  "Bridge a host TCP port to a guest vsock port (tcp:[host:]port=vsock:port), or a host vsock port the guest connects to to a host TCP address (vsock:port=tcp:[host:]port). Bridges are served by the supervisor and can't listen on ports below 1024",
+			Value:  nil,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_DOCKER_VSOCK",
+			Name:   "hyperkit-docker-vsock",
+			Usage:  "Also serve the docker daemon on a unix socket in the machine dir that the guest agent forwards over vsock, printed by the docker-socket command. The machine URL stays on the vmnet network",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_SSH_VSOCK",
+			Name:   "hyperkit-ssh-vsock",
+			Usage:  "Fall back to reaching SSH over vsock through the guest agent when IP discovery fails, from the boot after the agent got installed",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_STABLE_HOSTNAME",
+			Name:   "hyperkit-stable-hostname",
+			Usage:  "Point <machine>." + hostnameDomain + " at the machine in /etc/hosts and use it in the docker URL, so certificates stay valid as the IP changes. Create the machine with --tls-san <machine>." + hostnameDomain,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_MDNS",
+			Name:   "hyperkit-mdns",
+			Usage:  "Publish <machine>.local at the machine's IP address over mDNS with dns-sd on the vmnet bridge, kept up to date by the supervisor",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_HTTP_PROXY",
+			Name:   "hyperkit-http-proxy",
+			Usage:  "HTTP proxy for the guest shell and docker daemon",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_HTTPS_PROXY",
+			Name:   "hyperkit-https-proxy",
+			Usage:  "HTTPS proxy for the guest shell and docker daemon",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_NO_PROXY",
+			Name:   "hyperkit-no-proxy",
+			Usage:  "Comma separated hosts the guest reaches without the proxy",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_CA_CERT",
+			Name:   "hyperkit-ca-cert",
+			Usage:  "PEM CA certificate to add to the guest trust store, or with registry=path only to docker's for that registry",
+			Value:  nil,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_PROVISION_SCRIPT",
+			Name:   "hyperkit-provision-script",
+			Usage:  "Script to run in the machine over SSH once it first started, e.g. to install packages or preload images",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_PROVISION_ALWAYS",
+			Name:   "hyperkit-provision-always",
+			Usage:  "Run the provision script on every start",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_HOOK",
+			Name:   "hyperkit-hook",
+			Usage:  "Host command to run on a lifecycle event, as event=command with event one of " + strings.Join(hookEvents, ", ") + ". The machine is described in HYPERKIT_* environment variables",
+			Value:  nil,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_DATA_DISK_SIZE",
+			Name:   "hyperkit-data-disk-size",
+			Usage:  "Size in MB of a separate disk for " + guestDockerRoot + ", so images and volumes outlive the root disk. 0 keeps them on the root disk",
+			Value:  0,
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_EXTRA_DISK",
+			Name:   "hyperkit-extra-disk",
+			Usage:  "Extra disk as name:size in MB, left raw, or name:size:fs:mountpoint, formatted on first boot and mounted on every boot",
+			Value:  nil,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_DISK_TRIM",
+			Name:   "hyperkit-disk-trim",
+			Usage:  "Pass TRIM from the guest on to the disk images with the qemu backend, which frees the host space of deleted data. Hyperkit always does",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_EPHEMERAL",
+			Name:   "hyperkit-ephemeral",
+			Usage:  "Throw away everything written to the root disk when the machine stops, every start gets back to the machine as provisioned",
+		},
+		mcnflag.StringSliceFlag{
+			EnvVar: "HYPERKIT_ATTACH_ISO",
+			Name:   "hyperkit-attach-iso",
+			Usage:  "ISO image to attach as an extra CD-ROM drive, like a config drive or a package repository. Repeatable",
+			Value:  nil,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_AUTOSTART",
+			Name:   "hyperkit-autostart",
+			Usage:  "Start the machine at login, or at boot when created by root, through launchd, unless it was stopped through the driver, and restart it if it crashes",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_EVENTS",
+			Name:   "hyperkit-events",
+			Usage:  "Send lifecycle events as JSON lines: \"file\" appends them to events.jsonl in the machine dir, \"unix:<path>\" writes them to a listening unix socket",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_SUDO_HELPER",
+			Name:   "hyperkit-sudo-helper",
+			Usage:  "Run the driver as the user, and only its privileged steps as root through \"sudo <driver> helper\", instead of installing the driver setuid root. Print the sudoers rules with \"<driver> sudoers\". Config hooks and patches, extra arguments, attached ISOs and hooks are not supported with it",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_VPNKIT_SOCK",
+			Name:   "hyperkit-vpnkit-sock",
+			Usage:  "Location of the VPNKit socket used for networking. If empty, disables VPNKit, if \"auto\" uses the Docker Desktop VPNKit connection",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_PROFILE",
+			Name:   "hyperkit-profile",
+			Usage:  "Named profile of the hyperkit.defaults file in the storage path to take flag defaults from, e.g. ci. Flags given on the command line override it",
+			Value:  "",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_SOFT_RESTART",
+			Name:   "hyperkit-soft-restart",
+			Usage:  "Restart a running machine by rebooting its guest over SSH, keeping the hyperkit process, MAC address, IP address and NFS exports",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_SSH_KEY",
+			Name:   "hyperkit-ssh-key",
+			Usage:  "Existing private key, without a passphrase, to SSH into the machine with instead of generating one. Its public key is read from <path>.pub if present",
+			Value:  "",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_SSH_KEY_TYPE",
+			Name:   "hyperkit-ssh-key-type",
+			Usage:  "Type of the generated SSH key: rsa or ed25519",
+			Value:  sshKeyTypeRSA,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_SSH_USER",
+			Name:   "hyperkit-ssh-user",
+			Usage:  "User to SSH into the machine as, e.g. ubuntu for Ubuntu cloud images",
+			Value:  defaultSSHUser,
+		},
+		mcnflag.IntFlag{
+			EnvVar: "HYPERKIT_SSH_PORT",
+			Name:   "hyperkit-ssh-port",
+			Usage:  "Port sshd listens on in the machine",
+			Value:  defaultSSHPort,
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_KEEP_IN_BACKUPS",
+			Name:   "hyperkit-keep-in-backups",
+			Usage:  "Don't exclude the machine directory from Time Machine backups and the Spotlight index",
+		},
+		mcnflag.BoolFlag{
+			EnvVar: "HYPERKIT_ENCRYPT_DISK",
+			Name:   "hyperkit-encrypt-disk",
+			Usage:  "Keep the root disk in an encrypted sparse bundle, attached while the machine runs, with its passphrase in the keychain",
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_SHARE_BACKEND",
+			Name:   "hyperkit-share-backend",
+			Usage:  "How the NFS shares are served: nfs exports them with the host's nfsd, sftp serves them with an unprivileged file server the guest mounts with sshfs, for root only",
+			Value:  shareBackendNFS,
+		},
+		mcnflag.StringFlag{
+			EnvVar: "HYPERKIT_IGNITION_CONFIG",
+			Name:   "hyperkit-ignition-config",
+			Usage:  "Path to an Ignition config for Flatcar or Fedora CoreOS guests, attached as a config drive",
+			Value:  "",
+		},
 	}
 }
 
 // SetConfigFromFlags sets the machine config
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
+	flags, err := d.withDefaults(flags)
+	if err != nil {
+		return err
+	}
 	d.Boot2DockerURL = flags.String("hyperkit-boot2docker-url")
+	d.ISOKernelPath = flags.String("hyperkit-iso-kernel-path")
+	d.ISOInitrdPath = flags.String("hyperkit-iso-initrd-path")
+	d.Cmdline = flags.String("hyperkit-boot-cmd")
+	d.KernelURL = flags.String("hyperkit-kernel-url")
+	d.KernelChecksum = flags.String("hyperkit-kernel-checksum")
+	d.InitrdURL = flags.String("hyperkit-initrd-url")
+	d.InitrdChecksum = flags.String("hyperkit-initrd-checksum")
 	d.CPU = flags.Int("hyperkit-cpu-count")
 	d.DiskSize = int(flags.Int("hyperkit-disk-size"))
 	d.Memory = flags.Int("hyperkit-memory-size")
 	d.NFSFlags = flags.String("hyperkit-nfs-flags")
-	d.NFSShares = flags.StringSlice("hyperkit-nfs-shares")
+	d.NFSHostIP = flags.String("hyperkit-nfs-host-ip")
+	d.NFSInterface = flags.String("hyperkit-nfs-interface")
+	shares, err := normalizeNFSShares(flags.StringSlice("hyperkit-nfs-shares"))
+	if err != nil {
+		return err
+	}
+	d.NFSShares = shares
 	d.NFSSharesRoot = flags.String("hyperkit-nfs-root")
+	d.ShutdownTimeout = flags.Int("hyperkit-shutdown-timeout")
+	d.StopTimeout = flags.Int("hyperkit-stop-timeout")
+	d.KillTimeout = flags.Int("hyperkit-kill-timeout")
+	d.IPTimeout = flags.Int("hyperkit-ip-timeout")
+	d.IPPollInterval = flags.Int("hyperkit-ip-poll-interval")
+	d.IPDiscovery = flags.StringSlice("hyperkit-ip-discovery")
+	d.Wait = flags.String("hyperkit-wait")
+	d.WaitTimeout = flags.Int("hyperkit-wait-timeout")
+	d.Supervised = flags.Bool("hyperkit-supervise")
+	d.DiskIOPriority = flags.String("hyperkit-disk-io-priority")
+	d.DisableACPI = flags.Bool("hyperkit-disable-acpi")
+	d.HaltExit = flags.Bool("hyperkit-halt-exit")
+	d.PauseExit = flags.Bool("hyperkit-pause-exit")
+	d.PowerSave = flags.Bool("hyperkit-power-save")
+	d.WiredMemory = flags.Bool("hyperkit-wired-memory")
+	d.Backend = flags.String("hyperkit-backend")
+	d.ConfigHook = flags.String("hyperkit-config-hook")
+	d.ConfigPatch = flags.String("hyperkit-config-patch")
+	d.LeasesPath = flags.String("hyperkit-leases-path")
+	d.PreferIPv6 = flags.Bool("hyperkit-prefer-ipv6")
+	d.MTU = flags.Int("hyperkit-mtu")
+	d.TimeSync = flags.Bool("hyperkit-time-sync")
+	d.ProgressFile = flags.String("hyperkit-progress-file")
+	d.HyperkitBinary = flags.String("hyperkit-binary")
+	d.ExtraArgs = flags.StringSlice("hyperkit-extra-args")
+	d.ConsoleMaxSize = flags.Int("hyperkit-console-log-max-size")
+	d.ConsoleMaxFiles = flags.Int("hyperkit-console-log-files")
+	d.GuestAgent = flags.Bool("hyperkit-guest-agent")
+	d.GuestAgentPath = flags.String("hyperkit-guest-agent-path")
+	d.Balloon = flags.Bool("hyperkit-balloon")
+	d.NoVirtioRNG = flags.Bool("hyperkit-disable-virtio-rng")
+	d.VSockBridges = flags.StringSlice("hyperkit-vsock-bridge")
+	d.DockerVSock = flags.Bool("hyperkit-docker-vsock")
+	d.SSHOverVSock = flags.Bool("hyperkit-ssh-vsock")
+	d.StableHostname = flags.Bool("hyperkit-stable-hostname")
+	d.MDNS = flags.Bool("hyperkit-mdns")
+	d.HTTPProxy = flags.String("hyperkit-http-proxy")
+	d.HTTPSProxy = flags.String("hyperkit-https-proxy")
+	d.NoProxy = flags.String("hyperkit-no-proxy")
+	d.CACerts = flags.StringSlice("hyperkit-ca-cert")
+	d.ProvisionScript = flags.String("hyperkit-provision-script")
+	d.ProvisionAlways = flags.Bool("hyperkit-provision-always")
+	d.Hooks = flags.StringSlice("hyperkit-hook")
+	d.DataDisk = flags.Int("hyperkit-data-disk-size")
+	d.ExtraDisks = flags.StringSlice("hyperkit-extra-disk")
+	d.DiskTrim = flags.Bool("hyperkit-disk-trim")
+	d.Ephemeral = flags.Bool("hyperkit-ephemeral")
+	d.Autostart = flags.Bool("hyperkit-autostart")
+	d.Events = flags.String("hyperkit-events")
+	d.SudoHelper = flags.Bool("hyperkit-sudo-helper")
+	d.VpnKitSock = flags.String("hyperkit-vpnkit-sock")
+	d.Profile = flags.String(profileFlag)
+	d.SoftRestart = flags.Bool("hyperkit-soft-restart")
+	if key := flags.String("hyperkit-ssh-key"); key != "" {
+		abs, err := filepath.Abs(key)
+		if err != nil {
+			return err
+		}
+		d.SSHKey = abs
+	}
+	d.SSHKeyType = flags.String("hyperkit-ssh-key-type")
+	d.SSHUser = flags.String("hyperkit-ssh-user")
+	d.SSHPort = flags.Int("hyperkit-ssh-port")
+	d.KeepInBackups = flags.Bool("hyperkit-keep-in-backups")
+	d.EncryptDisk = flags.Bool("hyperkit-encrypt-disk")
+	d.ShareBackend = flags.String("hyperkit-share-backend")
+	if d.SSHKeyType == sshKeyTypeED25519 {
+		d.SSHKeyPath = d.ResolveStorePath(ed25519KeyFileName)
+	}
+	for _, iso := range flags.StringSlice("hyperkit-attach-iso") {
+		abs, err := filepath.Abs(iso)
+		if err != nil {
+			return err
+		}
+		d.AttachISOs = append(d.AttachISOs, abs)
+	}
+	d.IgnitionConfig = flags.String("hyperkit-ignition-config")
 
-	return nil
+	return d.validateConfig()
+}
+
+// validateConfig checks the driver settings for invalid combinations
+func (d *Driver) validateConfig() error {
+	if err := validateResources(d.CPU, d.Memory); err != nil {
+		return err
+	}
+	if err := validateDiskSize(d.DiskSize); err != nil {
+		return err
+	}
+	if _, err := buildIPStrategies(d.IPDiscovery); err != nil {
+		return err
+	}
+	if err := validateWaitStrategy(d.Wait); err != nil {
+		return err
+	}
+	if err := d.validateSSHKey(); err != nil {
+		return err
+	}
+	if err := validateSSHUser(d.SSHUser); err != nil {
+		return err
+	}
+	if d.SSHPort < 1 || d.SSHPort > 65535 {
+		return fmt.Errorf("SSH port %d must be between 1 and 65535", d.SSHPort)
+	}
+	if err := validateShareBackend(d.ShareBackend); err != nil {
+		return err
+	}
+	if err := validateNFSHost(d.NFSHostIP, d.NFSInterface); err != nil {
+		return err
+	}
+	if err := d.validateEncryptDisk(); err != nil {
+		return err
+	}
+	if err := validateBackend(d.Backend); err != nil {
+		return err
+	}
+	if d.Backend == backendQEMU && (len(d.VSockPorts) > 0 || len(d.VSockBridges) > 0 || d.VpnKitSock != "") {
+		return fmt.Errorf("vsock ports and VPNKit are only supported by the %s backend", backendHyperkit)
+	}
+	if _, err := d.vsockBridges(); err != nil {
+		return err
+	}
+	if d.Backend == backendQEMU && (d.ConfigHook != "" || d.ConfigPatch != "") {
+		return fmt.Errorf("config hooks and patches are only supported by the %s backend", backendHyperkit)
+	}
+	if d.PreferIPv6 && d.Wait != waitSSH && d.Wait != waitDocker {
+		return fmt.Errorf("IPv6 discovery needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if err := validateMTU(d.MTU); err != nil {
+		return err
+	}
+	if err := validateExtraArgs(d.ExtraArgs); err != nil {
+		return err
+	}
+	if d.MTU != 0 && d.Wait != waitSSH && d.Wait != waitDocker {
+		return fmt.Errorf("setting the MTU needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if d.TimeSync && d.Wait != waitSSH && d.Wait != waitDocker {
+		return fmt.Errorf("time sync needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if d.Wait == waitNone && len(d.NFSShares) > 0 {
+		return fmt.Errorf("NFS shares need the machine IP address, use --hyperkit-wait=%s or later", waitIP)
+	}
+	if d.GuestAgent && d.Backend == backendQEMU {
+		return fmt.Errorf("the guest agent is only supported by the %s backend", backendHyperkit)
+	}
+	if d.GuestAgent && d.Wait != waitSSH && d.Wait != waitDocker {
+		return fmt.Errorf("installing the guest agent needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if d.Balloon && d.WiredMemory {
+		return fmt.Errorf("wired memory can't be returned to the host, drop --hyperkit-balloon or --hyperkit-wired-memory")
+	}
+	if err := validateProxy("HTTP proxy", d.HTTPProxy); err != nil {
+		return err
+	}
+	if err := validateProxy("HTTPS proxy", d.HTTPSProxy); err != nil {
+		return err
+	}
+	if strings.Contains(d.NoProxy, "'") {
+		return fmt.Errorf("no proxy list %q must not contain single quotes", d.NoProxy)
+	}
+	if len(d.proxyEnv()) > 0 && !d.waitsForSSH() {
+		return fmt.Errorf("configuring the guest proxy needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if _, err := d.loadCACerts(); err != nil {
+		return err
+	}
+	if err := validateHooks(d.Hooks); err != nil {
+		return err
+	}
+	if err := validateEvents(d.Events); err != nil {
+		return err
+	}
+	if d.DataDisk < 0 {
+		return fmt.Errorf("data disk size must not be negative")
+	}
+	if err := d.validateExtraDisks(); err != nil {
+		return err
+	}
+	if d.formatsDisks() && !d.waitsForSSH() {
+		return fmt.Errorf("formatting and mounting extra disks needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if d.ProvisionScript != "" {
+		if _, err := os.Stat(d.ProvisionScript); err != nil {
+			return fmt.Errorf("provision script: %w", err)
+		}
+		if !d.waitsForSSH() {
+			return fmt.Errorf("running a provision script needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+		}
+	}
+	if err := validateAttachedISOs(d.AttachISOs); err != nil {
+		return err
+	}
+	if len(d.CACerts) > 0 && !d.waitsForSSH() {
+		return fmt.Errorf("installing CA certificates needs SSH access to the machine, use --hyperkit-wait=%s or %s", waitSSH, waitDocker)
+	}
+	if d.SSHOverVSock && !d.GuestAgent {
+		return fmt.Errorf("SSH is forwarded over vsock by the guest agent, use --hyperkit-guest-agent")
+	}
+	if d.DockerVSock && !d.GuestAgent {
+		return fmt.Errorf("the docker socket is forwarded over vsock by the guest agent, use --hyperkit-guest-agent")
+	}
+	if d.Balloon && !d.GuestAgent {
+		return fmt.Errorf("the memory balloon is sized from the guest agent's reports, use --hyperkit-guest-agent")
+	}
+	if d.IPTimeout <= 0 || d.IPPollInterval <= 0 {
+		return fmt.Errorf("IP timeout and poll interval must be positive")
+	}
+	if d.ConsoleMaxSize < 0 || d.ConsoleMaxFiles < 0 {
+		return fmt.Errorf("console log max size and files must not be negative")
+	}
+	if d.SudoHelper {
+		if err := d.checkHelperSettings(); err != nil {
+			return err
+		}
+	}
+	return pkgdrivers.ValidateIOPriority(d.DiskIOPriority)
 }
 
 // PreCreateCheck is called to enforce pre-creation steps
 func (d *Driver) PreCreateCheck() error {
-	return d.verifyRootPermissions()
+	if err := validateMachineName(d.MachineName); err != nil {
+		return err
+	}
+	if err := d.checkIdentityCollisions(false); err != nil {
+		return err
+	}
+	if err := d.verifyRootPermissions(); err != nil {
+		return err
+	}
+	if d.HyperkitBinary != "" {
+		if err := validateHyperkitBinary(d.HyperkitBinary); err != nil {
+			return err
+		}
+	}
+	if _, err := d.backend(); err != nil {
+		return err
+	}
+	if err := d.checkHost(getHostInfo(d.StorePath)); err != nil {
+		return err
+	}
+	if err := checkFirewall(); err != nil {
+		return err
+	}
+	return checkVMNetConfig()
 }
 
 // verifyRootPermissions is called before any step which needs root access
 func (d *Driver) verifyRootPermissions() error {
+	if d.useHelper() {
+		return d.checkHelper()
+	}
+	return CheckPermissions()
+}
+
+// CheckPermissions reports whether the driver binary runs with the root
+// permissions hyperkit needs, and how to install it setuid root otherwise.
+func CheckPermissions() error {
 	exe, err := os.Executable()
 	if err != nil {
 		return err
@@ -162,30 +939,151 @@ func (d *Driver) verifyRootPermissions() error {
 	euid := syscall.Geteuid()
 	log.Debugf("exe=%s uid=%d", exe, euid)
 	if euid != 0 {
-		return fmt.Errorf(permErr, filepath.Base(exe), exe, exe)
+		return newError(ErrNoRoot, "", fmt.Errorf(permErr, filepath.Base(exe), exe, exe))
 	}
 	return nil
 }
 
-// Create a host using the driver's config
+// Create a host using the driver's config. SIGINT and SIGTERM interrupt it.
 func (d *Driver) Create() error {
+	ctx, cancel := interruptContext()
+	defer cancel()
+	return d.CreateContext(ctx)
+}
+
+// CreateContext creates a host like Create, giving up once ctx is done. An
+// interrupted create is rolled back, so no half created machine is left.
+func (d *Driver) CreateContext(ctx context.Context) (err error) {
 	if err := d.verifyRootPermissions(); err != nil {
 		return err
 	}
+	unlock, err := d.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	d.emit(eventCreating, "")
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			log.Infof("Create of %s interrupted, rolling back", d.MachineName)
+			d.rollbackCreate()
+		}
+	}()
 
-	d.SSHUser = defaultSSHUser
+	if d.SSHUser == "" {
+		d.SSHUser = defaultSSHUser
+	}
+	if err := d.installSSHKey(); err != nil {
+		return fmt.Errorf("setting up the SSH key: %w", err)
+	}
+	if !d.KeepInBackups {
+		excludeFromBackups(d.ResolveStorePath("."))
+	}
 
+	makeRawDisk := func() error {
+		disk := d.rawDiskPath()
+		pw := d.newProgressWriter(progressDisk, filepath.Base(disk), int64(d.DiskSize)*1000000)
+		stop := pw.watch(disk)
+		err := pkgdrivers.MakeRawDiskAt(d.BaseDriver, disk, d.DiskSize)
+		stop()
+		if err != nil {
+			return err
+		}
+		pw.Done()
+		return nil
+	}
 	// TODO: handle different disk types.
-	if err := pkgdrivers.MakeDiskImage(d.BaseDriver, d.Boot2DockerURL, d.DiskSize); err != nil {
+	// The steps run to completion, so nothing writes to the machine dir
+	// while an interrupted create is rolled back. The download stops as soon
+	// as ctx is done, and no step starts after that.
+	makeDiskImage := func() error {
+		switch {
+		case d.netboot():
+			// The boot files are fetched later, there is no ISO
+		case strings.HasPrefix(d.Boot2DockerURL, "http://") || strings.HasPrefix(d.Boot2DockerURL, "https://"):
+			// Downloaded here rather than by libmachine to report progress
+			if err := d.download(ctx, d.Boot2DockerURL, d.ResolveStorePath(isoFilename)); err != nil {
+				return &pkgdrivers.ISOCopyError{Err: err}
+			}
+		default:
+			if err := pkgdrivers.CopyIsoToMachineDir(d.BaseDriver, d.Boot2DockerURL); err != nil {
+				return err
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return makeRawDisk()
+	}
+	if d.EncryptDisk {
+		if err := d.createEncryptedDisk(); err != nil {
+			return err
+		}
+	}
+	if err := pkgdrivers.RunWithIOPriority(d.DiskIOPriority, makeDiskImage); err != nil {
+		var isoErr *pkgdrivers.ISOCopyError
+		if errors.As(err, &isoErr) {
+			return newError(ErrISODownload, "check --hyperkit-boot2docker-url and the network, or download the ISO ahead of time with the prefetch subcommand", err)
+		}
 		return fmt.Errorf("making disk image: %w", err)
 	}
+	if err := d.createExtraDisks(); err != nil {
+		return err
+	}
+
+	if d.netboot() {
+		if err := d.fetchNetbootFiles(ctx); err != nil {
+			return err
+		}
+	} else {
+		isoPath := d.ResolveStorePath(isoFilename)
+		if err := d.extractKernel(isoPath); err != nil {
+			return fmt.Errorf("extracting kernel: %w", err)
+		}
+	}
 
-	isoPath := d.ResolveStorePath(isoFilename)
-	if err := d.extractKernel(isoPath); err != nil {
-		return fmt.Errorf("extracting kernel: %w", err)
+	if d.IgnitionConfig != "" {
+		if err := d.createIgnitionConfigDrive(); err != nil {
+			return fmt.Errorf("creating ignition config drive: %w", err)
+		}
+	}
+
+	if err := d.StartContext(ctx); err != nil {
+		return err
+	}
+	if d.Autostart {
+		if err := d.installLaunchdJob(); err != nil {
+			log.Warnf("Unable to start %s automatically: %v", d.MachineName, err)
+		}
 	}
+	return nil
+}
 
-	return d.Start()
+// rollbackCreate kills the machine and removes what Create made of it, but
+// keeps the logs and diagnostics in the machine dir.
+func (d *Driver) rollbackCreate() {
+	if s, err := d.GetState(); err == nil && s == state.Running {
+		if err := d.Kill(); err != nil {
+			log.Warnf("Unable to kill %s: %v", d.MachineName, err)
+		}
+	}
+	d.cleanupNfsExports()
+	d.removeExtraDisks()
+	d.removeEncryptedDisk()
+	paths := []string{
+		pkgdrivers.GetDiskPath(d.BaseDriver),
+		d.ResolveStorePath(isoFilename),
+		d.ResolveStorePath(ignitionISOFileName),
+	}
+	paths = append(paths, d.ownBootFiles()...)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to remove %s: %v", path, err)
+		}
+	}
 }
 
 // DriverName returns the name of the driver
@@ -195,7 +1093,18 @@ func (d *Driver) DriverName() string {
 
 // GetSSHHostname returns hostname for use with ssh
 func (d *Driver) GetSSHHostname() (string, error) {
-	return d.IPAddress, nil
+	if d.sshOverVSock() {
+		return sshVSockHost, nil
+	}
+	return d.preferredIP(), nil
+}
+
+// GetSSHPort returns the port for use with ssh
+func (d *Driver) GetSSHPort() (int, error) {
+	if d.sshOverVSock() {
+		return d.VSockSSHPort, nil
+	}
+	return d.BaseDriver.GetSSHPort()
 }
 
 // GetURL returns a Docker compatible host URL for connecting to this host
@@ -205,16 +1114,23 @@ func (d *Driver) GetURL() (string, error) {
 	if s != state.Running {
 		return "", err
 	}
+	if d.StableHostname {
+		return fmt.Sprintf("tcp://%s", net.JoinHostPort(d.stableHostname(), "2376")), nil
+	}
 
+	// The Docker URL stays on IPv4 even with --hyperkit-prefer-ipv6, the
+	// server certificate docker-machine generates only covers that address
 	ip, err := d.GetIP()
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("tcp://%s:2376", ip), nil
+	return fmt.Sprintf("tcp://%s", net.JoinHostPort(ip, "2376")), nil
 }
 
-// Return the state of the hyperkit pid
-func pidState(pid int) (state.State, error) {
+// Return the state of the hyperkit pid. If the process identity recorded at
+// launch is available it must match, otherwise we fall back to checking the
+// executable name.
+func (d *Driver) pidState(pid int) (state.State, error) {
 	if pid == 0 {
 		return state.Stopped, nil
 	}
@@ -226,8 +1142,21 @@ func pidState(pid int) (state.State, error) {
 		log.Debugf("hyperkit pid %d missing from process table", pid)
 		return state.Stopped, nil
 	}
-	// hyperkit or com.docker.hyper
-	if !strings.Contains(p.Executable(), "hyper") {
+
+	if ms, err := d.readMachineState(); err == nil && ms.Pid == pid && ms.Process != nil {
+		current, err := lookupProcessIdentity(pid)
+		if err == nil {
+			if !current.matches(ms.Process) {
+				log.Debugf("pid %d is stale, and is being used by %s started at %s", pid, current.Path, current.StartTime)
+				return state.Stopped, nil
+			}
+			return state.Running, nil
+		}
+		log.Debugf("unable to verify identity of pid %d: %v", pid, err)
+	}
+
+	// hyperkit, com.docker.hyper or qemu-system-x86_64
+	if !strings.Contains(p.Executable(), "hyper") && !strings.Contains(p.Executable(), "qemu") {
 		log.Debugf("pid %d is stale, and is being used by %s", pid, p.Executable())
 		return state.Stopped, nil
 	}
@@ -240,119 +1169,431 @@ func (d *Driver) GetState() (state.State, error) {
 		return state.Error, err
 	}
 
-	pid := d.getPid()
-	log.Debugf("hyperkit pid from json: %d", pid)
-	return pidState(pid)
+	pid := d.getPid()
+	log.Debugf("hyperkit pid from json: %d", pid)
+	s, err := d.pidState(pid)
+	if err == nil && s == state.Running {
+		if err := d.reconcileIP(); err != nil {
+			log.Debugf("Unable to reconcile the IP address of %s: %v", d.MachineName, err)
+		}
+	}
+	return s, err
+}
+
+// Kill stops a host forcefully
+func (d *Driver) Kill() (err error) {
+	if err := d.verifyRootPermissions(); err != nil {
+		return err
+	}
+	d.requestStop()
+	defer func() {
+		if err == nil {
+			d.discardEphemeralDisk()
+			d.detachEncryptedDisk()
+			d.emit(eventStopped, "")
+			d.updateMetrics(func(m *machineMetrics) { m.Stops++ })
+		}
+	}()
+	if err := d.sendSignal(syscall.SIGKILL); err != nil || d.KillTimeout <= 0 {
+		return err
+	}
+
+	for i := 0; i < d.KillTimeout; i++ {
+		time.Sleep(time.Second * 1)
+		s, err := d.GetState()
+		if err != nil {
+			return fmt.Errorf("hyperkit waiting for kill failed: %w", err)
+		}
+		if s == state.Stopped {
+			return nil
+		}
+	}
+	return fmt.Errorf("hyperkit still running %ds after SIGKILL", d.KillTimeout)
+}
+
+// Remove a host
+func (d *Driver) Remove() error {
+	return d.remove(false)
 }
 
-// Kill stops a host forcefully
-func (d *Driver) Kill() error {
-	if err := d.verifyRootPermissions(); err != nil {
-		return err
-	}
-	return d.sendSignal(syscall.SIGKILL)
+// ForceRemove removes a host like Remove, but carries on when the machine's
+// state can't be determined or it can't be stopped, killing what it can
+func (d *Driver) ForceRemove() error {
+	return d.remove(true)
 }
 
-// Remove a host
-func (d *Driver) Remove() error {
+func (d *Driver) remove(force bool) error {
 	if err := d.verifyRootPermissions(); err != nil {
-		return err
+		if !force {
+			return err
+		}
+		log.Warnf("%v, removing the files of %s anyway", err, d.MachineName)
+	}
+	unlock, err := d.lock()
+	if err != nil {
+		if !force {
+			return err
+		}
+		log.Warnf("Unable to lock %s: %v, removing it anyway", d.MachineName, err)
+		unlock = func() {}
 	}
+	defer unlock()
+	d.removeLaunchdJob()
 
 	s, err := d.GetState()
 	if err != nil || s == state.Error {
-		log.Debugf("Error checking machine status: %v, assuming it has been removed already", err)
+		if force {
+			log.Warnf("Unable to determine the state of %s: %v, killing whatever still runs", d.MachineName, err)
+			if err := d.Kill(); err != nil {
+				log.Debugf("Unable to kill %s: %v", d.MachineName, err)
+			}
+		} else {
+			log.Debugf("Error checking machine status: %v, assuming it has been removed already", err)
+		}
 	}
 	if s == state.Running {
 		if err := d.Stop(); err != nil {
-			return err
+			if !force {
+				return err
+			}
+			log.Warnf("Unable to stop %s: %v, killing it", d.MachineName, err)
+			if err := d.Kill(); err != nil {
+				log.Warnf("Unable to kill %s: %v", d.MachineName, err)
+			}
+			d.cleanupNfsExports()
+		}
+	} else {
+		// Stop cleans up the exports of running machines
+		d.cleanupNfsExports()
+	}
+
+	if d.leasesPath() != LeasesPath {
+		// Only bootpd's own file is rewritten as root
+		log.Debugf("Not pruning the dhcp lease of %s from %s", d.MachineName, d.leasesPath())
+	} else if b, err := d.backend(); err != nil {
+		log.Warnf("Unable to prune the dhcp lease of %s: %v", d.MachineName, err)
+	} else if mac, err := d.macAddress(b); err != nil {
+		log.Warnf("Unable to prune the dhcp lease of %s: %v", d.MachineName, err)
+	} else if n, err := removeLeases(d.leasesPath(), mac); err != nil {
+		d.audit(auditLeaseRemove, mac, err)
+		log.Warnf("Unable to prune the dhcp lease of %s: %v", d.MachineName, err)
+	} else if n > 0 {
+		d.audit(auditLeaseRemove, fmt.Sprintf("%d leases of %s", n, mac), nil)
+		log.Debugf("Removed %d dhcp leases for %s", n, mac)
+	}
+	if d.StableHostname {
+		if err := d.updateHostsEntry(""); err != nil {
+			log.Warnf("Unable to remove %s from %s: %v", d.stableHostname(), hostsPath, err)
+		}
+	}
+
+	d.removeEncryptedDisk()
+	d.removeArtifacts()
+	if _, err := os.Stat(KnownHostsPath(d.StorePath)); err == nil {
+		if _, err := UpdateKnownHosts(d.StorePath); err != nil {
+			log.Warnf("Unable to remove %s from %s: %v", d.MachineName, KnownHostsPath(d.StorePath), err)
 		}
 	}
+	if err := d.runHooks(hookPostRemove); err != nil {
+		log.Warnf("%v", err)
+	}
 	return nil
 }
 
-// Restart a host
-func (d *Driver) Restart() error {
-	return pkgdrivers.Restart(d)
+// Start a host. SIGINT and SIGTERM interrupt it.
+func (d *Driver) Start() error {
+	ctx, cancel := interruptContext()
+	defer cancel()
+	return d.StartContext(ctx)
 }
 
-// Start a host
-func (d *Driver) Start() error {
+// StartContext starts a host like Start, giving up once ctx is done. The
+// hyperkit process of an interrupted start is killed rather than orphaned.
+func (d *Driver) StartContext(ctx context.Context) (err error) {
 	if err := d.verifyRootPermissions(); err != nil {
 		return err
 	}
+	unlock, err := d.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := d.runHooks(hookPreStart); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			d.emit(eventRunning, "")
+			d.updateMetrics(func(m *machineMetrics) { m.Starts++ })
+			if err := d.runHooks(hookPostStart); err != nil {
+				log.Warnf("%v", err)
+			}
+		}
+	}()
+	d.clearStopRequest()
+	d.repairCerts()
+	if d.sshKeyMissing() {
+		if err := d.regenerateSSHKey(); err != nil {
+			return fmt.Errorf("regenerating SSH key: %w", err)
+		}
+		d.SSHKeyPending = true
+	}
 
-	stateDir := filepath.Join(d.StorePath, "machines", d.MachineName)
 	if err := d.recoverFromUncleanShutdown(); err != nil {
 		return err
 	}
-	h, err := hyperkit.New("", d.VpnKitSock, stateDir)
+	if err := d.checkDiskNotInUse(); err != nil {
+		return err
+	}
+	if err := d.checkIdentityCollisions(true); err != nil {
+		return err
+	}
+	if err := d.attachEncryptedDisk(); err != nil {
+		return err
+	}
+	if err := d.prepareEphemeralDisk(); err != nil {
+		return err
+	}
+	if err := d.restoreBootFiles(ctx); err != nil {
+		return fmt.Errorf("restoring the boot files: %w", err)
+	}
+	b, err := d.backend()
+	if err != nil {
+		return err
+	}
+
+	machineUUID := d.machineUUID()
+	log.Debugf("Using UUID %s", machineUUID)
+	mac, err := d.macAddress(b)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Generated MAC %s", mac)
+
+	if err := d.pickVSockSSHPort(); err != nil {
+		return err
+	}
+	d.rotateConsoleLog()
+	cmdline := d.kernelCmdline()
+	log.Debugf("Starting with %s and cmdline: %s", b.name(), cmdline)
+	d.emit(eventBooting, "")
+	booted := time.Now()
+	pid, err := d.startBackend(b, machineUUID, cmdline)
 	if err != nil {
-		return fmt.Errorf("new-ing Hyperkit: %w", err)
+		return err
+	}
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			log.Infof("Start of %s interrupted, killing it", d.MachineName)
+			if err := d.Kill(); err != nil {
+				log.Warnf("Unable to kill %s: %v", d.MachineName, err)
+			}
+		}
+	}()
+	if err := d.recordProcessIdentity(pid); err != nil {
+		log.Warnf("Unable to record hyperkit process identity: %v", err)
+	}
+	if d.needsSupervisor() {
+		if err := d.startSupervisor(); err != nil {
+			log.Warnf("Unable to supervise machine: %v", err)
+		}
 	}
 
-	// TODO: handle the rest of our settings.
-	h.Kernel = d.BootKernel
-	h.Initrd = d.BootInitrd
-	h.VMNet = true
-	h.ISOImages = []string{d.ResolveStorePath(isoFilename)}
-	h.Console = hyperkit.ConsoleFile
-	if d.CPU > defaultCPUs {
-		h.CPUs = d.CPU
+	if d.Wait == waitNone {
+		log.Debug("Not waiting for the machine to come up")
+		return nil
 	}
-	if d.Memory > defaultMemory {
-		h.Memory = d.Memory
+	if err := d.waitForIP(ctx, mac); err != nil && (ctx.Err() != nil || !d.fallBackToVSockSSH(err)) {
+		return d.bootFailed(err, mac)
 	}
-	h.UUID = d.UUID
-	if h.UUID == "" {
-		h.UUID = uuid.NewSHA1(uuid.Nil, []byte(d.GetMachineName())).String()
+	log.Debugf("IP: %s", d.IPAddress)
+	if d.IPAddress != "" {
+		d.emit(eventIPAcquired, d.IPAddress)
+		d.observeIPAcquired(booted)
+		if d.StableHostname {
+			if err := d.updateHostsEntry(d.IPAddress); err != nil {
+				log.Warnf("Unable to point %s at %s: %v", d.stableHostname(), d.IPAddress, err)
+			}
+		}
+		d.checkCertSANs()
+	}
+	// Ignition has run once the guest got this far
+	d.IgnitionApplied = d.IgnitionConfig != ""
+
+	if d.SSHKeyPending {
+		if err := d.injectSSHKey(); err != nil {
+			return fmt.Errorf("injecting regenerated SSH key: %w", err)
+		}
+		d.SSHKeyPending = false
 	}
 
-	if vsockPorts, err := d.extractVSockPorts(); err != nil {
+	if err := d.waitReady(ctx); err != nil {
+		return d.bootFailed(err, mac)
+	}
+	if d.waitsForSSH() {
+		d.checkHostKeys()
+	}
+	if err := d.applyMTU(); err != nil {
 		return err
-	} else if len(vsockPorts) >= 1 {
-		h.VSock = true
-		h.VSockPorts = vsockPorts
+	}
+	if d.TimeSync {
+		if err := d.syncClock(); err != nil {
+			log.Warnf("Unable to sync the guest clock: %v", err)
+		}
+	}
+	if d.PreferIPv6 {
+		d.updateIPv6(mac)
+	}
+	d.checkGuestRNG()
+	if d.DockerVSock {
+		if err := d.linkDockerSocket(); err != nil {
+			return fmt.Errorf("linking the docker socket: %w", err)
+		}
+	}
+	if d.GuestAgent && !d.AgentInstalled {
+		if err := d.installGuestAgent(); err != nil {
+			log.Warnf("Unable to install the guest agent: %v", err)
+		} else {
+			d.AgentInstalled = true
+		}
+	}
+	if err := d.setupExtraDisks(); err != nil {
+		return fmt.Errorf("setting up extra disks: %w", err)
+	}
+	if d.waitsForSSH() {
+		if err := d.applyEngineOptions(); err != nil {
+			log.Warnf("Unable to apply the engine options: %v", err)
+		}
+	}
+	if err := d.configureProxy(); err != nil {
+		return fmt.Errorf("configuring the guest proxy: %w", err)
+	}
+	if err := d.installCACerts(); err != nil {
+		return fmt.Errorf("installing CA certificates: %w", err)
+	}
+	if err := d.runProvisionScript(); err != nil {
+		return fmt.Errorf("provisioning %s: %w", d.MachineName, err)
 	}
 
-	log.Debugf("Using UUID %s", h.UUID)
-	mac, err := GetMACAddressFromUUID(h.UUID)
-	if err != nil {
-		return fmt.Errorf("getting MAC address from UUID: %w", err)
+	if len(d.NFSShares) > 0 {
+		log.Info("Setting up NFS mounts with NFS flags: ", d.NFSFlags)
+		// takes some time here for ssh / nfsd to work properly
+		if err := sleepContext(ctx, time.Second*30); err != nil {
+			return err
+		}
+		nfsStarted := time.Now()
+		err = d.setupNFSShare()
+		if err != nil {
+			// TODO(tstromberg): Check that logging an and error and return it is appropriate. Seems weird.
+			log.Errorf("NFS setup failed: %v", err)
+			return err
+		}
+		d.emit(eventNFSMounted, strings.Join(d.NFSShares, " "))
+		d.observeNFSSetup(nfsStarted)
 	}
 
-	// Need to strip 0's
-	mac = trimMacAddress(mac)
-	log.Debugf("Generated MAC %s", mac)
+	return nil
+}
 
-	disk, err := hyperkit.NewDisk(pkgdrivers.GetDiskPath(d.BaseDriver), d.DiskSize)
+// checkDiskNotInUse fails if a VM process already has the machine's disk
+// attached, as booting it twice corrupts its filesystem. hyperkit holds an
+// exclusive flock(2) on its disks while it runs.
+func (d *Driver) checkDiskNotInUse() error {
+	disk := d.rootDisk()
+	f, err := os.Open(disk)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		log.Warnf("Unable to check whether %s is in use: %v", disk, err)
+		return nil
+	}
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return fmt.Errorf("%s is locked by another VM process, stop it before starting %s again", disk, d.MachineName)
+	}
 	if err != nil {
-		return fmt.Errorf("error creating disk: %w", err)
+		log.Warnf("Unable to check whether %s is in use: %v", disk, err)
+		return nil
+	}
+	// Closing the file releases the flock
+	return nil
+}
+
+// machineUUID returns the UUID the machine runs with, which determines its
+// MAC address
+func (d *Driver) machineUUID() string {
+	if d.UUID != "" {
+		return d.UUID
 	}
-	h.Disks = []hyperkit.Disk{disk}
+	return uuid.NewSHA1(uuid.Nil, []byte(d.GetMachineName())).String()
+}
 
-	log.Debugf("Starting with cmdline: %s", d.Cmdline)
-	if _, err := h.Start(d.Cmdline); err != nil {
-		return fmt.Errorf("starting with cmd line: %s: %w", d.Cmdline, err)
+// macAddress returns the MAC address b gives the machine, in the format of
+// the dhcp leases file
+func (d *Driver) macAddress(b backend) (string, error) {
+	mac, err := b.macAddress(d.machineUUID())
+	if err != nil {
+		return "", fmt.Errorf("getting MAC address from UUID: %w", err)
 	}
+	// Need to strip 0's
+	return trimMacAddress(mac), nil
+}
 
+// waitForIP waits for the machine with the given MAC address to show up in
+// the dhcp leases file, while making sure hyperkit is still running.
+func (d *Driver) waitForIP(ctx context.Context, mac string) error {
 	getIP := func() error {
 		st, err := d.GetState()
 		if err != nil {
 			return fmt.Errorf("get state: %w", err)
 		}
 		if st == state.Error || st == state.Stopped {
-			return fmt.Errorf("hyperkit crashed! command line:\n  hyperkit %s", d.Cmdline)
+			return fmt.Errorf("hyperkit crashed! command line:\n  hyperkit %s", d.kernelCmdline())
 		}
 
-		d.IPAddress, err = GetIPAddressByMACAddress(mac)
+		d.IPAddress, err = d.discoverIP(mac)
 		if err != nil {
 			return &tempError{err}
 		}
 		return nil
 	}
 
-	for i := 0; i < 30; i++ {
+	// Wake up as soon as a lease is written, polling remains the fallback
+	// and drives the other discovery strategies
+	sleep := func(timeout time.Duration) error {
+		return sleepContext(ctx, timeout)
+	}
+	if w, err := newLeaseWatcher(d.leasesPath()); err != nil {
+		log.Debugf("Not watching %s, polling instead: %v", d.leasesPath(), err)
+	} else {
+		defer w.Close()
+		sleep = func(timeout time.Duration) error {
+			// Wait in short steps to notice ctx being done
+			deadline := time.Now().Add(timeout)
+			for ctx.Err() == nil {
+				step := time.Until(deadline)
+				if step <= 0 {
+					return nil
+				}
+				if step > waitPollInterval {
+					step = waitPollInterval
+				}
+				if w.Wait(step) {
+					return nil
+				}
+			}
+			return ctx.Err()
+		}
+	}
+
+	var err error
+	timeout := time.Duration(d.IPTimeout) * time.Second
+	deadline := time.Now().Add(timeout)
+	interval := time.Duration(d.IPPollInterval) * time.Second
+	for i := 0; ; i++ {
 		log.Debugf("Attempt %d", i)
 		err = getIP()
 		if err == nil {
@@ -361,29 +1602,44 @@ func (d *Driver) Start() error {
 		if _, ok := err.(*tempError); !ok {
 			return err
 		}
-		time.Sleep(2 * time.Second)
+		warnings.Warnf("Waiting for IP address: %v", err)
+		// Make a last attempt at the deadline rather than giving up early
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			break
+		}
+		if wait > interval {
+			wait = interval
+		}
+		if err := sleep(wait); err != nil {
+			return err
+		}
+		interval = nextIPPollInterval(interval)
 	}
+	d.audit(auditLeaseRead, d.leasesPath(), err)
 
 	if err != nil {
-		return fmt.Errorf("IP address never found in dhcp leases file %v", err)
-	}
-	log.Debugf("IP: %s", d.IPAddress)
-
-	if len(d.NFSShares) > 0 {
-		log.Info("Setting up NFS mounts with NFS flags: ", d.NFSFlags)
-		// takes some time here for ssh / nfsd to work properly
-		time.Sleep(time.Second * 30)
-		err = d.setupNFSShare()
-		if err != nil {
-			// TODO(tstromberg): Check that logging an and error and return it is appropriate. Seems weird.
-			log.Errorf("NFS setup failed: %v", err)
-			return err
+		// The most common reason, worth a specific error
+		if ferr := checkFirewall(); ferr != nil {
+			return ferr
 		}
+		return newError(ErrIPTimeout, "check the machine's console log, and that the macOS firewall doesn't block bootpd",
+			fmt.Errorf("IP address never found in dhcp leases file after %s %v", timeout, err))
 	}
-
 	return nil
 }
 
+// nextIPPollInterval doubles the IP lookup interval, up to maxIPPollInterval
+func nextIPPollInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return time.Second
+	}
+	if interval *= 2; interval > maxIPPollInterval {
+		return maxIPPollInterval
+	}
+	return interval
+}
+
 type tempError struct {
 	Err error
 }
@@ -421,7 +1677,7 @@ func (d *Driver) recoverFromUncleanShutdown() error {
 		return fmt.Errorf("parsing pidfile %s: %w", pidFile, err)
 	}
 
-	st, err := pidState(pid)
+	st, err := d.pidState(pid)
 	if err != nil {
 		return fmt.Errorf("pidState: %w", err)
 	}
@@ -438,18 +1694,45 @@ func (d *Driver) recoverFromUncleanShutdown() error {
 }
 
 // Stop a host gracefully
-func (d *Driver) Stop() error {
+func (d *Driver) Stop() (err error) {
 	if err := d.verifyRootPermissions(); err != nil {
 		return err
 	}
-	d.cleanupNfsExports()
-	err := d.sendSignal(syscall.SIGTERM)
+	unlock, err := d.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := d.runHooks(hookPreStop); err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			// Only unexport the shares once the guest is down, so it can
+			// still unmount them while powering off
+			d.cleanupNfsExports()
+			d.discardEphemeralDisk()
+			d.detachEncryptedDisk()
+		}
+	}()
+	d.emit(eventStopping, "")
+	d.requestStop()
+
+	if d.poweroffGuest() {
+		log.Info("Machine shut down by guest poweroff")
+		d.emit(eventStopped, "")
+		d.updateMetrics(func(m *machineMetrics) { m.Stops++ })
+		return nil
+	}
+
+	// hyperkit turns SIGTERM into an ACPI power button press
+	err = d.sendSignal(syscall.SIGTERM)
 	if err != nil {
 		return fmt.Errorf("hyperkit sigterm failed: %w", err)
 	}
 
-	// wait 5s for graceful shutdown
-	for i := 0; i < 5; i++ {
+	// wait for graceful shutdown
+	for i := 0; i < d.StopTimeout; i++ {
 		log.Debug("waiting for graceful shutdown")
 		time.Sleep(time.Second * 1)
 		s, err := d.GetState()
@@ -457,37 +1740,116 @@ func (d *Driver) Stop() error {
 			return fmt.Errorf("hyperkit waiting graceful shutdown failed: %w", err)
 		}
 		if s == state.Stopped {
+			log.Info("Machine shut down by ACPI power button (SIGTERM)")
+			d.emit(eventStopped, "")
+			d.updateMetrics(func(m *machineMetrics) { m.Stops++ })
 			return nil
 		}
 	}
 
-	log.Debug("sending sigkill")
+	log.Info("Machine did not shut down gracefully, sending SIGKILL")
 	return d.Kill()
 }
 
+// poweroffGuest asks the guest to power itself off over SSH and waits up to
+// ShutdownTimeout seconds for hyperkit to exit. It reports whether the machine
+// is stopped.
+func (d *Driver) poweroffGuest() bool {
+	if d.ShutdownTimeout <= 0 || (d.IPAddress == "" && !d.sshOverVSock()) {
+		return false
+	}
+
+	log.Debug("Powering off guest over SSH")
+	if _, err := drivers.RunSSHCommandFromDriver(d, "sudo poweroff"); err != nil {
+		// The connection is usually torn down by the shutdown itself.
+		log.Debugf("poweroff over SSH returned: %v", err)
+	}
+
+	timeout := time.Duration(d.ShutdownTimeout) * time.Second
+	if err := d.WaitFor(context.Background(), WaitStopped, timeout); err != nil {
+		log.Debugf("Guest did not power off within %s: %v", timeout, err)
+		return false
+	}
+	return true
+}
+
+// extractKernel extracts the kernel and initrd from the ISO at isoPath. They
+// are only extracted again once the ISO changed, or they were removed.
 func (d *Driver) extractKernel(isoPath string) error {
-	files, err := ISOExtractBootFiles(isoPath, d.ResolveStorePath(""))
+	sum, err := fileSHA256(isoPath)
 	if err != nil {
 		return err
 	}
+	checksum := hex.EncodeToString(sum)
+	if checksum == d.ISOChecksum && d.bootFilesPresent() {
+		log.Debugf("%s is unchanged, keeping the extracted kernel and initrd", isoPath)
+		return nil
+	}
+
+	files, err := d.isoBootFiles(isoPath, checksum)
+	if err != nil {
+		return err
+	}
+
+	entry := isoBootEntry(files)
+	if files.IsoLinuxCfgPath == "" && files.GrubCfgPath == "" {
+		log.Debugf("No isolinux or grub config found in %s", isoPath)
+	}
 
 	if files.KernelPath == "" {
-		return fmt.Errorf("failed to extract kernel boot image from iso: %w", err)
+		return fmt.Errorf("failed to extract kernel boot image from iso, use --hyperkit-iso-kernel-path to locate it")
+	}
+	if err := checkKernelUncompressed(files.KernelPath); err != nil {
+		return err
 	}
 	d.BootKernel = files.KernelPath
 
+	if len(entry.initrds) > 1 && d.ISOInitrdPath == "" {
+		if files.InitrdPath, err = combineInitrds(isoPath, d.ResolveStorePath(""), entry.initrds); err != nil {
+			return fmt.Errorf("combining initrds: %w", err)
+		}
+	}
 	if files.InitrdPath == "" {
-		return fmt.Errorf("failed to extract initial ram disk from iso: %w", err)
+		return fmt.Errorf("failed to extract initial ram disk from iso, use --hyperkit-iso-initrd-path to locate it")
+	}
+	if err := decompressInitrd(files.InitrdPath); err != nil {
+		return err
 	}
 	d.BootInitrd = files.InitrdPath
 
-	if files.IsoLinuxCfgPath == "" {
-		return fmt.Errorf("failed to extract isolinux config: %w", err)
-	}
+	d.ISOCmdline = entry.cmdline
+	log.Debugf("Kernel command line of %s: %s", isoPath, d.ISOCmdline)
+	d.ISOChecksum = checksum
 
 	return nil
 }
 
+// bootFilesPresent reports whether the kernel and initrd are in place
+func (d *Driver) bootFilesPresent() bool {
+	for _, path := range []string{d.BootKernel, d.BootInitrd} {
+		if path == "" {
+			return false
+		}
+		if _, err := os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// restoreBootFiles puts back a kernel or initrd that went missing from the
+// machine dir, from the ISO or the netboot cache
+func (d *Driver) restoreBootFiles(ctx context.Context) error {
+	if d.bootFilesPresent() {
+		return nil
+	}
+	log.Infof("The kernel or initrd of %s is missing, restoring it", d.MachineName)
+	if d.netboot() {
+		return d.fetchNetbootFiles(ctx)
+	}
+	return d.extractKernel(d.ResolveStorePath(isoFilename))
+}
+
 // InvalidPortNumberError implements the Error interface.
 // It is used when a VSockPorts port number cannot be recognised as an integer.
 type InvalidPortNumberError string
@@ -512,62 +1874,105 @@ func (d *Driver) extractVSockPorts() ([]int, error) {
 }
 
 func (d *Driver) setupNFSShare() error {
+	return d.setupNFSShares(d.NFSShares)
+}
+
+// setupNFSShares exports the given shares to the machine and mounts them,
+// failing with a ShareMountError if any of them isn't mounted. Shares
+// conflicting with an existing export are mounted through it if it
+// covers them for the machine.
+func (d *Driver) setupNFSShares(shares []string) error {
+	if d.sftpShares() {
+		return d.setupSFTPShares(shares)
+	}
 	user, err := user.Current()
 	if err != nil {
 		return err
 	}
 
-	hostIP, err := GetNetAddr()
+	hostIP, err := d.nfsHostIP()
 	if err != nil {
 		return err
 	}
 
-	mountCommands := fmt.Sprintf("#/bin/bash\\n")
 	log.Info(d.IPAddress)
+	if d.IPAddress == "" {
+		return fmt.Errorf("NFS exports need the IP address of machine %s", d.MachineName)
+	}
 
-	for _, share := range d.NFSShares {
-		a := strings.Split(share, ":")
-		share = a[0]
-		_share := share
-		_mnt_sub_path := _share
-		if len(a) > 1 {
-			_mnt_sub_path = a[1]
-		}
+	for _, share := range shares {
+		s := parseNFSShare(share)
+		share = s.Host
 		if !path.IsAbs(share) {
-			share = d.ResolveStorePath(share)
-			// rz: create path if it doesn't exist in the store...
-			_ = os.MkdirAll(share, os.ModeDir|0777)
-			// rz: we are suid root but NFS users will be mapped to the current user, so...
-			uid, _ := strconv.Atoi(user.Uid)
-			gid, _ := strconv.Atoi(user.Gid)
-			_ = os.Chown(share, uid, gid)
-		}
-		nfsConfig := fmt.Sprintf("%s %s -alldirs -mapall=%s", share, d.IPAddress, user.Username)
-
-		if _, err := nfsexports.Add("", d.nfsExportIdentifier(share), nfsConfig); err != nil {
-			if strings.Contains(err.Error(), "conflicts with existing export") {
-				log.Info("Conflicting NFS Share not setup and ignored:", err)
-				continue
-			}
-			return err
+			share = d.createStoreShare(share, user)
 		}
+		nfsConfig := nfsExportLine(share, d.IPAddress, user.Username)
 
-		root := d.NFSSharesRoot
-		mountCommands += fmt.Sprintf("sudo mkdir -p %s/%s\\n", root, _mnt_sub_path)
-		mountCommands += fmt.Sprintf("sudo mount -t nfs -o %s %s:%s %s/%s\\n", d.NFSFlags, hostIP, share, root, _mnt_sub_path)
+		if err := d.addNFSExport(share, nfsConfig); err != nil {
+			if !strings.Contains(err.Error(), "conflicts with existing export") {
+				return err
+			}
+			e, err := d.resolveExportConflict(share, err)
+			if err != nil {
+				return err
+			}
+			log.Infof("%s is already exported to %s by %q, mounting it through that", share, d.IPAddress, e.Line)
+		}
 	}
 
-	if err := nfsexports.ReloadDaemon(); err != nil {
+	if err := d.reloadNFSDaemon(); err != nil {
 		return err
 	}
 
-	writeScriptCmd := fmt.Sprintf("echo -e \"%s\" | sh", mountCommands)
+	_, err = d.mountShares(hostIP, shares)
+	return err
+}
 
-	if _, err := drivers.RunSSHCommandFromDriver(d, writeScriptCmd); err != nil {
-		return err
+// createStoreShare creates the directory of a share relative to the machine
+// dir, owned by user, and returns its path
+func (d *Driver) createStoreShare(share string, user *user.User) string {
+	share = d.ResolveStorePath(share)
+	// rz: create path if it doesn't exist in the store...
+	_ = os.MkdirAll(share, os.ModeDir|0777)
+	// rz: we are suid root but NFS users will be mapped to the current user, so...
+	uid, _ := strconv.Atoi(user.Uid)
+	gid, _ := strconv.Atoi(user.Gid)
+	_ = os.Chown(share, uid, gid)
+	return share
+}
+
+// nfsSharePath returns the host path of a share, which identifies its export
+func (d *Driver) nfsSharePath(share string) string {
+	share = parseNFSShare(share).Host
+	if !path.IsAbs(share) {
+		return d.ResolveStorePath(share)
 	}
+	return share
+}
 
-	return nil
+// nfsMountFlags returns the guest mount options of share
+func (d *Driver) nfsMountFlags(s nfsShare) string {
+	if s.Flags != "" || d.sftpShares() {
+		return s.Flags
+	}
+	return d.NFSFlags
+}
+
+// nfsMountCommands returns the guest commands mounting the host path share
+// at subPath below NFSSharesRoot with the mount options flags
+func (d *Driver) nfsMountCommands(hostIP net.IP, share, subPath, flags string) string {
+	root := d.NFSSharesRoot
+	if d.sftpShares() {
+		return sftpMountCommands(hostIP, d.FileServerPort, d.fileServerToken(), share, path.Join(root, subPath), flags)
+	}
+	mountPoint := shellQuote(root + "/" + subPath)
+	return fmt.Sprintf("sudo mkdir -p %s\\n", mountPoint) +
+		fmt.Sprintf("sudo mount -t nfs -o %s %s %s\\n", flags, shellQuote(hostIP.String()+":"+share), mountPoint)
+}
+
+// nfsExportLine returns the /etc/exports entry sharing path with ip
+func nfsExportLine(path, ip, username string) string {
+	return fmt.Sprintf("%s %s -alldirs -mapall=%s", quoteExportPath(path), ip, username)
 }
 
 func (d *Driver) nfsExportIdentifier(path string) string {
@@ -575,46 +1980,142 @@ func (d *Driver) nfsExportIdentifier(path string) string {
 }
 
 func (d *Driver) sendSignal(s os.Signal) error {
+	if sig, ok := s.(syscall.Signal); ok && d.useHelper() {
+		_, err := d.runHelper(helperSignal, strconv.Itoa(int(sig)))
+		return err
+	}
 	pid := d.getPid()
 	proc, err := os.FindProcess(pid)
 	if err != nil {
 		return err
 	}
 
-	return proc.Signal(s)
+	err = proc.Signal(s)
+	d.audit(auditSignal, fmt.Sprintf("%s to pid %d", s, pid), err)
+	return err
 }
 
-func (d *Driver) getPid() int {
-	pidPath := d.ResolveStorePath(machineFileName)
+// machineStateVersion is the version of the driver's additions to the
+// machine state file
+const machineStateVersion = 1
+
+// machineState is the part of the hyperkit.json machine state file used by
+// the driver. The file itself is written by hyperkit, and the driver adds the
+// identity of the launched process to it.
+type machineState struct {
+	Pid     int              `json:"pid"`
+	Process *processIdentity `json:"process_identity,omitempty"`
+	Version int              `json:"driver_state_version,omitempty"`
+}
 
-	f, err := os.Open(pidPath)
+func (d *Driver) readMachineState() (*machineState, error) {
+	f, err := os.Open(d.ResolveStorePath(machineFileName))
 	if err != nil {
-		log.Warnf("Error reading pid file: %v", err)
+		return nil, err
+	}
+	defer f.Close()
+
+	ms := &machineState{}
+	if err := json.NewDecoder(f).Decode(ms); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+func (d *Driver) getPid() int {
+	ms, err := d.readMachineState()
+	if os.IsNotExist(err) {
+		warnings.Warnf("Error reading pid file: %v", err)
 		return 0
 	}
+	if err != nil {
+		// A corrupt state file must not make a running machine look stopped,
+		// or a second instance could be started on the same disk
+		warnings.Warnf("Error reading pid file: %v, looking for the machine's process instead", err)
+		return d.recoverPid()
+	}
+	if ms.Version > machineStateVersion {
+		warnings.Warnf("%s has version %d, newer than the supported %d", machineFileName, ms.Version, machineStateVersion)
+	}
+	return ms.Pid
+}
 
-	dec := json.NewDecoder(f)
-	config := struct {
-		Pid int `json:pid`
-	}{}
-	if err := dec.Decode(&config); err != nil {
-		log.Warnf("Error decoding pid file: %v", err)
+// recoverPid finds the VM process using the machine's disk in the process
+// table, and rewrites the state file for it
+func (d *Driver) recoverPid() int {
+	pid, err := findProcessWithArg(d.rootDisk())
+	if err != nil {
+		warnings.Warnf("Unable to look for the machine's process: %v", err)
+		return 0
+	}
+	if pid == 0 {
 		return 0
 	}
+	log.Infof("Found the machine's process %d, rewriting %s", pid, machineFileName)
+	b, err := json.Marshal(machineState{Pid: pid, Version: machineStateVersion})
+	if err == nil {
+		err = writeFileAtomic(d.ResolveStorePath(machineFileName), b, 0644)
+	}
+	if err != nil {
+		log.Warnf("Unable to rewrite %s: %v", machineFileName, err)
+	}
+	return pid
+}
+
+// recordProcessIdentity adds the path and start time of the hyperkit process
+// to the machine state file, keeping everything hyperkit wrote there intact.
+func (d *Driver) recordProcessIdentity(pid int) error {
+	identity, err := lookupProcessIdentity(pid)
+	if err != nil {
+		return err
+	}
 
-	return config.Pid
+	path := d.ResolveStorePath(machineFileName)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if raw["process_identity"], err = json.Marshal(identity); err != nil {
+		return err
+	}
+	if raw["driver_state_version"], err = json.Marshal(machineStateVersion); err != nil {
+		return err
+	}
+	if b, err = json.Marshal(raw); err != nil {
+		return err
+	}
+	log.Debugf("Recording hyperkit process identity: %s started at %s", identity.Path, identity.StartTime)
+	return writeFileAtomic(path, b, 0644)
 }
 
 func (d *Driver) cleanupNfsExports() {
+	if d.sftpShares() {
+		d.stopFileServer()
+		return
+	}
 	if len(d.NFSShares) > 0 {
 		//log.Infof("You must be root to remove NFS shared folders. Please type root password.")
+		removed := 0
 		for _, share := range d.NFSShares {
-			if _, err := nfsexports.Remove("", d.nfsExportIdentifier(share)); err != nil {
+			id := d.nfsExportIdentifier(d.nfsSharePath(share))
+			if exists, err := nfsexports.Exists("", id); err == nil && !exists {
+				continue
+			}
+			if err := d.removeNFSExport(d.nfsSharePath(share)); err != nil {
 				log.Errorf("failed removing nfs share (%s): %v", share, err)
+				continue
 			}
+			removed++
 		}
 
-		if err := nfsexports.ReloadDaemon(); err != nil {
+		if removed == 0 {
+			return
+		}
+		if err := d.reloadNFSDaemon(); err != nil {
 			log.Errorf("failed to reload the nfs daemon: %v", err)
 		}
 	}
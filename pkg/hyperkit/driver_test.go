@@ -19,7 +19,14 @@ limitations under the License.
 package hyperkit
 
 import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
 )
 
 func Test_portExtraction(t *testing.T) {
@@ -84,3 +91,109 @@ func testEq(a, b []int) bool {
 
 	return true
 }
+
+func TestDriver_extractKernelUnchangedISO(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Not an ISO, extracting it fails
+	iso := filepath.Join(dir, isoFilename)
+	for _, name := range []string{isoFilename, "bzImage", "initrd.img"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum, err := fileSHA256(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Driver{
+		BaseDriver:  &drivers.BaseDriver{MachineName: "dev", StorePath: dir},
+		BootKernel:  filepath.Join(dir, "bzImage"),
+		BootInitrd:  filepath.Join(dir, "initrd.img"),
+		ISOChecksum: hex.EncodeToString(sum),
+	}
+	if err := d.extractKernel(iso); err != nil {
+		t.Errorf("extractKernel() of an unchanged ISO error = %v", err)
+	}
+
+	if err := os.Remove(d.BootInitrd); err != nil {
+		t.Fatal(err)
+	}
+	if d.bootFilesPresent() {
+		t.Error("bootFilesPresent() = true with the initrd removed")
+	}
+	if err := d.extractKernel(iso); err == nil {
+		t.Error("extractKernel() didn't extract again with the initrd removed")
+	}
+
+	d.ISOChecksum = "stale"
+	if err := ioutil.WriteFile(d.BootInitrd, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.extractKernel(iso); err == nil {
+		t.Error("extractKernel() didn't extract again after the ISO changed")
+	}
+}
+
+func TestDriver_checkDiskNotInUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "dev", StorePath: dir}}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+	disk := d.rootDisk()
+	if err := ioutil.WriteFile(disk, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.checkDiskNotInUse(); err != nil {
+		t.Fatalf("checkDiskNotInUse() on an unused disk = %v", err)
+	}
+
+	// Hold the disk like a running hyperkit
+	f, err := os.Open(disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.checkDiskNotInUse(); err == nil {
+		t.Error("checkDiskNotInUse() on a locked disk succeeded")
+	}
+}
+
+func TestDriver_validateConfigIPSettings(t *testing.T) {
+	tests := []struct {
+		name                  string
+		timeout, pollInterval int
+		wantErr               bool
+	}{
+		{"defaults", defaultIPTimeout, defaultIPPollInterval, false},
+		{"zero timeout", 0, defaultIPPollInterval, true},
+		{"negative timeout", -1, defaultIPPollInterval, true},
+		{"zero poll interval", defaultIPTimeout, 0, true},
+		{"negative poll interval", defaultIPTimeout, -2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver("dev", "")
+			d.BaseDriver = &drivers.BaseDriver{MachineName: "dev", SSHUser: defaultSSHUser, SSHPort: defaultSSHPort}
+			d.CPU = defaultCPUs
+			d.Memory = defaultMemory
+			d.IPTimeout = tt.timeout
+			d.IPPollInterval = tt.pollInterval
+			if err := d.validateConfig(); (err != nil) != tt.wantErr {
+				t.Errorf("validateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/log"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+const (
+	// encryptedBundleFileName is the encrypted sparse bundle holding the
+	// root disk of a machine created with --hyperkit-encrypt-disk
+	encryptedBundleFileName = "disk.sparsebundle"
+	// encryptedMountFileName is where the bundle is attached, the root disk
+	// path is a symlink into it
+	encryptedMountFileName = "encrypted-disk"
+	// encryptedBundleSlack is the room in MB the bundle's filesystem gets
+	// on top of the disk. The bundle only takes up what is written to it.
+	encryptedBundleSlack = 1024
+	// keychainService names the passphrases of the bundles in the keychain
+	keychainService = "docker-machine-driver-hyperkit"
+)
+
+// validateEncryptDisk checks that nothing would leave a plain copy of an
+// encrypted root disk in the machine dir
+func (d *Driver) validateEncryptDisk() error {
+	if d.EncryptDisk && d.Ephemeral {
+		return fmt.Errorf("ephemeral machines can't have an encrypted disk, their disk is copied on every start")
+	}
+	return nil
+}
+
+func (d *Driver) encryptedBundlePath() string {
+	return d.ResolveStorePath(encryptedBundleFileName)
+}
+
+func (d *Driver) encryptedMountPoint() string {
+	return d.ResolveStorePath(encryptedMountFileName)
+}
+
+// createEncryptedDisk creates and attaches a new encrypted sparse bundle for
+// the root disk, which is made right in it, see rawDiskPath, so none of it is
+// ever written unencrypted. A symlink at the usual disk path points into the
+// bundle, so everything else keeps using that. The passphrase is kept in the
+// user's keychain.
+func (d *Driver) createEncryptedDisk() error {
+	passphrase, err := newPassphrase()
+	if err != nil {
+		return err
+	}
+	bundle := d.encryptedBundlePath()
+	if err := storePassphrase(bundle, passphrase); err != nil {
+		return fmt.Errorf("storing the disk passphrase in the keychain: %w", err)
+	}
+	log.Infof("Creating encrypted sparse bundle %s", bundle)
+	size := strconv.Itoa(d.DiskSize+encryptedBundleSlack) + "m"
+	if err := hdiutil(passphrase, "create", "-size", size, "-type", "SPARSEBUNDLE", "-fs", "APFS", "-encryption", "AES-256", "-stdinpass", "-volname", d.MachineName, bundle); err != nil {
+		return fmt.Errorf("creating the encrypted disk bundle: %w", err)
+	}
+	if err := d.attachEncryptedDisk(); err != nil {
+		return err
+	}
+
+	disk := pkgdrivers.GetDiskPath(d.BaseDriver)
+	// Relative, so the link survives the store being moved
+	return os.Symlink(filepath.Join(encryptedMountFileName, filepath.Base(disk)), disk)
+}
+
+// rawDiskPath returns where the root disk is made: in the encrypted bundle
+// with EncryptDisk, at the usual disk path otherwise
+func (d *Driver) rawDiskPath() string {
+	disk := pkgdrivers.GetDiskPath(d.BaseDriver)
+	if d.EncryptDisk {
+		return filepath.Join(d.encryptedMountPoint(), filepath.Base(disk))
+	}
+	return disk
+}
+
+// attachEncryptedDisk attaches the encrypted bundle of the machine, unless
+// it is attached already
+func (d *Driver) attachEncryptedDisk() error {
+	mountPoint := d.encryptedMountPoint()
+	if !d.EncryptDisk || isMountPoint(mountPoint) {
+		return nil
+	}
+	bundle := d.encryptedBundlePath()
+	passphrase, err := readPassphrase(bundle)
+	if err != nil {
+		return fmt.Errorf("reading the disk passphrase from the keychain: %w", err)
+	}
+	if err := os.MkdirAll(mountPoint, 0700); err != nil {
+		return err
+	}
+	log.Debugf("Attaching %s at %s", bundle, mountPoint)
+	if err := hdiutil(passphrase, "attach", "-stdinpass", "-nobrowse", "-owners", "on", "-mountpoint", mountPoint, bundle); err != nil {
+		return fmt.Errorf("attaching the encrypted disk: %w", err)
+	}
+	return nil
+}
+
+// detachEncryptedDisk detaches the encrypted bundle of a stopped machine,
+// locking its disk again
+func (d *Driver) detachEncryptedDisk() {
+	mountPoint := d.encryptedMountPoint()
+	if !d.EncryptDisk || !isMountPoint(mountPoint) {
+		return
+	}
+	log.Debugf("Detaching %s", mountPoint)
+	if err := hdiutil("", "detach", mountPoint); err != nil {
+		log.Warnf("Unable to detach the encrypted disk of %s: %v", d.MachineName, err)
+	}
+}
+
+// removeEncryptedDisk deletes the encrypted bundle and its passphrase
+func (d *Driver) removeEncryptedDisk() {
+	if !d.EncryptDisk {
+		return
+	}
+	d.detachEncryptedDisk()
+	bundle := d.encryptedBundlePath()
+	if err := os.RemoveAll(bundle); err != nil {
+		log.Warnf("Unable to remove %s: %v", bundle, err)
+	}
+	if err := deletePassphrase(bundle); err != nil {
+		log.Warnf("Unable to remove the disk passphrase of %s from the keychain: %v", d.MachineName, err)
+	}
+}
+
+// isMountPoint reports whether path is the root of a mounted volume
+func isMountPoint(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	parent, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	parentSt, parentOK := parent.Sys().(*syscall.Stat_t)
+	return ok && parentOK && st.Dev != parentSt.Dev
+}
+
+func newPassphrase() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hdiutil runs hdiutil with args, handing it passphrase on stdin
+func hdiutil(passphrase string, args ...string) error {
+	cmd := exec.Command("/usr/bin/hdiutil", args...)
+	cmd.Stdin = strings.NewReader(passphrase)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("hdiutil %s: %v %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// storePassphrase adds the passphrase of bundle to the user's keychain. It
+// goes through security's stdin, where other users can't see it.
+func storePassphrase(bundle, passphrase string) error {
+	if strings.ContainsAny(bundle, "\"\\\n") {
+		return fmt.Errorf("can't store a passphrase for %q", bundle)
+	}
+	cmd := keychainCommand("-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a \"%s\" -w %s\n", keychainService, bundle, passphrase))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func readPassphrase(bundle string) (string, error) {
+	out, err := keychainCommand("find-generic-password", "-s", keychainService, "-a", bundle, "-w").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func deletePassphrase(bundle string) error {
+	if out, err := keychainCommand("delete-generic-password", "-s", keychainService, "-a", bundle).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// keychainCommand returns the security command with args, run as the user
+// who invoked the driver, so it uses their keychain rather than root's
+func keychainCommand(args ...string) *exec.Cmd {
+	return asCaller(exec.Command("/usr/bin/security", args...))
+}
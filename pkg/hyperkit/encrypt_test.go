@@ -0,0 +1,76 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateEncryptDisk(t *testing.T) {
+	tests := []struct {
+		encrypt, ephemeral bool
+		wantErr            bool
+	}{
+		{false, false, false},
+		{true, false, false},
+		{false, true, false},
+		{true, true, true},
+	}
+	for _, tt := range tests {
+		d := &Driver{EncryptDisk: tt.encrypt, Ephemeral: tt.ephemeral}
+		if err := d.validateEncryptDisk(); (err != nil) != tt.wantErr {
+			t.Errorf("validateEncryptDisk() with encrypt %v, ephemeral %v error = %v, wantErr %v", tt.encrypt, tt.ephemeral, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIsMountPoint(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if isMountPoint(tmpDir) {
+		t.Errorf("isMountPoint(%s) = true for a plain directory", tmpDir)
+	}
+	if isMountPoint(filepath.Join(tmpDir, "missing")) {
+		t.Error("isMountPoint() = true for a missing directory")
+	}
+	if !isMountPoint("/") && !isMountPoint("/proc") && !isMountPoint("/dev") {
+		t.Error("isMountPoint() = false for /, /proc and /dev")
+	}
+}
+
+func TestNewPassphrase(t *testing.T) {
+	a, err := newPassphrase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newPassphrase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a) != 64 || a == b {
+		t.Errorf("newPassphrase() = %q, %q, want distinct 64 hex digits", a, b)
+	}
+}
@@ -0,0 +1,135 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// guestDaemonConfig is where dockerd reads its configuration from
+const guestDaemonConfig = "/etc/docker/daemon.json"
+
+// loadEngineOptions reads the engine options docker-machine was created with
+// from the host config, which it saves before creating the machine
+func (d *Driver) loadEngineOptions() (*engine.Options, error) {
+	b, err := ioutil.ReadFile(d.ResolveStorePath(hostConfigFileName))
+	if err != nil {
+		return nil, err
+	}
+	host := struct {
+		HostOptions struct {
+			EngineOptions *engine.Options
+		}
+	}{}
+	if err := json.Unmarshal(b, &host); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", hostConfigFileName, err)
+	}
+	return host.HostOptions.EngineOptions, nil
+}
+
+// daemonConfig renders the engine options as dockerd's daemon.json, or
+// returns nil if there are none. Flags and environment variables have no
+// daemon.json equivalent and are returned as ignored.
+func daemonConfig(opts *engine.Options) (config []byte, ignored []string, err error) {
+	if opts == nil {
+		return nil, nil, nil
+	}
+	c := map[string]interface{}{}
+	if len(opts.InsecureRegistry) > 0 {
+		c["insecure-registries"] = opts.InsecureRegistry
+	}
+	if len(opts.RegistryMirror) > 0 {
+		c["registry-mirrors"] = opts.RegistryMirror
+	}
+	if len(opts.Labels) > 0 {
+		c["labels"] = opts.Labels
+	}
+	if opts.StorageDriver != "" {
+		c["storage-driver"] = opts.StorageDriver
+	}
+	if len(opts.DNS) > 0 {
+		c["dns"] = opts.DNS
+	}
+	if opts.LogLevel != "" {
+		c["log-level"] = opts.LogLevel
+	}
+	if opts.GraphDir != "" {
+		c["data-root"] = opts.GraphDir
+	}
+	if opts.Ipv6 {
+		c["ipv6"] = true
+	}
+	for _, f := range opts.ArbitraryFlags {
+		ignored = append(ignored, "--engine-opt "+f)
+	}
+	for _, e := range opts.Env {
+		ignored = append(ignored, "--engine-env "+e)
+	}
+	if len(c) == 0 {
+		return nil, ignored, nil
+	}
+	config, err = json.MarshalIndent(c, "", "  ")
+	return config, ignored, err
+}
+
+// guestOSID returns the ID from the guest's os-release
+func (d *Driver) guestOSID() (string, error) {
+	out, err := drivers.RunSSHCommandFromDriver(d, ". /etc/os-release && echo $ID")
+	return strings.TrimSpace(out), err
+}
+
+// applyEngineOptions writes the engine options into the guest's daemon.json
+// and restarts dockerd if that changed it. docker-machine's boot2docker
+// provisioner passes them as flags in its profile instead, which dockerd
+// refuses to combine with the same options in daemon.json, so boot2docker
+// guests are left to it.
+func (d *Driver) applyEngineOptions() error {
+	opts, err := d.loadEngineOptions()
+	if err != nil {
+		return err
+	}
+	config, ignored, err := daemonConfig(opts)
+	if err != nil || config == nil {
+		return err
+	}
+	id, err := d.guestOSID()
+	if err != nil {
+		return fmt.Errorf("detecting the guest OS: %w", err)
+	}
+	if id == "boot2docker" {
+		log.Debugf("Leaving the engine options to the boot2docker provisioner")
+		return nil
+	}
+	for _, opt := range ignored {
+		log.Warnf("%s can't be passed on to the docker daemon of %s, ignoring it", opt, d.MachineName)
+	}
+
+	log.Infof("Configuring the docker daemon of %s", d.MachineName)
+	cmd := fmt.Sprintf("cat > /tmp/daemon.json && (sudo cmp -s /tmp/daemon.json %[1]s || (sudo mkdir -p %[2]s && sudo mv /tmp/daemon.json %[1]s && (sudo systemctl restart docker || sudo service docker restart)))",
+		guestDaemonConfig, "/etc/docker")
+	return d.runSSHWithStdin(cmd, bytes.NewReader(config))
+}
@@ -0,0 +1,77 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/machine/libmachine/engine"
+)
+
+func TestDaemonConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        *engine.Options
+		want        string
+		wantIgnored []string
+	}{
+		{"no options", nil, "", nil},
+		{"defaults", &engine.Options{TLSVerify: true}, "", nil},
+		{
+			"registries and labels",
+			&engine.Options{InsecureRegistry: []string{"10.0.0.1:5000"}, RegistryMirror: []string{"https://mirror"}, Labels: []string{"env=dev"}, StorageDriver: "overlay2"},
+			`{
+  "insecure-registries": [
+    "10.0.0.1:5000"
+  ],
+  "labels": [
+    "env=dev"
+  ],
+  "registry-mirrors": [
+    "https://mirror"
+  ],
+  "storage-driver": "overlay2"
+}`,
+			nil,
+		},
+		{
+			"flags are ignored",
+			&engine.Options{LogLevel: "debug", ArbitraryFlags: []string{"experimental"}, Env: []string{"FOO=bar"}},
+			`{
+  "log-level": "debug"
+}`,
+			[]string{"--engine-opt experimental", "--engine-env FOO=bar"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ignored, err := daemonConfig(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("daemonConfig() = %s, want %s", got, tt.want)
+			}
+			if !reflect.DeepEqual(ignored, tt.wantIgnored) {
+				t.Errorf("daemonConfig() ignored %v, want %v", ignored, tt.wantIgnored)
+			}
+		})
+	}
+}
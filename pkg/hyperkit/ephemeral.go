@@ -0,0 +1,78 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/machine/libmachine/log"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// ephemeralDiskFileName is the throwaway copy of the root disk an ephemeral
+// machine runs on
+const ephemeralDiskFileName = "ephemeral.rawdisk"
+
+// rootDisk returns the root disk image the machine runs on: the ephemeral
+// copy while there is one, the machine's disk otherwise
+func (d *Driver) rootDisk() string {
+	if d.Ephemeral {
+		snapshot := d.ResolveStorePath(ephemeralDiskFileName)
+		if _, err := os.Stat(snapshot); err == nil {
+			return snapshot
+		}
+	}
+	return pkgdrivers.GetDiskPath(d.BaseDriver)
+}
+
+// prepareEphemeralDisk gives an ephemeral machine a fresh copy of its root
+// disk to run on. The first boot, during which docker-machine provisions the
+// machine, writes the disk itself: every later start gets back to the
+// machine as it was provisioned.
+func (d *Driver) prepareEphemeralDisk() error {
+	if !d.Ephemeral {
+		return nil
+	}
+	if !d.BaseDiskSealed {
+		log.Debugf("First boot of ephemeral machine %s, running on its disk", d.MachineName)
+		d.BaseDiskSealed = true
+		return nil
+	}
+	snapshot := d.ResolveStorePath(ephemeralDiskFileName)
+	if err := os.Remove(snapshot); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing the previous ephemeral disk: %w", err)
+	}
+	log.Debugf("Copying %s to %s", pkgdrivers.GetDiskPath(d.BaseDriver), snapshot)
+	if err := cloneFile(pkgdrivers.GetDiskPath(d.BaseDriver), snapshot, d.DiskIOPriority); err != nil {
+		os.Remove(snapshot)
+		return fmt.Errorf("copying the root disk: %w", err)
+	}
+	return nil
+}
+
+// discardEphemeralDisk throws away the writes of a stopped ephemeral machine
+func (d *Driver) discardEphemeralDisk() {
+	if !d.Ephemeral {
+		return
+	}
+	if err := os.Remove(d.ResolveStorePath(ephemeralDiskFileName)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Unable to remove the ephemeral disk: %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestDriver_EphemeralDisk(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	dir := filepath.Join(store, "machines", "dev")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	disk := filepath.Join(dir, "dev.rawdisk")
+	snapshot := filepath.Join(dir, ephemeralDiskFileName)
+	if err := ioutil.WriteFile(disk, []byte("provisioned"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "dev", StorePath: store}, Ephemeral: true}
+
+	// The first boot provisions the disk itself
+	if err := d.prepareEphemeralDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if !d.BaseDiskSealed || d.rootDisk() != disk {
+		t.Fatalf("first boot: sealed = %v, root disk = %s, want %s", d.BaseDiskSealed, d.rootDisk(), disk)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := d.prepareEphemeralDisk(); err != nil {
+			t.Fatal(err)
+		}
+		if d.rootDisk() != snapshot {
+			t.Fatalf("root disk = %s, want %s", d.rootDisk(), snapshot)
+		}
+		b, err := ioutil.ReadFile(snapshot)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "provisioned" {
+			t.Errorf("start %d: ephemeral disk holds %q, want a fresh copy", i, b)
+		}
+		if err := ioutil.WriteFile(snapshot, []byte("dirty"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d.discardEphemeralDisk()
+	if _, err := os.Stat(snapshot); !os.IsNotExist(err) {
+		t.Errorf("ephemeral disk not discarded: %v", err)
+	}
+	if d.rootDisk() != disk {
+		t.Errorf("root disk = %s after stop, want %s", d.rootDisk(), disk)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode identifies a class of driver failure. Codes are stable, so
+// callers can offer targeted fixes instead of matching error text.
+type ErrorCode string
+
+// Error codes of the driver
+const (
+	// ErrNoRoot means the driver binary isn't installed setuid root
+	ErrNoRoot ErrorCode = "NO_ROOT"
+	// ErrHyperkitMissing means no hyperkit, or fallback backend, was found
+	ErrHyperkitMissing ErrorCode = "HYPERKIT_MISSING"
+	// ErrIPTimeout means the machine never got an IP address
+	ErrIPTimeout ErrorCode = "IP_TIMEOUT"
+	// ErrISODownload means the boot ISO couldn't be downloaded or copied
+	ErrISODownload ErrorCode = "ISO_DOWNLOAD"
+	// ErrNFSExportConflict means a share overlaps an existing NFS export
+	ErrNFSExportConflict ErrorCode = "NFS_EXPORT_CONFLICT"
+	// ErrBootpdBlocked means the application firewall blocks bootpd, so
+	// the machine can't get a dhcp lease
+	ErrBootpdBlocked ErrorCode = "BOOTPD_BLOCKED"
+	// ErrVMNetConfig means the vmnet shared network config is broken
+	ErrVMNetConfig ErrorCode = "VMNET_CONFIG"
+	// ErrShareMount means shares couldn't be mounted in the machine
+	ErrShareMount ErrorCode = "SHARE_MOUNT"
+)
+
+// Error is a driver failure with a stable code and a remediation hint. The
+// code is part of the message too, as errors reach docker-machine as text
+// over the plugin RPC.
+type Error struct {
+	Code ErrorCode
+	Hint string
+	Err  error
+}
+
+func newError(code ErrorCode, hint string, err error) *Error {
+	return &Error{Code: code, Hint: hint, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Hint == "" {
+		return fmt.Sprintf("%v [%s]", e.Err, e.Code)
+	}
+	return fmt.Sprintf("%v. %s [%s]", e.Err, e.Hint, e.Code)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeOf returns the code of the driver error in err's chain, or an
+// empty code if there is none
+func ErrorCodeOf(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
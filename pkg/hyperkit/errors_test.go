@@ -0,0 +1,52 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorCodeOf(t *testing.T) {
+	base := errors.New("no lease for a:b:c:d:e:f")
+	typed := newError(ErrIPTimeout, "check the console log", base)
+	tests := []struct {
+		name    string
+		err     error
+		want    ErrorCode
+		wantMsg string
+	}{
+		{"typed", typed, ErrIPTimeout, "no lease for a:b:c:d:e:f. check the console log [IP_TIMEOUT]"},
+		{"wrapped", fmt.Errorf("starting: %w", typed), ErrIPTimeout, "starting: no lease for a:b:c:d:e:f. check the console log [IP_TIMEOUT]"},
+		{"no_hint", newError(ErrNoRoot, "", base), ErrNoRoot, "no lease for a:b:c:d:e:f [NO_ROOT]"},
+		{"untyped", base, "", "no lease for a:b:c:d:e:f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCodeOf(tt.err); got != tt.want {
+				t.Errorf("ErrorCodeOf() = %q, want %q", got, tt.want)
+			}
+			if got := tt.err.Error(); got != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", got, tt.wantMsg)
+			}
+			if !errors.Is(tt.err, base) {
+				t.Error("errors.Is() lost the underlying error")
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Lifecycle events of a machine
+const (
+	eventCreating   = "creating"
+	eventBooting    = "booting"
+	eventIPAcquired = "ip-acquired"
+	eventNFSMounted = "nfs-mounted"
+	eventUnmounted  = "nfs-unmounted"
+	eventRunning    = "running"
+	eventRebooting  = "rebooting"
+	eventStopping   = "stopping"
+	eventStopped    = "stopped"
+	eventCrashed    = "crashed"
+)
+
+const (
+	// eventsFile makes --hyperkit-events append to eventsFileName
+	eventsFile     = "file"
+	eventsFileName = "events.jsonl"
+	// eventsUnixPrefix makes --hyperkit-events send to a unix socket
+	eventsUnixPrefix = "unix:"
+	eventDialTimeout = time.Second
+)
+
+// Event is a lifecycle transition of a machine, sent as one line of JSON
+type Event struct {
+	Time    time.Time `json:"time"`
+	Machine string    `json:"machine"`
+	Event   string    `json:"event"`
+	// Detail is the IP address for ip-acquired, the mounted share for
+	// nfs-mounted, the unmounted one for nfs-unmounted and the reason for
+	// crashed
+	Detail string `json:"detail,omitempty"`
+}
+
+func validateEvents(events string) error {
+	if events == "" || events == eventsFile {
+		return nil
+	}
+	if path := strings.TrimPrefix(events, eventsUnixPrefix); path != events && path != "" {
+		return nil
+	}
+	return fmt.Errorf("invalid events destination %q, use %s or %s<socket path>", events, eventsFile, eventsUnixPrefix)
+}
+
+// emit sends a lifecycle event to the --hyperkit-events destination. Events
+// are best effort: a listener that isn't there doesn't fail the operation.
+func (d *Driver) emit(event, detail string) {
+	if d.Events == "" {
+		return
+	}
+	b, err := json.Marshal(Event{Time: time.Now().UTC(), Machine: d.MachineName, Event: event, Detail: detail})
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	if err := d.writeEvent(b); err != nil {
+		log.Debugf("Unable to send %s event: %v", event, err)
+	}
+}
+
+// writeEvent appends line to the events file, or sends it to the socket. The
+// socket is dialled as the user who invoked the driver, so they can't have
+// root write to sockets only root may connect to.
+func (d *Driver) writeEvent(line []byte) error {
+	if d.Events == eventsFile {
+		f, err := openCallerFile(d.ResolveStorePath(eventsFileName))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = f.Write(line)
+		return err
+	}
+	var conn net.Conn
+	err := withCallerIDs(func() error {
+		var err error
+		conn, err = net.DialTimeout("unix", strings.TrimPrefix(d.Events, eventsUnixPrefix), eventDialTimeout)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(eventDialTimeout))
+	_, err = conn.Write(line)
+	return err
+}
@@ -0,0 +1,119 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestValidateEvents(t *testing.T) {
+	tests := []struct {
+		events  string
+		wantErr bool
+	}{
+		{"", false},
+		{"file", false},
+		{"unix:/tmp/events.sock", false},
+		{"unix:", true},
+		{"/tmp/events.sock", true},
+		{"syslog", true},
+	}
+	for _, tt := range tests {
+		if err := validateEvents(tt.events); (err != nil) != tt.wantErr {
+			t.Errorf("validateEvents(%q) error = %v, wantErr %v", tt.events, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEmitFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir}, Events: eventsFile}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d.emit(eventBooting, "")
+	d.emit(eventIPAcquired, "192.168.64.2")
+	b, err := ioutil.ReadFile(d.ResolveStorePath(eventsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d events, want 2:\n%s", len(lines), b)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Machine != "test" || e.Event != eventIPAcquired || e.Detail != "192.168.64.2" || e.Time.IsZero() {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
+
+func TestEmitUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "events.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir}, Events: eventsUnixPrefix + sock}
+	d.emit(eventCrashed, "no console output available")
+	var e Event
+	if err := json.Unmarshal([]byte(<-received), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Event != eventCrashed || e.Detail != "no console output available" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	// Nobody listening isn't an error for the machine operation
+	l.Close()
+	d.emit(eventStopped, "")
+}
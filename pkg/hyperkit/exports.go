@@ -0,0 +1,231 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// exportsPath is where nfsd reads its exports from
+	exportsPath        = "/etc/exports"
+	exportConflictHint = "remove the overlapping entry from /etc/exports or share a different path"
+)
+
+// nfsExport is an entry of /etc/exports: one or more paths, their options
+// and the hosts or network they are exported to. The paths are on the data
+// volume, like those of the shares, see dataVolumePath.
+type nfsExport struct {
+	Line    string
+	Paths   []string
+	AllDirs bool
+	Hosts   []string
+	Network *net.IPNet
+}
+
+// parseExports reads the entries of an exports file, joining continued lines
+// and skipping comments
+func parseExports(b []byte) []nfsExport {
+	var exports []nfsExport
+	var line string
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasSuffix(l, "\\") {
+			line += strings.TrimSuffix(l, "\\") + " "
+			continue
+		}
+		line += l
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if e, ok := parseExport(strings.TrimSpace(line)); ok {
+			exports = append(exports, e)
+		}
+		line = ""
+	}
+	return exports
+}
+
+func parseExport(line string) (nfsExport, bool) {
+	fields := exportFields(line)
+	if len(fields) == 0 {
+		return nfsExport{}, false
+	}
+	e := nfsExport{Line: strings.Join(strings.Fields(line), " ")}
+	var network, mask string
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		name, value := f, ""
+		if j := strings.Index(f, "="); j >= 0 {
+			name, value = f[:j], f[j+1:]
+		}
+		switch {
+		case strings.HasPrefix(f, "/"):
+			e.Paths = append(e.Paths, dataVolumePath(filepath.Clean(f)))
+		case name == "-alldirs":
+			e.AllDirs = true
+		case name == "-network" || name == "-mask":
+			if value == "" && i+1 < len(fields) {
+				i++
+				value = fields[i]
+			}
+			if name == "-network" {
+				network = value
+			} else {
+				mask = value
+			}
+		case strings.HasPrefix(f, "-"):
+		default:
+			e.Hosts = append(e.Hosts, f)
+		}
+	}
+	if network != "" {
+		e.Network = parseExportNetwork(network, mask)
+	}
+	return e, len(e.Paths) > 0
+}
+
+// exportFields splits an exports entry at whitespace, except in double
+// quotes or escaped with a backslash, the way nfsd reads paths with spaces
+func exportFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	inField, quoted, escaped := false, false, false
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped, inField = true, true
+			continue
+		case r == '"':
+			quoted, inField = !quoted, true
+			continue
+		case !quoted && (r == ' ' || r == '\t'):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+			continue
+		}
+		field.WriteRune(r)
+		inField = true
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// quoteExportPath quotes path for an exports entry if it has spaces
+func quoteExportPath(path string) string {
+	if strings.Contains(path, " ") {
+		return `"` + path + `"`
+	}
+	return path
+}
+
+// parseExportNetwork parses the -network option, either as CIDR or with a
+// separate -mask
+func parseExportNetwork(network, mask string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(network); err == nil {
+		return n
+	}
+	ip := net.ParseIP(network).To4()
+	if ip == nil {
+		return nil
+	}
+	m := net.IPv4Mask(255, 255, 255, 0)
+	if mip := net.ParseIP(mask).To4(); mip != nil {
+		m = net.IPMask(mip)
+	}
+	return &net.IPNet{IP: ip.Mask(m), Mask: m}
+}
+
+// exportedTo reports whether the entry exports to ip, or to everyone
+func (e nfsExport) exportedTo(ip net.IP) bool {
+	if len(e.Hosts) == 0 && e.Network == nil {
+		return true
+	}
+	if e.Network != nil && e.Network.Contains(ip) {
+		return true
+	}
+	for _, h := range e.Hosts {
+		if hip := net.ParseIP(h); hip != nil && hip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// mountable reports whether path can be mounted through one of the entry's
+// paths, which must be path itself or, with -alldirs, a parent of it
+func (e nfsExport) mountable(path string) bool {
+	for _, p := range e.Paths {
+		if p == path || e.AllDirs && isSubPath(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlaps reports whether the entry exports path, a parent or a child of it
+func (e nfsExport) overlaps(path string) bool {
+	for _, p := range e.Paths {
+		if p == path || isSubPath(p, path) || isSubPath(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubPath(parent, path string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(parent, "/")+"/")
+}
+
+// resolveExportConflict is called when exporting path to the machine
+// conflicts with an existing export. It returns the entry that already lets
+// the machine mount path, or an error quoting the conflicting entries.
+func (d *Driver) resolveExportConflict(path string, conflict error) (nfsExport, error) {
+	b, err := ioutil.ReadFile(exportsPath)
+	if err != nil {
+		return nfsExport{}, newError(ErrNFSExportConflict, exportConflictHint, conflict)
+	}
+	return findExport(parseExports(b), dataVolumePath(filepath.Clean(path)), net.ParseIP(d.IPAddress), conflict)
+}
+
+func findExport(exports []nfsExport, path string, ip net.IP, conflict error) (nfsExport, error) {
+	var overlapping []string
+	for _, e := range exports {
+		if e.mountable(path) && e.exportedTo(ip) {
+			return e, nil
+		}
+		if e.overlaps(path) {
+			overlapping = append(overlapping, fmt.Sprintf("%q", e.Line))
+		}
+	}
+	if len(overlapping) == 0 {
+		return nfsExport{}, newError(ErrNFSExportConflict, exportConflictHint, conflict)
+	}
+	return nfsExport{}, newError(ErrNFSExportConflict, exportConflictHint, fmt.Errorf("%s conflicts with the %s entry %s", path, exportsPath, strings.Join(overlapping, ", ")))
+}
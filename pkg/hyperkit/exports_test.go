@@ -0,0 +1,104 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+const testExports = `# BEGIN: minikube-hyperkit dev-/Users
+/Users 192.168.64.2 -alldirs -mapall=me
+# END: minikube-hyperkit dev-/Users
+/opt/data -ro \
+  -network 192.168.64.0 -mask 255.255.255.0
+/Volumes/src -alldirs
+/srv/www 10.0.0.5
+`
+
+func TestParseExports(t *testing.T) {
+	exports := parseExports([]byte(testExports))
+	if len(exports) != 4 {
+		t.Fatalf("parsed %d exports, want 4: %+v", len(exports), exports)
+	}
+	if e := exports[1]; e.Paths[0] != "/System/Volumes/Data/opt/data" || e.Network == nil || e.Network.String() != "192.168.64.0/24" || e.AllDirs {
+		t.Errorf("continued entry parsed as %+v", e)
+	}
+	if e := exports[0]; !e.AllDirs || len(e.Hosts) != 1 || e.Hosts[0] != "192.168.64.2" {
+		t.Errorf("entry parsed as %+v", e)
+	}
+}
+
+func TestExportFields(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"/Users 192.168.64.2 -alldirs", []string{"/Users", "192.168.64.2", "-alldirs"}},
+		{`"/Users/me/My Projects"  192.168.64.2`, []string{"/Users/me/My Projects", "192.168.64.2"}},
+		{`/Users/me/My\ Projects -ro`, []string{"/Users/me/My Projects", "-ro"}},
+		{`"" -ro`, []string{"", "-ro"}},
+	}
+	for _, tt := range tests {
+		if got := exportFields(tt.line); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("exportFields(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	line := nfsExportLine("/Users/me/My Projects", "192.168.64.2", "me")
+	if e, ok := parseExport(line); !ok || e.Paths[0] != "/System/Volumes/Data/Users/me/My Projects" {
+		t.Errorf("parseExport(%q) = %+v", line, e)
+	}
+}
+
+func TestFindExport(t *testing.T) {
+	exports := parseExports([]byte(testExports))
+	conflict := errors.New("conflicts with existing export")
+	tests := []struct {
+		path, ip string
+		want     string
+		wantErr  string
+	}{
+		{"/Users/me/src", "192.168.64.2", "/Users 192.168.64.2 -alldirs -mapall=me", ""},
+		{"/Users", "192.168.64.2", "/Users 192.168.64.2 -alldirs -mapall=me", ""},
+		{"/Users/me/src", "192.168.64.3", "", `"/Users 192.168.64.2 -alldirs -mapall=me"`},
+		{"/opt/data", "192.168.64.3", "/opt/data -ro -network 192.168.64.0 -mask 255.255.255.0", ""},
+		{"/opt/data/sub", "192.168.64.3", "", "/opt/data -ro"},
+		{"/Volumes/src/app", "192.168.64.9", "/Volumes/src -alldirs", ""},
+		{"/srv", "10.0.0.5", "", `"/srv/www 10.0.0.5"`},
+		{"/Library", "192.168.64.2", "", "conflicts with existing export"},
+	}
+	for _, tt := range tests {
+		e, err := findExport(exports, dataVolumePath(tt.path), net.ParseIP(tt.ip), conflict)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("findExport(%s, %s) error = %v, want it to contain %s", tt.path, tt.ip, err, tt.wantErr)
+			}
+			// Unresolved conflicts fail the share rather than skipping it
+			if code := ErrorCodeOf(err); code != ErrNFSExportConflict {
+				t.Errorf("findExport(%s, %s) error code = %q, want %q", tt.path, tt.ip, code, ErrNFSExportConflict)
+			}
+			continue
+		}
+		if err != nil || e.Line != tt.want {
+			t.Errorf("findExport(%s, %s) = %q, %v, want %q", tt.path, tt.ip, e.Line, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/mtibben/docker-machine-driver-hyperkit/pkg/sftp"
+)
+
+const (
+	shareBackendNFS  = "nfs"
+	shareBackendSFTP = "sftp"
+
+	fileServerPidFileName    = "file-server.pid"
+	fileServerLogFileName    = "file-server.log"
+	fileServerConfigFileName = "file-server.json"
+	// fileServerListenTimeout bounds how long the file server waits for the
+	// vmnet interface to come up
+	fileServerListenTimeout = 30 * time.Second
+	// fileServerAuthTimeout bounds how long a connection may take to send
+	// the token
+	fileServerAuthTimeout = 10 * time.Second
+	// fileServerConnectCommand is the guest script sshfs runs instead of ssh
+	// to connect to the file server. It sends the token before the SFTP
+	// session and is only readable by root, which the mounts run as.
+	fileServerConnectCommand = "/var/run/hyperkit-file-server"
+)
+
+// fileServerConfig is what the file server serves, and to whom. It is read
+// again for every connection, so shares can be added while it runs. Token
+// is generated for every start of the file server, and a connection must
+// send it, followed by a newline, before the SFTP session.
+type fileServerConfig struct {
+	IP     string
+	HostIP string
+	Port   int
+	Roots  []string
+	Token  string `json:",omitempty"`
+}
+
+func validateShareBackend(backend string) error {
+	switch backend {
+	case "", shareBackendNFS, shareBackendSFTP:
+		return nil
+	}
+	return fmt.Errorf("unknown share backend %q, must be %s or %s", backend, shareBackendNFS, shareBackendSFTP)
+}
+
+// sftpShares reports whether the shares are served by the driver's own file
+// server rather than exported with nfsd
+func (d *Driver) sftpShares() bool {
+	return d.ShareBackend == shareBackendSFTP
+}
+
+// sftpMountCommands returns the guest commands mounting the host path share
+// at mountPoint with sshfs, talking to the file server on port through
+// fileServerConnectCommand, which sends token first
+func sftpMountCommands(hostIP net.IP, port int, token, share, mountPoint, flags string) string {
+	options := "ssh_command=" + fileServerConnectCommand + ",reconnect"
+	if flags != "" {
+		options += "," + flags
+	}
+	connect := fmt.Sprintf("{ echo %s; exec cat; } | exec nc %s %d", token, hostIP, port)
+	return "command -v sshfs >/dev/null || tce-load -wi sshfs-fuse\\n" +
+		fmt.Sprintf("sudo install -m 700 /dev/null %s\\n", fileServerConnectCommand) +
+		fmt.Sprintf("echo '#!/bin/sh' | sudo tee %s >/dev/null\\n", fileServerConnectCommand) +
+		fmt.Sprintf("echo '%s' | sudo tee -a %s >/dev/null\\n", connect, fileServerConnectCommand) +
+		fmt.Sprintf("sudo mkdir -p %s\\n", shellQuote(mountPoint)) +
+		fmt.Sprintf("sudo sshfs -o %s %s %s\\n", options, shellQuote(hostIP.String()+":"+share), shellQuote(mountPoint))
+}
+
+// setupSFTPShares serves the given shares, along with the machine's other
+// shares, with the file server and mounts them in the guest. Nothing on the
+// host outside the machine dir is changed.
+func (d *Driver) setupSFTPShares(shares []string) error {
+	user, err := user.Current()
+	if err != nil {
+		return err
+	}
+	hostIP, err := d.nfsHostIP()
+	if err != nil {
+		return err
+	}
+	if d.IPAddress == "" {
+		return fmt.Errorf("the file server needs the IP address of machine %s", d.MachineName)
+	}
+	if d.FileServerPort == 0 {
+		if d.FileServerPort, err = freeLocalPort(); err != nil {
+			return fmt.Errorf("picking a port for the file server: %w", err)
+		}
+	}
+
+	config := fileServerConfig{IP: d.IPAddress, HostIP: hostIP.String(), Port: d.FileServerPort}
+	for _, share := range append(append([]string{}, d.NFSShares...), shares...) {
+		if p := d.nfsSharePath(share); !containsString(config.Roots, p) {
+			config.Roots = append(config.Roots, p)
+		}
+	}
+	if err := d.writeFileServerConfig(config); err != nil {
+		return err
+	}
+	if err := d.startFileServer(); err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+		if host := parseNFSShare(share).Host; !path.IsAbs(host) {
+			d.createStoreShare(host, user)
+		}
+	}
+	_, err = d.mountShares(hostIP, shares)
+	return err
+}
+
+func (d *Driver) writeFileServerConfig(config fileServerConfig) error {
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(d.ResolveStorePath(fileServerConfigFileName), b, 0600)
+}
+
+// fileServerToken returns the token of the running file server, or "" if
+// there is none, which the file server refuses
+func (d *Driver) fileServerToken() string {
+	config, err := d.readFileServerConfig()
+	if err != nil {
+		log.Warnf("Unable to read the file server config: %v", err)
+		return ""
+	}
+	return config.Token
+}
+
+// removeFileServerRoot stops the file server from serving root, to
+// connected clients too
+func (d *Driver) removeFileServerRoot(root string) error {
+	config, err := d.readFileServerConfig()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var roots []string
+	for _, r := range config.Roots {
+		if r != root {
+			roots = append(roots, r)
+		}
+	}
+	config.Roots = roots
+	return d.writeFileServerConfig(config)
+}
+
+func (d *Driver) readFileServerConfig() (fileServerConfig, error) {
+	var config fileServerConfig
+	b, err := ioutil.ReadFile(d.ResolveStorePath(fileServerConfigFileName))
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(b, &config)
+	return config, err
+}
+
+// ServeFiles serves the machine's shares over SFTP on the host address the
+// machine mounts them from, to the machine only. It is meant to run as the
+// user owning the shares, never as root. It returns once the machine is
+// stopped or ctx is done.
+func (d *Driver) ServeFiles(ctx context.Context) error {
+	pidFile := d.ResolveStorePath(fileServerPidFileName)
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return fmt.Errorf("writing file server pid file: %w", err)
+	}
+	defer os.Remove(pidFile)
+
+	config, err := d.readFileServerConfig()
+	if err != nil {
+		return fmt.Errorf("reading file server config: %w", err)
+	}
+	if config.Token == "" {
+		return fmt.Errorf("the file server config has no token")
+	}
+	l, err := listenFileServer(ctx, net.JoinHostPort(config.HostIP, strconv.Itoa(config.Port)))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go func() {
+		ticker := time.NewTicker(superviseInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if d.stopRequested() {
+				log.Infof("Machine %s was stopped, no longer serving its shares", d.MachineName)
+				cancel()
+			}
+		}
+	}()
+
+	log.Infof("Serving the shares of %s on %s", d.MachineName, l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go d.serveFileConn(conn, config.Token)
+	}
+}
+
+// listenFileServer listens on addr, waiting for its interface to come up,
+// like the vmnet interface does with the first machine on it
+func listenFileServer(ctx context.Context, addr string) (net.Listener, error) {
+	deadline := time.Now().Add(fileServerListenTimeout)
+	for {
+		l, err := net.Listen("tcp", addr)
+		if err == nil {
+			return l, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("listening for the machine: %w", err)
+		}
+		if err := sleepContext(ctx, time.Second); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// serveFileConn serves a connection from the machine that sends token
+func (d *Driver) serveFileConn(conn net.Conn, token string) {
+	defer conn.Close()
+	config, err := d.readFileServerConfig()
+	if err != nil {
+		log.Warnf("Unable to read the file server config: %v", err)
+		return
+	}
+	if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != config.IP {
+		log.Warnf("Refusing file server connection from %s", conn.RemoteAddr())
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(fileServerAuthTimeout))
+	r := bufio.NewReader(conn)
+	if !fileServerAuthorized(r, token) {
+		log.Warnf("Refusing file server connection from %s without the token", conn.RemoteAddr())
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	s := &sftp.Server{Roots: func() []string {
+		if c, err := d.readFileServerConfig(); err == nil {
+			return c.Roots
+		}
+		return config.Roots
+	}}
+	if err := s.Serve(struct {
+		io.Reader
+		io.Writer
+	}{r, conn}); err != nil {
+		log.Debugf("File server connection from %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// fileServerAuthorized reads the first line of a connection and reports
+// whether it is token
+func fileServerAuthorized(r *bufio.Reader, token string) bool {
+	line, err := r.ReadSlice('\n')
+	if err != nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare(bytes.TrimSuffix(line, []byte("\n")), []byte(token)) == 1
+}
+
+// fileServerPid returns the pid of the running file server, or 0
+func (d *Driver) fileServerPid() int {
+	return detachedPid(d.ResolveStorePath(fileServerPidFileName))
+}
+
+// startFileServer launches a detached "file-server" process for this
+// machine with a new token, unless one is already running.
+func (d *Driver) startFileServer() error {
+	if pid := d.fileServerPid(); pid != 0 {
+		log.Debugf("Shares are already served by pid %d", pid)
+		return nil
+	}
+	config, err := d.readFileServerConfig()
+	if err != nil {
+		return fmt.Errorf("reading file server config: %w", err)
+	}
+	if config.Token, err = newPassphrase(); err != nil {
+		return err
+	}
+	if err := d.writeFileServerConfig(config); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logFile, err := os.OpenFile(d.ResolveStorePath(fileServerLogFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "file-server", "-storage-path", d.StorePath, d.MachineName)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting file server: %w", err)
+	}
+	log.Debugf("Started file server with pid %d", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+func (d *Driver) stopFileServer() {
+	pid := d.fileServerPid()
+	if pid == 0 {
+		return
+	}
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		log.Warnf("Unable to stop the file server: %v", err)
+	}
+}
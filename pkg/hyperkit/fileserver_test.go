@@ -0,0 +1,118 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestValidateShareBackend(t *testing.T) {
+	for _, backend := range []string{"", shareBackendNFS, shareBackendSFTP} {
+		if err := validateShareBackend(backend); err != nil {
+			t.Errorf("validateShareBackend(%q) = %v", backend, err)
+		}
+	}
+	if err := validateShareBackend("smb"); err == nil {
+		t.Error("unknown share backend accepted")
+	}
+}
+
+func TestSFTPMountCommands(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "default", StorePath: tmpDir}, NFSSharesRoot: "/nfsshares", NFSFlags: "noacl,async", ShareBackend: shareBackendSFTP, FileServerPort: 50123}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.writeFileServerConfig(fileServerConfig{Token: "0123abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	install := "command -v sshfs >/dev/null || tce-load -wi sshfs-fuse\\n" +
+		"sudo install -m 700 /dev/null /var/run/hyperkit-file-server\\n" +
+		"echo '#!/bin/sh' | sudo tee /var/run/hyperkit-file-server >/dev/null\\n" +
+		"echo '{ echo 0123abcd; exec cat; } | exec nc 192.168.64.1 50123' | sudo tee -a /var/run/hyperkit-file-server >/dev/null\\n"
+	for _, tt := range []struct {
+		share, want string
+	}{
+		{"/Users", install + "sudo mkdir -p '/nfsshares/Users'\\nsudo sshfs -o ssh_command=/var/run/hyperkit-file-server,reconnect '192.168.64.1:/Users' '/nfsshares/Users'\\n"},
+		{"/Users/me/db:db:flags=uid=1000", install + "sudo mkdir -p '/nfsshares/db'\\nsudo sshfs -o ssh_command=/var/run/hyperkit-file-server,reconnect,uid=1000 '192.168.64.1:/Users/me/db' '/nfsshares/db'\\n"},
+	} {
+		s := parseNFSShare(tt.share)
+		if got := d.nfsMountCommands(net.ParseIP("192.168.64.1"), d.nfsSharePath(tt.share), s.subPath(), d.nfsMountFlags(s)); got != tt.want {
+			t.Errorf("nfsMountCommands for %s = %q, want %q", tt.share, got, tt.want)
+		}
+	}
+}
+
+func TestFileServerAuthorized(t *testing.T) {
+	for _, tt := range []struct {
+		sent, token string
+		want        bool
+	}{
+		{"0123abcd\n", "0123abcd", true},
+		{"0123abcd\nSFTP", "0123abcd", true},
+		{"0123abce\n", "0123abcd", false},
+		{"0123abcd", "0123abcd", false},
+		{"\n", "", false},
+	} {
+		r := bufio.NewReader(strings.NewReader(tt.sent))
+		if got := fileServerAuthorized(r, tt.token); got != tt.want {
+			t.Errorf("fileServerAuthorized(%q, %q) = %v, want %v", tt.sent, tt.token, got, tt.want)
+		}
+	}
+}
+
+func TestFileServerConfig(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "default", StorePath: tmpDir}}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+	want := fileServerConfig{IP: "192.168.64.2", HostIP: "192.168.64.1", Port: 50123, Roots: []string{"/Users/me/src", tmpDir + "/machines/default/data"}, Token: "0123abcd"}
+	if err := d.writeFileServerConfig(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.readFileServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readFileServerConfig() = %+v, want %+v", got, want)
+	}
+	if pid := d.fileServerPid(); pid != 0 {
+		t.Errorf("fileServerPid() = %d without a pid file", pid)
+	}
+}
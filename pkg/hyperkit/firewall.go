@@ -0,0 +1,133 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	socketfilterfw = "/usr/libexec/ApplicationFirewall/socketfilterfw"
+	bootpdPath     = "/usr/libexec/bootpd"
+)
+
+// bootpdFirewallFix are the commands that let bootpd through the firewall
+var bootpdFirewallFix = []string{
+	"sudo " + socketfilterfw + " --add " + bootpdPath,
+	"sudo " + socketfilterfw + " --unblock " + bootpdPath,
+}
+
+// firewallState is what the macOS application firewall does to bootpd
+type firewallState struct {
+	Enabled       bool
+	BlockAll      bool
+	BootpdBlocked bool
+}
+
+// blocksBootpd reports whether guests can't get a dhcp lease from bootpd
+func (s firewallState) blocksBootpd() bool {
+	return s.Enabled && (s.BlockAll || s.BootpdBlocked)
+}
+
+// parseFirewallState interprets the output of socketfilterfw's
+// --getglobalstate, --getblockall and --getappblocked
+func parseFirewallState(global, blockAll, app string) firewallState {
+	return firewallState{
+		Enabled:       strings.Contains(global, "enabled") || strings.Contains(global, "State = 1"),
+		BlockAll:      strings.Contains(blockAll, "block all") && !strings.Contains(blockAll, "DISABLED"),
+		BootpdBlocked: strings.Contains(app, "is blocked"),
+	}
+}
+
+// checkFirewall fails with the commands to fix it if the application
+// firewall blocks bootpd. It passes if the firewall state can't be read.
+func checkFirewall() error {
+	run := func(args ...string) string {
+		out, err := exec.Command(socketfilterfw, args...).CombinedOutput()
+		if err != nil {
+			log.Debugf("%s %s: %v", socketfilterfw, strings.Join(args, " "), err)
+		}
+		return string(out)
+	}
+	if _, err := os.Stat(socketfilterfw); err != nil {
+		return nil
+	}
+	s := parseFirewallState(run("--getglobalstate"), run("--getblockall"), run("--getappblocked", bootpdPath))
+	if !s.blocksBootpd() {
+		return nil
+	}
+	reason := "blocks " + bootpdPath
+	if s.BlockAll {
+		reason = "blocks all incoming connections, including those to " + bootpdPath
+	}
+	hint := "allow bootpd with:\n  " + strings.Join(bootpdFirewallFix, "\n  ")
+	if s.BlockAll {
+		hint = "turn off \"Block all incoming connections\" in the firewall options, then " + hint
+	}
+	return newError(ErrBootpdBlocked, hint, fmt.Errorf("the macOS application firewall %s, so machines can't get an IP address", reason))
+}
+
+// checkVMNetConfig fails if the vmnet shared network config, which macOS
+// keeps next to its Internet Sharing settings, has an unusable address or
+// mask. A missing config is fine, vmnet writes it on first use.
+func checkVMNetConfig() error {
+	if _, err := os.Stat(VMNetDomain + ".plist"); err != nil {
+		return nil
+	}
+	read := func(key string) string {
+		out, err := exec.Command("/usr/bin/defaults", "read", VMNetDomain, key).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	return validateVMNetConfig(read(SharedNetAddrKey), read(SharedNetMaskKey))
+}
+
+func validateVMNetConfig(addr, mask string) error {
+	hint := fmt.Sprintf("fix or remove %s.plist and reboot, vmnet recreates it with defaults", VMNetDomain)
+	if addr == "" && mask == "" {
+		return nil
+	}
+	ip := net.ParseIP(addr).To4()
+	if ip == nil {
+		return newError(ErrVMNetConfig, hint, fmt.Errorf("invalid %s %q", SharedNetAddrKey, addr))
+	}
+	if mask == "" {
+		return nil
+	}
+	m := net.ParseIP(mask).To4()
+	if m == nil {
+		return newError(ErrVMNetConfig, hint, fmt.Errorf("invalid %s %q", SharedNetMaskKey, mask))
+	}
+	ones, bits := net.IPMask(m).Size()
+	if bits == 0 || ones > 30 {
+		return newError(ErrVMNetConfig, hint, fmt.Errorf("%s %s is not a usable network mask", SharedNetMaskKey, mask))
+	}
+	if ip.Equal(ip.Mask(net.IPMask(m))) {
+		return newError(ErrVMNetConfig, hint, fmt.Errorf("%s %s is the network address of %s, not a host address", SharedNetAddrKey, addr, mask))
+	}
+	return nil
+}
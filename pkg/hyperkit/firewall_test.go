@@ -0,0 +1,67 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import "testing"
+
+func TestParseFirewallState(t *testing.T) {
+	tests := []struct {
+		name                  string
+		global, blockAll, app string
+		want                  bool
+	}{
+		{"disabled", "Firewall is disabled. (State = 0)", "Block all DISABLED! ", "Incoming connection to the application is blocked", false},
+		{"permitted", "Firewall is enabled. (State = 1)", "Block all DISABLED! ", "The application /usr/libexec/bootpd is permitted", false},
+		{"not listed", "Firewall is enabled. (State = 1)", "Block all DISABLED! ", "The application /usr/libexec/bootpd is not part of the firewall", false},
+		{"blocked", "Firewall is enabled. (State = 1)", "Block all DISABLED! ", "Incoming connection to the application is blocked", true},
+		{"block all", "Firewall is enabled. (State = 1)", "Firewall is set to block all non-essential incoming connections", "Incoming connection to the application is permitted", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := parseFirewallState(tt.global, tt.blockAll, tt.app)
+			if got := s.blocksBootpd(); got != tt.want {
+				t.Errorf("blocksBootpd() = %v, want %v (%+v)", got, tt.want, s)
+			}
+		})
+	}
+}
+
+func TestValidateVMNetConfig(t *testing.T) {
+	tests := []struct {
+		addr, mask string
+		wantErr    bool
+	}{
+		{"", "", false},
+		{"192.168.64.1", "255.255.255.0", false},
+		{"192.168.64.1", "", false},
+		{"192.168.64", "255.255.255.0", true},
+		{"192.168.64.1", "255.255.255.255", true},
+		{"192.168.64.0", "255.255.255.0", true},
+		{"192.168.64.1", "garbage", true},
+	}
+	for _, tt := range tests {
+		err := validateVMNetConfig(tt.addr, tt.mask)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateVMNetConfig(%q, %q) = %v, wantErr %v", tt.addr, tt.mask, err, tt.wantErr)
+		}
+		if err != nil && ErrorCodeOf(err) != ErrVMNetConfig {
+			t.Errorf("validateVMNetConfig(%q, %q) code = %q, want %q", tt.addr, tt.mask, ErrorCodeOf(err), ErrVMNetConfig)
+		}
+	}
+}
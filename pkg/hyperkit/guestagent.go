@@ -0,0 +1,166 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/mtibben/docker-machine-driver-hyperkit/pkg/agent"
+)
+
+const (
+	// guestAgentBinaryName is the agent built from
+	// cmd/docker-machine-driver-hyperkit-agent, looked up next to the driver
+	guestAgentBinaryName = "docker-machine-driver-hyperkit-agent"
+	// guestAgentPath is where the agent is installed in the guest, on the
+	// persistent boot2docker disk
+	guestAgentPath = "/var/lib/boot2docker/" + guestAgentBinaryName
+	// guestBootScript runs at every boot2docker boot
+	guestBootScript = "/var/lib/boot2docker/bootlocal.sh"
+	// guestVSockCID is the vsock context ID hyperkit gives the guest
+	guestVSockCID  = 3
+	guestAgentPort = agent.DefaultPort
+	// guestDockerPort is where the agent forwards the docker socket
+	guestDockerPort = agent.DockerPort
+	// guestSSHPort is where the agent forwards the guest sshd
+	guestSSHPort = agent.SSHPort
+
+	guestAgentTimeout = 5 * time.Second
+)
+
+// GuestMetrics is the resource usage reported by the guest agent
+type GuestMetrics = agent.Metrics
+
+// guestAgentBinary returns the path of the agent to install
+func (d *Driver) guestAgentBinary() (string, error) {
+	if d.GuestAgentPath != "" {
+		return d.GuestAgentPath, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exe), guestAgentBinaryName), nil
+}
+
+// installGuestAgent copies the agent into the guest, starts it and makes it
+// start on every boot
+func (d *Driver) installGuestAgent() error {
+	binary, err := d.guestAgentBinary()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(binary)
+	if err != nil {
+		return fmt.Errorf("guest agent: %w, build it with GOOS=linux from cmd/%s or set --hyperkit-guest-agent-path", err, guestAgentBinaryName)
+	}
+	defer f.Close()
+
+	log.Infof("Installing the guest agent in %s", d.MachineName)
+	copyCmd := fmt.Sprintf("cat > /tmp/%[1]s && sudo mv /tmp/%[1]s %[2]s && sudo chmod 755 %[2]s", guestAgentBinaryName, guestAgentPath)
+	if err := d.runSSHWithStdin(copyCmd, f); err != nil {
+		return fmt.Errorf("copying guest agent: %w", err)
+	}
+	if _, err := drivers.RunSSHCommandFromDriver(d, d.guestAgentInstallCommand()); err != nil {
+		return fmt.Errorf("starting guest agent: %w", err)
+	}
+	return nil
+}
+
+// guestAgentInstallCommand adds the agent to the boot script unless it is
+// there already, and starts it
+func (d *Driver) guestAgentInstallCommand() string {
+	args := fmt.Sprintf("-port %d", guestAgentPort)
+	if d.DockerVSock {
+		args += fmt.Sprintf(" -docker-port %d", guestDockerPort)
+	}
+	if d.SSHOverVSock {
+		args += fmt.Sprintf(" -ssh-port %d", guestSSHPort)
+		if port, _ := d.BaseDriver.GetSSHPort(); port != defaultSSHPort {
+			args += fmt.Sprintf(" -sshd-addr 127.0.0.1:%d", port)
+		}
+	}
+	start := fmt.Sprintf("%s %s >/var/log/%s.log 2>&1 &", guestAgentPath, args, guestAgentBinaryName)
+	return strings.Join([]string{
+		fmt.Sprintf("(grep -qs %[1]s %[2]s || echo '%[3]s' | sudo tee -a %[2]s >/dev/null)", guestAgentBinaryName, guestBootScript, start),
+		"sudo chmod +x " + guestBootScript,
+		fmt.Sprintf("(pgrep -f %s >/dev/null || sudo sh -c '%s')", guestAgentPath, start),
+	}, " && ")
+}
+
+// runSSHWithStdin runs command in the guest with stdin as its input, through
+// the system's ssh client as the user, as libmachine's can't pass input
+func (d *Driver) runSSHWithStdin(command string, stdin io.Reader) error {
+	ip, err := d.GetSSHHostname()
+	if err != nil {
+		return err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("/usr/bin/ssh",
+		"-i", d.GetSSHKeyPath(),
+		"-p", strconv.Itoa(port),
+		"-o", "IdentitiesOnly=yes",
+		"-o", "LogLevel=quiet")
+	cmd.Args = append(cmd.Args, d.SSHHostKeyOptions()...)
+	cmd.Args = append(cmd.Args, fmt.Sprintf("%s@%s", d.GetSSHUsername(), ip), command)
+	cmd.Stdin = stdin
+	if out, err := asCaller(cmd).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// guestAgentSocket is the unix socket hyperkit forwards to the agent's vsock
+// port
+func (d *Driver) guestAgentSocket() string {
+	return d.guestVSockSocket(guestAgentPort)
+}
+
+// GuestMetrics asks the guest agent for the machine's memory, CPU and disk
+// usage as the guest sees it
+func (d *Driver) GuestMetrics() (GuestMetrics, error) {
+	var m GuestMetrics
+	if !d.GuestAgent {
+		return m, fmt.Errorf("%s was created without --hyperkit-guest-agent", d.MachineName)
+	}
+	conn, err := net.DialTimeout("unix", d.guestAgentSocket(), guestAgentTimeout)
+	if err != nil {
+		return m, fmt.Errorf("connecting to the guest agent: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(guestAgentTimeout))
+	if err := json.NewDecoder(conn).Decode(&m); err != nil {
+		return m, fmt.Errorf("reading from the guest agent: %w", err)
+	}
+	return m, nil
+}
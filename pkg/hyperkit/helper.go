@@ -0,0 +1,444 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/johanneswuerbach/nfsexports"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// HelperCommand is the command of the driver binary that runs privileged
+// actions as root, for machines created with --hyperkit-sudo-helper
+const HelperCommand = "helper"
+
+// Helper actions. Each is the only thing its sudoers rule lets run as root.
+const (
+	helperCheck       = "check"
+	helperStart       = "start"
+	helperSignal      = "signal"
+	helperNFSExport   = "nfs-export"
+	helperNFSUnexport = "nfs-unexport"
+	helperNFSReload   = "nfs-reload"
+	helperHosts       = "hosts"
+)
+
+var helperActions = []string{helperCheck, helperStart, helperSignal, helperNFSExport, helperNFSUnexport, helperNFSReload, helperHosts}
+
+// useHelper reports whether privileged steps go through the sudo helper,
+// rather than the driver doing them itself as root
+func (d *Driver) useHelper() bool {
+	return d.SudoHelper && syscall.Geteuid() != 0
+}
+
+// checkHelper verifies sudo lets the driver run its helper without a
+// password
+func (d *Driver) checkHelper() error {
+	if d.helperChecked {
+		return nil
+	}
+	if _, err := d.runHelper(helperCheck); err != nil {
+		exe, _ := os.Executable()
+		return newError(ErrNoRoot, fmt.Sprintf("install the sudo rules printed by \"%s sudoers\"", exe), err)
+	}
+	d.helperChecked = true
+	return nil
+}
+
+// runHelper runs a helper action for this machine as root through sudo, and
+// returns what it printed
+func (d *Driver) runHelper(action string, args ...string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	// The sudoers rules name the installed binary, not a symlink to it
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	cmd := exec.Command("/usr/bin/sudo", append([]string{"-n", exe, HelperCommand, action, d.StorePath, d.MachineName}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("sudo helper %s: %s", action, msg)
+		}
+		return "", fmt.Errorf("sudo helper %s: %w", action, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (d *Driver) startBackend(b backend, uuid, cmdline string) (int, error) {
+	if !d.useHelper() {
+		pid, err := b.start(d, uuid, cmdline)
+		d.audit(auditStart, fmt.Sprintf("%s pid %d", b.name(), pid), err)
+		return pid, err
+	}
+	out, err := d.runHelper(helperStart, uuid, cmdline)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+func (d *Driver) addNFSExport(path, line string) error {
+	if d.useHelper() {
+		_, err := d.runHelper(helperNFSExport, path)
+		return err
+	}
+	_, err := nfsexports.Add("", d.nfsExportIdentifier(path), line)
+	d.audit(auditNFSExport, line, err)
+	return err
+}
+
+func (d *Driver) removeNFSExport(path string) error {
+	if d.useHelper() {
+		_, err := d.runHelper(helperNFSUnexport, path)
+		return err
+	}
+	_, err := nfsexports.Remove("", d.nfsExportIdentifier(path))
+	d.audit(auditNFSUnexport, path, err)
+	return err
+}
+
+func (d *Driver) reloadNFSDaemon() error {
+	if d.useHelper() {
+		_, err := d.runHelper(helperNFSReload)
+		return err
+	}
+	err := nfsexports.ReloadDaemon()
+	d.audit(auditNFSReload, "", err)
+	return err
+}
+
+// RunHelper runs a privileged action for a machine. It runs as root through
+// sudo, so it trusts nothing but the machine belonging to the sudo user: the
+// arguments are "<action> <storage path> <machine> [args...]".
+func RunHelper(args []string, stdout io.Writer) error {
+	if len(args) < 3 {
+		return fmt.Errorf("usage: %s <%s> <storage path> <machine> [args...]", HelperCommand, strings.Join(helperActions, "|"))
+	}
+	action, storePath, name, args := args[0], args[1], args[2], args[3:]
+	if syscall.Geteuid() != 0 {
+		return fmt.Errorf("the helper needs to run as root through sudo")
+	}
+	caller, err := sudoCaller()
+	if err != nil {
+		return err
+	}
+	d, err := LoadDriver(storePath, name)
+	if err != nil {
+		return err
+	}
+	if err := checkOwnedBy(d.ResolveStorePath("."), caller); err != nil {
+		d.audit(auditHelperRefused, action, err)
+		return err
+	}
+	if err := checkHelperArgs(action, args); err != nil {
+		d.audit(auditHelperRefused, action, err)
+		return err
+	}
+
+	switch action {
+	case helperCheck:
+		return nil
+	case helperStart:
+		return d.helperStart(args[0], args[1], caller, stdout)
+	case helperSignal:
+		sig, _ := strconv.Atoi(args[0])
+		return d.helperSignal(syscall.Signal(sig))
+	case helperNFSExport:
+		if err := checkOwnedBy(args[0], caller); err != nil {
+			d.audit(auditHelperRefused, action+" "+args[0], err)
+			return err
+		}
+		if d.IPAddress == "" {
+			return fmt.Errorf("NFS exports need the IP address of machine %s", d.MachineName)
+		}
+		return d.addNFSExport(args[0], nfsExportLine(args[0], d.IPAddress, caller.Username))
+	case helperNFSUnexport:
+		return d.removeNFSExport(args[0])
+	case helperNFSReload:
+		return d.reloadNFSDaemon()
+	case helperHosts:
+		if err := validateMachineName(d.MachineName); err != nil {
+			d.audit(auditHelperRefused, action, err)
+			return err
+		}
+		return d.updateHostsEntry(args[0])
+	}
+	return fmt.Errorf("unknown helper action %s", action)
+}
+
+// checkHelperArgs validates the action specific arguments of the helper
+func checkHelperArgs(action string, args []string) error {
+	want := map[string]int{helperStart: 2, helperSignal: 1, helperNFSExport: 1, helperNFSUnexport: 1, helperHosts: 1}[action]
+	if len(args) != want {
+		return fmt.Errorf("helper %s takes %d arguments, got %d", action, want, len(args))
+	}
+	switch action {
+	case helperSignal:
+		if sig, err := strconv.Atoi(args[0]); err != nil || (syscall.Signal(sig) != syscall.SIGTERM && syscall.Signal(sig) != syscall.SIGKILL) {
+			return fmt.Errorf("helper only sends SIGTERM and SIGKILL, not %s", args[0])
+		}
+	case helperNFSExport, helperNFSUnexport:
+		if !strings.HasPrefix(args[0], "/") {
+			return fmt.Errorf("NFS share %s isn't an absolute path", args[0])
+		}
+	case helperHosts:
+		if args[0] != "" && net.ParseIP(args[0]) == nil {
+			return fmt.Errorf("invalid IP address %q", args[0])
+		}
+	}
+	return nil
+}
+
+// helperStart boots the machine as root, and hands the files hyperkit wrote
+// back to the caller, who runs everything else
+func (d *Driver) helperStart(uuid, cmdline string, caller *user.User, stdout io.Writer) error {
+	if err := d.checkHelperSettings(); err != nil {
+		d.audit(auditHelperRefused, helperStart, err)
+		return err
+	}
+	if err := d.checkHelperFiles(caller); err != nil {
+		d.audit(auditHelperRefused, helperStart, err)
+		return err
+	}
+	b, err := d.backend()
+	if err != nil {
+		return err
+	}
+	pid, err := b.start(d, uuid, cmdline)
+	d.audit(auditStart, fmt.Sprintf("%s pid %d through the sudo helper", b.name(), pid), err)
+	if err != nil {
+		return err
+	}
+	if err := d.recordProcessIdentity(pid); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to record hyperkit process identity: %v\n", err)
+	}
+	if err := chownMachineFiles(d.ResolveStorePath("."), caller); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, pid)
+	return err
+}
+
+// checkHelperSettings fails if the config, which the caller can edit, sets
+// anything that would have the helper run commands or open files of their
+// choosing as root
+func (d *Driver) checkHelperSettings() error {
+	var set []string
+	if d.ConfigHook != "" {
+		set = append(set, "ConfigHook")
+	}
+	if d.ConfigPatch != "" {
+		set = append(set, "ConfigPatch")
+	}
+	if len(d.ExtraArgs) > 0 {
+		set = append(set, "ExtraArgs")
+	}
+	if len(d.AttachISOs) > 0 {
+		set = append(set, "AttachISOs")
+	}
+	if len(d.Hooks) > 0 {
+		set = append(set, "Hooks")
+	}
+	if len(set) > 0 {
+		return fmt.Errorf("the sudo helper doesn't start machines with %s set", strings.Join(set, ", "))
+	}
+	return nil
+}
+
+// helperFiles returns the files the VM process opens as root, besides the
+// ones checkHelperSettings refuses
+func (d *Driver) helperFiles() []string {
+	files := []string{d.rootDisk()}
+	if d.EncryptDisk {
+		// The disk path is a symlink into the bundle, see checkHelperFiles
+		files[0] = d.rawDiskPath()
+	}
+	for _, extra := range d.extraDisks() {
+		files = append(files, d.diskPath(extra))
+	}
+	files = append(files, d.isoImages()...)
+	for _, path := range []string{d.BootKernel, d.BootInitrd} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// checkHelperFiles fails unless the files the VM process opens as root are
+// regular files of caller in the machine dir, so the caller can't have the
+// helper hand the guest other files through symlinks. The only symlink is
+// the root disk path of an encrypted disk, which must point into the bundle.
+func (d *Driver) checkHelperFiles(caller *user.User) error {
+	if d.EncryptDisk {
+		disk := pkgdrivers.GetDiskPath(d.BaseDriver)
+		want := filepath.Join(encryptedMountFileName, filepath.Base(disk))
+		if target, err := os.Readlink(disk); err != nil || target != want {
+			return fmt.Errorf("the encrypted disk %s must be a symlink to %s for the sudo helper", disk, want)
+		}
+	}
+	for _, path := range d.helperFiles() {
+		if err := checkHelperFile(d.ResolveStorePath("."), path, caller); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkHelperFile fails unless path is a regular file owned by caller inside
+// dir, with no symlink below dir on the way to it
+func checkHelperFile(dir, path string, caller *user.User) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s must be in the machine dir %s for the sudo helper", path, dir)
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if real != filepath.Join(realDir, rel) {
+		return fmt.Errorf("%s must not be or go through a symlink for the sudo helper", path)
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s must be a regular file for the sudo helper", path)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || strconv.FormatUint(uint64(st.Uid), 10) != caller.Uid {
+		return fmt.Errorf("%s must be owned by %s for the sudo helper", path, caller.Username)
+	}
+	return nil
+}
+
+// helperSignal signals the machine's VM process, as long as the pid in the
+// caller writable state file still is that process
+func (d *Driver) helperSignal(sig syscall.Signal) error {
+	pid := d.getPid()
+	if s, err := d.pidState(pid); err != nil || s != state.Running {
+		return fmt.Errorf("pid %d isn't the VM process of machine %s", pid, d.MachineName)
+	}
+	err := syscall.Kill(pid, sig)
+	d.audit(auditSignal, fmt.Sprintf("%s to pid %d", sig, pid), err)
+	return err
+}
+
+// sudoCaller returns the user who ran sudo
+func sudoCaller() (*user.User, error) {
+	uid := os.Getenv("SUDO_UID")
+	if uid == "" {
+		return nil, fmt.Errorf("the helper needs to run through sudo")
+	}
+	return user.LookupId(uid)
+}
+
+// checkOwnedBy fails unless path is owned by owner, or if owner is nil by
+// root and not writable by anyone else
+func checkOwnedBy(path string, owner *user.User) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("unable to get the owner of %s", path)
+	}
+	if owner == nil {
+		if st.Uid != 0 || fi.Mode().Perm()&0022 != 0 {
+			return fmt.Errorf("%s must be owned by root and only writable by root", path)
+		}
+		return nil
+	}
+	if strconv.Itoa(int(st.Uid)) != owner.Uid {
+		return fmt.Errorf("%s isn't owned by %s", path, owner.Username)
+	}
+	return nil
+}
+
+// chownMachineFiles gives the files root created in the machine directory
+// to the caller
+func chownMachineFiles(dir string, caller *user.User) error {
+	uid, err := strconv.Atoi(caller.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(caller.Gid)
+	if err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range entries {
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Uid == 0 {
+			if err := os.Lchown(filepath.Join(dir, fi.Name()), uid, gid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SudoersRules returns the sudoers rules that let user run the helper
+// actions of the driver binary exe as root without a password
+func SudoersRules(exe, user string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Privileged actions of %s, see --hyperkit-sudo-helper\n", exe)
+	for _, action := range helperActions {
+		fmt.Fprintf(&b, "%s ALL=(root) NOPASSWD: %s %s %s *\n", sudoersEscape(user), sudoersEscape(exe), HelperCommand, action)
+	}
+	return b.String()
+}
+
+// sudoersEscape escapes the characters sudoers gives a meaning in commands
+// and user names
+func sudoersEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ":", `\:`, "=", `\=`, " ", `\ `, "*", `\*`).Replace(s)
+}
+
+// CheckHelperBinary fails if exe could be replaced by someone other than
+// root, which would make the sudoers rules a way to run anything as root
+func CheckHelperBinary(exe string) error {
+	return checkOwnedBy(exe, nil)
+}
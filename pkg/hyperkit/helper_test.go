@@ -0,0 +1,154 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+func TestCheckHelperArgs(t *testing.T) {
+	tests := []struct {
+		action  string
+		args    []string
+		wantErr bool
+	}{
+		{helperCheck, nil, false},
+		{helperCheck, []string{"extra"}, true},
+		{helperStart, []string{"uuid", "console=ttyS0"}, false},
+		{helperStart, []string{"uuid"}, true},
+		{helperSignal, []string{"15"}, false},
+		{helperSignal, []string{"9"}, false},
+		{helperSignal, []string{"1"}, true},
+		{helperSignal, []string{"TERM"}, true},
+		{helperNFSExport, []string{"/Users/me/src"}, false},
+		{helperNFSExport, []string{"src"}, true},
+		{helperNFSUnexport, []string{"/Users/me/src"}, false},
+		{helperNFSReload, nil, false},
+		{helperHosts, []string{"192.168.64.2"}, false},
+		{helperHosts, []string{""}, false},
+		{helperHosts, []string{"192.168.64.2 evil"}, true},
+	}
+	for _, tt := range tests {
+		if err := checkHelperArgs(tt.action, tt.args); (err != nil) != tt.wantErr {
+			t.Errorf("checkHelperArgs(%s, %q) error = %v, wantErr %v", tt.action, tt.args, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckHelperSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Driver
+		wantErr bool
+	}{
+		{"plain", &Driver{}, false},
+		{"config hook", &Driver{ConfigHook: "/tmp/hook"}, true},
+		{"config patch", &Driver{ConfigPatch: "/tmp/patch.json"}, true},
+		{"extra args", &Driver{ExtraArgs: []string{"-s", "31,virtio-rnd"}}, true},
+		{"attached ISO", &Driver{AttachISOs: []string{"/tmp/tools.iso"}}, true},
+		{"hooks", &Driver{Hooks: []string{"pre-start=true"}}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.d.checkHelperSettings(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkHelperSettings() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckHelperFiles(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	caller, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(tmpDir, "secret")
+	if err := ioutil.WriteFile(secret, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(d *Driver) error
+		wantErr bool
+	}{
+		{"machine files", func(d *Driver) error { return nil }, false},
+		{"symlinked disk", func(d *Driver) error {
+			disk := pkgdrivers.GetDiskPath(d.BaseDriver)
+			os.Remove(disk)
+			return os.Symlink(secret, disk)
+		}, true},
+		{"symlinked ISO", func(d *Driver) error {
+			iso := d.ResolveStorePath(isoFilename)
+			os.Remove(iso)
+			return os.Symlink(secret, iso)
+		}, true},
+		{"kernel outside the machine dir", func(d *Driver) error {
+			d.BootKernel = secret
+			return nil
+		}, true},
+		{"directory as initrd", func(d *Driver) error {
+			d.BootInitrd = d.ResolveStorePath("initrd")
+			return os.Mkdir(d.BootInitrd, 0755)
+		}, true},
+	}
+	for i, tt := range tests {
+		d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "dev" + strconv.Itoa(i), StorePath: tmpDir}}
+		if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{pkgdrivers.GetDiskPath(d.BaseDriver), d.ResolveStorePath(isoFilename)} {
+			if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tt.setup(d); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.checkHelperFiles(caller); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkHelperFiles() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSudoersRules(t *testing.T) {
+	rules := SudoersRules("/usr/local/bin/docker-machine-driver-hyperkit", "%admin")
+	if want := "%admin ALL=(root) NOPASSWD: /usr/local/bin/docker-machine-driver-hyperkit helper start *\n"; !strings.Contains(rules, want) {
+		t.Errorf("rules don't contain %q:\n%s", want, rules)
+	}
+	if n := strings.Count(rules, "NOPASSWD"); n != len(helperActions) {
+		t.Errorf("got %d rules, want %d:\n%s", n, len(helperActions), rules)
+	}
+
+	if got, want := sudoersEscape("/Applications/My Tools/driver,v2"), `/Applications/My\ Tools/driver\,v2`; got != want {
+		t.Errorf("sudoersEscape() = %s, want %s", got, want)
+	}
+}
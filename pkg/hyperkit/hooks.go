@@ -0,0 +1,97 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Lifecycle events hook commands can be run on
+const (
+	hookPreStart   = "pre-start"
+	hookPostStart  = "post-start"
+	hookPreStop    = "pre-stop"
+	hookPostRemove = "post-remove"
+)
+
+var hookEvents = []string{hookPreStart, hookPostStart, hookPreStop, hookPostRemove}
+
+// parseHook parses an event=command hook
+func parseHook(spec string) (event, command string, err error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", fmt.Errorf("hook %q is not of the form event=command", spec)
+	}
+	if !containsString(hookEvents, parts[0]) {
+		return "", "", fmt.Errorf("hook %q: unknown event %q, use one of %s", spec, parts[0], strings.Join(hookEvents, ", "))
+	}
+	return parts[0], parts[1], nil
+}
+
+func validateHooks(hooks []string) error {
+	for _, spec := range hooks {
+		if _, _, err := parseHook(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hookEnv describes the machine to hook commands
+func (d *Driver) hookEnv(event string) []string {
+	env := append(os.Environ(),
+		"HYPERKIT_HOOK_EVENT="+event,
+		"HYPERKIT_MACHINE_NAME="+d.MachineName,
+		"HYPERKIT_MACHINE_DIR="+d.ResolveStorePath("."),
+		"HYPERKIT_STORE_PATH="+d.StorePath,
+		"HYPERKIT_IP="+d.IPAddress,
+	)
+	if event == hookPostStart || event == hookPreStop {
+		env = append(env, "HYPERKIT_PID="+strconv.Itoa(d.getPid()))
+	}
+	return env
+}
+
+// runHooks runs the hook commands for event in order, as the user who invoked
+// the driver and with sh so they can take arguments. The first failure is
+// returned; callers of post-event hooks only warn about it as the event has
+// happened.
+func (d *Driver) runHooks(event string) error {
+	for _, spec := range d.Hooks {
+		e, command, err := parseHook(spec)
+		if err != nil || e != event {
+			continue
+		}
+		log.Debugf("Running %s hook %s", event, command)
+		cmd := exec.Command("/bin/sh", "-c", command)
+		cmd.Env = d.hookEnv(event)
+		out, err := asCaller(cmd).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s hook %s: %w: %s", event, command, err, strings.TrimSpace(string(out)))
+		}
+		log.Debugf("%s hook output: %s", event, out)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestParseHook(t *testing.T) {
+	tests := []struct {
+		spec           string
+		event, command string
+		wantErr        bool
+	}{
+		{"pre-start=route add 10.0.0.0/8 $HYPERKIT_IP", hookPreStart, "route add 10.0.0.0/8 $HYPERKIT_IP", false},
+		{"post-remove=notify a=b", hookPostRemove, "notify a=b", false},
+		{"post-stop=true", "", "", true},
+		{"pre-start=", "", "", true},
+		{"pre-start", "", "", true},
+	}
+	for _, tt := range tests {
+		event, command, err := parseHook(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHook(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if event != tt.event || command != tt.command {
+			t.Errorf("parseHook(%q) = %q, %q, want %q, %q", tt.spec, event, command, tt.event, tt.command)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "dev", StorePath: dir}}
+	d.Hooks = []string{
+		"pre-start=echo $HYPERKIT_HOOK_EVENT $HYPERKIT_MACHINE_NAME >> " + out,
+		"post-remove=echo removed >> " + out,
+		"pre-start=echo second >> " + out,
+	}
+	if err := d.runHooks(hookPreStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "pre-start dev\nsecond\n"; got != want {
+		t.Errorf("hooks wrote %q, want %q", got, want)
+	}
+
+	d.Hooks = []string{"pre-stop=echo failing; exit 3"}
+	if err := d.runHooks(hookPreStop); err == nil || !strings.Contains(err.Error(), "failing") {
+		t.Errorf("runHooks() = %v, want the failing hook's output", err)
+	}
+}
@@ -0,0 +1,130 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// hostnameDomain is the domain of the stable machine hostnames. Not
+	// .local, macOS resolves that over mDNS before it looks at /etc/hosts.
+	hostnameDomain = "hyperkit.internal"
+	// hostsMarker tags the /etc/hosts lines the driver maintains
+	hostsMarker = "# docker-machine-driver-hyperkit"
+)
+
+// hostsPath is the hosts file the stable hostnames are written to
+var hostsPath = "/etc/hosts"
+
+// stableHostname is the name that keeps pointing at the machine as its IP
+// address changes
+func (d *Driver) stableHostname() string {
+	return d.MachineName + "." + hostnameDomain
+}
+
+// updateHostsEntry points the stable hostname at ip in the hosts file, or
+// removes it if ip is empty
+func (d *Driver) updateHostsEntry(ip string) error {
+	if d.useHelper() {
+		_, err := d.runHelper(helperHosts, ip)
+		return err
+	}
+	path, err := filepath.EvalSymlinks(hostsPath)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	updated := setHostsEntry(string(b), d.stableHostname(), ip)
+	if updated == string(b) {
+		return nil
+	}
+	err = writeFileAtomic(path, []byte(updated), 0644)
+	d.audit(auditHostsUpdate, d.stableHostname()+" "+ip, err)
+	return err
+}
+
+// setHostsEntry replaces the driver's line for hostname in hosts with one
+// for ip, leaving all other lines alone
+func setHostsEntry(hosts, hostname, ip string) string {
+	var b strings.Builder
+	marker := hostsMarker + " " + hostname
+	for _, line := range strings.SplitAfter(hosts, "\n") {
+		if strings.HasSuffix(strings.TrimSpace(line), marker) {
+			continue
+		}
+		b.WriteString(line)
+	}
+	if ip != "" {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\t%s %s\n", ip, hostname, marker)
+	}
+	return b.String()
+}
+
+// checkCertSANs warns when the server certificate doesn't cover the address
+// clients use, which happens when the machine IP changed since the
+// certificates were generated.
+func (d *Driver) checkCertSANs() {
+	if !d.StableHostname {
+		stale, err := d.CertsStale()
+		if err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to check the server certificate: %v", err)
+		}
+		if stale {
+			log.Warnf("The server certificate of %s isn't valid for %s, run \"docker-machine regenerate-certs %s\" or use --hyperkit-stable-hostname", d.MachineName, d.IPAddress, d.MachineName)
+		}
+		return
+	}
+
+	b, err := ioutil.ReadFile(d.ResolveStorePath("server.pem"))
+	if os.IsNotExist(err) {
+		// docker-machine generates it after the first start
+		return
+	}
+	cert, err := parseCertificate(b)
+	if err != nil {
+		log.Warnf("Unable to check the server certificate: %v", err)
+		return
+	}
+	if err := cert.VerifyHostname(d.stableHostname()); err != nil {
+		log.Warnf("The server certificate of %s isn't valid for %s, recreate the machine with --tls-san %s", d.MachineName, d.stableHostname(), d.stableHostname())
+	}
+}
+
+func parseCertificate(b []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
@@ -0,0 +1,41 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import "testing"
+
+func TestSetHostsEntry(t *testing.T) {
+	const base = "127.0.0.1\tlocalhost\n"
+	tests := []struct {
+		name, hosts, ip, want string
+	}{
+		{"add", base, "192.168.64.5", base + "192.168.64.5\tdev.hyperkit.internal # docker-machine-driver-hyperkit dev.hyperkit.internal\n"},
+		{"add without trailing newline", "127.0.0.1\tlocalhost", "192.168.64.5", base + "192.168.64.5\tdev.hyperkit.internal # docker-machine-driver-hyperkit dev.hyperkit.internal\n"},
+		{"update", base + "192.168.64.4\tdev.hyperkit.internal # docker-machine-driver-hyperkit dev.hyperkit.internal\n", "192.168.64.5", base + "192.168.64.5\tdev.hyperkit.internal # docker-machine-driver-hyperkit dev.hyperkit.internal\n"},
+		{"remove", base + "192.168.64.4\tdev.hyperkit.internal # docker-machine-driver-hyperkit dev.hyperkit.internal\n", "", base},
+		{"other machines are kept", base + "192.168.64.9\tmydev.hyperkit.internal # docker-machine-driver-hyperkit mydev.hyperkit.internal\n", "", base + "192.168.64.9\tmydev.hyperkit.internal # docker-machine-driver-hyperkit mydev.hyperkit.internal\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setHostsEntry(tt.hosts, "dev.hyperkit.internal", tt.ip); got != tt.want {
+				t.Errorf("setHostsEntry() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
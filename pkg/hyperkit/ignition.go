@@ -0,0 +1,91 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	ignitionISOFileName = "ignition-config.iso"
+	// configDriveLabel is the volume label Ignition looks for on config drives
+	configDriveLabel = "config-2"
+)
+
+// createIgnitionConfigDrive validates the Ignition config and packs it into
+// an OpenStack style config drive ISO in the machine dir, which Ignition reads
+// on the first boot of Flatcar and Fedora CoreOS guests.
+func (d *Driver) createIgnitionConfigDrive() error {
+	b, err := readCallerFile(d.IgnitionConfig, 0)
+	if err != nil {
+		return fmt.Errorf("reading ignition config: %w", err)
+	}
+	if !json.Valid(b) {
+		return fmt.Errorf("ignition config %s is not valid JSON", d.IgnitionConfig)
+	}
+
+	root, err := ioutil.TempDir("", "hyperkit-config-drive")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(root)
+	dataDir := filepath.Join(root, "openstack", "latest")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dataDir, "user_data"), b, 0644); err != nil {
+		return err
+	}
+
+	iso := d.ResolveStorePath(ignitionISOFileName)
+	os.Remove(iso)
+	log.Infof("Creating ignition config drive %s...", iso)
+	out, err := exec.Command("/usr/bin/hdiutil", "makehybrid", "-iso", "-joliet",
+		"-default-volume-name", configDriveLabel, "-o", iso, root).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hdiutil makehybrid: %v: %s", err, out)
+	}
+	return nil
+}
+
+// ignitionISO returns the path of the config drive, if the machine has one
+func (d *Driver) ignitionISO() string {
+	if d.IgnitionConfig == "" {
+		return ""
+	}
+	return d.ResolveStorePath(ignitionISOFileName)
+}
+
+func (d *Driver) ignitionCmdline() []string {
+	if d.IgnitionConfig == "" {
+		return nil
+	}
+	opts := []string{"ignition.platform.id=openstack"}
+	if !d.IgnitionApplied {
+		opts = append(opts, "ignition.firstboot")
+	}
+	return opts
+}
@@ -0,0 +1,152 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// xhyveConfigBackupFileName keeps the original config of imported machines
+const xhyveConfigBackupFileName = "config.json.xhyve"
+
+// xhyveDriver is the part of the docker-machine-driver-xhyve config that
+// carries over to hyperkit
+type xhyveDriver struct {
+	*drivers.BaseDriver
+	Boot2DockerURL string
+	BootCmd        string
+	CPU            int
+	Memory         int
+	DiskSize       int64
+	UUID           string
+	Qcow2          bool
+	NFSShare       bool
+	Virtio9p       bool
+}
+
+// ImportXhyveMachine converts a machine created by the xhyve driver into a
+// hyperkit machine in place. The disk, UUID and with it the MAC and IP
+// address are kept, so the machine doesn't have to be recreated.
+func ImportXhyveMachine(storePath, name string) (*Driver, error) {
+	machineDir := filepath.Join(storePath, "machines", name)
+	configPath := filepath.Join(machineDir, hostConfigFileName)
+	b, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading machine config: %w", err)
+	}
+	host := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &host); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", configPath, err)
+	}
+	var driverName string
+	if err := json.Unmarshal(host["DriverName"], &driverName); err != nil || driverName != "xhyve" {
+		return nil, fmt.Errorf("machine %s doesn't use the xhyve driver", name)
+	}
+	x := xhyveDriver{}
+	if err := json.Unmarshal(host["Driver"], &x); err != nil {
+		return nil, fmt.Errorf("decoding xhyve driver config: %w", err)
+	}
+	if x.Qcow2 {
+		return nil, fmt.Errorf("machine %s uses a qcow2 disk, which can't be imported", name)
+	}
+	if x.NFSShare || x.Virtio9p {
+		log.Warnf("Shared folders of %s are not imported, set them up again with --hyperkit-nfs-shares", name)
+	}
+
+	d := NewDriver(name, storePath)
+	d.BaseDriver = x.BaseDriver
+	if d.BaseDriver == nil {
+		d.BaseDriver = &drivers.BaseDriver{}
+	}
+	d.MachineName = name
+	d.StorePath = storePath
+	d.Boot2DockerURL = x.Boot2DockerURL
+	d.Cmdline = x.BootCmd
+	d.CPU = x.CPU
+	d.Memory = x.Memory
+	d.UUID = x.UUID
+	// xhyve sizes disks in MB
+	d.DiskSize = int(x.DiskSize)
+
+	if err := importXhyveDisk(machineDir, pkgdrivers.GetDiskPath(d.BaseDriver)); err != nil {
+		return nil, err
+	}
+	if err := d.importXhyveBootFiles(); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(machineDir, xhyveConfigBackupFileName), b, 0600); err != nil {
+		return nil, err
+	}
+	if host["DriverName"], err = json.Marshal(d.DriverName()); err != nil {
+		return nil, err
+	}
+	if host["Driver"], err = json.Marshal(d); err != nil {
+		return nil, err
+	}
+	if b, err = json.MarshalIndent(host, "", "    "); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(configPath, b, 0600); err != nil {
+		return nil, err
+	}
+	log.Infof("Imported %s, the original config is kept in %s", name, xhyveConfigBackupFileName)
+	return d, nil
+}
+
+// importXhyveDisk moves the raw disk of an xhyve machine to where hyperkit
+// expects it
+func importXhyveDisk(machineDir, diskPath string) error {
+	if _, err := os.Stat(diskPath); err == nil {
+		return nil
+	}
+	for _, name := range []string{"root-volume.img", filepath.Base(machineDir) + ".img"} {
+		candidate := filepath.Join(machineDir, name)
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		log.Debugf("Moving xhyve disk %s to %s", candidate, diskPath)
+		return os.Rename(candidate, diskPath)
+	}
+	return fmt.Errorf("no raw disk found in %s", machineDir)
+}
+
+// importXhyveBootFiles uses the kernel and initrd the xhyve driver extracted,
+// or extracts them again from the ISO
+func (d *Driver) importXhyveBootFiles() error {
+	kernel, initrd := d.ResolveStorePath("vmlinuz64"), d.ResolveStorePath("initrd.img")
+	if _, err := os.Stat(kernel); err == nil {
+		if _, err := os.Stat(initrd); err == nil {
+			d.BootKernel, d.BootInitrd = kernel, initrd
+			return nil
+		}
+	}
+	if err := d.extractKernel(d.ResolveStorePath(isoFilename)); err != nil {
+		return fmt.Errorf("extracting kernel: %w", err)
+	}
+	return nil
+}
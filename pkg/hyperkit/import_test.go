@@ -0,0 +1,80 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportXhyveMachine(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	machineDir := filepath.Join(store, "machines", "dev")
+	if err := os.MkdirAll(machineDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"ConfigVersion":3,"DriverName":"xhyve","Driver":{"IPAddress":"192.168.64.7","MachineName":"dev","SSHUser":"docker",` +
+		`"BootCmd":"loglevel=3 user=docker console=ttyS0","CPU":2,"Memory":2048,"DiskSize":20000,"UUID":"c4b6d5a0-0d6e-5d2a-9d3c-3f4c1b2a0e11"},` +
+		`"HostOptions":{"Driver":""},"Name":"dev"}`
+	files := map[string]string{
+		hostConfigFileName: config,
+		"dev.img":          "disk",
+		"vmlinuz64":        "kernel",
+		"initrd.img":       "initrd",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(machineDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ImportXhyveMachine(store, "dev"); err != nil {
+		t.Fatalf("ImportXhyveMachine() error = %v", err)
+	}
+
+	d, err := LoadDriver(store, "dev")
+	if err != nil {
+		t.Fatalf("LoadDriver() after import error = %v", err)
+	}
+	if d.IPAddress != "192.168.64.7" || d.UUID != "c4b6d5a0-0d6e-5d2a-9d3c-3f4c1b2a0e11" || d.CPU != 2 || d.Memory != 2048 || d.DiskSize != 20000 {
+		t.Errorf("imported driver = %+v", d)
+	}
+	if d.Cmdline != "loglevel=3 user=docker console=ttyS0" {
+		t.Errorf("imported cmdline = %q", d.Cmdline)
+	}
+	if d.BootKernel != filepath.Join(machineDir, "vmlinuz64") || d.BootInitrd != filepath.Join(machineDir, "initrd.img") {
+		t.Errorf("imported boot files = %q, %q", d.BootKernel, d.BootInitrd)
+	}
+	if _, err := os.Stat(filepath.Join(machineDir, "dev.rawdisk")); err != nil {
+		t.Errorf("disk not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(machineDir, xhyveConfigBackupFileName)); err != nil {
+		t.Errorf("original config not kept: %v", err)
+	}
+
+	if _, err := ImportXhyveMachine(store, "dev"); err == nil {
+		t.Error("importing a hyperkit machine succeeded")
+	}
+}
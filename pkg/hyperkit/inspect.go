@@ -0,0 +1,122 @@
+//go:build darwin
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	"github.com/johanneswuerbach/nfsexports"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// Inspection is everything known about a machine in one document, for
+// scripts and frontends
+type Inspection struct {
+	Name      string `json:"name"`
+	StorePath string `json:"store_path"`
+	State     string `json:"state"`
+	// Config is the driver config as saved in the machine's config.json
+	Config     *Driver         `json:"config"`
+	Paths      InspectPaths    `json:"paths"`
+	Runtime    *InspectRuntime `json:"runtime,omitempty"`
+	NFSExports []string        `json:"nfs_exports"`
+}
+
+// InspectPaths are the resolved files of a machine
+type InspectPaths struct {
+	MachineDir   string   `json:"machine_dir"`
+	Disk         string   `json:"disk"`
+	ExtraDisks   []string `json:"extra_disks,omitempty"`
+	ISO          string   `json:"iso,omitempty"`
+	Kernel       string   `json:"kernel"`
+	Initrd       string   `json:"initrd"`
+	ConsoleLog   string   `json:"console_log"`
+	CommandLine  string   `json:"command_line"`
+	DockerSocket string   `json:"docker_socket,omitempty"`
+}
+
+// InspectRuntime describes the running VM
+type InspectRuntime struct {
+	Pid    int           `json:"pid"`
+	Uptime time.Duration `json:"uptime_ns"`
+	IP     string        `json:"ip"`
+	IPv6   string        `json:"ipv6,omitempty"`
+	MAC    string        `json:"mac,omitempty"`
+}
+
+// Inspect returns the config, files and runtime state of the machine, and
+// which of its NFS shares are exported
+func (d *Driver) Inspect() (*Inspection, error) {
+	s, err := d.GetState()
+	if err != nil {
+		return nil, err
+	}
+	in := &Inspection{
+		Name:      d.MachineName,
+		StorePath: d.StorePath,
+		State:     s.String(),
+		Config:    d,
+		Paths: InspectPaths{
+			MachineDir:  d.ResolveStorePath("."),
+			Disk:        pkgdrivers.GetDiskPath(d.BaseDriver),
+			Kernel:      d.BootKernel,
+			Initrd:      d.BootInitrd,
+			ConsoleLog:  d.ResolveStorePath(consoleFileName),
+			CommandLine: d.ResolveStorePath(commandFileName),
+		},
+		NFSExports: []string{},
+	}
+	if d.DockerVSock {
+		in.Paths.DockerSocket = d.dockerSocket()
+	}
+	if !d.netboot() {
+		in.Paths.ISO = d.ResolveStorePath(isoFilename)
+	}
+	for _, disk := range d.extraDisks() {
+		in.Paths.ExtraDisks = append(in.Paths.ExtraDisks, d.diskPath(disk))
+	}
+	for _, share := range d.NFSShares {
+		path := d.nfsSharePath(share)
+		if ok, err := nfsexports.Exists("", d.nfsExportIdentifier(path)); err == nil && ok {
+			in.NFSExports = append(in.NFSExports, path)
+		}
+	}
+
+	if s != state.Running {
+		return in, nil
+	}
+	rt := &InspectRuntime{
+		Pid:  d.getPid(),
+		IP:   d.IPAddress,
+		IPv6: d.IPv6Address,
+	}
+	if id, err := lookupProcessIdentity(rt.Pid); err == nil {
+		rt.Uptime = time.Since(id.StartTime).Round(time.Second)
+	}
+	if b, err := d.backend(); err == nil {
+		// vmnet only hands out the MAC address of a UUID to root
+		if mac, err := d.macAddress(b); err == nil {
+			rt.MAC = mac
+		}
+	}
+	in.Runtime = rt
+	return in, nil
+}
@@ -0,0 +1,76 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDriver_InspectStopped(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	machineDir := filepath.Join(store, "machines", "dev")
+	if err := os.MkdirAll(machineDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"DriverName":"hyperkit","Driver":{"MachineName":"dev","IPAddress":"192.168.64.5","CPU":2,"DataDisk":10000}}`
+	if err := ioutil.WriteFile(filepath.Join(machineDir, hostConfigFileName), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDriver(store, "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, err := d.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.State != "Stopped" || in.Runtime != nil {
+		t.Errorf("Inspect() state = %s, runtime = %+v, want a stopped machine", in.State, in.Runtime)
+	}
+	if want := filepath.Join(machineDir, "dev.rawdisk"); in.Paths.Disk != want {
+		t.Errorf("Inspect() disk = %s, want %s", in.Paths.Disk, want)
+	}
+	if len(in.Paths.ExtraDisks) != 1 || in.Paths.ISO != filepath.Join(machineDir, isoFilename) {
+		t.Errorf("Inspect() paths = %+v", in.Paths)
+	}
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, ok := doc["config"].(map[string]interface{}); !ok || cfg["CPU"] != 2.0 {
+		t.Errorf("inspect JSON config = %v, want the driver config", doc["config"])
+	}
+	if exports, ok := doc["nfs_exports"].([]interface{}); !ok || len(exports) != 0 {
+		t.Errorf("inspect JSON nfs_exports = %v, want an empty list", doc["nfs_exports"])
+	}
+}
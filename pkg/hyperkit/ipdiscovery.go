@@ -0,0 +1,241 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIPAttempts is how many IP discovery attempts are kept for diagnostics
+const maxIPAttempts = 50
+
+var (
+	defaultIPStrategies = []string{"leases", "arp"}
+
+	arpLineRegexp = regexp.MustCompile(`\(([0-9.]+)\) at ([0-9A-Fa-f:]+)`)
+
+	ipStrategiesMu sync.Mutex
+	ipStrategies   = map[string]IPStrategyFactory{
+		"leases": newLeasesStrategy,
+		"arp":    func(string) (IPStrategy, error) { return arpStrategy{}, nil },
+		"static": newStaticStrategy,
+		"exec":   newExecStrategy,
+	}
+)
+
+// IPStrategy discovers the IP address of a machine from its MAC address
+type IPStrategy interface {
+	Discover(mac string) (string, error)
+}
+
+// IPStrategyFactory creates an IPStrategy from the argument following the
+// strategy name in --hyperkit-ip-discovery, e.g. the address in "static:1.2.3.4"
+type IPStrategyFactory func(arg string) (IPStrategy, error)
+
+// RegisterIPStrategy makes an IP discovery strategy available to
+// --hyperkit-ip-discovery under name, so embedders can add their own.
+func RegisterIPStrategy(name string, factory IPStrategyFactory) {
+	ipStrategiesMu.Lock()
+	defer ipStrategiesMu.Unlock()
+	ipStrategies[name] = factory
+}
+
+// ipAttempt is the outcome of a single strategy trying to discover the IP
+type ipAttempt struct {
+	Time     time.Time
+	Strategy string
+	IP       string
+	Err      string
+}
+
+func (a ipAttempt) String() string {
+	if a.Err != "" {
+		return fmt.Sprintf("%s %s: %s", a.Time.Format(time.RFC3339), a.Strategy, a.Err)
+	}
+	return fmt.Sprintf("%s %s: found %s", a.Time.Format(time.RFC3339), a.Strategy, a.IP)
+}
+
+// buildIPStrategies resolves strategy specs of the form name[:arg]
+func buildIPStrategies(specs []string) ([]IPStrategy, error) {
+	ipStrategiesMu.Lock()
+	defer ipStrategiesMu.Unlock()
+
+	var strategies []IPStrategy
+	for _, spec := range specs {
+		name, arg := spec, ""
+		if i := strings.Index(spec, ":"); i >= 0 {
+			name, arg = spec[:i], spec[i+1:]
+		}
+		factory, ok := ipStrategies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown IP discovery strategy %q", name)
+		}
+		s, err := factory(arg)
+		if err != nil {
+			return nil, fmt.Errorf("IP discovery strategy %q: %w", spec, err)
+		}
+		strategies = append(strategies, s)
+	}
+	return strategies, nil
+}
+
+// discoverIP tries each configured strategy in order and returns the first IP
+// address found, recording every attempt for the diagnostics bundle.
+func (d *Driver) discoverIP(mac string) (string, error) {
+	specs := d.IPDiscovery
+	if len(specs) == 0 {
+		specs = defaultIPStrategies
+	}
+	specs = append([]string(nil), specs...)
+	for i, spec := range specs {
+		// A plain leases strategy reads the configured leases file
+		if spec == "leases" && d.leasesPath() != LeasesPath {
+			specs[i] = "leases:" + d.leasesPath()
+		}
+	}
+	strategies, err := buildIPStrategies(specs)
+	if err != nil {
+		return "", err
+	}
+
+	var errs []string
+	for i, s := range strategies {
+		ip, err := s.Discover(mac)
+		attempt := ipAttempt{Time: time.Now(), Strategy: specs[i], IP: ip}
+		if err != nil {
+			attempt.Err = err.Error()
+			errs = append(errs, fmt.Sprintf("%s: %v", specs[i], err))
+		}
+		d.recordIPAttempt(attempt)
+		if err == nil {
+			return ip, nil
+		}
+	}
+	return "", fmt.Errorf("could not find an IP address for %s (%s)", mac, strings.Join(errs, "; "))
+}
+
+func (d *Driver) recordIPAttempt(a ipAttempt) {
+	d.ipAttempts = append(d.ipAttempts, a)
+	if len(d.ipAttempts) > maxIPAttempts {
+		d.ipAttempts = d.ipAttempts[len(d.ipAttempts)-maxIPAttempts:]
+	}
+}
+
+// leasesStrategy looks the MAC address up in a dhcp leases file, by default
+// the one of macOS's bootpd
+type leasesStrategy string
+
+func newLeasesStrategy(arg string) (IPStrategy, error) {
+	if arg == "" {
+		arg = LeasesPath
+	}
+	return leasesStrategy(arg), nil
+}
+
+func (s leasesStrategy) Discover(mac string) (string, error) {
+	if err := checkLeasesPath(string(s)); err != nil {
+		return "", err
+	}
+	return getIPAddressFromFile(mac, string(s))
+}
+
+// leasesPath returns the dhcp leases file of the machine
+func (d *Driver) leasesPath() string {
+	if d.LeasesPath == "" {
+		return LeasesPath
+	}
+	return d.LeasesPath
+}
+
+// checkLeasesPath fails unless path is the leases file of bootpd or a file
+// the user could read themselves, as the driver reads it as root
+func checkLeasesPath(path string) error {
+	if path == LeasesPath {
+		return nil
+	}
+	return checkCallerCanRead(path)
+}
+
+// arpStrategy looks the MAC address up in the host's ARP cache, which helps
+// with guests that use a static address and never ask bootpd for a lease.
+type arpStrategy struct{}
+
+func (arpStrategy) Discover(mac string) (string, error) {
+	out, err := exec.Command("/usr/sbin/arp", "-an").Output()
+	if err != nil {
+		return "", fmt.Errorf("arp: %w", err)
+	}
+	return ipFromARPOutput(string(out), mac)
+}
+
+func ipFromARPOutput(out, mac string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		m := arpLineRegexp.FindStringSubmatch(scanner.Text())
+		if m != nil && trimMacAddress(strings.ToLower(m[2])) == mac {
+			return m[1], nil
+		}
+	}
+	return "", fmt.Errorf("%s not in ARP cache", mac)
+}
+
+// staticStrategy returns a fixed address, for machines with a reservation
+type staticStrategy string
+
+func newStaticStrategy(arg string) (IPStrategy, error) {
+	if net.ParseIP(arg) == nil {
+		return nil, fmt.Errorf("invalid IP address %q", arg)
+	}
+	return staticStrategy(arg), nil
+}
+
+func (s staticStrategy) Discover(mac string) (string, error) {
+	return string(s), nil
+}
+
+// execStrategy runs a user supplied command with the MAC address as its only
+// argument, and expects the IP address on stdout. The command runs as the user
+// who invoked the driver, never as root.
+type execStrategy string
+
+func newExecStrategy(arg string) (IPStrategy, error) {
+	if arg == "" {
+		return nil, fmt.Errorf("missing command")
+	}
+	return execStrategy(arg), nil
+}
+
+func (s execStrategy) Discover(mac string) (string, error) {
+	out, err := asCaller(exec.Command(string(s), mac)).Output()
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(out))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s returned invalid IP address %q", s, ip)
+	}
+	return ip, nil
+}
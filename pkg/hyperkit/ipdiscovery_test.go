@@ -0,0 +1,80 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"testing"
+)
+
+var arpOutput = `? (192.168.1.1) at 0:11:22:33:44:55 on en0 ifscope [ethernet]
+? (192.168.64.3) at a4:b5:c6:d7:e8:f9 on bridge100 ifscope [ethernet]
+? (192.168.64.7) at a:b:c6:d7:e8:f on bridge100 ifscope [ethernet]
+? (192.168.64.255) at ff:ff:ff:ff:ff:ff on bridge100 ifscope [ethernet]
+`
+
+func Test_ipFromARPOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{"valid", "a4:b5:c6:d7:e8:f9", "192.168.64.3", false},
+		{"short_octets", "a:b:c6:d7:e8:f", "192.168.64.7", false},
+		{"missing", "a1:b2:c3:d4:e5:f6", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ipFromARPOutput(arpOutput, tt.mac)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ipFromARPOutput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ipFromARPOutput() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_buildIPStrategies(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   []string
+		wantErr bool
+	}{
+		{"defaults", []string{"leases", "arp"}, false},
+		{"static", []string{"static:192.168.64.10"}, false},
+		{"invalid_static", []string{"static:nope"}, true},
+		{"exec", []string{"exec:/usr/local/bin/find-ip"}, false},
+		{"unknown", []string{"mdns"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildIPStrategies(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("buildIPStrategies() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && len(got) != len(tt.specs) {
+				t.Errorf("buildIPStrategies() returned %d strategies, want %d", len(got), len(tt.specs))
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// guestIPv6Command lists the global IPv6 addresses of the guest
+const guestIPv6Command = "ip -6 -o addr show scope global"
+
+// discoverIPv6 finds a global IPv6 address of the machine, first in the
+// host's NDP cache and then by asking the guest over SSH on its IPv4
+// address.
+func (d *Driver) discoverIPv6(mac string) (string, error) {
+	if out, err := exec.Command("/usr/sbin/ndp", "-an").Output(); err == nil {
+		if ip := ipv6FromNDPOutput(string(out), mac); ip != "" {
+			return ip, nil
+		}
+	}
+	out, err := drivers.RunSSHCommandFromDriver(d, guestIPv6Command)
+	if err != nil {
+		return "", fmt.Errorf("listing guest IPv6 addresses: %w", err)
+	}
+	if ip := ipv6FromIPAddrOutput(out); ip != "" {
+		return ip, nil
+	}
+	return "", fmt.Errorf("machine has no global IPv6 address")
+}
+
+// ipv6FromNDPOutput returns the first global address of mac in the output
+// of ndp -an
+func ipv6FromNDPOutput(out, mac string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || trimMacAddress(strings.ToLower(fields[1])) != mac {
+			continue
+		}
+		if ip := net.ParseIP(fields[0]); isGlobalIPv6(ip) {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// ipv6FromIPAddrOutput returns the first global address in the output of
+// ip -6 -o addr
+func ipv6FromIPAddrOutput(out string) string {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] != "inet6" {
+				continue
+			}
+			ip, _, err := net.ParseCIDR(fields[i+1])
+			if err == nil && isGlobalIPv6(ip) {
+				return ip.String()
+			}
+		}
+	}
+	return ""
+}
+
+func isGlobalIPv6(ip net.IP) bool {
+	return ip != nil && ip.To4() == nil && ip.IsGlobalUnicast()
+}
+
+// updateIPv6 refreshes the IPv6 address of a machine that prefers IPv6
+func (d *Driver) updateIPv6(mac string) {
+	// SSH to the guest over IPv4 until the new address is known
+	d.IPv6Address = ""
+	ip, err := d.discoverIPv6(mac)
+	if err != nil {
+		log.Warnf("Unable to discover the IPv6 address, using %s: %v", d.IPAddress, err)
+		return
+	}
+	log.Debugf("IPv6: %s", ip)
+	d.IPv6Address = ip
+}
+
+// preferredIP returns the address clients should connect to
+func (d *Driver) preferredIP() string {
+	if d.PreferIPv6 && d.IPv6Address != "" {
+		return d.IPv6Address
+	}
+	return d.IPAddress
+}
@@ -0,0 +1,71 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"testing"
+)
+
+func Test_ipv6FromNDPOutput(t *testing.T) {
+	out := `Neighbor                             Linklayer Address  Netif Expire    St Flgs Prbs
+fe80::1:2ff:fe03:405%bridge100       a:b:c:d:e:f        bridge100 23h59m58s S
+2001:db8::a0b:cff:fe0d:e0f           a:b:c:d:e:f        bridge100 23h59m58s S
+2001:db8::99                         1:2:3:4:5:6        bridge100 23h59m58s S
+`
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"a:b:c:d:e:f", "2001:db8::a0b:cff:fe0d:e0f"},
+		{"1:2:3:4:5:6", "2001:db8::99"},
+		{"f:f:f:f:f:f", ""},
+	}
+	for _, tt := range tests {
+		if got := ipv6FromNDPOutput(out, tt.mac); got != tt.want {
+			t.Errorf("ipv6FromNDPOutput(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func Test_ipv6FromIPAddrOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want string
+	}{
+		{
+			"global",
+			"2: eth0    inet6 2001:db8::5/64 scope global dynamic mngtmpaddr \\       valid_lft 86390sec preferred_lft 14390sec\n",
+			"2001:db8::5",
+		},
+		{
+			"link_local_only",
+			"2: eth0    inet6 fe80::1/64 scope link \\       valid_lft forever preferred_lft forever\n",
+			"",
+		},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipv6FromIPAddrOutput(tt.out); got != tt.want {
+				t.Errorf("ipv6FromIPAddrOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package hyperkit
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -26,15 +27,74 @@ import (
 	"github.com/hooklift/iso9660"
 )
 
-var kernelRegexp = regexp.MustCompile(`(vmlinu[xz]|bzImage)[\d]*`)
+var (
+	// boot2docker and minikube ship vmlinuz64/bzimage, most distros /boot/vmlinuz-<version>
+	kernelRegexp = regexp.MustCompile(`(?i)(vmlinu[xz]|bzimage)[\d]*`)
+	initrdRegexp = regexp.MustCompile(`(?i)(initrd|initramfs)`)
+)
 
 type ISOBootFiles struct {
 	InitrdPath      string
 	KernelPath      string
 	IsoLinuxCfgPath string
+	GrubCfgPath     string
+}
+
+// ISOBootPaths overrides where the kernel and initrd are looked for inside
+// an ISO, for layouts the name based detection doesn't handle.
+type ISOBootPaths struct {
+	Kernel string
+	Initrd string
+}
+
+type bootFileKind int
+
+const (
+	bootFileNone bootFileKind = iota
+	bootFileKernel
+	bootFileInitrd
+	bootFileIsoLinuxCfg
+	bootFileGrubCfg
+)
+
+// classifyBootFile decides which boot file, if any, the ISO file name is
+func classifyBootFile(name string, paths ISOBootPaths) bootFileKind {
+	name = "/" + strings.TrimPrefix(strings.TrimSuffix(name, "."), "/")
+	base := filepath.Base(name)
+	switch {
+	case paths.Kernel != "":
+		if strings.EqualFold(name, "/"+strings.TrimPrefix(paths.Kernel, "/")) {
+			return bootFileKernel
+		}
+	case kernelRegexp.MatchString(base):
+		return bootFileKernel
+	}
+	switch {
+	case paths.Initrd != "":
+		if strings.EqualFold(name, "/"+strings.TrimPrefix(paths.Initrd, "/")) {
+			return bootFileInitrd
+		}
+	case initrdRegexp.MatchString(base) && !strings.HasSuffix(strings.ToLower(base), ".cfg"):
+		return bootFileInitrd
+	}
+	switch strings.ToLower(base) {
+	case "isolinux.cfg", "syslinux.cfg":
+		return bootFileIsoLinuxCfg
+	case "grub.cfg":
+		return bootFileGrubCfg
+	}
+	return bootFileNone
 }
 
 func ISOExtractBootFiles(isoPath, destDirPath string) (ISOBootFiles, error) {
+	return ISOExtractBootFilesWithPaths(isoPath, destDirPath, ISOBootPaths{})
+}
+
+// ISOExtractBootFilesWithPaths extracts the kernel, initrd and bootloader
+// configs from the ISO into destDirPath. It understands boot2docker and
+// minikube isolinux layouts as well as GRUB based ISOs with
+// /boot/vmlinuz-* and initrd/initramfs images.
+func ISOExtractBootFilesWithPaths(isoPath, destDirPath string, paths ISOBootPaths) (ISOBootFiles, error) {
 	bootFiles := ISOBootFiles{}
 	iso, err := os.Open(isoPath)
 	if err != nil {
@@ -60,31 +120,81 @@ func ISOExtractBootFiles(isoPath, destDirPath string) (ISOBootFiles, error) {
 		// For some reason file paths in the ISO sometimes contain a '.' character at the end, so strip that off.
 		destPath := filepath.Join(destDirPath, filepath.Base(strings.TrimSuffix(f.Name(), ".")))
 
-		if kernelRegexp.MatchString(f.Name()) {
+		switch classifyBootFile(f.Name(), paths) {
+		case bootFileKernel:
 			bootFiles.KernelPath = destPath
-		} else if strings.Contains(f.Name(), "initrd") {
+		case bootFileInitrd:
 			bootFiles.InitrdPath = destPath
-		} else if strings.Contains(f.Name(), "isolinux.cfg") {
+		case bootFileIsoLinuxCfg:
 			bootFiles.IsoLinuxCfgPath = destPath
-		} else {
+		case bootFileGrubCfg:
+			bootFiles.GrubCfgPath = destPath
+		default:
 			continue
 		}
 
-		err = func() error {
-			dst, err := os.Create(destPath)
-			if err != nil {
-				return err
-			}
-			defer dst.Close()
+		if err := copyISOFile(f, destPath); err != nil {
+			return bootFiles, err
+		}
+	}
+
+	return bootFiles, err
+}
+
+// isoExtractFiles extracts the files at paths in the ISO into destDirPath
+// and returns where they went, in the order of paths
+func isoExtractFiles(isoPath, destDirPath string, paths []string) ([]string, error) {
+	iso, err := os.Open(isoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer iso.Close()
 
-			_, err = io.Copy(dst, f.Sys().(io.Reader))
-			return err
-		}()
+	r, err := iso9660.NewReader(iso)
+	if err != nil {
+		return nil, err
+	}
 
+	dests := make([]string, len(paths))
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return bootFiles, err
+			return nil, err
+		}
+		if f.IsDir() {
+			continue
+		}
+		name := "/" + strings.TrimPrefix(strings.TrimSuffix(f.Name(), "."), "/")
+		for i, p := range paths {
+			if !strings.EqualFold(name, "/"+strings.TrimPrefix(p, "/")) {
+				continue
+			}
+			dests[i] = filepath.Join(destDirPath, fmt.Sprintf("%d-%s", i, filepath.Base(name)))
+			if err := copyISOFile(f, dests[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, dest := range dests {
+		if dest == "" {
+			return nil, fmt.Errorf("%s not found in %s", paths[i], isoPath)
 		}
 	}
+	return dests, nil
+}
 
-	return bootFiles, err
+func copyISOFile(f os.FileInfo, destPath string) error {
+	dst, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, f.Sys().(io.Reader)); err != nil {
+		return err
+	}
+	return dst.Close()
 }
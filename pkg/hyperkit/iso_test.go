@@ -0,0 +1,51 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"testing"
+)
+
+func Test_classifyBootFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		paths ISOBootPaths
+		want  bootFileKind
+	}{
+		{"boot2docker_kernel", "/boot/vmlinuz64", ISOBootPaths{}, bootFileKernel},
+		{"boot2docker_initrd", "/boot/initrd.img", ISOBootPaths{}, bootFileInitrd},
+		{"boot2docker_isolinux", "/boot/isolinux/isolinux.cfg", ISOBootPaths{}, bootFileIsoLinuxCfg},
+		{"minikube_kernel", "/boot/bzimage", ISOBootPaths{}, bootFileKernel},
+		{"minikube_initrd", "/boot/initrd", ISOBootPaths{}, bootFileInitrd},
+		{"distro_kernel", "/boot/vmlinuz-5.10.0-9-amd64", ISOBootPaths{}, bootFileKernel},
+		{"distro_initramfs", "/boot/initramfs-5.10.0.img", ISOBootPaths{}, bootFileInitrd},
+		{"grub", "/boot/grub/grub.cfg", ISOBootPaths{}, bootFileGrubCfg},
+		{"trailing_dot", "/BOOT/VMLINUZ.", ISOBootPaths{}, bootFileKernel},
+		{"unrelated", "/boot/grub/font.pf2", ISOBootPaths{}, bootFileNone},
+		{"explicit_kernel", "/casper/linux", ISOBootPaths{Kernel: "casper/linux"}, bootFileKernel},
+		{"explicit_kernel_skips_detection", "/boot/vmlinuz", ISOBootPaths{Kernel: "/casper/linux"}, bootFileNone},
+		{"explicit_initrd", "/casper/ramdisk.lz", ISOBootPaths{Initrd: "/casper/ramdisk.lz"}, bootFileInitrd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyBootFile(tt.file, tt.paths); got != tt.want {
+				t.Errorf("classifyBootFile(%q) = %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// patchOperation is a single RFC 6902 JSON patch operation
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyJSONPatch applies an RFC 6902 JSON patch to doc
+func applyJSONPatch(doc, patch []byte) ([]byte, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("decoding JSON patch: %w", err)
+	}
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("decoding document: %w", err)
+	}
+
+	for i, op := range ops {
+		var err error
+		switch op.Op {
+		case "add", "replace", "test":
+			var value interface{}
+			if err = json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("patch operation %d: decoding value: %w", i, err)
+			}
+			switch op.Op {
+			case "add":
+				root, err = patchAdd(root, op.Path, value)
+			case "replace":
+				if root, _, err = patchRemove(root, op.Path); err == nil {
+					root, err = patchAdd(root, op.Path, value)
+				}
+			case "test":
+				var current interface{}
+				if current, err = patchGet(root, op.Path); err == nil && !reflect.DeepEqual(current, value) {
+					err = fmt.Errorf("test failed for %s", op.Path)
+				}
+			}
+		case "remove":
+			root, _, err = patchRemove(root, op.Path)
+		case "move":
+			var value interface{}
+			if root, value, err = patchRemove(root, op.From); err == nil {
+				root, err = patchAdd(root, op.Path, value)
+			}
+		case "copy":
+			var value interface{}
+			if value, err = patchGet(root, op.From); err == nil {
+				root, err = patchAdd(root, op.Path, value)
+			}
+		default:
+			err = fmt.Errorf("unknown op %q", op.Op)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("patch operation %d: %w", i, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func patchGet(root interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	node := root
+	for _, t := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[t]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			node = v
+		case []interface{}:
+			i, err := strconv.Atoi(t)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%s not found", pointer)
+		}
+	}
+	return node, nil
+}
+
+// patchAdd adds value at pointer and returns the new root, as adding to an
+// array may reallocate it
+func patchAdd(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return setChild(root, tokens, pointer, func(parent interface{}, key string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[key] = value
+			return p, nil
+		case []interface{}:
+			if key == "-" {
+				return append(p, value), nil
+			}
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i > len(p) {
+				return nil, fmt.Errorf("invalid array index in %s", pointer)
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		}
+		return nil, fmt.Errorf("parent of %s is not a container", pointer)
+	})
+}
+
+// patchRemove removes the value at pointer and returns the new root and the
+// removed value
+func patchRemove(root interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, root, nil
+	}
+	var removed interface{}
+	root, err = setChild(root, tokens, pointer, func(parent interface{}, key string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			v, ok := p[key]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			removed = v
+			delete(p, key)
+			return p, nil
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(p) {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			removed = p[i]
+			return append(p[:i:i], p[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("parent of %s is not a container", pointer)
+	})
+	return root, removed, err
+}
+
+// setChild walks to the parent of the last token, lets f update it and
+// stores the updated parent back into its own parent.
+func setChild(node interface{}, tokens []string, pointer string, f func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return f(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", pointer)
+		}
+		updated, err := setChild(child, tokens[1:], pointer, f)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = updated
+		return n, nil
+	case []interface{}:
+		i, err := strconv.Atoi(tokens[0])
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, fmt.Errorf("%s not found", pointer)
+		}
+		updated, err := setChild(n[i], tokens[1:], pointer, f)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	}
+	return nil, fmt.Errorf("%s not found", pointer)
+}
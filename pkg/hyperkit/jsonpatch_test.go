@@ -0,0 +1,79 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"testing"
+)
+
+func Test_applyJSONPatch(t *testing.T) {
+	doc := `{"cpus":1,"iso":["a.iso"],"vsock_ports":[2376],"cmdline":"quiet","a/b":1}`
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr bool
+	}{
+		{
+			"replace",
+			`[{"op":"replace","path":"/cpus","value":4}]`,
+			`{"a/b":1,"cmdline":"quiet","cpus":4,"iso":["a.iso"],"vsock_ports":[2376]}`,
+			false,
+		},
+		{
+			"append_and_insert",
+			`[{"op":"add","path":"/iso/-","value":"c.iso"},{"op":"add","path":"/iso/0","value":"b.iso"}]`,
+			`{"a/b":1,"cmdline":"quiet","cpus":1,"iso":["b.iso","a.iso","c.iso"],"vsock_ports":[2376]}`,
+			false,
+		},
+		{
+			"remove_escaped_key",
+			`[{"op":"remove","path":"/a~1b"},{"op":"remove","path":"/vsock_ports/0"}]`,
+			`{"cmdline":"quiet","cpus":1,"iso":["a.iso"],"vsock_ports":[]}`,
+			false,
+		},
+		{
+			"move_and_copy",
+			`[{"op":"copy","from":"/cmdline","path":"/console"},{"op":"move","from":"/cpus","path":"/memory"}]`,
+			`{"a/b":1,"cmdline":"quiet","console":"quiet","iso":["a.iso"],"memory":1,"vsock_ports":[2376]}`,
+			false,
+		},
+		{
+			"test_failure",
+			`[{"op":"test","path":"/cpus","value":2}]`,
+			"",
+			true,
+		},
+		{
+			"missing_path",
+			`[{"op":"replace","path":"/memory","value":2048}]`,
+			"",
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyJSONPatch([]byte(doc), []byte(tt.patch))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyJSONPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("applyJSONPatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
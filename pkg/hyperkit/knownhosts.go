@@ -0,0 +1,218 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// hostKeysFileName keeps the guest SSH host keys seen at the first boot,
+	// one "<type> <key>" per line
+	hostKeysFileName = "ssh_host_keys"
+	// KnownHostsFileName is the known_hosts file in the store, listing the
+	// host keys of all its hyperkit machines
+	KnownHostsFileName = "hyperkit_known_hosts"
+	keyscanTimeout     = 5
+)
+
+// KnownHostsPath returns the known_hosts file of the machines in storePath
+func KnownHostsPath(storePath string) string {
+	return filepath.Join(storePath, KnownHostsFileName)
+}
+
+// parseKeyscan returns the sorted "<type> <key>" pairs of ssh-keyscan output
+func parseKeyscan(out []byte) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		key := fields[1] + " " + fields[2]
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scanHostKeys fetches the host keys the guest sshd presents
+func (d *Driver) scanHostKeys() ([]string, error) {
+	host, err := d.GetSSHHostname()
+	if err != nil {
+		return nil, err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return nil, err
+	}
+	out, err := asCaller(exec.Command("/usr/bin/ssh-keyscan", "-T", strconv.Itoa(keyscanTimeout), "-p", strconv.Itoa(port), host)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh-keyscan %s: %w", host, err)
+	}
+	keys := parseKeyscan(out)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("sshd on %s:%d presented no host keys", host, port)
+	}
+	return keys, nil
+}
+
+func (d *Driver) readHostKeys() ([]string, error) {
+	b, err := ioutil.ReadFile(d.ResolveStorePath(hostKeysFileName))
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
+
+// checkHostKeys records the guest host keys at the first boot, warns when
+// they changed on later boots, and updates the known_hosts file of the store.
+func (d *Driver) checkHostKeys() {
+	keys, err := d.scanHostKeys()
+	if err != nil {
+		log.Warnf("Unable to read the SSH host keys of %s: %v", d.MachineName, err)
+		return
+	}
+	known, err := d.readHostKeys()
+	switch {
+	case os.IsNotExist(err):
+		log.Debugf("Recording the SSH host keys of %s", d.MachineName)
+		if err := writeFileAtomic(d.ResolveStorePath(hostKeysFileName), []byte(strings.Join(keys, "\n")+"\n"), 0644); err != nil {
+			log.Warnf("Unable to record the SSH host keys: %v", err)
+			return
+		}
+	case err != nil:
+		log.Warnf("Unable to read the recorded SSH host keys: %v", err)
+		return
+	case strings.Join(known, "\n") != strings.Join(keys, "\n"):
+		log.Warnf("The SSH host keys of %s changed since its first boot. If the guest regenerated them, remove %s to accept the new ones",
+			d.MachineName, d.ResolveStorePath(hostKeysFileName))
+		return
+	}
+	if _, err := UpdateKnownHosts(d.StorePath, d); err != nil {
+		log.Warnf("Unable to update %s: %v", KnownHostsPath(d.StorePath), err)
+	}
+}
+
+// knownHostsEntries returns the known_hosts lines of the machine, for the
+// address SSH reaches it on and its stable hostname
+func (d *Driver) knownHostsEntries() []string {
+	keys, err := d.readHostKeys()
+	if err != nil || len(keys) == 0 {
+		return nil
+	}
+	host, err := d.GetSSHHostname()
+	if err != nil || host == "" {
+		return nil
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return nil
+	}
+	hosts := []string{host}
+	if d.StableHostname {
+		hosts = append(hosts, d.stableHostname())
+	}
+	for i, h := range hosts {
+		hosts[i] = knownHostsPattern(h, port)
+	}
+	var entries []string
+	for _, key := range keys {
+		entries = append(entries, strings.Join(hosts, ",")+" "+key)
+	}
+	return entries
+}
+
+// knownHostsPattern returns how known_hosts names host on port
+func knownHostsPattern(host string, port int) string {
+	if port == defaultSSHPort {
+		return host
+	}
+	return "[" + host + "]:" + strconv.Itoa(port)
+}
+
+// UpdateKnownHosts rewrites the known_hosts file of storePath from the
+// recorded host keys of its machines, taking the current config of the
+// machines in drivers over the saved one. It returns the file's path.
+func UpdateKnownHosts(storePath string, drivers ...*Driver) (string, error) {
+	current := map[string]*Driver{}
+	for _, d := range drivers {
+		current[d.MachineName] = d
+	}
+	refs, err := ListMachines([]string{storePath})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# SSH host keys of the hyperkit machines in %s, maintained by the driver\n", storePath)
+	for _, ref := range refs {
+		d, ok := current[ref.Name]
+		if !ok {
+			if d, err = LoadDriver(storePath, ref.Name); err != nil {
+				continue
+			}
+		}
+		for _, entry := range d.knownHostsEntries() {
+			fmt.Fprintln(&buf, entry)
+		}
+	}
+
+	path := KnownHostsPath(storePath)
+	if err := writeFileAtomic(path, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	// ssh refuses known_hosts files that aren't owned by the user
+	if uid := syscall.Getuid(); uid != 0 {
+		if err := os.Chown(path, uid, syscall.Getgid()); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// SSHHostKeyOptions returns the ssh options checking the host key of the
+// machine against the known_hosts file of the store, or not checking it at
+// all while no host key is recorded yet.
+func (d *Driver) SSHHostKeyOptions() []string {
+	if len(d.knownHostsEntries()) == 0 {
+		return []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null"}
+	}
+	return []string{"-o", "StrictHostKeyChecking=yes", "-o", "UserKnownHostsFile=" + KnownHostsPath(d.StorePath)}
+}
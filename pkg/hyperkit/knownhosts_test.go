@@ -0,0 +1,88 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestParseKeyscan(t *testing.T) {
+	out := []byte(`# 192.168.64.2:22 SSH-2.0-OpenSSH_8.1
+192.168.64.2 ssh-rsa AAAArsa
+192.168.64.2 ssh-ed25519 AAAAed25519
+192.168.64.2 ssh-rsa AAAArsa
+
+`)
+	want := []string{"ssh-ed25519 AAAAed25519", "ssh-rsa AAAArsa"}
+	if got := parseKeyscan(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseKeyscan() = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateKnownHosts(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+
+	writeMachine(t, store, "dev", "hyperkit")
+	writeMachine(t, store, "ci", "hyperkit")
+	writeMachine(t, store, "fresh", "hyperkit")
+	for _, name := range []string{"dev", "ci"} {
+		keys := "ssh-ed25519 AAAA" + name + "\n"
+		if err := ioutil.WriteFile(filepath.Join(store, "machines", name, hostKeysFileName), []byte(keys), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dev := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "dev", StorePath: store, IPAddress: "192.168.64.2", SSHPort: 22}}
+	ci := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "ci", StorePath: store, IPAddress: "192.168.64.3", SSHPort: 2222}}
+	path, err := UpdateKnownHosts(store, dev, ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"\n192.168.64.2 ssh-ed25519 AAAAdev\n", "\n[192.168.64.3]:2222 ssh-ed25519 AAAAci\n"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("known_hosts doesn't contain %q:\n%s", want, b)
+		}
+	}
+	if strings.Count(string(b), "\n") != 3 {
+		t.Errorf("known_hosts has entries for machines without recorded host keys:\n%s", b)
+	}
+
+	if opts := dev.SSHHostKeyOptions(); opts[len(opts)-1] != "UserKnownHostsFile="+path {
+		t.Errorf("SSHHostKeyOptions() = %q, want the store known_hosts", opts)
+	}
+	fresh := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "fresh", StorePath: store, IPAddress: "192.168.64.4"}}
+	if opts := fresh.SSHHostKeyOptions(); opts[len(opts)-1] != "UserKnownHostsFile=/dev/null" {
+		t.Errorf("SSHHostKeyOptions() = %q without recorded host keys", opts)
+	}
+}
@@ -0,0 +1,153 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	launchdLabelPrefix   = "com.github.mtibben.docker-machine-driver-hyperkit."
+	autostartLogFileName = "autostart.log"
+)
+
+func (d *Driver) launchdLabel() string {
+	return launchdLabelPrefix + d.MachineName
+}
+
+// launchdPlist renders a launchd job running args at load, which is login
+// for an agent and boot for a daemon
+func launchdPlist(label string, args []string, logPath string) []byte {
+	var b bytes.Buffer
+	esc := func(s string) string {
+		var e bytes.Buffer
+		xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+	b.WriteString(xml.Header)
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+	fmt.Fprintf(&b, "\t<key>Label</key>\n\t<string>%s</string>\n", esc(label))
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, arg := range args {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", esc(arg))
+	}
+	b.WriteString("\t</array>\n")
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	fmt.Fprintf(&b, "\t<key>StandardOutPath</key>\n\t<string>%s</string>\n", esc(logPath))
+	fmt.Fprintf(&b, "\t<key>StandardErrorPath</key>\n\t<string>%s</string>\n", esc(logPath))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.Bytes()
+}
+
+// launchdTarget returns where the job of the invoking user goes: a daemon
+// starting at boot for root, an agent starting at login otherwise
+func launchdTarget(label string) (plist, domain string, err error) {
+	uid := syscall.Getuid()
+	if uid == 0 {
+		return filepath.Join("/Library/LaunchDaemons", label+".plist"), "system", nil
+	}
+	u, err := user.LookupId(strconv.Itoa(uid))
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(u.HomeDir, "Library", "LaunchAgents", label+".plist"), fmt.Sprintf("gui/%d", uid), nil
+}
+
+// writeLaunchdPlist writes the plist at path through a temp file renamed
+// into place, refusing to replace a symlink there
+func writeLaunchdPlist(path string, data []byte) error {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%s is a symlink", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// installLaunchdJob makes launchd start the machine at login, or at boot
+// when created by root. The supervisor brings it back if it crashes. An
+// agent is written as its user, launchd ignores agents they don't own.
+func (d *Driver) installLaunchdJob() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	label := d.launchdLabel()
+	plist, domain, err := launchdTarget(label)
+	if err != nil {
+		return err
+	}
+	args := []string{exe, "autostart", "-storage-path", d.StorePath, d.MachineName}
+	data := launchdPlist(label, args, d.ResolveStorePath(autostartLogFileName))
+	if err := withCallerIDs(func() error { return writeLaunchdPlist(plist, data) }); err != nil {
+		return err
+	}
+
+	// Loading the job runs it right away, and it finds the machine up
+	if out, err := exec.Command("/bin/launchctl", "bootstrap", domain, plist).CombinedOutput(); err != nil {
+		log.Warnf("Unable to load %s, it takes effect on the next login: %v: %s", plist, err, bytes.TrimSpace(out))
+	}
+	log.Infof("Machine %s starts automatically through %s", d.MachineName, plist)
+	return nil
+}
+
+// removeLaunchdJob unloads and removes the job of installLaunchdJob
+func (d *Driver) removeLaunchdJob() {
+	plist, domain, err := launchdTarget(d.launchdLabel())
+	if err != nil {
+		log.Debugf("Unable to locate the launchd job of %s: %v", d.MachineName, err)
+		return
+	}
+	if _, err := os.Lstat(plist); os.IsNotExist(err) {
+		return
+	}
+	if out, err := exec.Command("/bin/launchctl", "bootout", domain+"/"+d.launchdLabel()).CombinedOutput(); err != nil {
+		log.Debugf("launchctl bootout: %v: %s", err, bytes.TrimSpace(out))
+	}
+	err = withCallerIDs(func() error { return os.Remove(plist) })
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Unable to remove %s: %v", plist, err)
+	}
+}
+
+// RunAutostart starts the machine for its launchd job, unless it is running
+// already or was stopped through the driver, and reports whether it did
+func (d *Driver) RunAutostart() (bool, error) {
+	if st, err := d.GetState(); err == nil && st == state.Running {
+		return false, nil
+	}
+	if d.stopRequested() {
+		log.Infof("Machine %s was stopped, not starting it", d.MachineName)
+		return false, nil
+	}
+	return true, d.Start()
+}
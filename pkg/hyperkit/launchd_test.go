@@ -0,0 +1,87 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	args := []string{"/usr/local/bin/docker-machine-driver-hyperkit", "autostart", "-storage-path", "/Users/dev/.docker/machine", "a&b"}
+	plist := string(launchdPlist(launchdLabelPrefix+"a&b", args, "/Users/dev/.docker/machine/machines/a&b/autostart.log"))
+
+	for _, want := range []string{
+		"<string>" + launchdLabelPrefix + "a&amp;b</string>",
+		"\t\t<string>autostart</string>\n\t\t<string>-storage-path</string>\n\t\t<string>/Users/dev/.docker/machine</string>\n\t\t<string>a&amp;b</string>\n",
+		"<key>RunAtLoad</key>\n\t<true/>",
+		"<key>StandardErrorPath</key>\n\t<string>/Users/dev/.docker/machine/machines/a&amp;b/autostart.log</string>",
+	} {
+		if !strings.Contains(plist, want) {
+			t.Errorf("plist lacks %q:\n%s", want, plist)
+		}
+	}
+
+	// The plist must be well formed for launchd to load it
+	dec := xml.NewDecoder(strings.NewReader(plist))
+	for {
+		if _, err := dec.Token(); err != nil {
+			if err != io.EOF {
+				t.Errorf("plist is not well formed: %v", err)
+			}
+			break
+		}
+	}
+}
+
+func TestWriteLaunchdPlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plist := filepath.Join(dir, "LaunchAgents", "job.plist")
+	if err := writeLaunchdPlist(plist, []byte("plist")); err != nil {
+		t.Fatalf("writeLaunchdPlist() = %v", err)
+	}
+	if b, _ := ioutil.ReadFile(plist); string(b) != "plist" {
+		t.Errorf("plist = %q", b)
+	}
+
+	target := filepath.Join(dir, "target")
+	if err := ioutil.WriteFile(target, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "LaunchAgents", "link.plist")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeLaunchdPlist(link, []byte("plist")); err == nil {
+		t.Error("wrote through a symlink")
+	}
+	if b, _ := ioutil.ReadFile(target); string(b) != "keep" {
+		t.Errorf("symlink target = %q", b)
+	}
+}
@@ -0,0 +1,100 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// leaseWatcher wakes up IP discovery as soon as bootpd writes the dhcp
+// leases file, using kqueue. bootpd may write the file in place or replace
+// it, so both the file and its directory are watched.
+type leaseWatcher struct {
+	path string
+	kq   int
+	fds  []int
+}
+
+func newLeaseWatcher(path string) (*leaseWatcher, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, err
+	}
+	w := &leaseWatcher{path: path, kq: kq}
+	if err := w.watch(filepath.Dir(path)); err != nil {
+		w.Close()
+		return nil, err
+	}
+	// The file itself may not exist until the first lease is handed out
+	w.watch(path)
+	return w, nil
+}
+
+func (w *leaseWatcher) watch(path string) error {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_EVTONLY, 0)
+	if err != nil {
+		return err
+	}
+	var ev syscall.Kevent_t
+	syscall.SetKevent(&ev, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_CLEAR)
+	ev.Fflags = syscall.NOTE_WRITE | syscall.NOTE_EXTEND | syscall.NOTE_DELETE | syscall.NOTE_RENAME
+	if _, err := syscall.Kevent(w.kq, []syscall.Kevent_t{ev}, nil, nil); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	w.fds = append(w.fds, fd)
+	return nil
+}
+
+// Wait returns when the leases file changed or timeout passed, and reports
+// whether it changed
+func (w *leaseWatcher) Wait(timeout time.Duration) bool {
+	ts := syscall.NsecToTimespec(timeout.Nanoseconds())
+	events := make([]syscall.Kevent_t, 4)
+	n, err := syscall.Kevent(w.kq, nil, events, &ts)
+	if err != nil || n == 0 {
+		return false
+	}
+	for _, ev := range events[:n] {
+		if ev.Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME) != 0 || len(w.fds) == 1 {
+			// The file was replaced or created, watch the new one
+			w.rewatchFile()
+			return true
+		}
+	}
+	return true
+}
+
+func (w *leaseWatcher) rewatchFile() {
+	for _, fd := range w.fds[1:] {
+		syscall.Close(fd)
+	}
+	w.fds = w.fds[:1]
+	w.watch(w.path)
+}
+
+// Close releases the kqueue and watched files
+func (w *leaseWatcher) Close() {
+	for _, fd := range w.fds {
+		syscall.Close(fd)
+	}
+	syscall.Close(w.kq)
+}
@@ -0,0 +1,55 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaseWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	leases := filepath.Join(dir, "dhcpd_leases")
+
+	w, err := newLeaseWatcher(leases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// bootpd creates the file with the first lease, then rewrites it
+	for _, write := range []string{"{\n\tname=dev\n}\n", "{\n\tname=dev2\n}\n"} {
+		go func(data string) {
+			time.Sleep(100 * time.Millisecond)
+			ioutil.WriteFile(leases, []byte(data), 0644)
+		}(write)
+		start := time.Now()
+		w.Wait(10 * time.Second)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("Wait() returned after %v, not when the leases file changed", elapsed)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// +build !darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"time"
+)
+
+type leaseWatcher struct{}
+
+func newLeaseWatcher(path string) (*leaseWatcher, error) {
+	return nil, errors.New("watching the leases file is not supported on this platform")
+}
+
+// Wait returns after timeout
+func (w *leaseWatcher) Wait(timeout time.Duration) bool {
+	time.Sleep(timeout)
+	return false
+}
+
+// Close does nothing
+func (w *leaseWatcher) Close() {}
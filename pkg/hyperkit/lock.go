@@ -0,0 +1,102 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// lockFileName is locked with flock(2) while an operation changes the machine
+const lockFileName = "machine.lock"
+
+var (
+	// lockTimeout is how long an operation waits for another one to finish
+	lockTimeout      = time.Minute
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// lock takes the machine lock, so concurrent docker-machine invocations
+// don't both manipulate the hyperkit state and pid files. It is reentrant,
+// as operations call each other, like Create calling Start. The returned
+// func releases the lock.
+func (d *Driver) lock() (func(), error) {
+	if d.lockDepth > 0 {
+		d.lockDepth++
+		return d.unlock, nil
+	}
+
+	path := d.ResolveStorePath(lockFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("machine %s is locked by pid %s, try again once it is done", d.MachineName, lockHolder(path))
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	// Record the holder for the error other invocations report
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	log.Debugf("Locked %s", path)
+	d.lockFile = f
+	d.lockDepth = 1
+	return d.unlock, nil
+}
+
+func (d *Driver) unlock() {
+	d.lockDepth--
+	if d.lockDepth > 0 || d.lockFile == nil {
+		return
+	}
+	d.lockFile.Truncate(0)
+	// Closing the file releases the flock
+	d.lockFile.Close()
+	d.lockFile = nil
+}
+
+// lockHolder returns the pid recorded in the lock file at path
+func lockHolder(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil || len(strings.TrimSpace(string(b))) == 0 {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(b))
+}
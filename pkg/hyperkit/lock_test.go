@@ -0,0 +1,74 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestDriver_lock(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	if err := os.MkdirAll(filepath.Join(store, "machines", "dev"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer func(timeout time.Duration) { lockTimeout = timeout }(lockTimeout)
+	lockTimeout = 200 * time.Millisecond
+
+	newDriver := func() *Driver {
+		d := NewDriver("dev", store)
+		d.BaseDriver = &drivers.BaseDriver{MachineName: "dev", StorePath: store}
+		return d
+	}
+	first, second := newDriver(), newDriver()
+
+	unlock, err := first.lock()
+	if err != nil {
+		t.Fatalf("lock() error = %v", err)
+	}
+	// Reentrant for nested operations
+	nestedUnlock, err := first.lock()
+	if err != nil {
+		t.Fatalf("nested lock() error = %v", err)
+	}
+	nestedUnlock()
+
+	_, err = second.lock()
+	if err == nil || !strings.Contains(err.Error(), "locked by pid "+strconv.Itoa(os.Getpid())) {
+		t.Fatalf("lock() while held error = %v, want locked by pid %d", err, os.Getpid())
+	}
+
+	unlock()
+	unlock, err = second.lock()
+	if err != nil {
+		t.Fatalf("lock() after release error = %v", err)
+	}
+	unlock()
+}
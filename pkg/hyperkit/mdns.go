@@ -0,0 +1,144 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// mdnsService is the service type the machine is published under
+const mdnsService = "_docker._tcp"
+
+// mdnsPublisher keeps a dns-sd proxy registration of <machine>.local for the
+// machine's current IP address running. It is only announced on the vmnet
+// bridge, not to the networks the host is on.
+type mdnsPublisher struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	ip   string
+}
+
+// mdnsHostname is the name the machine is published as
+func (d *Driver) mdnsHostname() string {
+	return d.MachineName + ".local"
+}
+
+func mdnsArgs(iface, name, hostname, ip string) []string {
+	return []string{"-i", iface, "-P", name, mdnsService, "local", strconv.Itoa(dockerPort), hostname, ip}
+}
+
+// publish registers the machine at ip, replacing a registration for another
+// address or one whose dns-sd exited
+func (p *mdnsPublisher) publish(d *Driver, ip string) error {
+	if p.cmd != nil && p.ip == ip && !p.exited() {
+		return nil
+	}
+	p.stop()
+
+	iface, err := vmnetInterface(ip)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("/usr/bin/dns-sd", mdnsArgs(iface, d.MachineName, d.mdnsHostname(), ip)...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("dns-sd: %w", err)
+	}
+	log.Infof("Publishing %s at %s over mDNS on %s", d.mdnsHostname(), ip, iface)
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	p.cmd, p.done, p.ip = cmd, done, ip
+	return nil
+}
+
+// vmnetInterface returns the host interface on the network of ip, the vmnet
+// bridge the machine is attached to
+func vmnetInterface(ip string) (string, error) {
+	addr := net.ParseIP(ip)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && n.Contains(addr) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no host interface is on the network of %s", ip)
+}
+
+func (p *mdnsPublisher) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop withdraws the registration
+func (p *mdnsPublisher) stop() {
+	if p.cmd == nil {
+		return
+	}
+	if !p.exited() {
+		p.cmd.Process.Kill()
+		<-p.done
+	}
+	p.cmd = nil
+}
+
+// currentIP discovers the machine's IP address as it is now, as the lease
+// may have changed since it started
+func (d *Driver) currentIP() (string, error) {
+	b, err := d.backend()
+	if err != nil {
+		return "", err
+	}
+	mac, err := d.macAddress(b)
+	if err != nil {
+		return "", err
+	}
+	return d.discoverIP(mac)
+}
+
+// updateMDNS publishes the machine's current address
+func (d *Driver) updateMDNS(p *mdnsPublisher) {
+	ip, err := d.currentIP()
+	if err != nil {
+		log.Debugf("Not publishing %s: %v", d.mdnsHostname(), err)
+		return
+	}
+	if err := p.publish(d, ip); err != nil {
+		warnings.Warnf("Unable to publish %s: %v", d.mdnsHostname(), err)
+	}
+}
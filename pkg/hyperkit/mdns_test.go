@@ -0,0 +1,40 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMDNSArgs(t *testing.T) {
+	want := []string{"-i", "bridge100", "-P", "dev", "_docker._tcp", "local", "2376", "dev.local", "192.168.64.5"}
+	if got := mdnsArgs("bridge100", "dev", "dev.local", "192.168.64.5"); !reflect.DeepEqual(got, want) {
+		t.Errorf("mdnsArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestVMNetInterface(t *testing.T) {
+	if iface, err := vmnetInterface("127.0.0.1"); err != nil || iface == "" {
+		t.Errorf("vmnetInterface(127.0.0.1) = %q, %v, want the loopback interface", iface, err)
+	}
+	if iface, err := vmnetInterface("dev.local"); err == nil {
+		t.Errorf("vmnetInterface(dev.local) = %q, want an error", iface)
+	}
+}
@@ -0,0 +1,207 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// metricsFileName keeps the lifecycle counters of a machine. They are
+// recorded by whichever process starts, stops or supervises the machine, so
+// they live on disk rather than in the process serving them.
+const metricsFileName = "metrics.json"
+
+type machineMetrics struct {
+	Starts  int64 `json:"starts"`
+	Stops   int64 `json:"stops"`
+	Crashes int64 `json:"crashes"`
+	// IPAcquireSeconds is the sum of the time from boot to having an IP
+	// over IPAcquireCount starts
+	IPAcquireSeconds float64 `json:"ip_acquire_seconds"`
+	IPAcquireCount   int64   `json:"ip_acquire_count"`
+	NFSSetupSeconds  float64 `json:"nfs_setup_seconds"`
+	NFSSetupCount    int64   `json:"nfs_setup_count"`
+}
+
+func loadMachineMetrics(path string) (machineMetrics, error) {
+	var m machineMetrics
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	return m, json.Unmarshal(b, &m)
+}
+
+// updateMetrics applies update to the persisted counters of the machine.
+// Metrics are best effort and never fail the operation being counted.
+func (d *Driver) updateMetrics(update func(m *machineMetrics)) {
+	path := d.ResolveStorePath(metricsFileName)
+	m, err := loadMachineMetrics(path)
+	if err != nil {
+		log.Debugf("Resetting unreadable metrics: %v", err)
+		m = machineMetrics{}
+	}
+	update(&m)
+	b, err := json.Marshal(m)
+	if err == nil {
+		err = writeFileAtomic(path, b, 0644)
+	}
+	if err != nil {
+		log.Debugf("Unable to record metrics: %v", err)
+	}
+}
+
+func (d *Driver) observeIPAcquired(since time.Time) {
+	d.updateMetrics(func(m *machineMetrics) {
+		m.IPAcquireSeconds += time.Since(since).Seconds()
+		m.IPAcquireCount++
+	})
+}
+
+func (d *Driver) observeNFSSetup(since time.Time) {
+	d.updateMetrics(func(m *machineMetrics) {
+		m.NFSSetupSeconds += time.Since(since).Seconds()
+		m.NFSSetupCount++
+	})
+}
+
+// machineSample is what /metrics reports for one machine
+type machineSample struct {
+	name    string
+	up      bool
+	metrics machineMetrics
+	stats   Stats
+}
+
+// MetricsHandler serves the metrics of the machines in StorePaths in the
+// Prometheus text format
+type MetricsHandler struct {
+	StorePaths []string
+}
+
+func (h MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed on %s", r.Method, r.URL.Path))
+		return
+	}
+	refs, err := ListMachines(h.StorePaths)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var samples []machineSample
+	for _, ref := range refs {
+		d, err := LoadDriver(ref.StorePath, ref.Name)
+		if err != nil {
+			log.Debugf("Skipping metrics of %s: %v", ref.QualifiedName(), err)
+			continue
+		}
+		sample := machineSample{name: ref.QualifiedName()}
+		if sample.metrics, err = loadMachineMetrics(d.ResolveStorePath(metricsFileName)); err != nil {
+			log.Debugf("Unable to read metrics of %s: %v", sample.name, err)
+		}
+		if s, err := d.GetState(); err == nil && s == state.Running {
+			sample.up = true
+		}
+		if sample.stats, err = d.Stats(); err != nil {
+			log.Debugf("Unable to get stats of %s: %v", sample.name, err)
+		}
+		samples = append(samples, sample)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if err := writeMetrics(w, samples); err != nil {
+		log.Debugf("Unable to write metrics: %v", err)
+	}
+}
+
+type metricFamily struct {
+	name, kind, help string
+	value            func(s machineSample) float64
+}
+
+var metricFamilies = []metricFamily{
+	{"hyperkit_machine_up", "gauge", "Whether the hyperkit process of the machine is running.", func(s machineSample) float64 {
+		if s.up {
+			return 1
+		}
+		return 0
+	}},
+	{"hyperkit_machine_starts_total", "counter", "Successful starts of the machine.", func(s machineSample) float64 { return float64(s.metrics.Starts) }},
+	{"hyperkit_machine_stops_total", "counter", "Stops and kills of the machine.", func(s machineSample) float64 { return float64(s.metrics.Stops) }},
+	{"hyperkit_machine_crashes_total", "counter", "Times the supervisor found the machine dead without a stop.", func(s machineSample) float64 { return float64(s.metrics.Crashes) }},
+	{"hyperkit_machine_cpu_percent", "gauge", "CPU use of the hyperkit process, as a percentage of one core.", func(s machineSample) float64 { return s.stats.CPUPercent }},
+	{"hyperkit_machine_memory_rss_bytes", "gauge", "Resident memory of the hyperkit process.", func(s machineSample) float64 { return float64(s.stats.RSSBytes) }},
+	{"hyperkit_machine_uptime_seconds", "gauge", "Time since the hyperkit process started.", func(s machineSample) float64 { return s.stats.Uptime.Seconds() }},
+	{"hyperkit_machine_disk_apparent_bytes", "gauge", "Size of the disk image as the guest sees it.", func(s machineSample) float64 { return float64(s.stats.DiskApparentBytes) }},
+	{"hyperkit_machine_disk_actual_bytes", "gauge", "Host space taken by the sparse disk image.", func(s machineSample) float64 { return float64(s.stats.DiskActualBytes) }},
+}
+
+type metricSummary struct {
+	name, help string
+	value      func(s machineSample) (sum float64, count int64)
+}
+
+var metricSummaries = []metricSummary{
+	{"hyperkit_machine_ip_acquisition_seconds", "Time from booting the machine to it having an IP address.", func(s machineSample) (float64, int64) {
+		return s.metrics.IPAcquireSeconds, s.metrics.IPAcquireCount
+	}},
+	{"hyperkit_machine_nfs_setup_seconds", "Time taken to export and mount the NFS shares.", func(s machineSample) (float64, int64) {
+		return s.metrics.NFSSetupSeconds, s.metrics.NFSSetupCount
+	}},
+}
+
+func writeMetrics(w io.Writer, samples []machineSample) error {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].name < samples[j].name })
+	var b strings.Builder
+	for _, f := range metricFamilies {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, s := range samples {
+			fmt.Fprintf(&b, "%s{machine=%s} %g\n", f.name, metricLabel(s.name), f.value(s))
+		}
+	}
+	for _, f := range metricSummaries {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s summary\n", f.name, f.help, f.name)
+		for _, s := range samples {
+			sum, count := f.value(s)
+			fmt.Fprintf(&b, "%s_sum{machine=%s} %g\n", f.name, metricLabel(s.name), sum)
+			fmt.Fprintf(&b, "%s_count{machine=%s} %d\n", f.name, metricLabel(s.name), count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// metricLabel quotes a label value the way the Prometheus text format wants
+func metricLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
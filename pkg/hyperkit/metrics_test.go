@@ -0,0 +1,81 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestUpdateMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir}}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d.updateMetrics(func(m *machineMetrics) { m.Starts++ })
+	d.updateMetrics(func(m *machineMetrics) { m.Starts++ })
+	d.observeIPAcquired(time.Now().Add(-2 * time.Second))
+	m, err := loadMachineMetrics(d.ResolveStorePath(metricsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Starts != 2 || m.IPAcquireCount != 1 || m.IPAcquireSeconds < 2 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	samples := []machineSample{
+		{name: "web", up: true, metrics: machineMetrics{Starts: 3, NFSSetupSeconds: 1.5, NFSSetupCount: 2}, stats: Stats{RSSBytes: 1 << 30}},
+		{name: `db@/tmp/"store"`, metrics: machineMetrics{Crashes: 1}},
+	}
+	var b strings.Builder
+	if err := writeMetrics(&b, samples); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE hyperkit_machine_starts_total counter\n",
+		`hyperkit_machine_up{machine="web"} 1` + "\n",
+		`hyperkit_machine_starts_total{machine="web"} 3` + "\n",
+		`hyperkit_machine_crashes_total{machine="db@/tmp/\"store\""} 1` + "\n",
+		`hyperkit_machine_memory_rss_bytes{machine="web"} 1.073741824e+09` + "\n",
+		"# TYPE hyperkit_machine_nfs_setup_seconds summary\n",
+		`hyperkit_machine_nfs_setup_seconds_sum{machine="web"} 1.5` + "\n",
+		`hyperkit_machine_nfs_setup_seconds_count{machine="web"} 2` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics don't contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, `machine="db`) > strings.Index(out, `machine="web"`) {
+		t.Errorf("machines not sorted:\n%s", out)
+	}
+}
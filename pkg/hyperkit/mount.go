@@ -0,0 +1,235 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/johanneswuerbach/nfsexports"
+)
+
+const (
+	// shareMountAttempts is how often mounting a share is tried
+	shareMountAttempts = 3
+	// shareMountedMarker is printed by the mount command once the share
+	// is mounted
+	shareMountedMarker = "mounted"
+	shareMountHint     = "Check that the machine can reach the host address it mounts the shares from, and that nothing blocks nfsd or the file server"
+)
+
+// shareMountBackoff is the wait before the second attempt to mount a share,
+// it doubles for every further attempt
+var shareMountBackoff = 2 * time.Second
+
+// ShareStatus is the outcome of mounting a single share in the machine
+type ShareStatus struct {
+	Share      string `json:"share"`
+	MountPoint string `json:"mount_point"`
+	Mounted    bool   `json:"mounted"`
+	Attempts   int    `json:"attempts"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ShareMountError reports the shares of a mount that failed, along with
+// those that succeeded
+type ShareMountError struct {
+	Shares []ShareStatus
+}
+
+func (e *ShareMountError) Error() string {
+	var failed []string
+	for _, s := range e.Shares {
+		if !s.Mounted {
+			failed = append(failed, fmt.Sprintf("%s at %s: %s", s.Share, s.MountPoint, s.Error))
+		}
+	}
+	return "mounting shares failed: " + strings.Join(failed, "; ")
+}
+
+// Mount shares a host path with the running machine and adds it to the
+// machine's shares, so it is mounted again on the next start. share has
+// the same host-path[:guest-subpath] format as --hyperkit-nfs-shares, and is
+// resolved the same way.
+func (d *Driver) Mount(share string) error {
+	if err := d.verifyRootPermissions(); err != nil {
+		return err
+	}
+	share, err := normalizeNFSShare(share)
+	if err != nil {
+		return err
+	}
+	host := d.nfsSharePath(share)
+	for _, s := range d.NFSShares {
+		if other := d.nfsSharePath(s); other == host || isSubPath(other, host) || isSubPath(host, other) {
+			return fmt.Errorf("%s is already shared by %s", host, s)
+		}
+	}
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if s != state.Running || d.IPAddress == "" {
+		return fmt.Errorf("machine %s must be running to mount %s", d.MachineName, share)
+	}
+
+	started := time.Now()
+	if err := d.setupNFSShares([]string{share}); err != nil {
+		return err
+	}
+	d.NFSShares = append(d.NFSShares, share)
+	d.emit(eventNFSMounted, share)
+	d.observeNFSSetup(started)
+	return nil
+}
+
+// Unmount stops sharing a host path with the machine and removes it from
+// the machine's shares. share is matched against them as given or by its
+// host path, so it can take any format Mount takes. A running machine
+// unmounts the share first, which fails while it is busy.
+func (d *Driver) Unmount(share string) error {
+	if err := d.verifyRootPermissions(); err != nil {
+		return err
+	}
+	i := findShare(d.NFSShares, share, d.nfsSharePath)
+	if i < 0 {
+		// The host path may have to be resolved first, like ~/src
+		normalized, err := normalizeNFSShare(share)
+		if err != nil {
+			return err
+		}
+		if i = findShare(d.NFSShares, normalized, d.nfsSharePath); i < 0 {
+			return fmt.Errorf("%s is not shared with machine %s", share, d.MachineName)
+		}
+	}
+	share = d.NFSShares[i]
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	// Stop takes care of the exports of stopped machines
+	if s == state.Running {
+		mountPoint := path.Join(d.NFSSharesRoot, parseNFSShare(share).subPath())
+		cmd := fmt.Sprintf("if mountpoint -q %s; then sudo umount %s; fi", shellQuote(mountPoint), shellQuote(mountPoint))
+		if _, err := drivers.RunSSHCommandFromDriver(d, cmd); err != nil {
+			return fmt.Errorf("unmounting %s in machine %s: %w", mountPoint, d.MachineName, err)
+		}
+		if err := d.unshare(d.nfsSharePath(share)); err != nil {
+			return err
+		}
+	}
+	d.NFSShares = append(d.NFSShares[:i:i], d.NFSShares[i+1:]...)
+	d.emit(eventUnmounted, share)
+	return nil
+}
+
+// findShare returns the index of share in shares, or -1. Shares match if
+// they are the same or share the host path returned by sharePath.
+func findShare(shares []string, share string, sharePath func(string) string) int {
+	for i, s := range shares {
+		if s == share || sharePath(s) == sharePath(share) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unshare stops serving the host path of a share to the machine. Exports the
+// share was mounted through, rather than exported with, are left alone.
+func (d *Driver) unshare(host string) error {
+	if d.sftpShares() {
+		return d.removeFileServerRoot(host)
+	}
+	if exists, err := nfsexports.Exists("", d.nfsExportIdentifier(host)); err != nil || !exists {
+		return err
+	}
+	if err := d.removeNFSExport(host); err != nil {
+		return fmt.Errorf("removing the NFS export of %s: %w", host, err)
+	}
+	return d.reloadNFSDaemon()
+}
+
+// mountShares mounts the shares from hostIP in the guest one at a time, and
+// checks each is mounted. It returns the status of every share, and an error
+// wrapping a ShareMountError if any of them failed.
+func (d *Driver) mountShares(hostIP net.IP, shares []string) ([]ShareStatus, error) {
+	run := func(command string) (string, error) {
+		return drivers.RunSSHCommandFromDriver(d, command)
+	}
+	var statuses []ShareStatus
+	failed := false
+	for _, share := range shares {
+		s := parseNFSShare(share)
+		mountPoint := path.Join(d.NFSSharesRoot, s.subPath())
+		commands := d.nfsMountCommands(hostIP, d.nfsSharePath(share), s.subPath(), d.nfsMountFlags(s))
+		status := mountShare(run, share, mountPoint, commands, shareMountBackoff)
+		if status.Mounted {
+			log.Infof("Mounted %s at %s", share, mountPoint)
+		} else {
+			log.Errorf("Mounting %s at %s failed: %s", share, mountPoint, status.Error)
+			failed = true
+		}
+		statuses = append(statuses, status)
+	}
+	if failed {
+		return statuses, newError(ErrShareMount, shareMountHint, &ShareMountError{Shares: statuses})
+	}
+	return statuses, nil
+}
+
+// mountShare runs the guest commands mounting share at mountPoint through
+// run, unless it is mounted already, until mountpoint confirms it is. It
+// retries up to shareMountAttempts times, waiting backoff, then twice as
+// long, and so on, in between.
+func mountShare(run func(string) (string, error), share, mountPoint, commands string, backoff time.Duration) ShareStatus {
+	status := ShareStatus{Share: share, MountPoint: mountPoint}
+	// Only the errors of the mount commands make it to the output, and the
+	// command succeeds either way, so they aren't lost in an SSH error
+	command := fmt.Sprintf("mountpoint -q %s || echo -e \"%s\" | sh 2>&1 >/dev/null; if mountpoint -q %s; then echo %s; fi",
+		shellQuote(mountPoint), commands, shellQuote(mountPoint), shareMountedMarker)
+	for status.Attempts < shareMountAttempts {
+		if status.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		status.Attempts++
+		out, err := run(command)
+		out = strings.TrimSpace(out)
+		switch {
+		case err != nil:
+			status.Error = err.Error()
+		case strings.HasSuffix(out, shareMountedMarker):
+			status.Mounted = true
+			status.Error = ""
+			return status
+		case out == "":
+			status.Error = "not mounted"
+		default:
+			status.Error = out
+		}
+		log.Debugf("Attempt %d to mount %s at %s failed: %s", status.Attempts, share, mountPoint, status.Error)
+	}
+	return status
+}
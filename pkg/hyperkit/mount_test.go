@@ -0,0 +1,101 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestMountShare(t *testing.T) {
+	tests := []struct {
+		name         string
+		outputs      []string
+		wantMounted  bool
+		wantAttempts int
+		wantErr      string
+	}{
+		{"mounted", []string{"mounted"}, true, 1, ""},
+		{"transient failure", []string{"mount: mounting 192.168.64.1:/Users on /nfsshares/Users failed: Connection refused", "mounted"}, true, 2, ""},
+		{"failure", []string{"permission denied", "permission denied", "permission denied"}, false, 3, "permission denied"},
+		{"silent failure", []string{"", "", ""}, false, 3, "not mounted"},
+	}
+	for _, tt := range tests {
+		var commands []string
+		run := func(command string) (string, error) {
+			commands = append(commands, command)
+			return tt.outputs[len(commands)-1] + "\n", nil
+		}
+		got := mountShare(run, "/Users", "/nfsshares/Users", "sudo mount\\n", 0)
+		if got.Mounted != tt.wantMounted || got.Attempts != tt.wantAttempts || got.Error != tt.wantErr {
+			t.Errorf("%s: mountShare() = %+v, want mounted %v after %d attempts with error %q", tt.name, got, tt.wantMounted, tt.wantAttempts, tt.wantErr)
+		}
+		if want := "mountpoint -q '/nfsshares/Users' || echo -e \"sudo mount\\n\" | sh"; !strings.HasPrefix(commands[0], want) {
+			t.Errorf("%s: command %q doesn't start with %q", tt.name, commands[0], want)
+		}
+	}
+
+	run := func(string) (string, error) { return "", errors.New("ssh: connection refused") }
+	if got := mountShare(run, "/Users", "/nfsshares/Users", "", 0); got.Mounted || got.Error != "ssh: connection refused" {
+		t.Errorf("mountShare() with SSH failing = %+v", got)
+	}
+}
+
+func TestShareMountError(t *testing.T) {
+	err := error(newError(ErrShareMount, shareMountHint, &ShareMountError{Shares: []ShareStatus{
+		{Share: "/Users", MountPoint: "/nfsshares/Users", Mounted: true, Attempts: 1},
+		{Share: "/Volumes/data:data", MountPoint: "/nfsshares/data", Attempts: 3, Error: "permission denied"},
+	}}))
+	if ErrorCodeOf(err) != ErrShareMount {
+		t.Errorf("ErrorCodeOf() = %s, want %s", ErrorCodeOf(err), ErrShareMount)
+	}
+	var mountErr *ShareMountError
+	if !errors.As(err, &mountErr) || len(mountErr.Shares) != 2 {
+		t.Fatalf("%v doesn't wrap the share statuses", err)
+	}
+	want := "mounting shares failed: /Volumes/data:data at /nfsshares/data: permission denied"
+	if got := mountErr.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestFindShare(t *testing.T) {
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "default", StorePath: "/store"}}
+	shares := []string{"/Users/me/src:src", "data", "/Volumes/db::flags=vers=3"}
+	tests := []struct {
+		share string
+		want  int
+	}{
+		{"/Users/me/src:src", 0},
+		{"/Users/me/src", 0},
+		{"data", 1},
+		{"/store/machines/default/data", 1},
+		{"/Volumes/db:db", 2},
+		{"/Users/me", -1},
+		{"/Users/me/src/app", -1},
+	}
+	for _, tt := range tests {
+		if got := findShare(shares, tt.share, d.nfsSharePath); got != tt.want {
+			t.Errorf("findShare(%q) = %d, want %d", tt.share, got, tt.want)
+		}
+	}
+}
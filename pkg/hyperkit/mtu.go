@@ -0,0 +1,57 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// MTU bounds for --hyperkit-mtu, from the IPv4 minimum to jumbo frames
+const (
+	minMTU = 576
+	maxMTU = 9000
+)
+
+func validateMTU(mtu int) error {
+	if mtu != 0 && (mtu < minMTU || mtu > maxMTU) {
+		return fmt.Errorf("invalid MTU %d, must be between %d and %d", mtu, minMTU, maxMTU)
+	}
+	return nil
+}
+
+// mtuCommand sets the MTU of the guest interface holding ip
+func mtuCommand(ip string, mtu int) string {
+	return fmt.Sprintf(`iface=$(ip -o -4 addr show | awk '$4 ~ /^%s\// {print $2}') && [ -n "$iface" ] && sudo ip link set dev "$iface" mtu %d`, ip, mtu)
+}
+
+// applyMTU sets the configured MTU inside the guest. It doesn't survive a
+// guest reboot, so it is applied on every start.
+func (d *Driver) applyMTU() error {
+	if d.MTU == 0 {
+		return nil
+	}
+	log.Debugf("Setting guest MTU to %d", d.MTU)
+	if _, err := drivers.RunSSHCommandFromDriver(d, mtuCommand(d.IPAddress, d.MTU)); err != nil {
+		return fmt.Errorf("setting guest MTU to %d: %w", d.MTU, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateMTU(t *testing.T) {
+	for mtu, wantErr := range map[int]bool{0: false, 576: false, 1400: false, 9000: false, 575: true, 9001: true, -1: true} {
+		if err := validateMTU(mtu); (err != nil) != wantErr {
+			t.Errorf("validateMTU(%d) error = %v, wantErr %v", mtu, err, wantErr)
+		}
+	}
+}
+
+func TestMtuCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Stand-ins for the guest's ip and sudo
+	out := filepath.Join(dir, "out")
+	scripts := map[string]string{
+		"ip": `#!/bin/sh
+if [ "$1" = "-o" ]; then
+	echo "1: lo    inet 127.0.0.1/8 scope host lo"
+	echo "2: eth0    inet 192.168.64.5/24 brd 192.168.64.255 scope global eth0"
+	echo "3: docker0    inet 172.17.0.1/16 scope global docker0"
+	exit 0
+fi
+echo "$@" >> ` + out + `
+`,
+		"sudo": "#!/bin/sh\nexec \"$@\"\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.64.5", "link set dev eth0 mtu 1400", false},
+		{"192.168.64.50", "", true},
+	}
+	for _, tt := range tests {
+		os.Remove(out)
+		cmd := exec.Command("/bin/sh", "-c", mtuCommand(tt.ip, 1400))
+		cmd.Env = append(os.Environ(), "PATH="+dir+":/usr/bin:/bin")
+		err := cmd.Run()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("mtuCommand(%q) error = %v, wantErr %v", tt.ip, err, tt.wantErr)
+		}
+		got, _ := ioutil.ReadFile(out)
+		if strings.TrimSpace(string(got)) != tt.want {
+			t.Errorf("mtuCommand(%q) ran ip %q, want %q", tt.ip, strings.TrimSpace(string(got)), tt.want)
+		}
+	}
+}
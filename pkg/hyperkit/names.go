@@ -0,0 +1,89 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// maxMachineNameLength keeps the name usable as a hostname label
+const maxMachineNameLength = 63
+
+var machineNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// validateMachineName rejects names that would break the store path, the NFS
+// export identifiers or the guest hostname derived from them
+func validateMachineName(name string) error {
+	if len(name) > maxMachineNameLength {
+		return fmt.Errorf("machine name %q is longer than %d characters, which hostnames can't be", name, maxMachineNameLength)
+	}
+	if !machineNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid machine name %q, use letters, digits, '.', '_' and '-', starting with a letter or digit, as the name ends up in paths, NFS exports and the hostname", name)
+	}
+	return nil
+}
+
+// identityCollisions returns the other machines of the store that run with
+// the same UUID. Both backends derive the MAC address from the UUID, so
+// these machines also share their MAC address, dhcp lease and IP address.
+func (d *Driver) identityCollisions() ([]*Driver, error) {
+	refs, err := ListMachines([]string{d.StorePath})
+	if err != nil {
+		return nil, err
+	}
+	var collisions []*Driver
+	for _, ref := range refs {
+		if ref.Name == d.MachineName {
+			continue
+		}
+		other, err := LoadDriver(ref.StorePath, ref.Name)
+		if err != nil {
+			continue
+		}
+		if other.machineUUID() == d.machineUUID() {
+			collisions = append(collisions, other)
+		}
+	}
+	return collisions, nil
+}
+
+// checkIdentityCollisions fails if another machine of the store has the UUID
+// of this one. Before boot only a running one is an error, as the two can
+// still take turns.
+func (d *Driver) checkIdentityCollisions(booting bool) error {
+	collisions, err := d.identityCollisions()
+	if err != nil {
+		return err
+	}
+	for _, other := range collisions {
+		msg := fmt.Sprintf("machine %s has the same UUID %s, and so MAC and IP address, as %s", d.MachineName, d.machineUUID(), other.MachineName)
+		if !booting {
+			return fmt.Errorf("%s, use another name", msg)
+		}
+		if s, err := other.GetState(); err == nil && s == state.Running {
+			return fmt.Errorf("%s, which is running. Stop it, or clone one of them to get a machine with its own UUID", msg)
+		}
+		log.Warnf("%s, only one of them can run at a time", msg)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestValidateMachineName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"default", false},
+		{"dev-2.local_ci", false},
+		{"", true},
+		{"my machine", true},
+		{"team/dev", true},
+		{"-dev", true},
+		{".dev", true},
+		{"dev@store", true},
+		{strings.Repeat("a", 63), false},
+		{strings.Repeat("a", 64), true},
+	}
+	for _, tt := range tests {
+		if err := validateMachineName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("validateMachineName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestIdentityCollisions(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	writeMachine(t, store, "web", "hyperkit")
+	writeMachine(t, store, "db", "hyperkit")
+	web := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "web", StorePath: store}}
+
+	// A copy of web's store directory keeps running with web's UUID
+	dir := filepath.Join(store, "machines", "copy")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"DriverName": "hyperkit", "Driver": {"MachineName": "copy", "UUID": "` + web.machineUUID() + `"}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, hostConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	collisions, err := web.identityCollisions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(collisions) != 1 || collisions[0].MachineName != "copy" {
+		t.Errorf("identityCollisions() = %v, want copy", collisions)
+	}
+	if err := web.checkIdentityCollisions(false); err == nil {
+		t.Error("creating a machine with a colliding UUID accepted")
+	}
+
+	db := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "db", StorePath: store}}
+	if collisions, err := db.identityCollisions(); err != nil || len(collisions) != 0 {
+		t.Errorf("identityCollisions() of db = %v, %v, want none", collisions, err)
+	}
+}
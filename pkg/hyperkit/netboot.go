@@ -0,0 +1,126 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+// netbootCacheDir is where downloaded kernels and initrds are cached,
+// relative to the store's cache
+const netbootCacheDir = "hyperkit-netboot"
+
+// netboot reports whether the machine boots a remote kernel and initrd
+// directly instead of an ISO
+func (d *Driver) netboot() bool {
+	return d.KernelURL != ""
+}
+
+// fetchNetbootFiles downloads the kernel and initrd through the store cache
+// into the machine dir.
+func (d *Driver) fetchNetbootFiles(ctx context.Context) error {
+	if d.InitrdURL == "" {
+		return fmt.Errorf("--hyperkit-kernel-url requires --hyperkit-initrd-url")
+	}
+
+	kernel, err := d.fetchCached(ctx, d.KernelURL, d.KernelChecksum)
+	if err != nil {
+		return fmt.Errorf("fetching kernel: %w", err)
+	}
+	initrd, err := d.fetchCached(ctx, d.InitrdURL, d.InitrdChecksum)
+	if err != nil {
+		return fmt.Errorf("fetching initrd: %w", err)
+	}
+
+	d.BootKernel = d.ResolveStorePath(path.Base(d.KernelURL))
+	d.BootInitrd = d.ResolveStorePath(path.Base(d.InitrdURL))
+	if err := mcnutils.CopyFile(kernel, d.BootKernel); err != nil {
+		return err
+	}
+	return mcnutils.CopyFile(initrd, d.BootInitrd)
+}
+
+// fetchCached returns the path of url in the store cache, downloading it
+// first if it isn't cached yet. If checksum is set, it is the expected
+// hex encoded sha256 of the file.
+func (d *Driver) fetchCached(ctx context.Context, url, checksum string) (string, error) {
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	key := checksum
+	if key == "" {
+		sum := sha256.Sum256([]byte(url))
+		key = hex.EncodeToString(sum[:])
+	}
+	dir := filepath.Join(d.StorePath, "cache", netbootCacheDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	cached := filepath.Join(dir, key+"-"+path.Base(url))
+	if _, err := os.Stat(cached); err == nil {
+		log.Debugf("Using cached %s for %s", cached, url)
+		return cached, nil
+	}
+
+	log.Infof("Downloading %s...", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	pw := d.newProgressWriter(progressDownload, path.Base(url), resp.ContentLength)
+	if _, err := io.Copy(io.MultiWriter(tmp, h, pw), resp.Body); err != nil {
+		return "", fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	pw.Done()
+	if got := hex.EncodeToString(h.Sum(nil)); checksum != "" && got != checksum {
+		return "", fmt.Errorf("checksum mismatch for %s: got sha256 %s, want %s", url, got, checksum)
+	}
+	return cached, os.Rename(tmp.Name(), cached)
+}
@@ -20,8 +20,10 @@ package hyperkit
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
@@ -38,6 +40,8 @@ const (
 	VMNetDomain = "/Library/Preferences/SystemConfiguration/com.apple.vmnet"
 	// SharedNetAddrKey is the key for the network address
 	SharedNetAddrKey = "Shared_Net_Address"
+	// SharedNetMaskKey is the key for the network mask
+	SharedNetMaskKey = "Shared_Net_Mask"
 )
 
 var (
@@ -61,8 +65,11 @@ func GetIPAddressByMACAddress(mac string) (string, error) {
 func getIPAddressFromFile(mac, path string) (string, error) {
 	log.Debugf("Searching for %s in %s ...", mac, path)
 	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("dhcp leases file %s does not exist, either no lease was handed out yet or it moved, see --hyperkit-leases-path", path)
+	}
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("reading dhcp leases file %s: %w", path, err)
 	}
 	defer file.Close()
 
@@ -122,6 +129,56 @@ func parseDHCPdLeasesFile(file io.Reader) ([]DHCPEntry, error) {
 	return dhcpEntries, scanner.Err()
 }
 
+// removeLeases removes the leases of mac from the dhcp leases file at path,
+// and returns how many it removed
+func removeLeases(path, mac string) (int, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		kept    bytes.Buffer
+		entry   []string
+		removed int
+	)
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "{":
+			entry = []string{line}
+		case entry == nil:
+			kept.WriteString(line)
+		case trimmed == "}":
+			entry = append(entry, line)
+			if leaseEntryMAC(entry) == mac {
+				removed++
+			} else {
+				kept.WriteString(strings.Join(entry, ""))
+			}
+			entry = nil
+		default:
+			entry = append(entry, line)
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, writeFileAtomic(path, kept.Bytes(), 0644)
+}
+
+func leaseEntryMAC(entry []string) string {
+	const prefix = "hw_address=1,"
+	for _, line := range entry {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, prefix) {
+			return line[len(prefix):]
+		}
+	}
+	return ""
+}
+
 // trimMacAddress trimming "0" of the ten's digit
 func trimMacAddress(rawUUID string) string {
 	return leadingZeroRegexp.ReplaceAllString(rawUUID, "$1")
@@ -143,3 +200,69 @@ func GetNetAddr() (net.IP, error) {
 	}
 	return ip, nil
 }
+
+// validateNFSHost checks the --hyperkit-nfs-host-ip and
+// --hyperkit-nfs-interface settings, of which at most one may be set
+func validateNFSHost(hostIP, iface string) error {
+	if hostIP != "" && iface != "" {
+		return fmt.Errorf("set either the NFS host IP or the NFS interface, not both")
+	}
+	if hostIP != "" && net.ParseIP(hostIP) == nil {
+		return fmt.Errorf("invalid NFS host IP %q", hostIP)
+	}
+	return nil
+}
+
+// nfsHostIP returns the host address the machine mounts its shares from:
+// the pinned address, the address of the pinned interface, or else the
+// vmnet address
+func (d *Driver) nfsHostIP() (net.IP, error) {
+	switch {
+	case d.NFSHostIP != "":
+		ip := net.ParseIP(d.NFSHostIP)
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return nil, err
+		}
+		if !hasAddr(addrs, ip) {
+			return nil, fmt.Errorf("NFS host IP %s is not an address of this host", ip)
+		}
+		return ip, nil
+	case d.NFSInterface != "":
+		iface, err := net.InterfaceByName(d.NFSInterface)
+		if err != nil {
+			return nil, fmt.Errorf("NFS interface %s: %w", d.NFSInterface, err)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		ip := firstIPv4(addrs)
+		if ip == nil {
+			return nil, fmt.Errorf("NFS interface %s has no IPv4 address", d.NFSInterface)
+		}
+		return ip, nil
+	}
+	return GetNetAddr()
+}
+
+// hasAddr reports whether ip is one of the interface addresses addrs
+func hasAddr(addrs []net.Addr, ip net.IP) bool {
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// firstIPv4 returns the first IPv4 address among the interface addresses
+// addrs, or nil
+func firstIPv4(addrs []net.Addr) net.IP {
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.To4()
+		}
+	}
+	return nil
+}
@@ -20,6 +20,7 @@ package hyperkit
 
 import (
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"testing"
@@ -106,3 +107,75 @@ func Test_getIpAddressFromFile(t *testing.T) {
 		})
 	}
 }
+
+func Test_removeLeases(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	dhcpFile := filepath.Join(tmpdir, "dhcp")
+	if err := ioutil.WriteFile(dhcpFile, validLeases, 0644); err != nil {
+		t.Fatalf("writefile: %v", err)
+	}
+
+	removed, err := removeLeases(dhcpFile, "a4:b5:c6:d7:e8:f9")
+	if err != nil {
+		t.Fatalf("removeLeases() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("removeLeases() = %d, want 1", removed)
+	}
+	if _, err := getIPAddressFromFile("a4:b5:c6:d7:e8:f9", dhcpFile); err == nil {
+		t.Error("lease still present after removeLeases()")
+	}
+	for _, mac := range []string{"a1:b2:c3:d4:e5:f6", "a5:b6:c7:d8:e9:f1"} {
+		if _, err := getIPAddressFromFile(mac, dhcpFile); err != nil {
+			t.Errorf("lease of %s removed: %v", mac, err)
+		}
+	}
+
+	if removed, err := removeLeases(filepath.Join(tmpdir, "missing"), "a1:b2:c3:d4:e5:f6"); err != nil || removed != 0 {
+		t.Errorf("removeLeases() on missing file = %d, %v, want 0, nil", removed, err)
+	}
+}
+
+func TestValidateNFSHost(t *testing.T) {
+	tests := []struct {
+		hostIP, iface string
+		wantErr       bool
+	}{
+		{"", "", false},
+		{"192.168.64.1", "", false},
+		{"", "bridge100", false},
+		{"192.168.64.1", "bridge100", true},
+		{"bridge100", "", true},
+	}
+	for _, tt := range tests {
+		if err := validateNFSHost(tt.hostIP, tt.iface); (err != nil) != tt.wantErr {
+			t.Errorf("validateNFSHost(%q, %q) error = %v, wantErr %v", tt.hostIP, tt.iface, err, tt.wantErr)
+		}
+	}
+}
+
+func TestInterfaceAddrs(t *testing.T) {
+	var addrs []net.Addr
+	for _, cidr := range []string{"fe80::1/64", "192.168.64.1/24", "10.8.0.2/24"} {
+		ip, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ipNet.IP = ip
+		addrs = append(addrs, ipNet)
+	}
+	if got := firstIPv4(addrs); !got.Equal(net.ParseIP("192.168.64.1")) {
+		t.Errorf("firstIPv4() = %s, want 192.168.64.1", got)
+	}
+	if got := firstIPv4(addrs[:1]); got != nil {
+		t.Errorf("firstIPv4() of an IPv6 address = %s, want nil", got)
+	}
+	if !hasAddr(addrs, net.ParseIP("10.8.0.2")) || hasAddr(addrs, net.ParseIP("10.8.0.1")) {
+		t.Error("hasAddr() doesn't match the interface addresses exactly")
+	}
+}
@@ -0,0 +1,192 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// PlanDisk is a disk image the machine would be started with
+type PlanDisk struct {
+	Path   string `json:"path"`
+	SizeMB int    `json:"size_mb"`
+	Exists bool   `json:"exists"`
+}
+
+// Plan describes what creating or starting a machine would do
+type Plan struct {
+	Backend string     `json:"backend"`
+	Boot    string     `json:"boot"`
+	Cmdline string     `json:"cmdline"`
+	CPUs    int        `json:"cpus"`
+	Memory  int        `json:"memory"`
+	Disks   []PlanDisk `json:"disks"`
+	ISOs    []string   `json:"isos,omitempty"`
+	Network string     `json:"network"`
+	MAC     string     `json:"mac"`
+	VSock   []int      `json:"vsock_ports,omitempty"`
+	// NFSExports are the /etc/exports entries that would be added
+	NFSExports []string `json:"nfs_exports,omitempty"`
+	// CommandLine is the VM command line, for the backends that render it
+	// themselves
+	CommandLine []string `json:"command_line,omitempty"`
+}
+
+func (p Plan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "backend: %s\n", p.Backend)
+	fmt.Fprintf(&b, "boot:    %s\n", p.Boot)
+	fmt.Fprintf(&b, "cmdline: %s\n", p.Cmdline)
+	fmt.Fprintf(&b, "cpus:    %d\n", p.CPUs)
+	fmt.Fprintf(&b, "memory:  %d MB\n", p.Memory)
+	for _, disk := range p.Disks {
+		state := "to be created"
+		if disk.Exists {
+			state = "existing"
+		}
+		fmt.Fprintf(&b, "disk:    %s (%d MB, %s)\n", disk.Path, disk.SizeMB, state)
+	}
+	for _, iso := range p.ISOs {
+		fmt.Fprintf(&b, "iso:     %s\n", iso)
+	}
+	fmt.Fprintf(&b, "network: %s, MAC %s\n", p.Network, p.MAC)
+	if len(p.VSock) > 0 {
+		fmt.Fprintf(&b, "vsock:   %v\n", p.VSock)
+	}
+	for _, export := range p.NFSExports {
+		fmt.Fprintf(&b, "export:  %s\n", export)
+	}
+	if len(p.CommandLine) > 0 {
+		fmt.Fprintf(&b, "command: %s\n", strings.Join(shellQuoteAll(p.CommandLine), " "))
+	}
+	return b.String()
+}
+
+// Plan validates the machine config and works out what starting the
+// machine, or creating it if it doesn't exist yet, would do. It needs no
+// root permissions and changes nothing.
+func (d *Driver) Plan() (*Plan, error) {
+	if err := d.validateConfig(); err != nil {
+		return nil, err
+	}
+	b, err := d.backend()
+	if err != nil {
+		return nil, err
+	}
+	boot, err := d.planBoot()
+	if err != nil {
+		return nil, err
+	}
+	p := &Plan{
+		Backend: b.name(),
+		Boot:    boot,
+		Cmdline: d.kernelCmdline(),
+		CPUs:    d.CPU,
+		Memory:  d.Memory,
+		ISOs:    d.isoImages(),
+		Network: "vmnet shared",
+	}
+	if d.VpnKitSock != "" {
+		p.Network = "VPNKit " + d.VpnKitSock
+	}
+
+	disks := []PlanDisk{{Path: pkgdrivers.GetDiskPath(d.BaseDriver), SizeMB: d.DiskSize}}
+	for _, disk := range d.extraDisks() {
+		disks = append(disks, PlanDisk{Path: d.diskPath(disk), SizeMB: disk.size})
+	}
+	for i := range disks {
+		_, err := os.Stat(disks[i].Path)
+		disks[i].Exists = err == nil
+	}
+	p.Disks = disks
+
+	// vmnet only hands out the MAC address of a UUID to root
+	if mac, err := d.macAddress(b); err == nil {
+		p.MAC = mac
+	} else {
+		p.MAC = "assigned by vmnet at start"
+	}
+
+	ports, err := d.extractVSockPorts()
+	if err != nil {
+		return nil, err
+	}
+	p.VSock = append(ports, d.bridgedGuestPorts()...)
+	if d.GuestAgent {
+		p.VSock = append(p.VSock, guestAgentPort)
+	}
+
+	if len(d.NFSShares) > 0 {
+		username := "<user>"
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+		ip := d.IPAddress
+		if ip == "" {
+			ip = "<machine ip>"
+		}
+		for _, share := range d.NFSShares {
+			p.NFSExports = append(p.NFSExports, nfsExportLine(d.nfsSharePath(share), ip, username))
+		}
+	}
+
+	if b.name() == backendQEMU {
+		binary := qemuBinary
+		if path, err := exec.LookPath(qemuBinary); err == nil {
+			binary = path
+		}
+		p.CommandLine = append([]string{binary}, qemuArgs(d, d.machineUUID(), p.MAC, p.Cmdline)...)
+	}
+	return p, nil
+}
+
+// planBoot describes what the machine boots, without fetching anything
+func (d *Driver) planBoot() (string, error) {
+	if d.netboot() {
+		return fmt.Sprintf("kernel %s, initrd %s", d.KernelURL, d.InitrdURL), nil
+	}
+	iso := d.ResolveStorePath(isoFilename)
+	if _, err := os.Stat(iso); err == nil {
+		return iso, nil
+	}
+	url := d.Boot2DockerURL
+	switch {
+	case url == "":
+		cached := filepath.Join(d.StorePath, "cache", isoFilename)
+		if _, err := os.Stat(cached); err == nil {
+			return "latest boot2docker release, cached at " + cached, nil
+		}
+		return "latest boot2docker release, to be downloaded", nil
+	case strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"):
+		return url + ", to be downloaded", nil
+	default:
+		path := strings.TrimPrefix(url, "file://")
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("boot2docker ISO: %w", err)
+		}
+		return path, nil
+	}
+}
@@ -0,0 +1,80 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanMachine(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+
+	p, err := PlanMachine(store, "dev", map[string]interface{}{
+		"Backend":   backendQEMU,
+		"CPU":       2,
+		"Memory":    2048,
+		"NFSShares": []string{"/Users/dev/src:src"},
+		"IPAddress": "192.168.64.5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(store, "machines", "dev")); !os.IsNotExist(err) {
+		t.Errorf("planning created the machine dir: %v", err)
+	}
+
+	if p.Backend != backendQEMU || p.CPUs != 2 || p.Memory != 2048 {
+		t.Errorf("plan = %+v", p)
+	}
+	if p.Boot != "latest boot2docker release, to be downloaded" {
+		t.Errorf("plan boot = %q", p.Boot)
+	}
+	wantDisk := filepath.Join(store, "machines", "dev", "dev.rawdisk")
+	if len(p.Disks) != 1 || p.Disks[0].Path != wantDisk || p.Disks[0].Exists {
+		t.Errorf("plan disks = %+v, want %s to be created", p.Disks, wantDisk)
+	}
+	if len(p.NFSExports) != 1 || !strings.HasPrefix(p.NFSExports[0], "/Users/dev/src 192.168.64.5 -alldirs -mapall=") {
+		t.Errorf("plan NFS exports = %q", p.NFSExports)
+	}
+	if len(p.CommandLine) == 0 || !strings.Contains(strings.Join(p.CommandLine, " "), "-name dev") {
+		t.Errorf("plan command line = %q", p.CommandLine)
+	}
+	if !strings.Contains(p.String(), "disk:    "+wantDisk+" (20000 MB, to be created)") {
+		t.Errorf("plan output:\n%s", p)
+	}
+}
+
+func TestPlanMachineInvalid(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	if _, err := PlanMachine(store, "dev", map[string]interface{}{"Wait": "forever"}); err == nil {
+		t.Error("PlanMachine() with an invalid wait strategy succeeded")
+	}
+}
@@ -0,0 +1,38 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"time"
+)
+
+const (
+	// powerSaveCmdline keeps the guest kernel tickless while idle
+	powerSaveCmdline = "nohz=on"
+	// powerSaveSuperviseInterval is how often the supervisor polls hyperkit
+	// in power save mode
+	powerSaveSuperviseInterval = 30 * time.Second
+)
+
+func (d *Driver) superviseInterval() time.Duration {
+	if d.PowerSave {
+		return powerSaveSuperviseInterval
+	}
+	return superviseInterval
+}
@@ -0,0 +1,212 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// minMacOSVersion is the first macOS release with Hypervisor.framework
+const minMacOSVersion = "10.10.3"
+
+var vmStatPageSizeRegexp = regexp.MustCompile(`page size of (\d+) bytes`)
+
+// hostInfo is what the host offers for running machines. Zero values mean
+// unknown, and skip their check.
+type hostInfo struct {
+	// HVSupport is kern.hv_support, "1" if Hypervisor.framework is usable
+	HVSupport string
+	OSVersion string
+	// CPUs are the logical cores, PhysicalCPUs the cores without
+	// hyperthreading
+	CPUs         int
+	PhysicalCPUs int
+	// MemBytes is the physical memory, AvailMemBytes the part of it that
+	// is free or can be reclaimed right away
+	MemBytes      uint64
+	AvailMemBytes uint64
+	// FreeDiskBytes is the space available in the machine store
+	FreeDiskBytes uint64
+}
+
+func getHostInfo(storePath string) hostInfo {
+	var info hostInfo
+	info.HVSupport, _ = sysctl("kern.hv_support")
+	if out, err := exec.Command("/usr/bin/sw_vers", "-productVersion").Output(); err != nil {
+		log.Debugf("Unable to get the macOS version: %v", err)
+	} else {
+		info.OSVersion = strings.TrimSpace(string(out))
+	}
+	if s, err := sysctl("hw.ncpu"); err == nil {
+		info.CPUs, _ = strconv.Atoi(s)
+	}
+	if s, err := sysctl("hw.physicalcpu"); err == nil {
+		info.PhysicalCPUs, _ = strconv.Atoi(s)
+	}
+	if s, err := sysctl("hw.memsize"); err == nil {
+		info.MemBytes, _ = strconv.ParseUint(s, 10, 64)
+	}
+	if out, err := exec.Command("/usr/bin/vm_stat").Output(); err != nil {
+		log.Debugf("Unable to get the free memory: %v", err)
+	} else {
+		info.AvailMemBytes = parseVMStat(string(out))
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(storePath, &st); err != nil {
+		log.Debugf("Unable to get the free disk space of %s: %v", storePath, err)
+	} else {
+		info.FreeDiskBytes = uint64(st.Bavail) * uint64(st.Bsize)
+	}
+	return info
+}
+
+func sysctl(name string) (string, error) {
+	out, err := exec.Command("/usr/sbin/sysctl", "-n", name).Output()
+	if err != nil {
+		log.Debugf("Unable to read sysctl %s: %v", name, err)
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// parseVMStat returns the free, inactive and speculative memory reported by
+// vm_stat, which macOS can hand to a new process without swapping
+func parseVMStat(out string) uint64 {
+	m := vmStatPageSizeRegexp.FindStringSubmatch(out)
+	if m == nil {
+		return 0
+	}
+	pageSize, _ := strconv.ParseUint(m[1], 10, 64)
+	var pages uint64
+	for _, line := range strings.Split(out, "\n") {
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Pages free", "Pages inactive", "Pages speculative":
+			n, _ := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(kv[1]), "."), 10, 64)
+			pages += n
+		}
+	}
+	return pages * pageSize
+}
+
+// checkHost reports every way the host can't run the machine as configured.
+// Problems that may still work out, like memory that is in use right now,
+// are only warned about.
+func (d *Driver) checkHost(info hostInfo) error {
+	var problems []string
+	if info.HVSupport != "" && info.HVSupport != "1" {
+		problems = append(problems, "Hypervisor.framework is not available (kern.hv_support is "+info.HVSupport+"). "+
+			"Check that the CPU supports virtualization and that the machine isn't itself a VM without nested virtualization")
+	}
+	if info.OSVersion != "" && compareVersions(info.OSVersion, minMacOSVersion) < 0 {
+		problems = append(problems, fmt.Sprintf("macOS %s is too old, hyperkit needs %s or later", info.OSVersion, minMacOSVersion))
+	}
+	if info.CPUs > 0 && d.CPU > info.CPUs {
+		problems = append(problems, fmt.Sprintf("%d CPUs requested but the host only has %d, lower --hyperkit-cpu-count", d.CPU, info.CPUs))
+	}
+	mem := uint64(d.Memory) * 1024 * 1024
+	if info.MemBytes > 0 && mem >= info.MemBytes {
+		problems = append(problems, fmt.Sprintf("%d MB of memory requested but the host only has %d MB, lower --hyperkit-memory-size",
+			d.Memory, info.MemBytes/1024/1024))
+	} else if d.WiredMemory {
+		d.checkWiredMemory(info)
+	} else if info.AvailMemBytes > 0 && mem > info.AvailMemBytes {
+		log.Warnf("%d MB of memory requested but only %d MB are free, the host may start swapping", d.Memory, info.AvailMemBytes/1024/1024)
+	}
+	disk := uint64(d.DiskSize) * 1000000
+	if info.FreeDiskBytes > 0 && disk > info.FreeDiskBytes {
+		problems = append(problems, fmt.Sprintf("%s disk requested but only %s are free in %s, free up space or lower --hyperkit-disk-size",
+			formatBytes(int64(disk)), formatBytes(int64(info.FreeDiskBytes)), d.StorePath))
+	}
+
+	if len(problems) == 0 {
+		for _, warning := range d.resourceWarnings(info) {
+			log.Warn(warning)
+		}
+		return nil
+	}
+	return fmt.Errorf("the host can't run this machine:\n  - %s", strings.Join(problems, "\n  - "))
+}
+
+// resourceWarnings returns what the host can run, but not comfortably
+func (d *Driver) resourceWarnings(info hostInfo) []string {
+	var warnings []string
+	if info.PhysicalCPUs > 0 && d.CPU > info.PhysicalCPUs && (info.CPUs == 0 || d.CPU <= info.CPUs) {
+		warnings = append(warnings, fmt.Sprintf("%d CPUs requested but the host only has %d physical cores, the machine competes with the host for hyperthreads",
+			d.CPU, info.PhysicalCPUs))
+	}
+	mem := uint64(d.Memory) * 1024 * 1024
+	if info.MemBytes > 0 && mem < info.MemBytes && mem > info.MemBytes/4*3 {
+		warnings = append(warnings, fmt.Sprintf("%d MB of memory requested, more than 75%% of the host's %d MB, leaving little for macOS and other applications",
+			d.Memory, info.MemBytes/1024/1024))
+	}
+	return warnings
+}
+
+// checkWiredMemory warns when wiring the guest memory would starve the host,
+// as wired memory can't be paged out to make room for anything else. It
+// returns the warning for tests.
+func (d *Driver) checkWiredMemory(info hostInfo) string {
+	mem := uint64(d.Memory) * 1024 * 1024
+	var warning string
+	switch {
+	case info.AvailMemBytes > 0 && mem > info.AvailMemBytes:
+		warning = fmt.Sprintf("%d MB of memory will be wired but only %d MB are free, the host will page out other applications to make room, or hyperkit fails to start",
+			d.Memory, info.AvailMemBytes/1024/1024)
+	case info.MemBytes > 0 && mem > info.MemBytes/2:
+		warning = fmt.Sprintf("%d MB of memory will be wired, more than half of the host's %d MB, which the host can't page out while the machine runs",
+			d.Memory, info.MemBytes/1024/1024)
+	}
+	if warning != "" {
+		log.Warn(warning)
+	}
+	return warning
+}
+
+// compareVersions compares dotted version numbers, treating missing parts
+// as 0
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,155 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestParseVMStat(t *testing.T) {
+	out := `Mach Virtual Memory Statistics: (page size of 4096 bytes)
+Pages free:                               10000.
+Pages active:                            500000.
+Pages inactive:                           20000.
+Pages speculative:                         1000.
+Pages throttled:                              0.
+`
+	if got, want := parseVMStat(out), uint64(31000*4096); got != want {
+		t.Errorf("parseVMStat() = %d, want %d", got, want)
+	}
+	if got := parseVMStat("garbage"); got != 0 {
+		t.Errorf("parseVMStat(garbage) = %d, want 0", got)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.15.7", "10.10.3", 1},
+		{"10.10", "10.10.3", -1},
+		{"10.10.3", "10.10.3", 0},
+		{"11.2", "10.10.3", 1},
+		{"10.9.5", "10.10.3", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	good := hostInfo{
+		HVSupport:     "1",
+		OSVersion:     "10.15.7",
+		CPUs:          8,
+		MemBytes:      16 << 30,
+		AvailMemBytes: 8 << 30,
+		FreeDiskBytes: 100e9,
+	}
+	tests := []struct {
+		name string
+		info func(hostInfo) hostInfo
+		cpu  int
+		want string
+	}{
+		{"ok", func(h hostInfo) hostInfo { return h }, 2, ""},
+		{"unknown", func(hostInfo) hostInfo { return hostInfo{} }, 64, ""},
+		{"no hvf", func(h hostInfo) hostInfo { h.HVSupport = "0"; return h }, 2, "Hypervisor.framework"},
+		{"old macos", func(h hostInfo) hostInfo { h.OSVersion = "10.9.5"; return h }, 2, "too old"},
+		{"cpus", func(h hostInfo) hostInfo { return h }, 16, "--hyperkit-cpu-count"},
+		{"memory", func(h hostInfo) hostInfo { h.MemBytes = 512 << 20; return h }, 2, "--hyperkit-memory-size"},
+		{"disk", func(h hostInfo) hostInfo { h.FreeDiskBytes = 1e9; return h }, 2, "--hyperkit-disk-size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Driver{
+				BaseDriver: &drivers.BaseDriver{StorePath: "/tmp/store"},
+				CPU:        tt.cpu,
+				Memory:     1024,
+				DiskSize:   defaultDiskSize,
+			}
+			err := d.checkHost(tt.info(good))
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("checkHost() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("checkHost() = %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWiredMemory(t *testing.T) {
+	tests := []struct {
+		name   string
+		memory int
+		info   hostInfo
+		want   string
+	}{
+		{"fits", 2048, hostInfo{MemBytes: 16 << 30, AvailMemBytes: 8 << 30}, ""},
+		{"not free", 4096, hostInfo{MemBytes: 16 << 30, AvailMemBytes: 2 << 30}, "only 2048 MB are free"},
+		{"half the host", 6144, hostInfo{MemBytes: 8 << 30, AvailMemBytes: 7 << 30}, "more than half"},
+		{"unknown", 4096, hostInfo{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Driver{Memory: tt.memory, WiredMemory: true}
+			got := d.checkWiredMemory(tt.info)
+			if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+				t.Errorf("checkWiredMemory() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceWarnings(t *testing.T) {
+	info := hostInfo{CPUs: 8, PhysicalCPUs: 4, MemBytes: 16 << 30}
+	tests := []struct {
+		name   string
+		cpu    int
+		memory int
+		want   string
+	}{
+		{"fits", 4, 8192, ""},
+		{"hyperthreads", 6, 8192, "4 physical cores"},
+		{"memory", 2, 14000, "75%"},
+	}
+	for _, tt := range tests {
+		d := &Driver{CPU: tt.cpu, Memory: tt.memory}
+		warnings := d.resourceWarnings(info)
+		if tt.want == "" {
+			if len(warnings) > 0 {
+				t.Errorf("%s: resourceWarnings() = %q, want none", tt.name, warnings)
+			}
+			continue
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0], tt.want) {
+			t.Errorf("%s: resourceWarnings() = %q, want one containing %q", tt.name, warnings, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+const (
+	// bootFilesCacheDir is where prefetched boot files are extracted,
+	// relative to the store's ISO cache
+	bootFilesCacheDir = "hyperkit"
+	// bootFilesManifestFileName records which ISO the prefetched boot files
+	// were extracted from
+	bootFilesManifestFileName = "boot-files.json"
+)
+
+// bootFilesManifest is the content of the boot files manifest
+type bootFilesManifest struct {
+	ISOChecksum string
+	Files       ISOBootFiles
+}
+
+// Prefetch downloads the ISO into the cache of the store at storePath and
+// extracts its boot files, without creating a machine. An empty isoURL
+// prefetches the latest boot2docker release. With checksum set the ISO must
+// have that SHA-256. Machines created from the same ISO later copy the
+// extracted boot files instead of extracting them again.
+func Prefetch(storePath, isoURL, checksum string) (ISOBootFiles, error) {
+	cacheDir := filepath.Join(storePath, "cache")
+	b2 := mcnutils.NewB2dUtils(storePath)
+
+	isoPath := filepath.Join(cacheDir, isoFilename)
+	if isoURL == "" {
+		log.Info("Updating the boot2docker ISO cache...")
+		if err := b2.UpdateISOCache(isoURL); err != nil {
+			return ISOBootFiles{}, fmt.Errorf("updating ISO cache: %w", err)
+		}
+	} else {
+		isoPath = filepath.Join(cacheDir, path.Base(isoURL))
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return ISOBootFiles{}, err
+		}
+		log.Infof("Downloading %s to %s...", isoURL, isoPath)
+		if err := b2.DownloadISO(cacheDir, path.Base(isoURL), isoURL); err != nil {
+			return ISOBootFiles{}, fmt.Errorf("downloading %s: %w", isoURL, err)
+		}
+	}
+
+	sum, err := fileSHA256(isoPath)
+	if err != nil {
+		return ISOBootFiles{}, err
+	}
+	if checksum != "" && !strings.EqualFold(checksum, hex.EncodeToString(sum)) {
+		os.Remove(isoPath)
+		return ISOBootFiles{}, fmt.Errorf("%s has SHA-256 %x, not %s, removed it", isoPath, sum, checksum)
+	}
+
+	dest := filepath.Join(cacheDir, bootFilesCacheDir)
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return ISOBootFiles{}, err
+	}
+	log.Infof("Extracting boot files from %s...", isoPath)
+	files, err := ISOExtractBootFiles(isoPath, dest)
+	if err != nil {
+		return files, fmt.Errorf("extracting boot files: %w", err)
+	}
+	if files.KernelPath == "" || files.InitrdPath == "" {
+		return files, fmt.Errorf("%s does not contain a kernel and initrd", isoPath)
+	}
+	b, err := json.Marshal(bootFilesManifest{ISOChecksum: hex.EncodeToString(sum), Files: files})
+	if err != nil {
+		return files, err
+	}
+	return files, writeFileAtomic(filepath.Join(dest, bootFilesManifestFileName), b, 0644)
+}
+
+// prefetchedBootFiles returns the boot files Prefetch extracted into the
+// store at storePath from the ISO with checksum, if it did
+func prefetchedBootFiles(storePath, checksum string) (ISOBootFiles, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(storePath, "cache", bootFilesCacheDir, bootFilesManifestFileName))
+	if err != nil {
+		return ISOBootFiles{}, false
+	}
+	var m bootFilesManifest
+	if err := json.Unmarshal(b, &m); err != nil || m.ISOChecksum != checksum {
+		return ISOBootFiles{}, false
+	}
+	for _, path := range []string{m.Files.KernelPath, m.Files.InitrdPath} {
+		if _, err := os.Stat(path); err != nil {
+			return ISOBootFiles{}, false
+		}
+	}
+	return m.Files, true
+}
+
+// isoBootFiles puts the boot files of the ISO at isoPath, whose SHA-256 is
+// checksum, into the machine dir. They are copied from the prefetched boot
+// files of the same ISO where there are any, and extracted otherwise.
+func (d *Driver) isoBootFiles(isoPath, checksum string) (ISOBootFiles, error) {
+	paths := ISOBootPaths{
+		Kernel: d.ISOKernelPath,
+		Initrd: d.ISOInitrdPath,
+	}
+	if files, ok := prefetchedBootFiles(d.StorePath, checksum); ok && paths == (ISOBootPaths{}) {
+		log.Infof("Using the boot files prefetched from %s", isoPath)
+		kernel := d.ResolveStorePath(filepath.Base(files.KernelPath))
+		initrd := d.ResolveStorePath(filepath.Base(files.InitrdPath))
+		err := mcnutils.CopyFile(files.KernelPath, kernel)
+		if err == nil {
+			err = mcnutils.CopyFile(files.InitrdPath, initrd)
+		}
+		if err == nil {
+			// The boot configs are only read, they can stay in the cache
+			files.KernelPath, files.InitrdPath = kernel, initrd
+			return files, nil
+		}
+		log.Debugf("Unable to copy the prefetched boot files, extracting them: %v", err)
+	}
+	return ISOExtractBootFilesWithPaths(isoPath, d.ResolveStorePath(""), paths)
+}
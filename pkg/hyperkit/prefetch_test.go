@@ -0,0 +1,107 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestPrefetchChecksumMismatch(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	src := filepath.Join(store, "tampered.iso")
+	if err := ioutil.WriteFile(src, []byte("not the ISO"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Prefetch(store, "file://"+src, strings.Repeat("0", 64))
+	if err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Fatalf("Prefetch() error = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(filepath.Join(store, "cache", "tampered.iso")); !os.IsNotExist(err) {
+		t.Errorf("ISO with the wrong checksum kept in the cache: %v", err)
+	}
+}
+
+func TestDriver_isoBootFilesPrefetched(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	cache := filepath.Join(store, "cache", bootFilesCacheDir)
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(store, "machines", "dev"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	files := ISOBootFiles{
+		KernelPath:      filepath.Join(cache, "vmlinuz64"),
+		InitrdPath:      filepath.Join(cache, "initrd.img"),
+		IsoLinuxCfgPath: filepath.Join(cache, "isolinux.cfg"),
+	}
+	for _, path := range []string{files.KernelPath, files.InitrdPath, files.IsoLinuxCfgPath} {
+		if err := ioutil.WriteFile(path, []byte(filepath.Base(path)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sum := sha256.Sum256([]byte("iso"))
+	checksum := hex.EncodeToString(sum[:])
+	manifest := `{"ISOChecksum":"` + checksum + `","Files":{"KernelPath":"` + files.KernelPath +
+		`","InitrdPath":"` + files.InitrdPath + `","IsoLinuxCfgPath":"` + files.IsoLinuxCfgPath + `"}}`
+	if err := ioutil.WriteFile(filepath.Join(cache, bootFilesManifestFileName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "dev", StorePath: store}}
+	// The ISO itself doesn't exist, so the boot files can only come from
+	// the cache
+	got, err := d.isoBootFiles(filepath.Join(store, "missing.iso"), checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ISOBootFiles{
+		KernelPath:      d.ResolveStorePath("vmlinuz64"),
+		InitrdPath:      d.ResolveStorePath("initrd.img"),
+		IsoLinuxCfgPath: files.IsoLinuxCfgPath,
+	}
+	if got != want {
+		t.Errorf("isoBootFiles() = %+v, want %+v", got, want)
+	}
+	if b, err := ioutil.ReadFile(want.KernelPath); err != nil || string(b) != "vmlinuz64" {
+		t.Errorf("kernel not copied into the machine dir: %q, %v", b, err)
+	}
+
+	// Boot files of another ISO aren't used
+	if _, err := d.isoBootFiles(filepath.Join(store, "missing.iso"), strings.Repeat("0", 64)); err == nil {
+		t.Error("isoBootFiles() used the boot files of another ISO")
+	}
+}
@@ -0,0 +1,121 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// psStartTimeLayout is the layout of the lstart column printed by ps(1)
+const psStartTimeLayout = "Mon Jan 2 15:04:05 2006"
+
+var psOutputRegexp = regexp.MustCompile(`^\s*(\S+\s+\S+\s+\d+\s+[\d:]+\s+\d+)\s+(.+)$`)
+
+// processIdentity identifies a process beyond its pid, which the OS is free to
+// hand out again once hyperkit has exited.
+type processIdentity struct {
+	Path      string    `json:"path"`
+	StartTime time.Time `json:"start_time"`
+}
+
+func (p *processIdentity) matches(other *processIdentity) bool {
+	return p.Path == other.Path && p.StartTime.Equal(other.StartTime)
+}
+
+// lookupProcessIdentity returns the full executable path and start time of pid
+func lookupProcessIdentity(pid int) (*processIdentity, error) {
+	cmd := exec.Command("/bin/ps", "-o", "lstart=", "-o", "comm=", "-p", strconv.Itoa(pid))
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ps %d: %w", pid, err)
+	}
+	return parseProcessIdentity(string(out))
+}
+
+func parseProcessIdentity(out string) (*processIdentity, error) {
+	m := psOutputRegexp.FindStringSubmatch(strings.TrimSpace(out))
+	if m == nil {
+		return nil, fmt.Errorf("unable to parse ps output: %q", out)
+	}
+	start, err := time.ParseInLocation(psStartTimeLayout, strings.Join(strings.Fields(m[1]), " "), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("parsing process start time: %w", err)
+	}
+	return &processIdentity{
+		Path:      strings.TrimSpace(m[2]),
+		StartTime: start,
+	}, nil
+}
+
+// findProcessWithArg returns the pid of a hyperkit or QEMU process with the
+// path arg in its command line, or 0 if there is none
+func findProcessWithArg(arg string) (int, error) {
+	cmd := exec.Command("/bin/ps", "-ax", "-o", "pid=", "-o", "command=")
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ps: %w", err)
+	}
+	return parseProcessWithArg(string(out), arg), nil
+}
+
+func parseProcessWithArg(out, arg string) int {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if !strings.Contains(fields[1], "hyperkit") && !strings.Contains(fields[1], "qemu") {
+			continue
+		}
+		if !hasPathArg(line, arg) {
+			continue
+		}
+		if pid, err := strconv.Atoi(fields[0]); err == nil {
+			return pid
+		}
+	}
+	return 0
+}
+
+// hasPathArg reports whether the command line has path as a whole argument or
+// as the file of a hyperkit device or QEMU drive option, rather than as part
+// of a longer path
+func hasPathArg(line, path string) bool {
+	for i := 0; ; {
+		n := strings.Index(line[i:], path)
+		if n < 0 {
+			return false
+		}
+		start, end := i+n, i+n+len(path)
+		before, after := line[:start], line[end:]
+		if (strings.HasSuffix(before, " ") || strings.HasSuffix(before, ",") || strings.HasSuffix(before, "=") || strings.HasSuffix(before, ",file://")) &&
+			(after == "" || strings.IndexAny(after[:1], " ,?") == 0) {
+			return true
+		}
+		i = start + 1
+	}
+}
@@ -0,0 +1,109 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseProcessIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		wantPath string
+		wantTime time.Time
+		wantErr  bool
+	}{
+		{
+			"valid",
+			"Thu Oct 16 10:04:05 2026     /usr/local/bin/hyperkit\n",
+			"/usr/local/bin/hyperkit",
+			time.Date(2026, time.October, 16, 10, 4, 5, 0, time.Local),
+			false,
+		},
+		{
+			"padded_day_and_spaces_in_path",
+			"Mon Oct  6 09:00:00 2026 /Applications/Docker.app/Contents/Resources/bin/com.docker.hyperkit with space",
+			"/Applications/Docker.app/Contents/Resources/bin/com.docker.hyperkit with space",
+			time.Date(2026, time.October, 6, 9, 0, 0, 0, time.Local),
+			false,
+		},
+		{
+			"empty",
+			"",
+			"",
+			time.Time{},
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcessIdentity(tt.out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProcessIdentity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Path != tt.wantPath {
+				t.Errorf("parseProcessIdentity() path = %q, want %q", got.Path, tt.wantPath)
+			}
+			if !got.StartTime.Equal(tt.wantTime) {
+				t.Errorf("parseProcessIdentity() start time = %v, want %v", got.StartTime, tt.wantTime)
+			}
+		})
+	}
+}
+
+func Test_parseProcessWithArg(t *testing.T) {
+	out := `    1 /sbin/launchd
+  412 /usr/bin/vim /Users/me/.docker/machine/machines/dev/dev.rawdisk
+  977 /usr/local/bin/hyperkit -A -u -F /Users/me/.docker/machine/machines/dev/hyperkit.pid -s 2:0,virtio-blk,file:///Users/me/.docker/machine/machines/dev/dev.rawdisk,format=raw
+ 1024 /usr/local/bin/qemu-system-x86_64 -drive file=/Users/me/.docker/machine/machines/other/other.rawdisk,format=raw,if=virtio
+`
+	tests := []struct {
+		arg  string
+		want int
+	}{
+		{"/Users/me/.docker/machine/machines/dev/dev.rawdisk", 977},
+		{"/Users/me/.docker/machine/machines/other/other.rawdisk", 1024},
+		{"/Users/me/.docker/machine/machines/gone/gone.rawdisk", 0},
+		{"/me/.docker/machine/machines/dev/dev.rawdisk", 0},
+		{"/Users/me/.docker/machine/machines/dev/dev.raw", 0},
+	}
+	for _, tt := range tests {
+		if got := parseProcessWithArg(out, tt.arg); got != tt.want {
+			t.Errorf("parseProcessWithArg(%q) = %d, want %d", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestParseProcessStats(t *testing.T) {
+	cpu, rss, err := parseProcessStats("  12.5 524288\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu != 12.5 || rss != 512<<20 {
+		t.Errorf("parseProcessStats() = %v, %d, want 12.5, %d", cpu, rss, 512<<20)
+	}
+	if _, _, err := parseProcessStats(""); err == nil {
+		t.Error("parseProcessStats(\"\") succeeded, want an error")
+	}
+}
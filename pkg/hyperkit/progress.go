@@ -0,0 +1,229 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// progressInterval is how often a running step reports progress
+const progressInterval = 2 * time.Second
+
+// Steps of Create that report progress
+const (
+	progressDownload = "download"
+	progressDisk     = "disk"
+)
+
+// Progress is an update on a long running step of Create
+type Progress struct {
+	// Step is "download" or "disk"
+	Step string `json:"step"`
+	// Name is the file the step works on
+	Name string `json:"name"`
+	// Bytes is how much of the file has been written so far
+	Bytes int64 `json:"bytes"`
+	// Total is the expected size of the file, or 0 if unknown
+	Total   int64         `json:"total,omitempty"`
+	Percent float64       `json:"percent,omitempty"`
+	ETA     time.Duration `json:"eta_ns,omitempty"`
+	Done    bool          `json:"done,omitempty"`
+}
+
+func (p Progress) String() string {
+	s := fmt.Sprintf("%s %s: %s", p.Step, p.Name, formatBytes(p.Bytes))
+	switch {
+	case p.Done:
+		return s + ", done"
+	case p.Total > 0:
+		s += fmt.Sprintf(" of %s (%.0f%%)", formatBytes(p.Total), p.Percent)
+		if p.ETA > 0 {
+			s += fmt.Sprintf(", %s left", p.ETA)
+		}
+	}
+	return s
+}
+
+// ProgressFunc receives the progress updates of Create
+type ProgressFunc func(Progress)
+
+// SetProgressFunc makes Create report progress to f, in addition to the log
+// and the --hyperkit-progress-file stream.
+func (d *Driver) SetProgressFunc(f ProgressFunc) {
+	d.progressFunc = f
+}
+
+func (d *Driver) reportProgress(p Progress) {
+	log.Info(p)
+	if d.progressFunc != nil {
+		d.progressFunc(p)
+	}
+	if d.ProgressFile == "" {
+		return
+	}
+	// Reopened for every update, so a fifo reader may come and go
+	f, err := openCallerFile(d.ProgressFile)
+	if err != nil {
+		log.Debugf("Unable to write progress to %s: %v", d.ProgressFile, err)
+		return
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(p); err != nil {
+		log.Debugf("Unable to write progress to %s: %v", d.ProgressFile, err)
+	}
+}
+
+// progressWriter counts the bytes written to it and reports them at most
+// every progressInterval
+type progressWriter struct {
+	d          *Driver
+	progress   Progress
+	start      time.Time
+	lastReport time.Time
+}
+
+func (d *Driver) newProgressWriter(step, name string, total int64) *progressWriter {
+	if total < 0 {
+		total = 0
+	}
+	w := &progressWriter{
+		d:        d,
+		progress: Progress{Step: step, Name: name, Total: total},
+		start:    time.Now(),
+	}
+	w.lastReport = w.start
+	d.reportProgress(w.progress)
+	return w
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.progress.Bytes += int64(len(b))
+	if now := time.Now(); now.Sub(w.lastReport) >= progressInterval {
+		w.lastReport = now
+		w.update(now)
+		w.d.reportProgress(w.progress)
+	}
+	return len(b), nil
+}
+
+func (w *progressWriter) update(now time.Time) {
+	p := &w.progress
+	if p.Total <= 0 || p.Bytes <= 0 {
+		return
+	}
+	p.Percent = float64(p.Bytes) * 100 / float64(p.Total)
+	elapsed := now.Sub(w.start)
+	remaining := float64(p.Total-p.Bytes) / float64(p.Bytes) * float64(elapsed)
+	p.ETA = time.Duration(remaining).Round(time.Second)
+}
+
+// watch reports the size of the file at path as the step's progress while
+// something else writes it, until the returned function is called
+func (w *progressWriter) watch(path string) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-t.C:
+				if fi, err := os.Stat(path); err == nil {
+					w.progress.Bytes = fi.Size()
+					w.update(now)
+					w.d.reportProgress(w.progress)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-stopped
+	}
+}
+
+// Done reports the step as finished
+func (w *progressWriter) Done() {
+	w.progress.Done = true
+	if w.progress.Total > 0 {
+		w.progress.Bytes = w.progress.Total
+	}
+	w.progress.Percent = 100
+	w.progress.ETA = 0
+	w.d.reportProgress(w.progress)
+}
+
+// download fetches url to dest, reporting progress along the way
+func (d *Driver) download(ctx context.Context, url, dest string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+
+	tmp := dest + ".download"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	pw := d.newProgressWriter(progressDownload, path.Base(url), resp.ContentLength)
+	if _, err := io.Copy(io.MultiWriter(f, pw), resp.Body); err != nil {
+		return fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	pw.Done()
+	return os.Rename(tmp, dest)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
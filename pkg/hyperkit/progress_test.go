@@ -0,0 +1,97 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{999, "999 B"},
+		{1500, "1.5 kB"},
+		{27500000, "27.5 MB"},
+		{20000000000, "20.0 GB"},
+	}
+	for _, tc := range tests {
+		if got := formatBytes(tc.n); got != tc.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tc.n, got, tc.want)
+		}
+	}
+}
+
+func TestProgressWriterUpdate(t *testing.T) {
+	start := time.Now()
+	w := &progressWriter{
+		progress: Progress{Step: progressDownload, Name: "boot2docker.iso", Bytes: 25, Total: 100},
+		start:    start,
+	}
+	w.update(start.Add(10 * time.Second))
+	if w.progress.Percent != 25 {
+		t.Errorf("Percent = %v, want 25", w.progress.Percent)
+	}
+	if w.progress.ETA != 30*time.Second {
+		t.Errorf("ETA = %v, want 30s", w.progress.ETA)
+	}
+}
+
+func TestProgressFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := NewDriver("default", dir)
+	d.ProgressFile = filepath.Join(dir, "progress")
+	var got []Progress
+	d.SetProgressFunc(func(p Progress) { got = append(got, p) })
+
+	w := d.newProgressWriter(progressDisk, "default.rawdisk", 100)
+	w.Write(make([]byte, 10))
+	w.Done()
+
+	if len(got) != 2 || got[0].Done || !got[1].Done || got[1].Bytes != 100 {
+		t.Errorf("progress callbacks = %+v, want a start and a done update", got)
+	}
+	f, err := os.Open(d.ProgressFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines int
+	for s := bufio.NewScanner(f); s.Scan(); lines++ {
+		var p Progress
+		if err := json.Unmarshal(s.Bytes(), &p); err != nil {
+			t.Errorf("invalid progress line %q: %v", s.Text(), err)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("progress file has %d lines, want 2", lines)
+	}
+}
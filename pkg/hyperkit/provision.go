@@ -0,0 +1,50 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// guestProvisionScript is where the provision script is copied in the guest
+const guestProvisionScript = "/tmp/docker-machine-provision"
+
+// runProvisionScript runs the user's provision script in the guest on the
+// first start, or on every start with ProvisionAlways. A failed script is
+// run again on the next start.
+func (d *Driver) runProvisionScript() error {
+	if d.ProvisionScript == "" || (d.Provisioned && !d.ProvisionAlways) {
+		return nil
+	}
+	script, err := readCallerFile(d.ProvisionScript, 0)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Running %s in %s", d.ProvisionScript, d.MachineName)
+	cmd := fmt.Sprintf("cat > %[1]s && chmod +x %[1]s && %[1]s", guestProvisionScript)
+	if err := d.runSSHWithStdin(cmd, bytes.NewReader(script)); err != nil {
+		return fmt.Errorf("%s: %w", d.ProvisionScript, err)
+	}
+	d.Provisioned = true
+	return nil
+}
@@ -0,0 +1,42 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import "testing"
+
+func TestRunProvisionScriptSkips(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *Driver
+		wantErr bool
+	}{
+		{"no script", &Driver{}, false},
+		{"already provisioned", &Driver{ProvisionScript: "/nonexistent", Provisioned: true}, false},
+		{"every start", &Driver{ProvisionScript: "/nonexistent", Provisioned: true, ProvisionAlways: true}, true},
+		{"first start", &Driver{ProvisionScript: "/nonexistent"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The script is missing, so only an attempt to run it fails
+			if err := tt.d.runProvisionScript(); (err != nil) != tt.wantErr {
+				t.Errorf("runProvisionScript() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// guestProxyProfile sets the proxy for shells in the guest
+	guestProxyProfile = "/etc/profile.d/docker-machine-proxy.sh"
+	// guestProxyDropIn sets the proxy for a systemd managed dockerd
+	guestProxyDropIn = "/etc/systemd/system/docker.service.d/http-proxy.conf"
+	// guestDockerProfile is read by the boot2docker docker init script
+	guestDockerProfile = "/var/lib/boot2docker/profile"
+	proxyBlockBegin    = "# begin docker-machine-driver-hyperkit proxy"
+	proxyBlockEnd      = "# end docker-machine-driver-hyperkit proxy"
+	// proxyReapplyWindow is how long after docker-machine provisioned the
+	// machine the supervisor keeps re-applying the proxy
+	proxyReapplyWindow = 2 * time.Minute
+)
+
+// validateProxy checks a proxy URL. They end up single quoted in guest
+// scripts, so they can't contain single quotes.
+func validateProxy(name, proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%s %q is not a URL like http://proxy.example.com:3128", name, proxy)
+	}
+	if strings.Contains(proxy, "'") {
+		return fmt.Errorf("%s %q must not contain single quotes", name, proxy)
+	}
+	return nil
+}
+
+// proxyEnv returns the proxy environment variables, in both cases as tools
+// disagree on which one they read
+func (d *Driver) proxyEnv() [][2]string {
+	var env [][2]string
+	for _, v := range []struct{ name, value string }{
+		{"HTTP_PROXY", d.HTTPProxy},
+		{"HTTPS_PROXY", d.HTTPSProxy},
+		{"NO_PROXY", d.NoProxy},
+	} {
+		if v.value != "" {
+			env = append(env, [2]string{v.name, v.value}, [2]string{strings.ToLower(v.name), v.value})
+		}
+	}
+	return env
+}
+
+// proxyScript returns the shell script that configures the proxy in a guest
+// with the given os-release ID, restarting dockerd if its proxy changed. The
+// proxy URLs may carry credentials, so the files it writes are only readable
+// by root.
+func proxyScript(osID string, env [][2]string) string {
+	var exports, systemd strings.Builder
+	for _, kv := range env {
+		fmt.Fprintf(&exports, "export %s='%s'\n", kv[0], kv[1])
+		fmt.Fprintf(&systemd, "Environment='%s=%s'\n", kv[0], kv[1])
+	}
+
+	var s strings.Builder
+	fmt.Fprintf(&s, "set -e\numask 077\ncat > %s <<'EOF'\n%sEOF\nchmod 600 %[1]s\n", guestProxyProfile, exports.String())
+	if osID == "boot2docker" {
+		// The provisioner rewrites the profile, so the block is re-added
+		// on every start
+		fmt.Fprintf(&s, "touch %[1]s\nold=$(cat %[1]s)\n", guestDockerProfile)
+		fmt.Fprintf(&s, "sed -i '/^%s$/,/^%s$/d' %s\n", proxyBlockBegin, proxyBlockEnd, guestDockerProfile)
+		fmt.Fprintf(&s, "cat >> %s <<'EOF'\n%s\n%s%s\nEOF\n", guestDockerProfile, proxyBlockBegin, exports.String(), proxyBlockEnd)
+		fmt.Fprintf(&s, "chmod 600 %s\n", guestDockerProfile)
+		fmt.Fprintf(&s, "[ \"$old\" = \"$(cat %s)\" ] || /etc/init.d/docker restart\n", guestDockerProfile)
+		return s.String()
+	}
+	fmt.Fprintf(&s, "mkdir -p %s\n", "/etc/systemd/system/docker.service.d")
+	fmt.Fprintf(&s, "cat > %s.new <<'EOF'\n[Service]\n%sEOF\n", guestProxyDropIn, systemd.String())
+	fmt.Fprintf(&s, "if cmp -s %[1]s.new %[1]s; then rm %[1]s.new; else mv %[1]s.new %[1]s; systemctl daemon-reload; systemctl restart docker; fi\n", guestProxyDropIn)
+	return s.String()
+}
+
+// configureProxy points the guest shell and dockerd at the proxies
+func (d *Driver) configureProxy() error {
+	env := d.proxyEnv()
+	if len(env) == 0 {
+		return nil
+	}
+	id, err := d.guestOSID()
+	if err != nil {
+		return fmt.Errorf("detecting the guest OS: %w", err)
+	}
+	log.Infof("Configuring the proxy of %s", d.MachineName)
+	return d.runSSHWithStdin("sudo sh", strings.NewReader(proxyScript(id, env)))
+}
+
+// reapplyProxy configures the proxy again after docker-machine provisioned
+// the machine, as its boot2docker provisioner rewrites the profile the proxy
+// is set in. Provisioning starts with writing the server certificate, and
+// the proxy script only touches the guest when the proxy is missing, so it
+// is re-applied on every call for a while after that.
+func (d *Driver) reapplyProxy(now time.Time) {
+	if len(d.proxyEnv()) == 0 {
+		return
+	}
+	fi, err := os.Stat(d.ResolveStorePath("server.pem"))
+	if err != nil || now.Sub(fi.ModTime()) > proxyReapplyWindow {
+		return
+	}
+	if err := d.configureProxy(); err != nil {
+		log.Warnf("Unable to configure the proxy of %s: %v", d.MachineName, err)
+	}
+}
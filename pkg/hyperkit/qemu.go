@@ -0,0 +1,148 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	qemuBinary = "qemu-system-x86_64"
+	// qemuPidFileName is where QEMU writes its pid when daemonizing
+	qemuPidFileName = "qemu.pid"
+)
+
+// qemuBackend runs the machine with HVF accelerated QEMU, for hosts where
+// hyperkit can't be installed. It uses the same disk, ISO, kernel and console
+// files as hyperkit, and vmnet shared networking so the machine gets its IP
+// from the same dhcp server.
+type qemuBackend struct{}
+
+func qemuInstalled() bool {
+	_, err := exec.LookPath(qemuBinary)
+	return err == nil
+}
+
+func (qemuBackend) name() string {
+	return backendQEMU
+}
+
+// macAddress derives a stable locally administered unicast MAC from uuid,
+// which QEMU passes to vmnet as is.
+func (qemuBackend) macAddress(uuid string) (string, error) {
+	sum := sha1.Sum([]byte(uuid))
+	sum[0] = sum[0]&0xfe | 0x02
+	mac := make([]string, 6)
+	for i := range mac {
+		mac[i] = fmt.Sprintf("%02x", sum[i])
+	}
+	return strings.Join(mac, ":"), nil
+}
+
+func (b qemuBackend) start(d *Driver, uuid, cmdline string) (int, error) {
+	qemu, err := exec.LookPath(qemuBinary)
+	if err != nil {
+		return 0, fmt.Errorf("%s not found: %w", qemuBinary, err)
+	}
+	mac, err := b.macAddress(uuid)
+	if err != nil {
+		return 0, err
+	}
+	args := qemuArgs(d, uuid, mac, cmdline)
+	d.recordCommandLine(qemu, args)
+	if out, err := exec.Command(qemu, args...).CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("starting %s: %w: %s", qemuBinary, err, strings.TrimSpace(string(out)))
+	}
+
+	b2, err := ioutil.ReadFile(d.ResolveStorePath(qemuPidFileName))
+	if err != nil {
+		return 0, fmt.Errorf("reading QEMU pid file: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b2)))
+	if err != nil {
+		return 0, fmt.Errorf("parsing QEMU pid file: %w", err)
+	}
+
+	// Keep the hyperkit.json layout so state, stop and diagnostics work the
+	// same for both backends
+	ms, err := json.Marshal(map[string]interface{}{
+		"pid":                  pid,
+		"hyperkit":             qemu,
+		"arguments":            args,
+		"cmdline":              cmdline,
+		"driver_state_version": machineStateVersion,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(d.ResolveStorePath(machineFileName), ms, 0644); err != nil {
+		return 0, err
+	}
+	return pid, nil
+}
+
+// qemuDiscard passes guest discards on to the disk images with DiskTrim
+func qemuDiscard(d *Driver) string {
+	if d.DiskTrim {
+		return ",discard=unmap"
+	}
+	return ""
+}
+
+func qemuArgs(d *Driver, uuid, mac, cmdline string) []string {
+	args := []string{
+		"-name", d.MachineName,
+		"-uuid", uuid,
+		"-accel", "hvf",
+		"-cpu", "host",
+		"-smp", strconv.Itoa(d.CPU),
+		"-m", strconv.Itoa(d.Memory),
+		"-kernel", d.BootKernel,
+		"-initrd", d.BootInitrd,
+		"-append", cmdline,
+		"-drive", "file=" + d.rootDisk() + ",format=raw,if=virtio" + qemuDiscard(d),
+		"-netdev", "vmnet-shared,id=net0",
+		"-device", "virtio-net-pci,netdev=net0,mac=" + mac,
+		// Appended to, so the log can be rotated while QEMU runs
+		"-chardev", "file,id=console,append=on,path=" + d.ResolveStorePath(consoleFileName),
+		"-serial", "chardev:console",
+		"-display", "none",
+		"-daemonize",
+		"-pidfile", d.ResolveStorePath(qemuPidFileName),
+	}
+	for _, disk := range d.extraDisks() {
+		args = append(args, "-drive", "file="+d.diskPath(disk)+",format=raw,if=virtio"+qemuDiscard(d))
+	}
+	for i, iso := range d.isoImages() {
+		args = append(args, "-drive", fmt.Sprintf("file=%s,media=cdrom,index=%d", iso, i+1))
+	}
+	if d.DisableACPI {
+		args = append(args, "-no-acpi")
+	}
+	if d.WiredMemory {
+		args = append(args, "-overcommit", "mem-lock=on")
+	}
+	return args
+}
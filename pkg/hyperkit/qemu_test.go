@@ -0,0 +1,67 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func Test_qemuBackend_macAddress(t *testing.T) {
+	uuids := []string{
+		"c4b6d5a0-0d6e-5d2a-9d3c-3f4c1b2a0e11",
+		"00000000-0000-0000-0000-000000000000",
+	}
+	for _, id := range uuids {
+		got, err := qemuBackend{}.macAddress(id)
+		if err != nil {
+			t.Fatalf("macAddress(%q) error = %v", id, err)
+		}
+		hw, err := net.ParseMAC(got)
+		if err != nil {
+			t.Fatalf("macAddress(%q) = %q, not a MAC: %v", id, got, err)
+		}
+		if hw[0]&0x01 != 0 || hw[0]&0x02 == 0 {
+			t.Errorf("macAddress(%q) = %q, want a locally administered unicast address", id, got)
+		}
+		if again, _ := (qemuBackend{}).macAddress(id); again != got {
+			t.Errorf("macAddress(%q) not stable: %q != %q", id, got, again)
+		}
+	}
+}
+
+func Test_qemuArgs_attachedISOs(t *testing.T) {
+	d := NewDriver("dev", "/store")
+	d.BaseDriver = &drivers.BaseDriver{MachineName: "dev", StorePath: "/store"}
+	d.AttachISOs = []string{"/isos/config.iso", "/isos/repo.iso"}
+
+	args := strings.Join(qemuArgs(d, "uuid", "mac", ""), " ")
+	for _, want := range []string{
+		"file=/store/machines/dev/boot2docker.iso,media=cdrom,index=1",
+		"file=/isos/config.iso,media=cdrom,index=2",
+		"file=/isos/repo.iso,media=cdrom,index=3",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("qemu args %q lack %q", args, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// GetIP returns the IP address of the machine, as GetState last reconciled
+// it
+func (d *Driver) GetIP() (string, error) {
+	if d.IPAddress == "" {
+		return "", errors.New("IP address is not set")
+	}
+	return d.IPAddress, nil
+}
+
+// reconcileIP re-resolves the IP address of the running machine when the
+// stored address stops accepting connections on the SSH port, e.g. because
+// the machine got a new lease after the host slept. The new address is kept
+// in memory only, docker-machine saves the config after the commands that
+// need it.
+func (d *Driver) reconcileIP() error {
+	if d.IPAddress == "" {
+		return nil
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return err
+	}
+	if dialable(net.JoinHostPort(d.IPAddress, fmt.Sprint(port))) {
+		return nil
+	}
+
+	ip, err := d.currentIP()
+	if err != nil {
+		return err
+	}
+	if ip == d.IPAddress {
+		return nil
+	}
+
+	d.IPAddress = ip
+	if d.StableHostname {
+		log.Infof("The IP address of %s changed to %s, pointing %s at it", d.MachineName, ip, d.stableHostname())
+		if err := d.updateHostsEntry(ip); err != nil {
+			log.Warnf("Unable to point %s at %s: %v", d.stableHostname(), ip, err)
+		}
+	} else {
+		log.Warnf("The IP address of %s changed to %s, run \"docker-machine regenerate-certs %s\" to update its certificates", d.MachineName, ip, d.MachineName)
+	}
+	return nil
+}
+
+// CertsStale reports whether the machine's Docker server certificate
+// doesn't cover its current IP address, which docker-machine
+// regenerate-certs fixes
+func (d *Driver) CertsStale() (bool, error) {
+	b, err := ioutil.ReadFile(d.ResolveStorePath("server.pem"))
+	if err != nil {
+		return false, err
+	}
+	cert, err := parseCertificate(b)
+	if err != nil {
+		return false, fmt.Errorf("server.pem: %w", err)
+	}
+	ip := net.ParseIP(d.IPAddress)
+	for _, certIP := range cert.IPAddresses {
+		if certIP.Equal(ip) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
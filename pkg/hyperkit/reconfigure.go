@@ -0,0 +1,142 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	// minMemory is the least memory, in MB, boot2docker boots with
+	minMemory = 512
+	// maxCPUs is the most vCPUs hyperkit gives a machine (VM_MAXCPU)
+	maxCPUs = 16
+	// minDiskSize is the least disk, in MB, worth running docker on
+	minDiskSize = 1000
+)
+
+// Reconfigure changes the CPUs and memory of the machine, keeping the
+// current value for zeros. The new values are validated and saved right
+// away, and a running machine is restarted to apply them, after unmounting
+// its NFS shares. It returns the changes, like "memory: 1024 MB -> 2048 MB".
+func (d *Driver) Reconfigure(cpus, memory int) ([]string, error) {
+	if err := d.verifyRootPermissions(); err != nil {
+		return nil, err
+	}
+	unlock, err := d.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	next := *d
+	if cpus != 0 {
+		next.CPU = cpus
+	}
+	if memory != 0 {
+		next.Memory = memory
+	}
+	if err := validateResources(next.CPU, next.Memory); err != nil {
+		return nil, err
+	}
+	var changes []string
+	if next.CPU != d.CPU {
+		changes = append(changes, fmt.Sprintf("cpus: %d -> %d", d.CPU, next.CPU))
+	}
+	if next.Memory != d.Memory {
+		changes = append(changes, fmt.Sprintf("memory: %d MB -> %d MB", d.Memory, next.Memory))
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	if err := next.checkHost(getHostInfo(d.StorePath)); err != nil {
+		return nil, err
+	}
+
+	d.CPU, d.Memory = next.CPU, next.Memory
+	if err := d.SaveConfig(); err != nil {
+		return nil, fmt.Errorf("saving config: %w", err)
+	}
+	log.Infof("Reconfigured %s: %s", d.MachineName, strings.Join(changes, ", "))
+
+	s, err := d.GetState()
+	if err != nil {
+		return changes, err
+	}
+	if s != state.Running {
+		return changes, nil
+	}
+	log.Infof("Restarting %s to apply the new configuration", d.MachineName)
+	d.unmountNFSShares()
+	if err := d.Stop(); err != nil {
+		return changes, fmt.Errorf("stopping: %w", err)
+	}
+	if err := d.Start(); err != nil {
+		return changes, fmt.Errorf("starting: %w", err)
+	}
+	return changes, d.SaveConfig()
+}
+
+func validateResources(cpus, memory int) error {
+	if cpus < 1 {
+		return fmt.Errorf("invalid CPU count %d, must be at least 1", cpus)
+	}
+	if cpus > maxCPUs {
+		return fmt.Errorf("invalid CPU count %d, hyperkit supports at most %d CPUs per machine", cpus, maxCPUs)
+	}
+	if memory < minMemory {
+		return fmt.Errorf("invalid memory size %d MB, must be at least %d MB for the guest to boot", memory, minMemory)
+	}
+	return nil
+}
+
+func validateDiskSize(size int) error {
+	if size < minDiskSize {
+		return fmt.Errorf("invalid disk size %d MB, must be at least %d MB to hold the guest's docker images and containers", size, minDiskSize)
+	}
+	return nil
+}
+
+// nfsMountPoints returns where the NFS shares are mounted in the guest
+func (d *Driver) nfsMountPoints() []string {
+	var mounts []string
+	for _, share := range d.NFSShares {
+		mounts = append(mounts, path.Join(d.NFSSharesRoot, parseNFSShare(share).subPath()))
+	}
+	return mounts
+}
+
+// unmountNFSShares unmounts the NFS shares in the guest, so nothing in the
+// guest holds on to them when the exports go away
+func (d *Driver) unmountNFSShares() {
+	mounts := d.nfsMountPoints()
+	if len(mounts) == 0 {
+		return
+	}
+	cmd := "sudo umount " + strings.Join(shellQuoteAll(mounts), " ")
+	if _, err := drivers.RunSSHCommandFromDriver(d, cmd); err != nil {
+		log.Warnf("Unable to unmount NFS shares: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateResources(t *testing.T) {
+	tests := []struct {
+		cpus, memory int
+		wantErr      bool
+	}{
+		{1, 1024, false},
+		{4, 512, false},
+		{0, 1024, true},
+		{2, 256, true},
+		{-2, 1024, true},
+		{16, 1024, false},
+		{17, 1024, true},
+		{2, -1024, true},
+	}
+	for _, tt := range tests {
+		if err := validateResources(tt.cpus, tt.memory); (err != nil) != tt.wantErr {
+			t.Errorf("validateResources(%d, %d) = %v, wantErr %v", tt.cpus, tt.memory, err, tt.wantErr)
+		}
+	}
+
+	if err := validateDiskSize(10); err == nil {
+		t.Error("validateDiskSize(10) accepted a 10 MB disk")
+	}
+	if err := validateDiskSize(defaultDiskSize); err != nil {
+		t.Errorf("validateDiskSize(%d) = %v", defaultDiskSize, err)
+	}
+}
+
+func TestNFSMountPoints(t *testing.T) {
+	d := &Driver{
+		NFSShares:     []string{"/Users", "src:code/src", "data"},
+		NFSSharesRoot: "/mnt",
+	}
+	want := []string{"/mnt/Users", "/mnt/code/src", "/mnt/data"}
+	if got := d.nfsMountPoints(); !reflect.DeepEqual(got, want) {
+		t.Errorf("nfsMountPoints() = %q, want %q", got, want)
+	}
+}
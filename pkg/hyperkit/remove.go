@@ -0,0 +1,106 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/log"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// driverArtifacts are the files the driver and the VM process create in the
+// machine directory, besides the disks and the boot files. The files of
+// docker-machine itself, like config.json and the certificates, are left to
+// docker-machine.
+var driverArtifacts = []string{
+	isoFilename,
+	isoFilename + ".prev",
+	isoFilename + ".next",
+	combinedInitrdFileName,
+	ignitionISOFileName,
+	machineFileName,
+	pidFileName,
+	qemuPidFileName,
+	consoleFileName,
+	consoleTTYFileName,
+	lastBootConsoleFileName,
+	diagnosticsFileName,
+	commandFileName,
+	wrapperFileName,
+	stopMarkerFileName,
+	supervisorPidFileName,
+	supervisorLogFileName,
+	autostartLogFileName,
+	balloonTargetFileName,
+	dockerSocketFileName,
+	sshVSockPortFileName,
+	metricsFileName,
+	eventsFileName,
+	hostKeysFileName,
+	fileServerPidFileName,
+	fileServerLogFileName,
+	fileServerConfigFileName,
+	spotlightMarkerFileName,
+	encryptedMountFileName,
+}
+
+// removeArtifacts deletes the disks, boot files and everything else the
+// driver created for the machine, rather than relying on the caller to
+// remove the machine directory. It returns the paths it couldn't remove.
+func (d *Driver) removeArtifacts() []string {
+	paths := append([]string{pkgdrivers.GetDiskPath(d.BaseDriver), d.ResolveStorePath(ephemeralDiskFileName)}, d.ownBootFiles()...)
+	for _, disk := range d.extraDisks() {
+		paths = append(paths, d.diskPath(disk))
+	}
+	for _, name := range driverArtifacts {
+		paths = append(paths, d.ResolveStorePath(name))
+	}
+	// Rotated console logs
+	if rotated, err := filepath.Glob(d.ResolveStorePath(consoleFileName) + ".*"); err == nil {
+		paths = append(paths, rotated...)
+	}
+
+	var failed []string
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Unable to remove %s: %v", path, err)
+			failed = append(failed, path)
+		}
+	}
+	return failed
+}
+
+// ownBootFiles returns the boot kernel and initrd if the driver extracted
+// them into the machine directory. Boot files elsewhere, which the config can
+// point anywhere, aren't the machine's to remove.
+func (d *Driver) ownBootFiles() []string {
+	dir := filepath.Clean(d.ResolveStorePath("."))
+	var files []string
+	for _, path := range []string{d.BootKernel, d.BootInitrd} {
+		if path != "" && filepath.Dir(filepath.Clean(path)) == dir {
+			files = append(files, path)
+		}
+	}
+	return files
+}
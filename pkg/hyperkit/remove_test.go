@@ -0,0 +1,74 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestRemoveArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Driver{
+		BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir},
+		ExtraDisks: []string{"cache:1000"},
+	}
+	d.BootKernel = d.ResolveStorePath("bzImage")
+	// A boot file outside the machine dir isn't the machine's
+	d.BootInitrd = filepath.Join(dir, "initrd.img")
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(d.BootInitrd, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	created := []string{"test.rawdisk", "disk-cache.rawdisk", "bzImage", machineFileName, consoleFileName, consoleFileName + ".1", supervisorLogFileName}
+	kept := []string{hostConfigFileName, "id_rsa", "server.pem"}
+	for _, name := range append(created, kept...) {
+		if err := ioutil.WriteFile(d.ResolveStorePath(name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if failed := d.removeArtifacts(); len(failed) > 0 {
+		t.Errorf("removeArtifacts() failed to remove %v", failed)
+	}
+	for _, name := range created {
+		if _, err := os.Stat(d.ResolveStorePath(name)); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", name)
+		}
+	}
+	for _, name := range kept {
+		if _, err := os.Stat(d.ResolveStorePath(name)); err != nil {
+			t.Errorf("docker-machine's %s removed: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(d.BootInitrd); err != nil {
+		t.Errorf("boot file outside the machine dir removed: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// consoleTTYFileName is the link to the guest console pty hyperkit creates
+// in the state dir with hyperkit.ConsoleFile
+const consoleTTYFileName = "tty"
+
+// consolePTYPrefix is where the ptys hyperkit creates for the console are
+const consolePTYPrefix = "/dev/ttys"
+
+var (
+	// clientCertFiles are copied from the store into the machine dir
+	clientCertFiles = []string{"ca.pem", "cert.pem", "key.pem"}
+	// serverCertFiles can only be regenerated by docker-machine
+	serverCertFiles = []string{"server.pem", "server-key.pem"}
+)
+
+// sshKeyMissing reports whether the machine's SSH key pair is gone, e.g.
+// after restoring the store from a backup that skipped it.
+func (d *Driver) sshKeyMissing() bool {
+	for _, path := range []string{d.GetSSHKeyPath(), d.GetSSHKeyPath() + ".pub"} {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// regenerateSSHKey replaces a missing SSH key pair with a new one
+func (d *Driver) regenerateSSHKey() error {
+	log.Warnf("SSH key %s is missing, generating a new one", d.GetSSHKeyPath())
+	os.Remove(d.GetSSHKeyPath())
+	os.Remove(d.GetSSHKeyPath() + ".pub")
+	return d.installSSHKey()
+}
+
+// chownSSHKey gives the SSH key pair the driver made as root to the user, who
+// needs it for docker-machine ssh
+func (d *Driver) chownSSHKey() error {
+	for _, path := range []string{d.GetSSHKeyPath(), d.GetSSHKeyPath() + ".pub"} {
+		if err := chownToCaller(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// injectSSHKey authorizes the current public key in the guest by typing
+// commands on the console, where boot2docker is logged in automatically.
+// The key is also added to the userdata archive boot2docker restores the
+// home directory from at boot.
+func (d *Driver) injectSSHKey() error {
+	pub, err := readCallerFile(d.GetSSHKeyPath()+".pub", 0)
+	if err != nil {
+		return err
+	}
+	tty, err := openConsoleTTY(d.ResolveStorePath(consoleTTYFileName))
+	if err != nil {
+		return fmt.Errorf("opening guest console: %w", err)
+	}
+	defer tty.Close()
+
+	key := strings.TrimSpace(string(pub))
+	script := fmt.Sprintf("\nmkdir -p ~/.ssh && echo %s > ~/.ssh/authorized_keys && chmod 700 ~/.ssh && chmod 600 ~/.ssh/authorized_keys"+
+		" && (cd ~ && sudo tar rf /var/lib/boot2docker/userdata.tar .ssh/authorized_keys)\n", shellQuote(key))
+	log.Info("Injecting the new SSH key into the guest over its console")
+	_, err = tty.Write([]byte(script))
+	return err
+}
+
+// openConsoleTTY opens the pty link points to for writing. The link is in the
+// machine dir, so it must lead to a pty, not to a file root would overwrite.
+func openConsoleTTY(link string) (*os.File, error) {
+	path, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(path, consolePTYPrefix) {
+		return nil, fmt.Errorf("%s points to %s, not a pty", link, path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NOFOLLOW|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a pty", path)
+	}
+	return f, nil
+}
+
+// repairCerts restores missing client certificates in the machine dir from
+// the store, and points out missing server certificates.
+func (d *Driver) repairCerts() {
+	for _, name := range clientCertFiles {
+		dst := d.ResolveStorePath(name)
+		if _, err := os.Stat(dst); !os.IsNotExist(err) {
+			continue
+		}
+		src := filepath.Join(d.StorePath, "certs", name)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		log.Warnf("%s is missing, restoring it from %s", dst, src)
+		// Read as the user, and not through a symlink they planted
+		b, err := readCallerFile(src, syscall.O_NOFOLLOW)
+		if err == nil {
+			err = writeFileAtomic(dst, b, 0600)
+		}
+		if err != nil {
+			log.Warnf("Unable to restore %s: %v", dst, err)
+		}
+	}
+	for _, name := range serverCertFiles {
+		if _, err := os.Stat(d.ResolveStorePath(name)); os.IsNotExist(err) {
+			log.Warnf("%s is missing, run \"docker-machine regenerate-certs %s\" to recreate it", name, d.MachineName)
+		}
+	}
+}
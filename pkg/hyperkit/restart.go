@@ -0,0 +1,147 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+const bootIDCommand = "cat /proc/sys/kernel/random/boot_id"
+
+// Restart a host. With --hyperkit-soft-restart a running machine is rebooted
+// by its guest, which keeps the hyperkit process, MAC address, IP address and
+// NFS exports. It is stopped and started again if that isn't possible.
+func (d *Driver) Restart() error {
+	if d.SoftRestart {
+		err := d.softRestart()
+		if err == nil {
+			return nil
+		}
+		log.Warnf("Soft restart of %s failed, restarting it fully: %v", d.MachineName, err)
+		if s, err := d.GetState(); err == nil && s == state.Stopped {
+			return d.Start()
+		}
+	}
+	return pkgdrivers.Restart(d)
+}
+
+// canSoftRestart reports why a machine in state s can't be rebooted by its
+// guest, if it can't
+func (d *Driver) canSoftRestart(s state.State) error {
+	if s != state.Running {
+		return fmt.Errorf("machine is %s", s)
+	}
+	if d.IPAddress == "" && !d.sshOverVSock() {
+		return fmt.Errorf("machine has no IP address to reach it over SSH")
+	}
+	return nil
+}
+
+// softRestart reboots the guest over SSH and waits for it to come back with a
+// new boot id, then mounts the NFS shares again.
+func (d *Driver) softRestart() error {
+	unlock, err := d.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	s, err := d.GetState()
+	if err != nil {
+		return err
+	}
+	if err := d.canSoftRestart(s); err != nil {
+		return err
+	}
+	pid := d.getPid()
+	bootID, err := drivers.RunSSHCommandFromDriver(d, bootIDCommand)
+	if err != nil {
+		return fmt.Errorf("reading the guest boot id: %w", err)
+	}
+
+	log.Infof("Rebooting %s", d.MachineName)
+	d.emit(eventRebooting, "")
+	if _, err := drivers.RunSSHCommandFromDriver(d, "sudo reboot"); err != nil {
+		// The connection is usually torn down by the reboot itself.
+		log.Debugf("reboot over SSH returned: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.WaitTimeout)*time.Second)
+	defer cancel()
+	err = poll(ctx, waitPollInterval, func() (bool, error) {
+		if s, err := d.GetState(); err == nil && s == state.Stopped {
+			return false, fmt.Errorf("hyperkit exited during the reboot")
+		}
+		if ready, err := d.sshReady(); err != nil || !ready {
+			return false, err
+		}
+		out, err := drivers.RunSSHCommandFromDriver(d, bootIDCommand)
+		if err != nil {
+			log.Debugf("Waiting for %s to reboot: %v", d.MachineName, err)
+			return false, nil
+		}
+		return strings.TrimSpace(out) != strings.TrimSpace(bootID), nil
+	})
+	if err != nil {
+		return fmt.Errorf("waiting for the guest to reboot: %w", err)
+	}
+	if newPid := d.getPid(); newPid != pid {
+		return fmt.Errorf("hyperkit process changed from %d to %d during the reboot", pid, newPid)
+	}
+	if d.Wait == waitDocker {
+		if err := d.WaitFor(ctx, WaitDockerReady, 0); err != nil {
+			return fmt.Errorf("machine never became %s: %w", WaitDockerReady, err)
+		}
+	}
+
+	if err := d.applyMTU(); err != nil {
+		return err
+	}
+	if d.TimeSync {
+		if err := d.syncClock(); err != nil {
+			log.Warnf("Unable to sync the guest clock: %v", err)
+		}
+	}
+	if len(d.NFSShares) > 0 {
+		if err := d.mountNFSShares(); err != nil {
+			return fmt.Errorf("mounting the NFS shares: %w", err)
+		}
+		d.emit(eventNFSMounted, strings.Join(d.NFSShares, " "))
+	}
+	d.emit(eventRunning, "")
+	log.Infof("Rebooted %s", d.MachineName)
+	return nil
+}
+
+// mountNFSShares mounts the already exported NFS shares in the guest again
+func (d *Driver) mountNFSShares() error {
+	hostIP, err := d.nfsHostIP()
+	if err != nil {
+		return err
+	}
+	_, err = d.mountShares(hostIP, d.NFSShares)
+	return err
+}
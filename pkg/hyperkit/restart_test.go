@@ -0,0 +1,63 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"net"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/state"
+)
+
+func TestCanSoftRestart(t *testing.T) {
+	tests := []struct {
+		state   state.State
+		ip      string
+		wantErr bool
+	}{
+		{state.Running, "192.168.64.2", false},
+		{state.Running, "", true},
+		{state.Stopped, "192.168.64.2", true},
+		{state.Paused, "192.168.64.2", true},
+	}
+	for _, tt := range tests {
+		d := &Driver{BaseDriver: &drivers.BaseDriver{IPAddress: tt.ip}}
+		if err := d.canSoftRestart(tt.state); (err != nil) != tt.wantErr {
+			t.Errorf("canSoftRestart(%s) with IP %q error = %v, wantErr %v", tt.state, tt.ip, err, tt.wantErr)
+		}
+	}
+}
+
+func TestNFSMountCommands(t *testing.T) {
+	d := &Driver{NFSSharesRoot: "/nfsshares", NFSFlags: "noacl,async"}
+	for _, tt := range []struct {
+		share, want string
+	}{
+		{"/Users", "sudo mkdir -p '/nfsshares//Users'\\nsudo mount -t nfs -o noacl,async '192.168.64.1:/Users' '/nfsshares//Users'\\n"},
+		{"/Users/me/src:src", "sudo mkdir -p '/nfsshares/src'\\nsudo mount -t nfs -o noacl,async '192.168.64.1:/Users/me/src' '/nfsshares/src'\\n"},
+		{"/Users/me/db:db:flags=vers=3,nolock", "sudo mkdir -p '/nfsshares/db'\\nsudo mount -t nfs -o vers=3,nolock '192.168.64.1:/Users/me/db' '/nfsshares/db'\\n"},
+		{"/Users/me/My Projects:projects", "sudo mkdir -p '/nfsshares/projects'\\nsudo mount -t nfs -o noacl,async '192.168.64.1:/Users/me/My Projects' '/nfsshares/projects'\\n"},
+	} {
+		s := parseNFSShare(tt.share)
+		if got := d.nfsMountCommands(net.ParseIP("192.168.64.1"), d.nfsSharePath(tt.share), s.subPath(), d.nfsMountFlags(s)); got != tt.want {
+			t.Errorf("nfsMountCommands for %s = %q, want %q", tt.share, got, tt.want)
+		}
+	}
+}
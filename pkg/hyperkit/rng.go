@@ -0,0 +1,82 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// rngDevice is hyperkit's virtio-rng device emulation
+	rngDevice = "virtio-rnd"
+	// rngSlot is the PCI slot of the rng, clear of the slots the hyperkit
+	// Go API hands out
+	rngSlot = 30
+	// guestRNGCommand lists the hardware rngs the guest kernel drives
+	guestRNGCommand = "cat /sys/class/misc/hw_random/rng_available 2>/dev/null || true"
+)
+
+// virtioRNG reports whether the machine gets a virtio-rng device, which
+// feeds the guest entropy pool from the host so boot doesn't stall on it. It
+// does unless the rng is disabled, the guest has no driver for it or the
+// hyperkit binary at hyperkitPath doesn't have it.
+func (d *Driver) virtioRNG(hyperkitPath string) bool {
+	if d.NoVirtioRNG || d.RNGUnsupported {
+		return false
+	}
+	if ok, err := hyperkitHasDevice(hyperkitPath, rngDevice); err != nil || !ok {
+		log.Debugf("%s has no %s device, not attaching it: %v", hyperkitPath, rngDevice, err)
+		return false
+	}
+	return true
+}
+
+func rngArgs() []string {
+	return []string{"-s", fmt.Sprintf("%d,%s", rngSlot, rngDevice)}
+}
+
+// checkGuestRNG stops attaching the rng to guests whose kernel has no
+// virtio-rng driver
+func (d *Driver) checkGuestRNG() {
+	if !d.rngAttached {
+		return
+	}
+	out, err := drivers.RunSSHCommandFromDriver(d, guestRNGCommand)
+	if err != nil {
+		log.Debugf("Unable to check the guest rng: %v", err)
+		return
+	}
+	if !guestHasVirtioRNG(out) {
+		log.Infof("The guest kernel of %s has no virtio-rng driver, no longer attaching %s", d.MachineName, rngDevice)
+		d.RNGUnsupported = true
+	}
+}
+
+func guestHasVirtioRNG(rngAvailable string) bool {
+	for _, rng := range strings.Fields(rngAvailable) {
+		if strings.HasPrefix(rng, "virtio_rng") {
+			return true
+		}
+	}
+	return false
+}
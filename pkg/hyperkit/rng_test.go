@@ -0,0 +1,79 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGuestHasVirtioRNG(t *testing.T) {
+	tests := []struct {
+		available string
+		want      bool
+	}{
+		{"virtio_rng.0\n", true},
+		{"tpm-rng virtio_rng.1 \n", true},
+		{"tpm-rng\n", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := guestHasVirtioRNG(tt.available); got != tt.want {
+			t.Errorf("guestHasVirtioRNG(%q) = %v, want %v", tt.available, got, tt.want)
+		}
+	}
+}
+
+func TestVirtioRNG(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	withRNG := filepath.Join(tmp, "hyperkit")
+	if err := ioutil.WriteFile(withRNG, []byte("virtio-net\x00virtio-rnd\x00"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	withoutRNG := filepath.Join(tmp, "hyperkit-stock")
+	if err := ioutil.WriteFile(withoutRNG, []byte("virtio-net\x00"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		driver Driver
+		binary string
+		want   bool
+	}{
+		{"default", Driver{}, withRNG, true},
+		{"disabled", Driver{NoVirtioRNG: true}, withRNG, false},
+		{"guest without a driver", Driver{RNGUnsupported: true}, withRNG, false},
+		{"hyperkit without the device", Driver{}, withoutRNG, false},
+		{"missing hyperkit", Driver{}, filepath.Join(tmp, "missing"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.driver.virtioRNG(tt.binary); got != tt.want {
+				t.Errorf("virtioRNG() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dataVolume is where macOS 10.15 and later keep the writable directories
+// of the read-only system volume, which nfsd exports them from
+const dataVolume = "/System/Volumes/Data"
+
+// firmlinks are the directories of the system volume that macOS links to
+// the data volume, from /usr/share/firmlinks. /Volumes is left out, as the
+// volumes mounted there are filesystems of their own.
+var firmlinks = []string{
+	"/Applications",
+	"/Library",
+	"/Users",
+	"/cores",
+	"/opt",
+	"/private",
+	"/usr/local",
+}
+
+const nfsShareFlagsPrefix = "flags="
+
+// nfsMountFlagsPattern matches the mount options a share may set
+var nfsMountFlagsPattern = regexp.MustCompile(`^[a-zA-Z0-9_.=-]+(,[a-zA-Z0-9_.=-]+)*$`)
+
+// nfsShareUnsafeChars can't appear in share paths, which end up quoted in
+// /etc/exports and in the guest mount script. Spaces are fine there.
+const nfsShareUnsafeChars = "\t\n\"'`\\$;&|<>*?"
+
+// normalizeNFSShares resolves the host paths of the shares, see
+// normalizeNFSShare, and rejects shares that export a path twice
+func normalizeNFSShares(shares []string) ([]string, error) {
+	var normalized []string
+	hostPaths := map[string]string{}
+	for _, share := range shares {
+		n, err := normalizeNFSShare(share)
+		if err != nil {
+			return nil, err
+		}
+		host := parseNFSShare(n).Host
+		for other, otherShare := range hostPaths {
+			if other == host || isSubPath(other, host) || isSubPath(host, other) {
+				return nil, fmt.Errorf("NFS shares %s and %s overlap, share only one of them", otherShare, share)
+			}
+		}
+		hostPaths[host] = share
+		normalized = append(normalized, n)
+	}
+	return normalized, nil
+}
+
+// nfsShare is a share in the host-path[:guest-subpath[:flags=<options>]]
+// format of --hyperkit-nfs-shares
+type nfsShare struct {
+	Host  string
+	Guest string
+	// Flags are the guest mount options, replacing NFSFlags
+	Flags string
+}
+
+func parseNFSShare(share string) nfsShare {
+	parts := strings.SplitN(share, ":", 3)
+	s := nfsShare{Host: parts[0]}
+	if len(parts) > 1 {
+		s.Guest = parts[1]
+	}
+	if len(parts) > 2 {
+		s.Flags = strings.TrimPrefix(parts[2], nfsShareFlagsPrefix)
+	}
+	return s
+}
+
+// subPath returns where the share is mounted below NFSSharesRoot
+func (s nfsShare) subPath() string {
+	if s.Guest != "" {
+		return s.Guest
+	}
+	return s.Host
+}
+
+func (s nfsShare) String() string {
+	parts := []string{s.Host}
+	if s.Guest != "" || s.Flags != "" {
+		parts = append(parts, s.subPath())
+	}
+	if s.Flags != "" {
+		parts = append(parts, nfsShareFlagsPrefix+s.Flags)
+	}
+	return strings.Join(parts, ":")
+}
+
+// normalizeNFSShare turns a share into the form the exports and mounts are
+// set up from. A host path starting with ~ is in the user's home directory,
+// one starting with ./ or ../ is relative to the working directory and other
+// relative paths stay in the machine dir. Host directories outside the
+// machine dir must exist, and are resolved to the real path nfsd exports.
+// Their guest subpath defaults to the path given.
+func normalizeNFSShare(share string) (string, error) {
+	if strings.ContainsAny(share, nfsShareUnsafeChars) {
+		return "", fmt.Errorf("NFS share %q must not contain tabs, newlines, quotes or shell special characters", share)
+	}
+	parts := strings.SplitN(share, ":", 3)
+	s := parseNFSShare(share)
+	if s.Host == "" {
+		return "", fmt.Errorf("NFS share %q has no host path", share)
+	}
+	// The guest subpath may only be left empty in front of flags
+	if len(parts) == 2 || s.Guest != "" {
+		if err := validateGuestSubPath(s.Guest); err != nil {
+			return "", fmt.Errorf("NFS share %q: %w", share, err)
+		}
+	}
+	if len(parts) > 2 {
+		if !strings.HasPrefix(parts[2], nfsShareFlagsPrefix) || !nfsMountFlagsPattern.MatchString(s.Flags) {
+			return "", fmt.Errorf("NFS share %q: mount options must be given as %s<option>[,<option>...]", share, nfsShareFlagsPrefix)
+		}
+	}
+
+	host := s.Host
+	switch {
+	case host == "~" || strings.HasPrefix(host, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		host = filepath.Join(home, strings.TrimPrefix(host, "~"))
+	case strings.HasPrefix(host, "~"):
+		return "", fmt.Errorf("NFS share %q: only ~ and ~/ are expanded", share)
+	case host == "." || host == ".." || strings.HasPrefix(host, "./") || strings.HasPrefix(host, "../"):
+		abs, err := filepath.Abs(host)
+		if err != nil {
+			return "", err
+		}
+		host = abs
+	case !filepath.IsAbs(host):
+		// In the machine dir, created when it is set up
+		if err := validateGuestSubPath(host); err != nil {
+			return "", fmt.Errorf("NFS share %q: %w", share, err)
+		}
+		return s.String(), nil
+	}
+
+	if s.Guest == "" {
+		s.Guest = filepath.Clean(host)
+	}
+	real, err := resolveSharePath(host)
+	if err != nil {
+		return "", fmt.Errorf("NFS share %s: %w", share, err)
+	}
+	s.Host = real
+	return s.String(), nil
+}
+
+// validateGuestSubPath checks the guest path of a share, which is below
+// the NFS root
+func validateGuestSubPath(p string) error {
+	if p == "" {
+		return fmt.Errorf("empty guest path")
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if elem == ".." {
+			return fmt.Errorf("guest path %s must stay below the NFS root", p)
+		}
+	}
+	return nil
+}
+
+// resolveSharePath returns the path nfsd exports the host directory p as,
+// with symlinks resolved and firmlinks replaced by the data volume
+func resolveSharePath(p string) (string, error) {
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(real)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", real)
+	}
+	if _, err := os.Stat(dataVolume); err == nil {
+		real = dataVolumePath(real)
+	}
+	return real, nil
+}
+
+// dataVolumePath returns the path of p on the data volume if it is in a
+// firmlinked directory
+func dataVolumePath(p string) string {
+	for _, link := range firmlinks {
+		if p == link || isSubPath(link, p) {
+			return dataVolume + p
+		}
+	}
+	return p
+}
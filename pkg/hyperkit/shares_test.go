@@ -0,0 +1,127 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDataVolumePath(t *testing.T) {
+	for p, want := range map[string]string{
+		"/Users/me/src":              "/System/Volumes/Data/Users/me/src",
+		"/Users":                     "/System/Volumes/Data/Users",
+		"/usr/local/src":             "/System/Volumes/Data/usr/local/src",
+		"/usr/bin":                   "/usr/bin",
+		"/UsersX":                    "/UsersX",
+		"/Volumes/External/src":      "/Volumes/External/src",
+		"/System/Volumes/Data/Users": "/System/Volumes/Data/Users",
+	} {
+		if got := dataVolumePath(p); got != want {
+			t.Errorf("dataVolumePath(%s) = %s, want %s", p, got, want)
+		}
+	}
+}
+
+func TestNormalizeNFSShares(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	spaced := filepath.Join(dir, "my src")
+	if err := os.Mkdir(spaced, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(src, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+
+	tests := []struct {
+		share   string
+		want    string
+		wantErr bool
+	}{
+		{"data", "data", false},
+		{"data:code/data", "data:code/data", false},
+		{src, src + ":" + src, false},
+		{link + ":src", src + ":src", false},
+		{"~/src", src + ":" + src, false},
+		{"~", dir + ":" + dir, false},
+		{"~root/src", "", true},
+		{filepath.Join(dir, "missing"), "", true},
+		{filepath.Join(dir, "file"), "", true},
+		{spaced + ":my src", spaced + ":my src", false},
+		{dir + "/my\tsrc", "", true},
+		{"data::flags=vers=3,nolock", "data:data:flags=vers=3,nolock", false},
+		{src + ":src:flags=ro", src + ":src:flags=ro", false},
+		{"~/src::flags=vers=3", src + ":" + src + ":flags=vers=3", false},
+		{"data:db:vers=3", "", true},
+		{"data:db:flags=", "", true},
+		{"data:db:flags=ro,,soft", "", true},
+		{"data:", "", true},
+		{"data:../etc", "", true},
+		{"data:a:b", "", true},
+		{"../data", "", true},
+		{"$(reboot)", "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeNFSShare(tt.share)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeNFSShare(%q) error = %v, wantErr %v", tt.share, err, tt.wantErr)
+			continue
+		}
+		if got != dataVolumePathIfPresent(tt.want) {
+			t.Errorf("normalizeNFSShare(%q) = %q, want %q", tt.share, got, tt.want)
+		}
+	}
+
+	if _, err := normalizeNFSShares([]string{src, "~/src/app:app"}); err == nil || !strings.Contains(err.Error(), "overlap") {
+		t.Errorf("nested shares not rejected: %v", err)
+	}
+	if _, err := normalizeNFSShares([]string{src, link + ":other"}); err == nil {
+		t.Error("the same directory shared twice through a symlink")
+	}
+}
+
+// dataVolumePathIfPresent maps share paths like resolveSharePath does on
+// the host running the test
+func dataVolumePathIfPresent(share string) string {
+	if _, err := os.Stat(dataVolume); err != nil || !filepath.IsAbs(share) {
+		return share
+	}
+	return dataVolumePath(share)
+}
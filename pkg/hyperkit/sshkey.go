@@ -0,0 +1,144 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/ssh"
+)
+
+// SSH key types generated with --hyperkit-ssh-key-type
+const (
+	sshKeyTypeRSA     = "rsa"
+	sshKeyTypeED25519 = "ed25519"
+)
+
+// ed25519KeyFileName replaces id_rsa in the machine dir for ed25519 keys
+const ed25519KeyFileName = "id_ed25519"
+
+// sshKeygenPath is the system's ssh-keygen, not whichever the PATH of the
+// invoking user has
+const sshKeygenPath = "/usr/bin/ssh-keygen"
+
+// sshUserPattern matches the user names the guest commands can be built with
+var sshUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*$`)
+
+func validateSSHUser(user string) error {
+	if len(user) > 32 || !sshUserPattern.MatchString(user) {
+		return fmt.Errorf("invalid SSH user %q, must start with a lowercase letter or underscore followed by at most 31 lowercase letters, digits, dots, dashes or underscores", user)
+	}
+	return nil
+}
+
+func validateSSHKeyType(keyType string) error {
+	switch keyType {
+	case sshKeyTypeRSA, sshKeyTypeED25519:
+		return nil
+	}
+	return fmt.Errorf("invalid SSH key type %q, must be %s or %s", keyType, sshKeyTypeRSA, sshKeyTypeED25519)
+}
+
+// validateSSHKey checks an existing private key given with --hyperkit-ssh-key
+func (d *Driver) validateSSHKey() error {
+	if err := validateSSHKeyType(d.SSHKeyType); err != nil {
+		return err
+	}
+	if d.SSHKey == "" {
+		return nil
+	}
+	if d.SSHKeyType != sshKeyTypeRSA {
+		return fmt.Errorf("--hyperkit-ssh-key-type only applies to generated keys, drop it or --hyperkit-ssh-key")
+	}
+	fi, err := os.Stat(d.SSHKey)
+	if err != nil {
+		return fmt.Errorf("SSH key: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("SSH key %s is not a file", d.SSHKey)
+	}
+	if err := checkCallerCanRead(d.SSHKey); err != nil {
+		return fmt.Errorf("SSH key: %w", err)
+	}
+	return nil
+}
+
+// installSSHKey puts the machine's SSH key pair at GetSSHKeyPath: a copy of
+// the key given with --hyperkit-ssh-key, or a newly generated one. Either
+// belongs to the user who invoked the driver.
+func (d *Driver) installSSHKey() error {
+	path := d.GetSSHKeyPath()
+	if d.SSHKey == "" {
+		if err := generateSSHKey(path, d.SSHKeyType); err != nil {
+			return err
+		}
+		return d.chownSSHKey()
+	}
+
+	log.Infof("Using SSH key %s", d.SSHKey)
+	if err := copyCallerFile(d.SSHKey, path, 0600); err != nil {
+		return fmt.Errorf("copying SSH key: %w", err)
+	}
+	if _, err := os.Stat(d.SSHKey + ".pub"); err == nil {
+		return copyCallerFile(d.SSHKey+".pub", path+".pub", 0644)
+	}
+	// -P "" makes a key with a passphrase fail rather than prompt for it
+	out, err := asCaller(exec.Command(sshKeygenPath, "-y", "-P", "", "-f", path)).Output()
+	if err != nil {
+		return fmt.Errorf("deriving the public key of %s, which must not have a passphrase: %w", d.SSHKey, err)
+	}
+	return writeFileAtomic(path+".pub", out, 0644)
+}
+
+// copyCallerFile copies src, which the user who invoked the driver must be
+// allowed to read, to a new file at dst that belongs to them. dst is
+// replaced by a rename, so a symlink there isn't followed.
+func copyCallerFile(src, dst string, perm os.FileMode) error {
+	if err := checkCallerCanRead(src); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(dst, b, perm)
+}
+
+// generateSSHKey generates a key pair of keyType without a passphrase at path
+// and path.pub, unless path exists
+func generateSSHKey(path, keyType string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	if keyType != sshKeyTypeED25519 {
+		return ssh.GenerateSSHKey(path)
+	}
+	log.Debugf("Generating ed25519 SSH key %s", path)
+	out, err := exec.Command(sshKeygenPath, "-q", "-t", sshKeyTypeED25519, "-N", "", "-C", "", "-f", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("generating ed25519 SSH key: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
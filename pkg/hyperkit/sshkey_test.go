@@ -0,0 +1,142 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestValidateSSHKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(key, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key, keyType string
+		wantErr      bool
+	}{
+		{"", sshKeyTypeRSA, false},
+		{"", sshKeyTypeED25519, false},
+		{"", "dsa", true},
+		{key, sshKeyTypeRSA, false},
+		{key, sshKeyTypeED25519, true},
+		{filepath.Join(dir, "missing"), sshKeyTypeRSA, true},
+		{dir, sshKeyTypeRSA, true},
+	}
+	for _, tt := range tests {
+		d := &Driver{SSHKey: tt.key, SSHKeyType: tt.keyType}
+		if err := d.validateSSHKey(); (err != nil) != tt.wantErr {
+			t.Errorf("validateSSHKey() with key %q of type %s error = %v, wantErr %v", tt.key, tt.keyType, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateSSHUser(t *testing.T) {
+	tests := []struct {
+		user  string
+		valid bool
+	}{
+		{"docker", true},
+		{"ubuntu", true},
+		{"_svc.ci-1", true},
+		{"", false},
+		{"Ubuntu", false},
+		{"1user", false},
+		{"me;reboot", false},
+		{strings.Repeat("a", 33), false},
+	}
+	for _, tt := range tests {
+		if err := validateSSHUser(tt.user); (err == nil) != tt.valid {
+			t.Errorf("validateSSHUser(%q) error = %v, want valid %v", tt.user, err, tt.valid)
+		}
+	}
+}
+
+func TestInstallSSHKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "shared")
+	if err := ioutil.WriteFile(key, []byte("private"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(key+".pub", []byte("public"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "machines", "test"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Driver{BaseDriver: &drivers.BaseDriver{MachineName: "test", StorePath: dir}, SSHKey: key}
+	if err := d.installSSHKey(); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{d.GetSSHKeyPath(): "private", d.GetSSHKeyPath() + ".pub": "public"} {
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", path, b, err, want)
+		}
+	}
+	if fi, err := os.Stat(d.GetSSHKeyPath()); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("private key mode = %v, %v, want 0600", fi.Mode(), err)
+	}
+}
+
+func TestGenerateED25519Key(t *testing.T) {
+	if _, err := os.Stat(sshKeygenPath); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ed25519KeyFileName)
+	if err := generateSSHKey(path, sshKeyTypeED25519); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ioutil.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(pub), "ssh-ed25519 ") {
+		t.Errorf("public key %q is not an ed25519 key", pub)
+	}
+	// An existing key is kept
+	if err := generateSSHKey(path, sshKeyTypeED25519); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := ioutil.ReadFile(path + ".pub"); string(again) != string(pub) {
+		t.Error("existing key was replaced")
+	}
+}
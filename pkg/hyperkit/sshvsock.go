@@ -0,0 +1,114 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// sshVSockHost is where the supervisor bridges SSH over vsock to
+const sshVSockHost = "127.0.0.1"
+
+// sshVSockPortFileName records the port Start picked for SSH over vsock, for
+// the supervisor
+const sshVSockPortFileName = "ssh-vsock.port"
+
+// sshOverVSock reports whether SSH goes through the vsock bridge because IP
+// discovery failed
+func (d *Driver) sshOverVSock() bool {
+	return d.SSHOverVSock && d.IPAddress == ""
+}
+
+// sshVSockBridge bridges VSockSSHPort on localhost to the guest agent, which
+// forwards it to the guest sshd
+func (d *Driver) sshVSockBridge() vsockBridge {
+	return vsockBridge{
+		toGuest:   true,
+		tcpAddr:   net.JoinHostPort(sshVSockHost, fmt.Sprint(d.VSockSSHPort)),
+		vsockPort: guestSSHPort,
+	}
+}
+
+// pickVSockSSHPort picks the port SSH over vsock is bridged on. That happens
+// at every start, a port that was free when the machine was created may be
+// taken by now. A supervisor that is still running keeps its port.
+func (d *Driver) pickVSockSSHPort() error {
+	if !d.SSHOverVSock || detachedPid(d.ResolveStorePath(supervisorPidFileName)) != 0 {
+		return nil
+	}
+	port, err := freeLocalPort()
+	if err != nil {
+		return fmt.Errorf("picking a port for SSH over vsock: %w", err)
+	}
+	d.VSockSSHPort = port
+	return ioutil.WriteFile(d.ResolveStorePath(sshVSockPortFileName), []byte(strconv.Itoa(port)), 0644)
+}
+
+// loadVSockSSHPort reads the port Start picked, which the supervisor doesn't
+// find in the config it loaded before Start saved it
+func (d *Driver) loadVSockSSHPort() {
+	b, err := ioutil.ReadFile(d.ResolveStorePath(sshVSockPortFileName))
+	if err != nil {
+		return
+	}
+	if port, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil {
+		d.VSockSSHPort = port
+	}
+}
+
+// freeLocalPort returns a TCP port on localhost nothing listens on
+func freeLocalPort() (int, error) {
+	l, err := net.Listen("tcp", net.JoinHostPort(sshVSockHost, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// fallBackToVSockSSH switches SSH to vsock after IP discovery failed with
+// err, and reports whether it did. That needs the guest agent installed by
+// an earlier boot.
+func (d *Driver) fallBackToVSockSSH(err error) bool {
+	if !d.SSHOverVSock {
+		return false
+	}
+	if !d.AgentInstalled {
+		log.Warnf("Not falling back to SSH over vsock, the guest agent isn't installed yet")
+		return false
+	}
+	// The supervisor serves the bridge from the start of the machine
+	log.Warnf("%v, reaching SSH over vsock on %s:%d instead", err, sshVSockHost, d.VSockSSHPort)
+	d.IPAddress = ""
+	return true
+}
+
+// dockerReadyOverSSH checks the docker daemon from inside the guest, for when
+// it isn't reachable over the network
+func (d *Driver) dockerReadyOverSSH() (bool, error) {
+	_, err := drivers.RunSSHCommandFromDriver(d, "sudo docker version >/dev/null")
+	return err == nil, nil
+}
@@ -0,0 +1,92 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+func TestSSHOverVSock(t *testing.T) {
+	d := &Driver{BaseDriver: &drivers.BaseDriver{IPAddress: "192.168.64.2", SSHPort: 22}}
+	d.SSHOverVSock = true
+	d.VSockSSHPort = 40022
+
+	if d.fallBackToVSockSSH(errors.New("no IP")) {
+		t.Fatal("fell back to SSH over vsock before the guest agent was installed")
+	}
+	if host, _ := d.GetSSHHostname(); host != "192.168.64.2" {
+		t.Errorf("GetSSHHostname() = %s with an IP address", host)
+	}
+
+	d.AgentInstalled = true
+	if !d.fallBackToVSockSSH(errors.New("no IP")) {
+		t.Fatal("didn't fall back to SSH over vsock")
+	}
+	host, _ := d.GetSSHHostname()
+	port, _ := d.GetSSHPort()
+	if host != sshVSockHost || port != 40022 {
+		t.Errorf("SSH goes to %s:%d, want %s:40022", host, port, sshVSockHost)
+	}
+	bridges, err := d.vsockBridges()
+	if err != nil || len(bridges) != 1 || bridges[0].String() != "tcp:127.0.0.1:40022=vsock:52003" {
+		t.Errorf("vsockBridges() = %v, %v", bridges, err)
+	}
+}
+
+func TestSSHOverVSockCustomPort(t *testing.T) {
+	d := &Driver{BaseDriver: &drivers.BaseDriver{SSHPort: 22}, SSHOverVSock: true}
+	if cmd := d.guestAgentInstallCommand(); strings.Contains(cmd, "-sshd-addr") {
+		t.Errorf("agent told where sshd listens on the default port: %s", cmd)
+	}
+	d.SSHPort = 2222
+	if cmd := d.guestAgentInstallCommand(); !strings.Contains(cmd, "-ssh-port 52003 -sshd-addr 127.0.0.1:2222") {
+		t.Errorf("agent not forwarding to sshd on port 2222: %s", cmd)
+	}
+}
+
+func TestPickVSockSSHPort(t *testing.T) {
+	store, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store)
+	d := &Driver{BaseDriver: &drivers.BaseDriver{StorePath: store, MachineName: "test"}, SSHOverVSock: true}
+	if err := os.MkdirAll(d.ResolveStorePath("."), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.pickVSockSSHPort(); err != nil {
+		t.Fatalf("pickVSockSSHPort() = %v", err)
+	}
+	if d.VSockSSHPort == 0 {
+		t.Fatal("no port picked")
+	}
+
+	// The supervisor loads the config saved before the start
+	supervisor := &Driver{BaseDriver: d.BaseDriver, SSHOverVSock: true}
+	supervisor.loadVSockSSHPort()
+	if supervisor.VSockSSHPort != d.VSockSSHPort {
+		t.Errorf("supervisor bridges port %d, Start picked %d", supervisor.VSockSSHPort, d.VSockSSHPort)
+	}
+}
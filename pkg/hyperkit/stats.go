@@ -0,0 +1,106 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/state"
+	pkgdrivers "github.com/mtibben/docker-machine-driver-hyperkit/pkg/drivers"
+)
+
+// Stats is what a machine costs the host. The process fields are zero while
+// the machine is stopped.
+type Stats struct {
+	Pid int `json:"pid,omitempty"`
+	// CPUPercent is the share of one host core, averaged by ps over the
+	// recent past
+	CPUPercent float64       `json:"cpu_percent"`
+	RSSBytes   int64         `json:"rss_bytes"`
+	Uptime     time.Duration `json:"uptime_ns"`
+	// DiskApparentBytes is the size of the disk image as the guest sees
+	// it, DiskActualBytes the host space it takes as a sparse file
+	DiskApparentBytes int64 `json:"disk_apparent_bytes"`
+	DiskActualBytes   int64 `json:"disk_actual_bytes"`
+}
+
+func (s Stats) String() string {
+	var b strings.Builder
+	if s.Pid != 0 {
+		fmt.Fprintf(&b, "pid:    %d\n", s.Pid)
+		fmt.Fprintf(&b, "cpu:    %.1f%%\n", s.CPUPercent)
+		fmt.Fprintf(&b, "memory: %s\n", formatBytes(s.RSSBytes))
+		fmt.Fprintf(&b, "uptime: %s\n", s.Uptime)
+	}
+	fmt.Fprintf(&b, "disk:   %s used of %s\n", formatBytes(s.DiskActualBytes), formatBytes(s.DiskApparentBytes))
+	return b.String()
+}
+
+// Stats reports the host CPU, memory and disk use of the machine
+func (d *Driver) Stats() (Stats, error) {
+	var stats Stats
+	disk := pkgdrivers.GetDiskPath(d.BaseDriver)
+	fi, err := os.Stat(disk)
+	if err != nil {
+		return stats, err
+	}
+	stats.DiskApparentBytes = fi.Size()
+	stats.DiskActualBytes = allocatedBytes(disk)
+
+	if s, err := d.GetState(); err != nil || s != state.Running {
+		return stats, err
+	}
+	pid := d.getPid()
+	cmd := exec.Command("/bin/ps", "-o", "%cpu=", "-o", "rss=", "-p", strconv.Itoa(pid))
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return stats, fmt.Errorf("ps %d: %w", pid, err)
+	}
+	if stats.CPUPercent, stats.RSSBytes, err = parseProcessStats(string(out)); err != nil {
+		return stats, err
+	}
+	if id, err := lookupProcessIdentity(pid); err == nil {
+		stats.Uptime = time.Since(id.StartTime).Round(time.Second)
+	}
+	stats.Pid = pid
+	return stats, nil
+}
+
+// parseProcessStats parses the %cpu and rss (in KiB) columns of ps(1)
+func parseProcessStats(out string) (float64, int64, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unable to parse ps output: %q", out)
+	}
+	cpu, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing cpu: %w", err)
+	}
+	rss, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("parsing rss: %w", err)
+	}
+	return cpu, rss * 1024, nil
+}
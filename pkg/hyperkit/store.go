@@ -0,0 +1,238 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/drivers"
+)
+
+// hostConfigFileName is the file docker-machine persists a host to
+const hostConfigFileName = "config.json"
+
+// LoadDriver loads the driver of an existing machine from the docker-machine
+// store at storePath, for operations that run outside of docker-machine.
+func LoadDriver(storePath, machineName string) (*Driver, error) {
+	path := filepath.Join(storePath, "machines", machineName, hostConfigFileName)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading machine config: %w", err)
+	}
+
+	host := struct {
+		DriverName string
+		Driver     json.RawMessage
+	}{}
+	if err := json.Unmarshal(b, &host); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	d := NewDriver(machineName, storePath)
+	if host.DriverName != d.DriverName() {
+		return nil, fmt.Errorf("machine %s uses the %s driver, not %s", machineName, host.DriverName, d.DriverName())
+	}
+	d.BaseDriver = &drivers.BaseDriver{
+		MachineName: machineName,
+		StorePath:   storePath,
+	}
+	if err := json.Unmarshal(host.Driver, d); err != nil {
+		return nil, fmt.Errorf("decoding driver config in %s: %w", path, err)
+	}
+	return d, nil
+}
+
+// MachineRef locates a hyperkit machine in one of several stores
+type MachineRef struct {
+	Name      string
+	StorePath string
+	// Ambiguous is set when another store has a machine with the same name
+	Ambiguous bool
+}
+
+// QualifiedName returns a name that identifies the machine across stores
+func (m MachineRef) QualifiedName() string {
+	if !m.Ambiguous {
+		return m.Name
+	}
+	return m.Name + "@" + m.StorePath
+}
+
+// ListMachines returns the hyperkit machines of all stores, flagging names
+// that exist in more than one of them.
+func ListMachines(storePaths []string) ([]MachineRef, error) {
+	var refs []MachineRef
+	count := map[string]int{}
+	for _, storePath := range storePaths {
+		dirs, err := ioutil.ReadDir(filepath.Join(storePath, "machines"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if !dir.IsDir() {
+				continue
+			}
+			if _, err := LoadDriver(storePath, dir.Name()); err != nil {
+				// Not a hyperkit machine, or not one we can read
+				continue
+			}
+			refs = append(refs, MachineRef{Name: dir.Name(), StorePath: storePath})
+			count[dir.Name()]++
+		}
+	}
+	for i := range refs {
+		refs[i].Ambiguous = count[refs[i].Name] > 1
+	}
+	return refs, nil
+}
+
+// ResolveMachine finds the machine called name in the given stores. Names
+// that exist in several stores must be qualified as name@store-path.
+func ResolveMachine(storePaths []string, name string) (MachineRef, error) {
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		return MachineRef{Name: name[:i], StorePath: name[i+1:]}, nil
+	}
+
+	refs, err := ListMachines(storePaths)
+	if err != nil {
+		return MachineRef{}, err
+	}
+	var found []MachineRef
+	for _, ref := range refs {
+		if ref.Name == name {
+			found = append(found, ref)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return MachineRef{}, fmt.Errorf("machine %s not found in %s", name, strings.Join(storePaths, ", "))
+	case 1:
+		return found[0], nil
+	}
+	var candidates []string
+	for _, ref := range found {
+		candidates = append(candidates, ref.QualifiedName())
+	}
+	return MachineRef{}, fmt.Errorf("machine name %s is ambiguous, use one of %s", name, strings.Join(candidates, ", "))
+}
+
+// LoadMachine resolves name across the stores and loads its driver
+func LoadMachine(storePaths []string, name string) (*Driver, error) {
+	ref, err := ResolveMachine(storePaths, name)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDriver(ref.StorePath, ref.Name)
+}
+
+// CreateMachine creates a machine in the store at storePath outside of
+// docker-machine. settings use the names of the machine's config.json and
+// default to the values of the driver flags.
+func CreateMachine(storePath, name string, settings map[string]interface{}) (*Driver, error) {
+	d, err := newMachine(storePath, name, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	machineDir := filepath.Join(storePath, "machines", name)
+	if err := os.MkdirAll(machineDir, 0700); err != nil {
+		return nil, err
+	}
+	host := map[string]interface{}{
+		"ConfigVersion": 3,
+		"Name":          name,
+		"DriverName":    d.DriverName(),
+		"Driver":        d,
+	}
+	b, err := json.MarshalIndent(host, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(machineDir, hostConfigFileName), b, 0600); err != nil {
+		return nil, err
+	}
+
+	createErr := d.Create()
+	// Save what Create learnt, like the boot files and the IP address, even
+	// if it failed half way
+	if err := d.SaveConfig(); err != nil && createErr == nil {
+		return nil, err
+	}
+	return d, createErr
+}
+
+// PlanMachine returns what CreateMachine would do with the same arguments,
+// without creating anything
+func PlanMachine(storePath, name string, settings map[string]interface{}) (*Plan, error) {
+	d, err := newMachine(storePath, name, settings)
+	if err != nil {
+		return nil, err
+	}
+	return d.Plan()
+}
+
+// newMachine returns the validated driver of a machine yet to be created
+func newMachine(storePath, name string, settings map[string]interface{}) (*Driver, error) {
+	if err := validateMachineName(name); err != nil {
+		return nil, err
+	}
+	machineDir := filepath.Join(storePath, "machines", name)
+	if _, err := os.Stat(machineDir); err == nil {
+		return nil, fmt.Errorf("machine %s already exists in %s", name, storePath)
+	}
+
+	d := NewDriver(name, storePath)
+	d.BaseDriver = &drivers.BaseDriver{
+		MachineName: name,
+		StorePath:   storePath,
+	}
+	// Without command line flags, start from the defaults file of the store
+	// and the profile of the settings
+	if profile, ok := settings["Profile"].(string); ok {
+		d.Profile = profile
+	}
+	if err := d.SetConfigFromFlags(nil); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, fmt.Errorf("invalid machine settings: %w", err)
+	}
+	if err := d.validateConfig(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SaveConfig persists the driver config of a machine managed outside of
+// docker-machine, e.g. after Start changed its IP address.
+func (d *Driver) SaveConfig() error {
+	return d.saveDriverConfig(d)
+}
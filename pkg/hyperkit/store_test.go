@@ -0,0 +1,94 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeMachine(t *testing.T, storePath, name, driverName string) {
+	dir := filepath.Join(storePath, "machines", name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	config := `{"DriverName": "` + driverName + `", "Driver": {"MachineName": "` + name + `", "CPU": 2}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, hostConfigFileName), []byte(config), 0644); err != nil {
+		t.Fatalf("writefile: %v", err)
+	}
+}
+
+func Test_ResolveMachine(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	personal := filepath.Join(tmpdir, "personal")
+	project := filepath.Join(tmpdir, "project")
+	writeMachine(t, personal, "default", "hyperkit")
+	writeMachine(t, personal, "dev", "hyperkit")
+	writeMachine(t, personal, "vbox", "virtualbox")
+	writeMachine(t, project, "default", "hyperkit")
+	stores := []string{personal, project}
+
+	refs, err := ListMachines(stores)
+	if err != nil {
+		t.Fatalf("ListMachines() error = %v", err)
+	}
+	if len(refs) != 3 {
+		t.Errorf("ListMachines() returned %d machines, want 3", len(refs))
+	}
+
+	tests := []struct {
+		name      string
+		machine   string
+		wantStore string
+		wantErr   bool
+	}{
+		{"unique", "dev", personal, false},
+		{"ambiguous", "default", "", true},
+		{"qualified", "default@" + project, project, false},
+		{"other_driver", "vbox", "", true},
+		{"missing", "nope", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveMachine(stores, tt.machine)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveMachine() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.StorePath != tt.wantStore {
+				t.Errorf("ResolveMachine() store = %v, want %v", got.StorePath, tt.wantStore)
+			}
+		})
+	}
+
+	d, err := LoadMachine(stores, "dev")
+	if err != nil {
+		t.Fatalf("LoadMachine() error = %v", err)
+	}
+	if d.CPU != 2 || d.StorePath != personal {
+		t.Errorf("LoadMachine() = CPU %d store %s, want CPU 2 store %s", d.CPU, d.StorePath, personal)
+	}
+}
@@ -0,0 +1,253 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	stopMarkerFileName    = "stop-requested"
+	supervisorPidFileName = "supervisor.pid"
+	supervisorLogFileName = "supervisor.log"
+	superviseInterval     = 5 * time.Second
+	// A machine that keeps crashing is restarted after restartBackoffMin at
+	// first, doubling up to restartBackoffMax. Once it stays up for
+	// restartBackoffReset it's restarted right away again.
+	restartBackoffMin   = 5 * time.Second
+	restartBackoffMax   = 5 * time.Minute
+	restartBackoffReset = 10 * time.Minute
+)
+
+// restartBackoff spaces out the restarts of a machine that keeps crashing
+type restartBackoff struct {
+	delay time.Duration
+	next  time.Time
+}
+
+// crashed records a crash at now and returns when to restart the machine
+func (b *restartBackoff) crashed(now time.Time) time.Time {
+	b.delay *= 2
+	if b.delay < restartBackoffMin {
+		b.delay = restartBackoffMin
+	}
+	if b.delay > restartBackoffMax {
+		b.delay = restartBackoffMax
+	}
+	b.next = now.Add(b.delay)
+	return b.next
+}
+
+// running records the machine running at now
+func (b *restartBackoff) running(now time.Time) {
+	if b.delay != 0 && now.Sub(b.next) >= restartBackoffReset {
+		b.delay = 0
+	}
+}
+
+// Supervise watches the hyperkit process and restarts the machine with its
+// persisted config whenever it dies without having been stopped through the
+// driver. While the machine runs, it also does the periodic work its settings
+// call for. It returns once the machine is stopped or ctx is done.
+func (d *Driver) Supervise(ctx context.Context) error {
+	pidFile := d.ResolveStorePath(supervisorPidFileName)
+	if err := writeFileAtomic(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return fmt.Errorf("writing supervisor pid file: %w", err)
+	}
+	defer os.Remove(pidFile)
+
+	log.Infof("Supervising machine %s", d.MachineName)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.loadVSockSSHPort()
+	if err := d.runVSockBridges(ctx); err != nil {
+		return err
+	}
+	var mdns mdnsPublisher
+	defer mdns.stop()
+	interval := d.superviseInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastTick, lastClockCheck, lastBalloon := time.Now(), time.Now(), time.Time{}
+	var backoff restartBackoff
+	var restartAt time.Time
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now = <-ticker.C:
+		}
+		slept := hostSlept(lastTick, now, interval)
+		lastTick = now
+
+		if d.stopRequested() {
+			log.Infof("Machine %s was stopped, no longer supervising it", d.MachineName)
+			return nil
+		}
+		s, err := d.GetState()
+		if err != nil {
+			warnings.Warnf("Error getting machine state: %v", err)
+			continue
+		}
+		if s == state.Running {
+			backoff.running(now)
+			restartAt = time.Time{}
+			if d.TimeSync && (slept || now.Sub(lastClockCheck) >= timeSyncInterval) {
+				d.checkClock()
+				lastClockCheck = now
+			}
+			if d.Balloon && now.Sub(lastBalloon) >= balloonInterval {
+				d.resizeBalloon()
+				lastBalloon = now
+			}
+			if d.MDNS {
+				d.updateMDNS(&mdns)
+			}
+			d.reapplyProxy(now)
+			continue
+		}
+		if restartAt.IsZero() {
+			mdns.stop()
+			reason := d.crashReason()
+			d.emit(eventCrashed, reason)
+			d.updateMetrics(func(m *machineMetrics) { m.Crashes++ })
+			if !d.Supervised && !d.Autostart {
+				log.Infof("Machine %s is no longer running", d.MachineName)
+				d.detachEncryptedDisk()
+				return nil
+			}
+			restartAt = backoff.crashed(now)
+			log.Warnf("hyperkit exited unexpectedly (%s), restarting machine %s in %s", reason, d.MachineName, restartAt.Sub(now))
+		}
+		if now.Before(restartAt) {
+			continue
+		}
+
+		restartAt = time.Time{}
+		if err := d.StartContext(ctx); err != nil {
+			log.Errorf("Restarting machine %s failed: %v", d.MachineName, err)
+		}
+	}
+}
+
+func (d *Driver) crashReason() string {
+	path, err := d.saveConsoleTail()
+	if err != nil {
+		return "no console output available"
+	}
+	return "last console output saved to " + path
+}
+
+// requestStop records that the machine is being stopped on purpose, so the
+// supervisor doesn't bring it back.
+func (d *Driver) requestStop() {
+	if err := writeFileAtomic(d.ResolveStorePath(stopMarkerFileName), nil, 0644); err != nil {
+		log.Warnf("Unable to write stop marker: %v", err)
+	}
+}
+
+func (d *Driver) stopRequested() bool {
+	_, err := os.Stat(d.ResolveStorePath(stopMarkerFileName))
+	return err == nil
+}
+
+func (d *Driver) clearStopRequest() {
+	if err := os.Remove(d.ResolveStorePath(stopMarkerFileName)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Unable to remove stop marker: %v", err)
+	}
+}
+
+// needsSupervisor reports whether the machine has anything for the
+// supervisor to do
+func (d *Driver) needsSupervisor() bool {
+	return d.Supervised || d.Autostart || d.TimeSync || d.Balloon || len(d.VSockBridges) > 0 || d.SSHOverVSock || d.MDNS || len(d.proxyEnv()) > 0 || d.EncryptDisk
+}
+
+// detachedPid returns the pid in pidFile, written by a detached process of
+// the driver like the supervisor, if that process still runs, or 0
+func detachedPid(pidFile string) int {
+	fi, err := os.Stat(pidFile)
+	if err != nil {
+		return 0
+	}
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0
+	}
+	id, err := lookupProcessIdentity(pid)
+	if err != nil {
+		return 0
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return 0
+	}
+	// Once the process exited the OS can hand its pid to a process started
+	// after the pid file was written
+	if filepath.Base(id.Path) != filepath.Base(exe) || id.StartTime.After(fi.ModTime()) {
+		return 0
+	}
+	return pid
+}
+
+// startSupervisor launches a detached "supervise" process for this machine,
+// unless one is already running.
+func (d *Driver) startSupervisor() error {
+	if pid := detachedPid(d.ResolveStorePath(supervisorPidFileName)); pid != 0 {
+		log.Debugf("Machine is already supervised by pid %d", pid)
+		return nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logFile, err := openCallerFile(d.ResolveStorePath(supervisorLogFileName))
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(exe, "supervise", "-storage-path", d.StorePath, d.MachineName)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting supervisor: %w", err)
+	}
+	log.Debugf("Started supervisor with pid %d", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
@@ -0,0 +1,82 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	var b restartBackoff
+	now := time.Now()
+	want := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second}
+	for i, delay := range want {
+		if got := b.crashed(now).Sub(now); got != delay {
+			t.Errorf("crash %d: restart after %s, want %s", i, got, delay)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		b.crashed(now)
+	}
+	if got := b.crashed(now).Sub(now); got != restartBackoffMax {
+		t.Errorf("restart after %s, want at most %s", got, restartBackoffMax)
+	}
+
+	b.running(now.Add(time.Minute))
+	if got := b.crashed(now).Sub(now); got != restartBackoffMax {
+		t.Errorf("restart after %s when the machine ran briefly, want %s", got, restartBackoffMax)
+	}
+	b.running(now.Add(restartBackoffMax + restartBackoffReset))
+	if got := b.crashed(now).Sub(now); got != restartBackoffMin {
+		t.Errorf("restart after %s once the machine stayed up, want %s", got, restartBackoffMin)
+	}
+}
+
+func TestDetachedPid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, supervisorPidFileName)
+
+	if pid := detachedPid(pidFile); pid != 0 {
+		t.Errorf("detachedPid() = %d without a pid file", pid)
+	}
+	if err := ioutil.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pid := detachedPid(pidFile); pid != os.Getpid() {
+		t.Errorf("detachedPid() = %d, want the running process %d", pid, os.Getpid())
+	}
+
+	// A pid file older than the process with its pid is stale
+	old := time.Now().Add(-24 * time.Hour)
+	if err := os.Chtimes(pidFile, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if pid := detachedPid(pidFile); pid != 0 {
+		t.Errorf("detachedPid() = %d for a pid the process got after the pid file was written", pid)
+	}
+}
@@ -0,0 +1,82 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// timeSyncInterval is how often the supervisor checks the guest clock
+	timeSyncInterval = time.Minute
+	// maxClockSkew is how far the guest clock may drift before it is reset
+	maxClockSkew = 2 * time.Second
+)
+
+// clockSkew returns how far the guest clock is behind the host clock
+func (d *Driver) clockSkew() (time.Duration, error) {
+	out, err := drivers.RunSSHCommandFromDriver(d, "date +%s")
+	if err != nil {
+		return 0, fmt.Errorf("reading guest clock: %w", err)
+	}
+	guest, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing guest clock %q: %w", out, err)
+	}
+	return time.Since(time.Unix(guest, 0)).Round(time.Second), nil
+}
+
+// syncClock sets the guest clock to the host clock
+func (d *Driver) syncClock() error {
+	cmd := fmt.Sprintf("sudo date -u -s @%d", time.Now().Unix())
+	if _, err := drivers.RunSSHCommandFromDriver(d, cmd); err != nil {
+		return fmt.Errorf("setting guest clock: %w", err)
+	}
+	return nil
+}
+
+// checkClock resets the guest clock if it drifted, typically after the host
+// slept
+func (d *Driver) checkClock() {
+	skew, err := d.clockSkew()
+	if err != nil {
+		warnings.Warnf("Unable to check the guest clock: %v", err)
+		return
+	}
+	if skew < maxClockSkew && skew > -maxClockSkew {
+		return
+	}
+	log.Infof("Guest clock of %s is off by %s, resetting it", d.MachineName, skew)
+	if err := d.syncClock(); err != nil {
+		warnings.Warnf("%v", err)
+	}
+}
+
+// hostSlept reports whether the host was asleep between two ticks of a
+// ticker with the given interval. The wall clock keeps running while the
+// host sleeps, unlike the monotonic clock.
+func hostSlept(last, now time.Time, interval time.Duration) bool {
+	return now.Round(0).Sub(last.Round(0)) > 2*interval
+}
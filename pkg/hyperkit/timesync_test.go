@@ -0,0 +1,44 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_hostSlept(t *testing.T) {
+	last := time.Date(2026, time.October, 16, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"on_time", last.Add(5 * time.Second), false},
+		{"late_tick", last.Add(9 * time.Second), false},
+		{"slept", last.Add(30 * time.Minute), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hostSlept(last, tt.now, 5*time.Second); got != tt.want {
+				t.Errorf("hostSlept() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
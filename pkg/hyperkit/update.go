@@ -0,0 +1,234 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/docker/machine/libmachine/state"
+)
+
+// UpdateKind describes when a config change takes effect
+type UpdateKind string
+
+const (
+	// UpdateLive changes take effect immediately
+	UpdateLive UpdateKind = "live"
+	// UpdateRestart changes take effect the next time the machine starts
+	UpdateRestart UpdateKind = "restart"
+)
+
+// configUpdateKinds lists the driver settings that can be changed once the
+// machine has been created, and when the change takes effect. Everything
+// else, like identities, paths and commands the driver runs, is fixed.
+var configUpdateKinds = map[string]UpdateKind{
+	"SSHUser":         UpdateLive,
+	"SSHPort":         UpdateLive,
+	"ShutdownTimeout": UpdateLive,
+	"StopTimeout":     UpdateLive,
+	"KillTimeout":     UpdateLive,
+	"IPTimeout":       UpdateLive,
+	"IPPollInterval":  UpdateLive,
+	"Wait":            UpdateLive,
+	"WaitTimeout":     UpdateLive,
+	"DiskIOPriority":  UpdateLive,
+	"SoftRestart":     UpdateLive,
+	"CPU":             UpdateRestart,
+	"Memory":          UpdateRestart,
+	"Cmdline":         UpdateRestart,
+	"NFSShares":       UpdateRestart,
+	"NFSSharesRoot":   UpdateRestart,
+	"NFSFlags":        UpdateRestart,
+	"NFSHostIP":       UpdateRestart,
+	"NFSInterface":    UpdateRestart,
+	"ShareBackend":    UpdateRestart,
+	"VSockPorts":      UpdateRestart,
+	"VSockBridges":    UpdateRestart,
+	"DockerVSock":     UpdateRestart,
+	"SSHOverVSock":    UpdateRestart,
+	"StableHostname":  UpdateRestart,
+	"MDNS":            UpdateRestart,
+	"HTTPProxy":       UpdateRestart,
+	"HTTPSProxy":      UpdateRestart,
+	"NoProxy":         UpdateRestart,
+	"Autostart":       UpdateRestart,
+	"Events":          UpdateRestart,
+	"Supervised":      UpdateRestart,
+	"DisableACPI":     UpdateRestart,
+	"HaltExit":        UpdateRestart,
+	"PauseExit":       UpdateRestart,
+	"PowerSave":       UpdateRestart,
+	"WiredMemory":     UpdateRestart,
+	"PreferIPv6":      UpdateRestart,
+	"MTU":             UpdateRestart,
+	"TimeSync":        UpdateRestart,
+	"ConsoleMaxSize":  UpdateRestart,
+	"ConsoleMaxFiles": UpdateRestart,
+	"GuestAgent":      UpdateRestart,
+	"Balloon":         UpdateRestart,
+	"NoVirtioRNG":     UpdateRestart,
+	"ProvisionAlways": UpdateRestart,
+	"DiskTrim":        UpdateRestart,
+}
+
+// ConfigChange describes a single changed setting
+type ConfigChange struct {
+	Name string
+	Old  interface{}
+	New  interface{}
+	Kind UpdateKind
+	// RestartRequired is set when the machine runs with the old value
+	RestartRequired bool
+}
+
+// UpdateConfig changes the settings of an existing machine, keyed by their
+// name in the machine's config.json. The changes are validated, rejected if
+// they touch settings fixed at creation, and persisted atomically. The
+// returned changes report which ones only apply after a restart.
+func (d *Driver) UpdateConfig(settings map[string]interface{}) ([]ConfigChange, error) {
+	current, err := driverSettings(d)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *d
+	base := *d.BaseDriver
+	updated.BaseDriver = &base
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &updated); err != nil {
+		return nil, fmt.Errorf("invalid settings: %w", err)
+	}
+	if err := updated.validateConfig(); err != nil {
+		return nil, err
+	}
+	next, err := driverSettings(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := d.GetState()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes []ConfigChange
+	for _, name := range names {
+		if _, ok := current[name]; !ok {
+			return nil, fmt.Errorf("unknown setting %s", name)
+		}
+		if reflect.DeepEqual(current[name], next[name]) {
+			continue
+		}
+		kind, ok := configUpdateKinds[name]
+		if !ok {
+			return nil, fmt.Errorf("%s can't be changed after the machine has been created", name)
+		}
+		changes = append(changes, ConfigChange{
+			Name:            name,
+			Old:             current[name],
+			New:             next[name],
+			Kind:            kind,
+			RestartRequired: kind == UpdateRestart && s == state.Running,
+		})
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if err := d.saveDriverConfig(&updated); err != nil {
+		return nil, err
+	}
+	*d = updated
+	return changes, nil
+}
+
+// driverSettings returns the persisted settings of d by name
+func driverSettings(d *Driver) (map[string]interface{}, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	settings := map[string]interface{}{}
+	return settings, json.Unmarshal(b, &settings)
+}
+
+// saveDriverConfig replaces the driver section of the machine's config.json
+// with updated, keeping the rest of the file intact.
+func (d *Driver) saveDriverConfig(updated *Driver) error {
+	path := d.ResolveStorePath(hostConfigFileName)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading machine config: %w", err)
+	}
+	host := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &host); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	if host["Driver"], err = json.Marshal(updated); err != nil {
+		return err
+	}
+	if b, err = json.MarshalIndent(host, "", "    "); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b, 0600)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	// The driver runs as root, the file belongs to the user it runs for
+	if err := chownToCaller(tmp.Name()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
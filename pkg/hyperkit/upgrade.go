@@ -0,0 +1,164 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// Upgrade fetches the ISO again from where the machine got it, the latest
+// boot2docker release if that is unset, and boots the machine from it. The
+// kernel and initrd are extracted anew and a running machine is restarted,
+// the disk is kept as it is. It reports whether the ISO changed.
+func (d *Driver) Upgrade() (bool, error) {
+	if err := d.verifyRootPermissions(); err != nil {
+		return false, err
+	}
+	unlock, err := d.lock()
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	if d.netboot() {
+		return false, fmt.Errorf("machine %s boots %s rather than an ISO, there is nothing to upgrade", d.MachineName, d.KernelURL)
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	iso := d.ResolveStorePath(isoFilename)
+	next := iso + ".next"
+	defer os.Remove(next)
+	if err := d.fetchISO(ctx, next); err != nil {
+		return false, fmt.Errorf("fetching the ISO: %w", err)
+	}
+	same, err := sameContent(iso, next)
+	if err != nil {
+		return false, err
+	}
+	if same {
+		log.Infof("%s is already up to date", d.MachineName)
+		return false, nil
+	}
+
+	s, err := d.GetState()
+	if err != nil {
+		return false, err
+	}
+	running := s == state.Running
+	if running {
+		log.Infof("Stopping %s to upgrade it", d.MachineName)
+		d.unmountNFSShares()
+		if err := d.Stop(); err != nil {
+			return false, fmt.Errorf("stopping: %w", err)
+		}
+	}
+
+	prev := iso + ".prev"
+	if err := os.Rename(iso, prev); err != nil {
+		return false, err
+	}
+	if err := os.Rename(next, iso); err != nil {
+		os.Rename(prev, iso)
+		return false, err
+	}
+	if err := d.extractKernel(iso); err != nil {
+		log.Warnf("Unable to boot the new ISO, keeping the previous one")
+		os.Rename(prev, iso)
+		if err := d.extractKernel(iso); err != nil {
+			log.Warnf("Unable to extract the previous kernel: %v", err)
+		}
+		return false, fmt.Errorf("extracting kernel: %w", err)
+	}
+	os.Remove(prev)
+	// The new guest kernel may have the virtio-rng driver the old one lacked
+	d.RNGUnsupported = false
+	if err := d.SaveConfig(); err != nil {
+		return true, fmt.Errorf("saving config: %w", err)
+	}
+	log.Infof("Upgraded the ISO of %s", d.MachineName)
+
+	if !running {
+		return true, nil
+	}
+	if err := d.StartContext(ctx); err != nil {
+		return true, fmt.Errorf("starting: %w", err)
+	}
+	return true, d.SaveConfig()
+}
+
+// fetchISO gets the ISO at Boot2DockerURL, or the latest boot2docker
+// release, to dest
+func (d *Driver) fetchISO(ctx context.Context, dest string) error {
+	url := d.Boot2DockerURL
+	switch {
+	case strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://"):
+		log.Infof("Downloading %s...", url)
+		return d.download(ctx, url, dest)
+	case url == "":
+		log.Info("Updating the boot2docker ISO cache...")
+		if err := mcnutils.NewB2dUtils(d.StorePath).UpdateISOCache(""); err != nil {
+			return err
+		}
+		return mcnutils.CopyFile(filepath.Join(d.StorePath, "cache", isoFilename), dest)
+	default:
+		return mcnutils.CopyFile(strings.TrimPrefix(url, "file://"), dest)
+	}
+}
+
+// sameContent reports whether the files at a and b hold the same bytes. A
+// missing a counts as different.
+func sameContent(a, b string) (bool, error) {
+	sumA, err := fileSHA256(a)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	sumB, err := fileSHA256(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(sumA, sumB), nil
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -22,6 +22,9 @@ import (
 	vmnet "github.com/zchee/go-vmnet"
 )
 
+// vmnetSupported is whether this build can use the vmnet framework
+const vmnetSupported = true
+
 func GetMACAddressFromUUID(id string) (string, error) {
 	return vmnet.GetMACAddressFromUUID(id)
 }
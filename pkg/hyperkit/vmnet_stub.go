@@ -22,6 +22,9 @@ import (
 	"errors"
 )
 
+// vmnetSupported is whether this build can use the vmnet framework
+const vmnetSupported = false
+
 func GetMACAddressFromUUID(UUID string) (string, error) {
 	return "", errors.New("Function not supported on CGO_ENABLED=0 binaries")
 }
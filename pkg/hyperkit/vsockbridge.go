@@ -0,0 +1,224 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// hostVSockCID is the vsock context ID of the host, which the guest connects
+// to for host ports
+const hostVSockCID = 2
+
+// vsockBridge proxies connections between a host TCP address and a guest
+// vsock port. A bridge to the guest listens on the TCP address and connects
+// to the vsock port hyperkit exposes; a bridge to the host listens on the
+// vsock port guests connect to and dials the TCP address.
+type vsockBridge struct {
+	toGuest   bool
+	tcpAddr   string
+	vsockPort int
+}
+
+func (b vsockBridge) String() string {
+	if b.toGuest {
+		return fmt.Sprintf("tcp:%s=vsock:%d", b.tcpAddr, b.vsockPort)
+	}
+	return fmt.Sprintf("vsock:%d=tcp:%s", b.vsockPort, b.tcpAddr)
+}
+
+// parseVSockBridge parses a bridge of the form listen=target, where one side
+// is vsock:port and the other tcp:[host:]port. The host of a listening TCP
+// side defaults to localhost.
+func parseVSockBridge(spec string) (vsockBridge, error) {
+	var b vsockBridge
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return b, fmt.Errorf("vsock bridge %q is not of the form listen=target", spec)
+	}
+	listen, target := parts[0], parts[1]
+	var tcp, vsock string
+	switch {
+	case strings.HasPrefix(listen, "tcp:") && strings.HasPrefix(target, "vsock:"):
+		b.toGuest = true
+		tcp, vsock = listen[len("tcp:"):], target[len("vsock:"):]
+		if !strings.Contains(tcp, ":") {
+			tcp = "127.0.0.1:" + tcp
+		}
+	case strings.HasPrefix(listen, "vsock:") && strings.HasPrefix(target, "tcp:"):
+		vsock, tcp = listen[len("vsock:"):], target[len("tcp:"):]
+		if !strings.Contains(tcp, ":") {
+			tcp = "127.0.0.1:" + tcp
+		}
+	default:
+		return b, fmt.Errorf("vsock bridge %q must connect a tcp: and a vsock: endpoint", spec)
+	}
+
+	port, err := strconv.Atoi(vsock)
+	if err != nil || port <= 0 {
+		return b, fmt.Errorf("vsock bridge %q has an invalid vsock port", spec)
+	}
+	b.vsockPort = port
+	if _, p, err := net.SplitHostPort(tcp); err != nil {
+		return b, fmt.Errorf("vsock bridge %q: %w", spec, err)
+	} else if n, err := strconv.Atoi(p); err != nil || n <= 0 || n > 65535 {
+		return b, fmt.Errorf("vsock bridge %q has an invalid tcp port", spec)
+	} else if b.toGuest && n < 1024 {
+		// The supervisor runs as root, so without this any user could
+		// bind a privileged port on the host through a bridge.
+		return b, fmt.Errorf("vsock bridge %q can't listen on privileged port %d", spec, n)
+	}
+	b.tcpAddr = tcp
+	return b, nil
+}
+
+func (d *Driver) vsockBridges() ([]vsockBridge, error) {
+	bridges := make([]vsockBridge, 0, len(d.VSockBridges))
+	for _, spec := range d.VSockBridges {
+		b, err := parseVSockBridge(spec)
+		if err != nil {
+			return nil, err
+		}
+		bridges = append(bridges, b)
+	}
+	if d.SSHOverVSock {
+		bridges = append(bridges, d.sshVSockBridge())
+	}
+	return bridges, nil
+}
+
+// bridgedGuestPorts returns the guest vsock ports hyperkit has to expose for
+// the bridges to the guest
+func (d *Driver) bridgedGuestPorts() []int {
+	bridges, _ := d.vsockBridges()
+	var ports []int
+	for _, b := range bridges {
+		if b.toGuest {
+			ports = append(ports, b.vsockPort)
+		}
+	}
+	return ports
+}
+
+// guestVSockSocket is the unix socket hyperkit forwards to a guest vsock port
+func (d *Driver) guestVSockSocket(port int) string {
+	return d.ResolveStorePath(fmt.Sprintf("%08x.%08x", guestVSockCID, port))
+}
+
+// hostVSockSocket is the unix socket hyperkit connects guests to when they
+// connect to a host vsock port
+func (d *Driver) hostVSockSocket(port int) string {
+	return d.ResolveStorePath(fmt.Sprintf("%08x.%08x", hostVSockCID, port))
+}
+
+// runVSockBridges serves all bridges until ctx is done
+func (d *Driver) runVSockBridges(ctx context.Context) error {
+	bridges, err := d.vsockBridges()
+	if err != nil {
+		return err
+	}
+	var listeners []net.Listener
+	for _, b := range bridges {
+		l, err := d.listenVSockBridge(b)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("vsock bridge %s: %w", b, err)
+		}
+		listeners = append(listeners, l)
+		log.Infof("Bridging %s", b)
+		go d.serveVSockBridge(b, l)
+	}
+	go func() {
+		<-ctx.Done()
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	return nil
+}
+
+func (d *Driver) listenVSockBridge(b vsockBridge) (net.Listener, error) {
+	if b.toGuest {
+		return net.Listen("tcp", b.tcpAddr)
+	}
+	path := d.hostVSockSocket(b.vsockPort)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+func (d *Driver) serveVSockBridge(b vsockBridge, l net.Listener) {
+	network, addr := "tcp", b.tcpAddr
+	if b.toGuest {
+		network, addr = "unix", d.guestVSockSocket(b.vsockPort)
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Debugf("vsock bridge %s stopped: %v", b, err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			target, err := net.Dial(network, addr)
+			if err != nil {
+				log.Warnf("vsock bridge %s: %v", b, err)
+				return
+			}
+			defer target.Close()
+			proxy(conn, target)
+		}()
+	}
+}
+
+// closeWriter is implemented by connections that can be half closed
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// proxy copies between a and b until both directions are done, half closing
+// each side once the other has nothing more to send
+func proxy(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+}
@@ -0,0 +1,84 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseVSockBridge(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    vsockBridge
+		wantErr bool
+	}{
+		{"tcp:8080=vsock:80", vsockBridge{toGuest: true, tcpAddr: "127.0.0.1:8080", vsockPort: 80}, false},
+		{"tcp:0.0.0.0:8080=vsock:80", vsockBridge{toGuest: true, tcpAddr: "0.0.0.0:8080", vsockPort: 80}, false},
+		{"vsock:5432=tcp:db.local:5432", vsockBridge{tcpAddr: "db.local:5432", vsockPort: 5432}, false},
+		{"vsock:5432=tcp:5432", vsockBridge{tcpAddr: "127.0.0.1:5432", vsockPort: 5432}, false},
+		{"tcp:8080", vsockBridge{}, true},
+		{"tcp:8080=tcp:80", vsockBridge{}, true},
+		{"tcp:8080=vsock:http", vsockBridge{}, true},
+		{"tcp:99999=vsock:80", vsockBridge{}, true},
+		{"tcp:80=vsock:80", vsockBridge{}, true},
+		{"tcp:0.0.0.0:443=vsock:443", vsockBridge{}, true},
+		{"vsock:80=tcp:80", vsockBridge{tcpAddr: "127.0.0.1:80", vsockPort: 80}, false},
+	}
+	for _, tt := range tests {
+		got, err := parseVSockBridge(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseVSockBridge(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseVSockBridge(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	client, a := net.Pipe()
+	b, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		proxy(a, b)
+		close(done)
+	}()
+
+	go client.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(server, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("server read %q, %v", buf, err)
+	}
+	go server.Write([]byte("pong"))
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("client read %q, %v", buf, err)
+	}
+
+	client.Close()
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy didn't return after both sides closed")
+	}
+}
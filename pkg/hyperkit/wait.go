@@ -0,0 +1,205 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	dockerPort       = 2376
+	waitPollInterval = time.Second
+)
+
+// WaitCondition is a machine condition that WaitFor can block on
+type WaitCondition string
+
+const (
+	// WaitRunning waits for the hyperkit process to be running
+	WaitRunning WaitCondition = "running"
+	// WaitStopped waits for the hyperkit process to have exited
+	WaitStopped WaitCondition = "stopped"
+	// WaitSSHReady waits for the SSH server to greet
+	WaitSSHReady WaitCondition = "ssh-ready"
+	// WaitDockerReady waits for the Docker API to accept connections
+	WaitDockerReady WaitCondition = "docker-ready"
+)
+
+// Readiness strategies for Start, set with --hyperkit-wait
+const (
+	waitNone   = "none"
+	waitIP     = "ip"
+	waitSSH    = "ssh"
+	waitDocker = "docker"
+)
+
+func validateWaitStrategy(w string) error {
+	switch w {
+	case waitNone, waitIP, waitSSH, waitDocker:
+		return nil
+	}
+	return fmt.Errorf("invalid wait strategy %q, must be one of %s, %s, %s or %s", w, waitNone, waitIP, waitSSH, waitDocker)
+}
+
+// WaitFor blocks until the machine reaches cond, the timeout expires or ctx
+// is cancelled. A zero timeout waits until ctx is done.
+func (d *Driver) WaitFor(ctx context.Context, cond WaitCondition, timeout time.Duration) error {
+	var check func() (bool, error)
+	switch cond {
+	case WaitRunning:
+		check = d.stateIs(state.Running)
+	case WaitStopped:
+		check = d.stateIs(state.Stopped)
+	case WaitSSHReady:
+		check = d.sshReady
+	case WaitDockerReady:
+		check = d.dockerReady
+	default:
+		return fmt.Errorf("unknown wait condition %q", cond)
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return poll(ctx, waitPollInterval, func() (bool, error) {
+		ok, err := check()
+		if err != nil {
+			return false, err
+		}
+		log.Debugf("Waiting for machine to be %s: %v", cond, ok)
+		return ok, nil
+	})
+}
+
+func (d *Driver) stateIs(want state.State) func() (bool, error) {
+	return func() (bool, error) {
+		s, err := d.GetState()
+		if err != nil {
+			return false, err
+		}
+		return s == want, nil
+	}
+}
+
+func (d *Driver) sshReady() (bool, error) {
+	if d.IPAddress == "" && !d.sshOverVSock() {
+		return false, nil
+	}
+	host, err := d.GetSSHHostname()
+	if err != nil {
+		return false, err
+	}
+	port, err := d.GetSSHPort()
+	if err != nil {
+		return false, err
+	}
+	return sshBanner(net.JoinHostPort(host, fmt.Sprint(port))), nil
+}
+
+func (d *Driver) dockerReady() (bool, error) {
+	if d.sshOverVSock() {
+		return d.dockerReadyOverSSH()
+	}
+	if d.IPAddress == "" {
+		return false, nil
+	}
+	return dialable(net.JoinHostPort(d.IPAddress, fmt.Sprint(dockerPort))), nil
+}
+
+// waitsForSSH reports whether Start waits for SSH, so the guest can be
+// configured over it
+func (d *Driver) waitsForSSH() bool {
+	return d.Wait == waitSSH || d.Wait == waitDocker
+}
+
+// waitReady probes the layers required by the Wait strategy once the machine
+// has an IP address, and reports the first one that never came up.
+func (d *Driver) waitReady(ctx context.Context) error {
+	var conditions []WaitCondition
+	switch d.Wait {
+	case waitSSH:
+		conditions = []WaitCondition{WaitSSHReady}
+	case waitDocker:
+		conditions = []WaitCondition{WaitSSHReady, WaitDockerReady}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(d.WaitTimeout)*time.Second)
+	defer cancel()
+	for _, cond := range conditions {
+		log.Debugf("Waiting for %s", cond)
+		if err := d.WaitFor(ctx, cond, 0); err != nil {
+			return fmt.Errorf("machine never became %s: %w", cond, err)
+		}
+	}
+	return nil
+}
+
+func dialable(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, waitPollInterval)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// sshBanner reports whether an SSH server greets on addr. Accepting the
+// connection isn't enough, the vsock bridge does that before the guest sshd
+// is up.
+func sshBanner(addr string) bool {
+	conn, err := net.DialTimeout("tcp", addr, waitPollInterval)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(waitPollInterval))
+	line, _ := bufio.NewReader(conn).ReadString('\n')
+	return strings.HasPrefix(line, "SSH-")
+}
+
+// poll calls f every interval until it reports done, returns an error or ctx
+// is done.
+func poll(ctx context.Context, interval time.Duration, f func() (bool, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		done, err := f()
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
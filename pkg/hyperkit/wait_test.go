@@ -0,0 +1,54 @@
+// +build darwin
+
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSSHBanner(t *testing.T) {
+	tests := []struct {
+		name  string
+		greet string
+		want  bool
+	}{
+		{"sshd", "SSH-2.0-OpenSSH_8.4\r\n", true},
+		{"bridge without sshd", "", false},
+		{"other server", "HTTP/1.1 400 Bad Request\r\n", false},
+	}
+	for _, tt := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(greet string) {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(greet))
+			conn.Close()
+		}(tt.greet)
+		if got := sshBanner(l.Addr().String()); got != tt.want {
+			t.Errorf("%s: sshBanner() = %v, want %v", tt.name, got, tt.want)
+		}
+		l.Close()
+	}
+}
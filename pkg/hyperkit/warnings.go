@@ -0,0 +1,84 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// warningInterval is how long an identical warning is suppressed for
+const warningInterval = time.Minute
+
+// warnings deduplicates the warnings emitted while polling the machine state
+var warnings = newWarningThrottle(warningInterval, log.Warn)
+
+// warningThrottle emits each distinct warning at most once per interval,
+// counting the repeats it swallowed and reporting them with the next emission.
+type warningThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	emit     func(args ...interface{})
+	now      func() time.Time
+	seen     map[string]*warningRecord
+}
+
+type warningRecord struct {
+	last       time.Time
+	suppressed int
+}
+
+func newWarningThrottle(interval time.Duration, emit func(args ...interface{})) *warningThrottle {
+	return &warningThrottle{
+		interval: interval,
+		emit:     emit,
+		now:      time.Now,
+		seen:     map[string]*warningRecord{},
+	}
+}
+
+// Warnf formats and emits a warning unless the same warning was emitted less
+// than the throttle interval ago.
+func (w *warningThrottle) Warnf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	w.mu.Lock()
+	now := w.now()
+	r, ok := w.seen[msg]
+	if ok && now.Sub(r.last) < w.interval {
+		r.suppressed++
+		w.mu.Unlock()
+		return
+	}
+	out := msg
+	if ok && r.suppressed > 0 {
+		out = fmt.Sprintf("%s (repeated %d more times)", msg, r.suppressed)
+	}
+	// Forget warnings that stopped recurring, along with what they swallowed
+	for m, r := range w.seen {
+		if now.Sub(r.last) >= w.interval {
+			delete(w.seen, m)
+		}
+	}
+	w.seen[msg] = &warningRecord{last: now}
+	w.mu.Unlock()
+
+	w.emit(out)
+}
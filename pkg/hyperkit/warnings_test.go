@@ -0,0 +1,53 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hyperkit
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_warningThrottle(t *testing.T) {
+	var got []string
+	w := newWarningThrottle(time.Minute, func(args ...interface{}) {
+		got = append(got, fmt.Sprint(args...))
+	})
+	now := time.Unix(0, 0)
+	w.now = func() time.Time { return now }
+
+	w.Warnf("Error reading pid file: %v", "missing")
+	w.Warnf("Error reading pid file: %v", "missing")
+	w.Warnf("Error reading pid file: %v", "missing")
+	w.Warnf("Error decoding pid file: %v", "eof")
+	now = now.Add(2 * time.Minute)
+	w.Warnf("Error reading pid file: %v", "missing")
+	w.Warnf("Error reading pid file: %v", "missing")
+
+	want := []string{
+		"Error reading pid file: missing",
+		"Error decoding pid file: eof",
+		"Error reading pid file: missing (repeated 2 more times)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("warnings = %q, want %q", got, want)
+	}
+	if len(w.seen) != 1 {
+		t.Errorf("%d warnings remembered, want the stale one forgotten", len(w.seen))
+	}
+}
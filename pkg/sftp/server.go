@@ -0,0 +1,803 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sftp is a minimal SFTP version 3 server confined to a set of host
+// directories, which the driver serves machine shares with. It speaks the
+// protocol right on a connection, the way sshfs -o directport expects it,
+// without SSH around it.
+package sftp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Packet types
+const (
+	fxpInit          = 1
+	fxpVersion       = 2
+	fxpOpen          = 3
+	fxpClose         = 4
+	fxpRead          = 5
+	fxpWrite         = 6
+	fxpLstat         = 7
+	fxpFstat         = 8
+	fxpSetstat       = 9
+	fxpFsetstat      = 10
+	fxpOpendir       = 11
+	fxpReaddir       = 12
+	fxpRemove        = 13
+	fxpMkdir         = 14
+	fxpRmdir         = 15
+	fxpRealpath      = 16
+	fxpStat          = 17
+	fxpRename        = 18
+	fxpReadlink      = 19
+	fxpSymlink       = 20
+	fxpStatus        = 101
+	fxpHandle        = 102
+	fxpData          = 103
+	fxpName          = 104
+	fxpAttrs         = 105
+	fxpExtended      = 200
+	fxpExtendedReply = 201
+)
+
+// Status codes
+const (
+	fxOK               = 0
+	fxEOF              = 1
+	fxNoSuchFile       = 2
+	fxPermissionDenied = 3
+	fxFailure          = 4
+	fxBadMessage       = 5
+	fxOpUnsupported    = 8
+)
+
+// Attribute flags
+const (
+	attrSize        = 0x1
+	attrUIDGID      = 0x2
+	attrPermissions = 0x4
+	attrACModTime   = 0x8
+	attrExtended    = 0x80000000
+)
+
+// Open flags
+const (
+	openRead   = 0x1
+	openWrite  = 0x2
+	openAppend = 0x4
+	openCreate = 0x8
+	openTrunc  = 0x10
+	openExcl   = 0x20
+)
+
+const (
+	protocolVersion = 3
+	// maxPacket bounds the packets a client may send, sshfs writes up to
+	// 64 KiB at a time
+	maxPacket = 256 * 1024
+	maxRead   = 64 * 1024
+	// readdirBatch is how many entries a READDIR reply carries at most
+	readdirBatch = 128
+	posixRename  = "posix-rename@openssh.com"
+)
+
+var (
+	errBadMessage = errors.New("bad message")
+	errOutside    = errors.New("path outside the shared directories")
+)
+
+// Server serves the directories returned by Roots. Paths outside them, and
+// symlinks pointing out of them, are refused.
+type Server struct {
+	// Roots returns the absolute paths of the shared directories. It is
+	// called for every request, so directories can be shared while clients
+	// are connected.
+	Roots func() []string
+}
+
+// Serve handles the requests of a single client on rw until it disconnects
+func (s *Server) Serve(rw io.ReadWriter) error {
+	c := &conn{server: s, w: rw, handles: map[string]*handle{}}
+	defer c.closeHandles()
+	for {
+		typ, payload, err := readPacket(rw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.handle(typ, payload); err != nil {
+			return err
+		}
+	}
+}
+
+type handle struct {
+	file   *os.File
+	path   string
+	append bool
+}
+
+type conn struct {
+	server     *Server
+	w          io.Writer
+	handles    map[string]*handle
+	nextHandle int
+}
+
+func (c *conn) closeHandles() {
+	for _, h := range c.handles {
+		h.file.Close()
+	}
+}
+
+func readPacket(r io.Reader) (byte, []byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n < 1 || n > maxPacket {
+		return 0, nil, fmt.Errorf("invalid packet length %d", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return b[0], b[1:], nil
+}
+
+func (c *conn) handle(typ byte, payload []byte) error {
+	d := &decoder{b: payload}
+	if typ == fxpInit {
+		e := newPacket(fxpVersion)
+		e.uint32(protocolVersion)
+		e.string(posixRename)
+		e.string("1")
+		return c.send(e)
+	}
+
+	id := d.uint32()
+	if d.err != nil {
+		return d.err
+	}
+	var reply *encoder
+	var err error
+	switch typ {
+	case fxpRealpath:
+		reply, err = c.realpath(id, d)
+	case fxpStat:
+		reply, err = c.stat(id, d, os.Stat, true)
+	case fxpLstat:
+		reply, err = c.stat(id, d, os.Lstat, false)
+	case fxpFstat:
+		reply, err = c.fstat(id, d)
+	case fxpOpen:
+		reply, err = c.open(id, d)
+	case fxpOpendir:
+		reply, err = c.opendir(id, d)
+	case fxpClose:
+		reply, err = c.close(id, d)
+	case fxpRead:
+		reply, err = c.read(id, d)
+	case fxpWrite:
+		reply, err = c.write(id, d)
+	case fxpReaddir:
+		reply, err = c.readdir(id, d)
+	case fxpSetstat:
+		reply, err = c.setstat(id, d)
+	case fxpFsetstat:
+		reply, err = c.fsetstat(id, d)
+	case fxpRemove:
+		reply, err = c.remove(id, d, syscall.Unlink)
+	case fxpRmdir:
+		reply, err = c.remove(id, d, syscall.Rmdir)
+	case fxpMkdir:
+		reply, err = c.mkdir(id, d)
+	case fxpRename:
+		reply, err = c.rename(id, d, false)
+	case fxpReadlink:
+		reply, err = c.readlink(id, d)
+	case fxpSymlink:
+		reply, err = c.symlink(id, d)
+	case fxpExtended:
+		if name := d.string(); name == posixRename {
+			reply, err = c.rename(id, d, true)
+		} else {
+			reply = status(id, fxOpUnsupported, "unsupported extension "+name)
+		}
+	default:
+		reply = status(id, fxOpUnsupported, fmt.Sprintf("unsupported request type %d", typ))
+	}
+	if err != nil {
+		reply = errorStatus(id, err)
+	}
+	return c.send(reply)
+}
+
+func (c *conn) send(e *encoder) error {
+	binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+	_, err := c.w.Write(e.b)
+	return err
+}
+
+// checkPath cleans p and checks that it is in one of the shared
+// directories. The directory p is in must not lead out of them through
+// symlinks, and with follow set neither may p itself.
+func (c *conn) checkPath(p string, follow bool) (string, error) {
+	p = path.Clean("/" + p)
+	var roots []string
+	for _, root := range c.server.Roots() {
+		root = filepath.Clean(root)
+		if p == root {
+			return p, nil
+		}
+		if real, err := filepath.EvalSymlinks(root); err == nil {
+			roots = append(roots, real)
+		}
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(p))
+	if err != nil {
+		if os.IsNotExist(err) && !within(filepath.Dir(p), roots) {
+			return "", errOutside
+		}
+		return "", err
+	}
+	if !within(parent, roots) {
+		return "", errOutside
+	}
+	if follow {
+		if real, err := filepath.EvalSymlinks(p); err == nil && !within(real, roots) {
+			return "", errOutside
+		}
+	}
+	return p, nil
+}
+
+// within reports whether p is one of roots or in one of them
+func within(p string, roots []string) bool {
+	for _, root := range roots {
+		if p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *conn) realpath(id uint32, d *decoder) (*encoder, error) {
+	p := d.string()
+	if d.err != nil {
+		return nil, d.err
+	}
+	p = path.Clean("/" + p)
+	e := newPacket(fxpName)
+	e.uint32(id)
+	e.uint32(1)
+	e.string(p)
+	e.string(p)
+	e.attrs(nil)
+	return e, nil
+}
+
+func (c *conn) stat(id uint32, d *decoder, stat func(string) (os.FileInfo, error), follow bool) (*encoder, error) {
+	p, err := c.checkPath(d.string(), follow)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return attrsReply(id, fi), nil
+}
+
+func (c *conn) fstat(id uint32, d *decoder) (*encoder, error) {
+	h, err := c.lookup(d.string())
+	if err != nil {
+		return nil, err
+	}
+	fi, err := h.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return attrsReply(id, fi), nil
+}
+
+func (c *conn) open(id uint32, d *decoder) (*encoder, error) {
+	name := d.string()
+	pflags := d.uint32()
+	a := d.attrs()
+	if d.err != nil {
+		return nil, d.err
+	}
+	p, err := c.checkPath(name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags int
+	switch {
+	case pflags&openRead != 0 && pflags&openWrite != 0:
+		flags = os.O_RDWR
+	case pflags&openWrite != 0:
+		flags = os.O_WRONLY
+	default:
+		flags = os.O_RDONLY
+	}
+	if pflags&openCreate != 0 {
+		flags |= os.O_CREATE
+	}
+	if pflags&openTrunc != 0 {
+		flags |= os.O_TRUNC
+	}
+	if pflags&openExcl != 0 {
+		flags |= os.O_EXCL
+	}
+	perm := os.FileMode(0644)
+	if a.flags&attrPermissions != 0 {
+		perm = os.FileMode(a.perm & 0777)
+	}
+	f, err := os.OpenFile(p, flags, perm)
+	if err != nil {
+		return nil, err
+	}
+	return c.newHandle(id, &handle{file: f, path: p, append: pflags&openAppend != 0}), nil
+}
+
+func (c *conn) opendir(id uint32, d *decoder) (*encoder, error) {
+	p, err := c.checkPath(d.string(), true)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || !fi.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a directory", p)
+	}
+	return c.newHandle(id, &handle{file: f, path: p}), nil
+}
+
+func (c *conn) newHandle(id uint32, h *handle) *encoder {
+	c.nextHandle++
+	name := strconv.Itoa(c.nextHandle)
+	c.handles[name] = h
+	e := newPacket(fxpHandle)
+	e.uint32(id)
+	e.string(name)
+	return e
+}
+
+func (c *conn) lookup(name string) (*handle, error) {
+	h, ok := c.handles[name]
+	if !ok {
+		return nil, errBadMessage
+	}
+	return h, nil
+}
+
+func (c *conn) close(id uint32, d *decoder) (*encoder, error) {
+	name := d.string()
+	h, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.handles, name)
+	if err := h.file.Close(); err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func (c *conn) read(id uint32, d *decoder) (*encoder, error) {
+	h, err := c.lookup(d.string())
+	offset := d.uint64()
+	length := d.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if length > maxRead {
+		length = maxRead
+	}
+	buf := make([]byte, length)
+	n, err := h.file.ReadAt(buf, int64(offset))
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	e := newPacket(fxpData)
+	e.uint32(id)
+	e.string(string(buf[:n]))
+	return e, nil
+}
+
+func (c *conn) write(id uint32, d *decoder) (*encoder, error) {
+	h, err := c.lookup(d.string())
+	offset := d.uint64()
+	data := d.string()
+	if err != nil {
+		return nil, err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if h.append {
+		_, err = h.file.Seek(0, io.SeekEnd)
+		if err == nil {
+			_, err = h.file.Write([]byte(data))
+		}
+	} else {
+		_, err = h.file.WriteAt([]byte(data), int64(offset))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func (c *conn) readdir(id uint32, d *decoder) (*encoder, error) {
+	h, err := c.lookup(d.string())
+	if err != nil {
+		return nil, err
+	}
+	infos, err := h.file.Readdir(readdirBatch)
+	if len(infos) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	e := newPacket(fxpName)
+	e.uint32(id)
+	e.uint32(uint32(len(infos)))
+	for _, fi := range infos {
+		e.string(fi.Name())
+		e.string(longName(fi))
+		e.attrs(fi)
+	}
+	return e, nil
+}
+
+func (c *conn) setstat(id uint32, d *decoder) (*encoder, error) {
+	p, err := c.checkPath(d.string(), true)
+	a := d.attrs()
+	if err != nil {
+		return nil, err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := a.apply(p, os.Truncate, os.Chmod); err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func (c *conn) fsetstat(id uint32, d *decoder) (*encoder, error) {
+	h, err := c.lookup(d.string())
+	a := d.attrs()
+	if err != nil {
+		return nil, err
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	truncate := func(string, int64) error { return h.file.Truncate(int64(a.size)) }
+	chmod := func(string, os.FileMode) error { return h.file.Chmod(os.FileMode(a.perm & 07777)) }
+	if err := a.apply(h.path, truncate, chmod); err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func (c *conn) remove(id uint32, d *decoder, remove func(string) error) (*encoder, error) {
+	p, err := c.checkPath(d.string(), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := remove(p); err != nil {
+		return nil, &os.PathError{Op: "remove", Path: p, Err: err}
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func (c *conn) mkdir(id uint32, d *decoder) (*encoder, error) {
+	p, err := c.checkPath(d.string(), false)
+	a := d.attrs()
+	if err != nil {
+		return nil, err
+	}
+	perm := os.FileMode(0755)
+	if a.flags&attrPermissions != 0 {
+		perm = os.FileMode(a.perm & 0777)
+	}
+	if err := os.Mkdir(p, perm); err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+// rename renames a file. Version 3 renames fail if the target exists, the
+// posix-rename extension replaces it.
+func (c *conn) rename(id uint32, d *decoder, replace bool) (*encoder, error) {
+	from, err := c.checkPath(d.string(), false)
+	if err != nil {
+		return nil, err
+	}
+	to, err := c.checkPath(d.string(), false)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(to); err == nil && !replace {
+		return status(id, fxFailure, to+" exists"), nil
+	}
+	if err := os.Rename(from, to); err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func (c *conn) readlink(id uint32, d *decoder) (*encoder, error) {
+	p, err := c.checkPath(d.string(), false)
+	if err != nil {
+		return nil, err
+	}
+	target, err := os.Readlink(p)
+	if err != nil {
+		return nil, err
+	}
+	e := newPacket(fxpName)
+	e.uint32(id)
+	e.uint32(1)
+	e.string(target)
+	e.string(target)
+	e.attrs(nil)
+	return e, nil
+}
+
+// symlink creates a symlink. Like OpenSSH, and so sshfs, the target comes
+// before the path of the link, unlike in the protocol draft.
+func (c *conn) symlink(id uint32, d *decoder) (*encoder, error) {
+	target := d.string()
+	p, err := c.checkPath(d.string(), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Symlink(target, p); err != nil {
+		return nil, err
+	}
+	return status(id, fxOK, ""), nil
+}
+
+func attrsReply(id uint32, fi os.FileInfo) *encoder {
+	e := newPacket(fxpAttrs)
+	e.uint32(id)
+	e.attrs(fi)
+	return e
+}
+
+func status(id uint32, code uint32, msg string) *encoder {
+	e := newPacket(fxpStatus)
+	e.uint32(id)
+	e.uint32(code)
+	e.string(msg)
+	e.string("")
+	return e
+}
+
+func errorStatus(id uint32, err error) *encoder {
+	switch {
+	case err == io.EOF:
+		return status(id, fxEOF, "EOF")
+	case err == errBadMessage:
+		return status(id, fxBadMessage, err.Error())
+	case err == errOutside || os.IsPermission(err):
+		return status(id, fxPermissionDenied, err.Error())
+	case os.IsNotExist(err):
+		return status(id, fxNoSuchFile, err.Error())
+	}
+	return status(id, fxFailure, err.Error())
+}
+
+// fileAttrs are the attributes of a file as sent over the wire
+type fileAttrs struct {
+	flags uint32
+	size  uint64
+	uid   uint32
+	gid   uint32
+	perm  uint32
+	atime uint32
+	mtime uint32
+}
+
+// apply sets the attributes on the file at p, through truncate and chmod
+// for the size and the permissions. The owner is left alone, as the server
+// runs as the user owning the shares.
+func (a fileAttrs) apply(p string, truncate func(string, int64) error, chmod func(string, os.FileMode) error) error {
+	if a.flags&attrSize != 0 {
+		if err := truncate(p, int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrPermissions != 0 {
+		if err := chmod(p, os.FileMode(a.perm&07777)); err != nil {
+			return err
+		}
+	}
+	if a.flags&attrACModTime != 0 {
+		if err := os.Chtimes(p, time.Unix(int64(a.atime), 0), time.Unix(int64(a.mtime), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unixMode converts a FileMode to the st_mode bits SFTP sends
+func unixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	switch {
+	case m.IsDir():
+		mode |= syscall.S_IFDIR
+	case m&os.ModeSymlink != 0:
+		mode |= syscall.S_IFLNK
+	case m&os.ModeNamedPipe != 0:
+		mode |= syscall.S_IFIFO
+	case m&os.ModeSocket != 0:
+		mode |= syscall.S_IFSOCK
+	case m&os.ModeCharDevice != 0:
+		mode |= syscall.S_IFCHR
+	case m&os.ModeDevice != 0:
+		mode |= syscall.S_IFBLK
+	default:
+		mode |= syscall.S_IFREG
+	}
+	if m&os.ModeSetuid != 0 {
+		mode |= syscall.S_ISUID
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= syscall.S_ISGID
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= syscall.S_ISVTX
+	}
+	return mode
+}
+
+func owner(fi os.FileInfo) (uint32, uint32) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid
+	}
+	return 0, 0
+}
+
+// longName formats fi like ls -l, for the READDIR replies
+func longName(fi os.FileInfo) string {
+	uid, gid := owner(fi)
+	return fmt.Sprintf("%s 1 %d %d %d %s %s", fi.Mode(), uid, gid, fi.Size(), fi.ModTime().Format("Jan _2 15:04"), fi.Name())
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil || len(d.b) < 4 {
+		d.err = errBadMessage
+		return 0
+	}
+	v := binary.BigEndian.Uint32(d.b)
+	d.b = d.b[4:]
+	return v
+}
+
+func (d *decoder) uint64() uint64 {
+	return uint64(d.uint32())<<32 | uint64(d.uint32())
+}
+
+func (d *decoder) string() string {
+	n := d.uint32()
+	if d.err != nil || uint32(len(d.b)) < n {
+		d.err = errBadMessage
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
+
+func (d *decoder) attrs() fileAttrs {
+	var a fileAttrs
+	a.flags = d.uint32()
+	if a.flags&attrSize != 0 {
+		a.size = d.uint64()
+	}
+	if a.flags&attrUIDGID != 0 {
+		a.uid = d.uint32()
+		a.gid = d.uint32()
+	}
+	if a.flags&attrPermissions != 0 {
+		a.perm = d.uint32()
+	}
+	if a.flags&attrACModTime != 0 {
+		a.atime = d.uint32()
+		a.mtime = d.uint32()
+	}
+	if a.flags&attrExtended != 0 {
+		for n := d.uint32(); n > 0 && d.err == nil; n-- {
+			d.string()
+			d.string()
+		}
+	}
+	return a
+}
+
+type encoder struct {
+	b []byte
+}
+
+// newPacket starts a packet of type typ, leaving room for its length
+func newPacket(typ byte) *encoder {
+	return &encoder{b: []byte{0, 0, 0, 0, typ}}
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.b = append(e.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.uint32(uint32(v >> 32))
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// attrs writes the attributes of fi, or none if it is nil
+func (e *encoder) attrs(fi os.FileInfo) {
+	if fi == nil {
+		e.uint32(0)
+		return
+	}
+	uid, gid := owner(fi)
+	mtime := uint32(fi.ModTime().Unix())
+	e.uint32(attrSize | attrUIDGID | attrPermissions | attrACModTime)
+	e.uint64(uint64(fi.Size()))
+	e.uint32(uid)
+	e.uint32(gid)
+	e.uint32(unixMode(fi.Mode()))
+	e.uint32(mtime)
+	e.uint32(mtime)
+}
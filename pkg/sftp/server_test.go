@@ -0,0 +1,271 @@
+/*
+Copyright 2016 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sftp
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// client sends requests to a Server over a pipe
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	id   uint32
+}
+
+func newClient(t *testing.T, roots ...string) *client {
+	server, conn := net.Pipe()
+	s := &Server{Roots: func() []string { return roots }}
+	go s.Serve(server)
+	t.Cleanup(func() { conn.Close() })
+
+	c := &client{t: t, conn: conn}
+	e := newPacket(fxpInit)
+	e.uint32(protocolVersion)
+	if typ, d := c.roundTrip(e); typ != fxpVersion || d.uint32() != protocolVersion {
+		t.Fatalf("unexpected reply to INIT: type %d", typ)
+	}
+	return c
+}
+
+// request starts a request of type typ with the next id
+func (c *client) request(typ byte) *encoder {
+	c.id++
+	e := newPacket(typ)
+	e.uint32(c.id)
+	return e
+}
+
+func (c *client) roundTrip(e *encoder) (byte, *decoder) {
+	c.t.Helper()
+	b := e.b
+	n := len(b) - 4
+	b[0], b[1], b[2], b[3] = byte(n>>24), byte(n>>16), byte(n>>8), byte(n)
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatal(err)
+	}
+	typ, payload, err := readPacket(c.conn)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	d := &decoder{b: payload}
+	if typ != fxpVersion {
+		if id := d.uint32(); id != c.id {
+			c.t.Fatalf("reply id %d, want %d", id, c.id)
+		}
+	}
+	return typ, d
+}
+
+// status sends e and returns the status code of the reply
+func (c *client) status(e *encoder) uint32 {
+	c.t.Helper()
+	typ, d := c.roundTrip(e)
+	if typ != fxpStatus {
+		c.t.Fatalf("reply type %d, want status", typ)
+	}
+	return d.uint32()
+}
+
+func (c *client) open(p string, flags uint32) string {
+	c.t.Helper()
+	e := c.request(fxpOpen)
+	e.string(p)
+	e.uint32(flags)
+	e.uint32(0)
+	typ, d := c.roundTrip(e)
+	if typ != fxpHandle {
+		c.t.Fatalf("opening %s: reply type %d, status %d", p, typ, d.uint32())
+	}
+	return d.string()
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "docker-machine-driver-hyperkit-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	// the temp dir may be behind a symlink, like /var on macOS
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReadWrite(t *testing.T) {
+	root := tempDir(t)
+	c := newClient(t, root)
+	p := filepath.Join(root, "file")
+
+	h := c.open(p, openWrite|openCreate|openTrunc)
+	e := c.request(fxpWrite)
+	e.string(h)
+	e.uint64(0)
+	e.string("hello world")
+	if code := c.status(e); code != fxOK {
+		t.Fatalf("write status %d", code)
+	}
+	e = c.request(fxpClose)
+	e.string(h)
+	if code := c.status(e); code != fxOK {
+		t.Fatalf("close status %d", code)
+	}
+
+	h = c.open(p, openRead)
+	e = c.request(fxpRead)
+	e.string(h)
+	e.uint64(6)
+	e.uint32(100)
+	typ, d := c.roundTrip(e)
+	if got := d.string(); typ != fxpData || got != "world" {
+		t.Errorf("read = %d %q, want data \"world\"", typ, got)
+	}
+	e = c.request(fxpRead)
+	e.string(h)
+	e.uint64(11)
+	e.uint32(100)
+	if code := c.status(e); code != fxEOF {
+		t.Errorf("read past the end status %d, want EOF", code)
+	}
+
+	e = c.request(fxpStat)
+	e.string(p)
+	typ, d = c.roundTrip(e)
+	if typ != fxpAttrs {
+		t.Fatalf("stat reply type %d", typ)
+	}
+	a := d.attrs()
+	if a.size != 11 || a.perm&0170000 != 0100000 {
+		t.Errorf("stat = size %d mode %o, want a regular file of 11 bytes", a.size, a.perm)
+	}
+}
+
+func TestReaddir(t *testing.T) {
+	root := tempDir(t)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newClient(t, root)
+
+	e := c.request(fxpOpendir)
+	e.string(root)
+	typ, d := c.roundTrip(e)
+	if typ != fxpHandle {
+		t.Fatalf("opendir reply type %d", typ)
+	}
+	h := d.string()
+	names := map[string]bool{}
+	for {
+		e = c.request(fxpReaddir)
+		e.string(h)
+		typ, d = c.roundTrip(e)
+		if typ == fxpStatus {
+			if code := d.uint32(); code != fxEOF {
+				t.Fatalf("readdir status %d", code)
+			}
+			break
+		}
+		for n := d.uint32(); n > 0; n-- {
+			names[d.string()] = true
+			d.string()
+			d.attrs()
+		}
+	}
+	if len(names) != 3 || !names["a"] || !names["b"] || !names["c"] {
+		t.Errorf("readdir = %v, want a, b and c", names)
+	}
+}
+
+func TestRename(t *testing.T) {
+	root := tempDir(t)
+	for _, name := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := newClient(t, root)
+
+	e := c.request(fxpRename)
+	e.string(filepath.Join(root, "a"))
+	e.string(filepath.Join(root, "b"))
+	if code := c.status(e); code != fxFailure {
+		t.Errorf("rename over an existing file status %d, want failure", code)
+	}
+	e = c.request(fxpExtended)
+	e.string(posixRename)
+	e.string(filepath.Join(root, "a"))
+	e.string(filepath.Join(root, "b"))
+	if code := c.status(e); code != fxOK {
+		t.Fatalf("posix-rename status %d", code)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(root, "b")); err != nil || string(b) != "a" {
+		t.Errorf("b = %q, %v after posix-rename, want a", b, err)
+	}
+}
+
+func TestConfinement(t *testing.T) {
+	dir := tempDir(t)
+	root := filepath.Join(dir, "share")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t, root)
+
+	for _, p := range []string{
+		secret,
+		root + "/../secret",
+		root + "/escape/secret",
+		root + "/link",
+		dir + "/missing/file",
+	} {
+		e := c.request(fxpStat)
+		e.string(p)
+		if code := c.status(e); code != fxPermissionDenied {
+			t.Errorf("stat %s status %d, want permission denied", p, code)
+		}
+	}
+
+	// the link itself is in the share
+	e := c.request(fxpLstat)
+	e.string(root + "/link")
+	if typ, _ := c.roundTrip(e); typ != fxpAttrs {
+		t.Errorf("lstat of a link in the share reply type %d", typ)
+	}
+	e = c.request(fxpStat)
+	e.string(root + "/missing")
+	if code := c.status(e); code != fxNoSuchFile {
+		t.Errorf("stat of a missing file status %d, want no such file", code)
+	}
+}